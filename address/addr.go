@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"strings"
 )
 
@@ -27,14 +28,43 @@ func MACFromString(mac string) (MAC, error) {
 	if err != nil {
 		return MAC{}, err
 	}
+	if len(bs) != 6 {
+		return MAC{}, fmt.Errorf("MAC '%s' does not have 6 octets", mac)
+	}
 	return MAC{bs[0], bs[1], bs[2], bs[3], bs[4], bs[5]}, nil
 }
 
 type IPAddrsOut []IPAddrOut
 
 type IPAddrOut struct {
-	Address string `json:"address"`
-	IfName  string `json:"ifname"`
+	Address   string     `json:"address"`
+	IfName    string     `json:"ifname"`
+	OperState string     `json:"operstate"`
+	AddrInfo  []AddrInfo `json:"addr_info"`
+}
+
+type AddrInfo struct {
+	Family    string `json:"family"`
+	Local     string `json:"local"`
+	PrefixLen int    `json:"prefixlen"`
+}
+
+// IPNets are the addresses of the interface with their networks,
+// addresses that do not parse are skipped
+func (o IPAddrOut) IPNets() []net.IPNet {
+	ipNets := []net.IPNet{}
+	for _, info := range o.AddrInfo {
+		ip := net.ParseIP(info.Local)
+		if ip == nil {
+			continue
+		}
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		ipNets = append(ipNets, net.IPNet{IP: ip, Mask: net.CIDRMask(info.PrefixLen, bits)})
+	}
+	return ipNets
 }
 
 // given an interface, can extract MAC from an IPAddrOut
@@ -0,0 +1,53 @@
+package address_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/address"
+)
+
+func TestDefaultDev(t *testing.T) {
+	routes, err := address.RoutesOutFromString(`[
+		{"dst":"default","gateway":"10.0.0.1","dev":"wlan0","protocol":"dhcp","metric":600,"flags":[]},
+		{"dst":"default","gateway":"44.44.0.1","dev":"wan","flags":[]},
+		{"dst":"44.44.0.0/16","dev":"wan","protocol":"kernel","scope":"link","prefsrc":"44.44.55.55","flags":[]}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := routes.DefaultDev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev != "wan" {
+		t.Fatalf("expected the lowest metric device wan, got %s", dev)
+	}
+	if _, err := routes[2:].DefaultDev(); err == nil {
+		t.Fatal("expected no default route")
+	}
+}
+
+func TestIPNets(t *testing.T) {
+	addrs, err := address.IPAddrsOutFromString(`[{
+		"ifindex":2,"ifname":"wan","flags":["BROADCAST","MULTICAST","UP","LOWER_UP"],"mtu":1500,
+		"operstate":"UP","link_type":"ether","address":"aa:bb:cc:dd:ee:ff","broadcast":"ff:ff:ff:ff:ff:ff",
+		"addr_info":[
+			{"family":"inet","local":"44.44.55.55","prefixlen":16,"scope":"global","label":"wan"},
+			{"family":"inet6","local":"fe80::a8bb:ccff:fedd:eeff","prefixlen":64,"scope":"link"}
+		]
+	}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addrs[0].OperState != "UP" {
+		t.Fatalf("expected UP, got %s", addrs[0].OperState)
+	}
+	ipNets := []string{}
+	for _, ipNet := range addrs[0].IPNets() {
+		ipNets = append(ipNets, ipNet.String())
+	}
+	if expected := []string{"44.44.55.55/16", "fe80::a8bb:ccff:fedd:eeff/64"}; !reflect.DeepEqual(ipNets, expected) {
+		t.Fatalf("expected %v, got %v", expected, ipNets)
+	}
+}
@@ -0,0 +1,35 @@
+package address
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+func LinksJsonCmd() []string {
+	return strings.Split("ip -j link show", " ")
+}
+
+type LinksOut []LinkOut
+
+type LinkOut struct {
+	IfName   string `json:"ifname"`
+	LinkType string `json:"link_type"`
+}
+
+// pass in the output from `ip -j link`
+func LinksOutFromString(output string) (LinksOut, error) {
+	target := LinksOut{}
+	err := json.Unmarshal([]byte(output), &target)
+	return target, err
+}
+
+// Devices are the names of the links that are not loopback
+func (links LinksOut) Devices() []string {
+	devices := []string{}
+	for _, link := range links {
+		if link.LinkType != "loopback" {
+			devices = append(devices, link.IfName)
+		}
+	}
+	return devices
+}
@@ -0,0 +1,67 @@
+package address
+
+import (
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+func NeighJsonCmd() []string {
+	return strings.Split("ip -j neigh show", " ")
+}
+
+type NeighsOut []NeighOut
+
+type NeighOut struct {
+	Dst    string   `json:"dst"`
+	Dev    string   `json:"dev"`
+	LLAddr string   `json:"lladdr"`
+	State  []string `json:"state"`
+}
+
+// pass in the output from `ip -j neigh`
+func NeighsOutFromString(output string) (NeighsOut, error) {
+	target := NeighsOut{}
+	err := json.Unmarshal([]byte(output), &target)
+	return target, err
+}
+
+// IPs are the addresses of the MAC on the device, any device if empty,
+// skipping the neighbors that failed to resolve
+func (neighs NeighsOut) IPs(mac MAC, dev string) []string {
+	ips := []string{}
+	for _, n := range neighs {
+		if n.LLAddr == "" || slices.Contains(n.State, "FAILED") || (dev != "" && n.Dev != dev) {
+			continue
+		}
+		if neighMAC, err := MACFromString(n.LLAddr); err == nil && neighMAC == mac {
+			ips = append(ips, n.Dst)
+		}
+	}
+	return ips
+}
+
+// MACs are the resolved neighbors on the device, any device if empty, in order without duplicates
+func (neighs NeighsOut) MACs(dev string) []MAC {
+	macs := []MAC{}
+	for _, n := range neighs {
+		if n.LLAddr == "" || slices.Contains(n.State, "FAILED") || (dev != "" && n.Dev != dev) {
+			continue
+		}
+		if mac, err := MACFromString(n.LLAddr); err == nil && !slices.Contains(macs, mac) {
+			macs = append(macs, mac)
+		}
+	}
+	return macs
+}
+
+// Neighbor is the resolved neighbor with the IP
+func (neighs NeighsOut) Neighbor(ip string) (NeighOut, bool) {
+	for _, n := range neighs {
+		if n.Dst == ip && n.LLAddr != "" && !slices.Contains(n.State, "FAILED") {
+			return n, true
+		}
+	}
+	return NeighOut{}, false
+}
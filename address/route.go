@@ -0,0 +1,44 @@
+package address
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+func DefaultRouteJsonCmd() []string {
+	return strings.Split("ip -j route show default", " ")
+}
+
+type RoutesOut []RouteOut
+
+type RouteOut struct {
+	Dst     string `json:"dst"`
+	Gateway string `json:"gateway"`
+	Dev     string `json:"dev"`
+	Metric  int    `json:"metric"`
+}
+
+// pass in the output from `ip -j route`
+func RoutesOutFromString(output string) (RoutesOut, error) {
+	target := RoutesOut{}
+	err := json.Unmarshal([]byte(output), &target)
+	return target, err
+}
+
+// DefaultDev is the device of the default route with the lowest metric
+func (routes RoutesOut) DefaultDev() (string, error) {
+	var best *RouteOut
+	for i, route := range routes {
+		if route.Dst != "default" || route.Dev == "" {
+			continue
+		}
+		if best == nil || route.Metric < best.Metric {
+			best = &routes[i]
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("no default route")
+	}
+	return best.Dev, nil
+}
@@ -0,0 +1,183 @@
+package attempts
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/resource"
+)
+
+const (
+	// DEFAULT_MAX_ATTEMPTS bounds the memory used for each namespace
+	DEFAULT_MAX_ATTEMPTS = 10000
+	// DEFAULT_RETENTION is how long attempts are kept, by the hour they happened
+	DEFAULT_RETENTION = 7 * 24 * time.Hour
+)
+
+// Attempt has the packets blocked from a device to a destination during an hour
+type Attempt struct {
+	MAC         string    `json:"mac"`
+	Destination string    `json:"destination"`
+	Hour        time.Time `json:"hour"`
+	Count       int       `json:"count"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+}
+
+type key struct {
+	mac, destination string
+	hour             int64
+}
+
+// entry is an attempt in the heap of the attempts by their Last
+type entry struct {
+	key     key
+	attempt *Attempt
+	index   int
+}
+
+// recency is a heap of the attempts, the least recently seen first
+type recency []*entry
+
+func (r recency) Len() int           { return len(r) }
+func (r recency) Less(i, j int) bool { return r[i].attempt.Last.Before(r[j].attempt.Last) }
+func (r recency) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+	r[i].index, r[j].index = i, j
+}
+func (r *recency) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*r)
+	*r = append(*r, e)
+}
+func (r *recency) Pop() any {
+	old := *r
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*r = old[:len(old)-1]
+	return e
+}
+
+// Log aggregates the blocked attempts, hours older than the Retention are rotated out
+// and the least recently seen attempts are dropped to keep at most MaxAttempts
+type Log struct {
+	lock        sync.Mutex
+	MaxAttempts int
+	Retention   time.Duration
+	attempts    map[key]*entry
+	recent      recency
+	// rotated is the hour of the last rotation, the hours are only rotated out when it changes
+	rotated int64
+}
+
+func NewLog() *Log {
+	return &Log{
+		MaxAttempts: DEFAULT_MAX_ATTEMPTS,
+		Retention:   DEFAULT_RETENTION,
+		attempts:    map[key]*entry{},
+	}
+}
+
+// Add counts a blocked packet
+func (l *Log) Add(mac, destination string, at time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	hour := at.UTC().Truncate(time.Hour)
+	if hour.Unix() > l.rotated {
+		l.rotate(hour)
+	}
+	k := key{mac: mac, destination: destination, hour: hour.Unix()}
+	e, ok := l.attempts[k]
+	if !ok {
+		e = &entry{key: k, attempt: &Attempt{MAC: mac, Destination: destination, Hour: hour, First: at, Last: at}}
+		l.attempts[k] = e
+		heap.Push(&l.recent, e)
+	}
+	e.attempt.Count++
+	if at.After(e.attempt.Last) {
+		e.attempt.Last = at
+		heap.Fix(&l.recent, e.index)
+	}
+	for len(l.attempts) > l.MaxAttempts {
+		least := heap.Pop(&l.recent).(*entry)
+		delete(l.attempts, least.key)
+	}
+}
+
+// rotate removes the hours that are past the retention
+func (l *Log) rotate(hour time.Time) {
+	l.rotated = hour.Unix()
+	oldest := hour.Add(-l.Retention).Unix()
+	kept := l.recent[:0]
+	for _, e := range l.recent {
+		if e.key.hour <= oldest {
+			delete(l.attempts, e.key)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	for i := len(kept); i < len(l.recent); i++ {
+		l.recent[i] = nil
+	}
+	l.recent = kept
+	for i, e := range l.recent {
+		e.index = i
+	}
+	heap.Init(&l.recent)
+}
+
+// Query has the attempts for the MAC, or all MACs if empty, from the hour of since,
+// ordered by hour, MAC and destination, the hours past the retention are rotated out
+// first as a quiet gateway may not have added an attempt since they passed
+func (l *Log) Query(mac string, since time.Time) []Attempt {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if hour := time.Now().UTC().Truncate(time.Hour); hour.Unix() > l.rotated {
+		l.rotate(hour)
+	}
+	from := since.UTC().Truncate(time.Hour)
+	found := []Attempt{}
+	for _, e := range l.attempts {
+		if (mac == "" || e.attempt.MAC == mac) && !e.attempt.Hour.Before(from) {
+			found = append(found, *e.attempt)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if !a.Hour.Equal(b.Hour) {
+			return a.Hour.Before(b.Hour)
+		}
+		if a.MAC != b.MAC {
+			return a.MAC < b.MAC
+		}
+		return a.Destination < b.Destination
+	})
+	return found
+}
+
+// Reset removes all the attempts
+func (l *Log) Reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.attempts, l.recent, l.rotated = map[key]*entry{}, nil, 0
+}
+
+var (
+	nsLogsLock sync.Mutex
+	// nsLogs has the log of each namespace, keyed by namespace name
+	nsLogs = map[string]*Log{}
+)
+
+// For is the log of the attempts blocked in the namespace
+func For(ns resource.NS) *Log {
+	nsLogsLock.Lock()
+	defer nsLogsLock.Unlock()
+	log, ok := nsLogs[ns.Name]
+	if !ok {
+		log = NewLog()
+		nsLogs[ns.Name] = log
+	}
+	return log
+}
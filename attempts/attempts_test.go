@@ -0,0 +1,131 @@
+package attempts_test
+
+import (
+	"encoding/binary"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/attempts"
+	"github.com/plockc/gateway/resource"
+)
+
+// start is within the current hour as the log rotates out the hours past the retention when queried
+var start = time.Now().UTC().Truncate(time.Hour).Add(15 * time.Minute)
+
+func TestLog(t *testing.T) {
+	log := attempts.NewLog()
+	log.Add("12:12:12:12:12:AB", "44.44.44.44", start)
+	log.Add("12:12:12:12:12:AB", "44.44.44.44", start.Add(30*time.Minute))
+	log.Add("12:12:12:12:12:AB", "44.44.44.44", start.Add(time.Hour))
+	log.Add("12:12:12:12:12:CD", "44.44.44.44", start)
+
+	found := log.Query("", time.Time{})
+	if len(found) != 3 {
+		t.Fatalf("expected 3 attempts, got %v", found)
+	}
+	hour := start.Truncate(time.Hour)
+	expected := attempts.Attempt{
+		MAC: "12:12:12:12:12:AB", Destination: "44.44.44.44", Hour: hour,
+		Count: 2, First: start, Last: start.Add(30 * time.Minute),
+	}
+	if !reflect.DeepEqual(found[0], expected) {
+		t.Fatalf("expected %+v, got %+v", expected, found[0])
+	}
+
+	if found := log.Query("12:12:12:12:12:CD", time.Time{}); len(found) != 1 || found[0].Count != 1 {
+		t.Fatalf("expected one attempt for the mac, got %v", found)
+	}
+	if found := log.Query("", start.Add(time.Hour)); len(found) != 1 || !found[0].Hour.Equal(hour.Add(time.Hour)) {
+		t.Fatalf("expected one attempt since the next hour, got %v", found)
+	}
+}
+
+func TestLogRotation(t *testing.T) {
+	log := attempts.NewLog()
+	log.Retention = 2 * time.Hour
+	log.Add("12:12:12:12:12:AB", "44.44.44.44", start)
+	log.Add("12:12:12:12:12:AB", "44.44.44.44", start.Add(2*time.Hour))
+	found := log.Query("", time.Time{})
+	if len(found) != 1 || !found[0].Hour.Equal(start.Add(2*time.Hour).Truncate(time.Hour)) {
+		t.Fatalf("expected the first hour to be rotated out, got %v", found)
+	}
+
+	log = attempts.NewLog()
+	log.Retention = 2 * time.Hour
+	log.Add("12:12:12:12:12:AB", "44.44.44.44", start.Add(-3*time.Hour))
+	if found := log.Query("", time.Time{}); len(found) != 0 {
+		t.Fatalf("expected the hour past the retention to be rotated out when queried, got %v", found)
+	}
+
+	log = attempts.NewLog()
+	log.MaxAttempts = 2
+	log.Add("12:12:12:12:12:AB", "44.44.44.1", start)
+	log.Add("12:12:12:12:12:AB", "44.44.44.2", start.Add(time.Minute))
+	log.Add("12:12:12:12:12:AB", "44.44.44.1", start.Add(2*time.Minute))
+	log.Add("12:12:12:12:12:AB", "44.44.44.3", start.Add(3*time.Minute))
+	found = log.Query("", time.Time{})
+	if len(found) != 2 || found[0].Destination != "44.44.44.1" || found[1].Destination != "44.44.44.3" {
+		t.Fatalf("expected the least recent attempt to be dropped, got %v", found)
+	}
+}
+
+// attribute is a netlink attribute, the tests are run on little endian hosts
+func attribute(attrType uint16, value []byte) []byte {
+	attr := make([]byte, (4+len(value)+3)&^3)
+	binary.LittleEndian.PutUint16(attr[0:2], uint16(4+len(value)))
+	binary.LittleEndian.PutUint16(attr[2:4], attrType)
+	copy(attr[4:], value)
+	return attr
+}
+
+func TestParsePacket(t *testing.T) {
+	// IPv4 header from 192.168.100.20 to 44.44.44.44
+	payload := []byte{
+		0x45, 0, 0, 84, 0, 0, 0x40, 0, 64, 1, 0, 0,
+		192, 168, 100, 20, 44, 44, 44, 44,
+	}
+	hwaddr := []byte{0, 6, 0, 0, 0x12, 0x12, 0x12, 0x12, 0x12, 0xab, 0, 0}
+	msg := []byte{2, 0, 0, 2}
+	msg = append(msg, attribute(attempts.NFULA_HWADDR, hwaddr)...)
+	msg = append(msg, attribute(attempts.NFULA_PREFIX, []byte("gw-dt-log[2a]\x00"))...)
+	msg = append(msg, attribute(attempts.NFULA_PAYLOAD, payload)...)
+
+	packet, err := attempts.ParsePacket(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ruleId, ok := packet.RuleId(); !ok || ruleId != "2a" {
+		t.Fatalf("expected rule 2a, got '%s'", packet.Prefix)
+	}
+	log := attempts.NewLog()
+	if err := log.Record(packet, start); err != nil {
+		t.Fatal(err)
+	}
+	found := log.Query("", time.Time{})
+	if len(found) != 1 || found[0].MAC != "12:12:12:12:12:AB" || found[0].Destination != "44.44.44.44" {
+		t.Fatalf("expected the attempt from the packet, got %v", found)
+	}
+
+	packet.Prefix = "someone else"
+	if err := log.Record(packet, start); err == nil {
+		t.Fatal("expected failure for a packet not logged by a managed rule")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	q := attempts.NewQuery(resource.NewNS("test")).AttemptsResource()
+	if err := q.Filter(url.Values{"mac": {"12:12:12:12:12:ab"}, "since": {start.Truncate(time.Hour).Format(time.RFC3339)}}); err != nil {
+		t.Fatal(err)
+	}
+	if q.MAC != "12:12:12:12:12:AB" || !q.Since.Equal(start.Truncate(time.Hour)) {
+		t.Fatalf("unexpected query %+v", q.Query)
+	}
+	if err := q.Filter(url.Values{"since": {"yesterday"}}); resource.KindOf(err) != resource.INVALID {
+		t.Fatalf("expected invalid for a bad since, got %v", err)
+	}
+	if err := q.Filter(url.Values{"mac": {"12:12"}}); resource.KindOf(err) != resource.INVALID {
+		t.Fatalf("expected invalid for a bad mac, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package attempts
+
+import (
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+)
+
+const (
+	// COPY_RANGE is the bytes of each packet copied, enough for the IPv4 header
+	COPY_RANGE = 64
+	// MIN_BACKOFF is the first wait after failing to receive, doubling up to MAX_BACKOFF
+	MIN_BACKOFF = 10 * time.Millisecond
+	MAX_BACKOFF = time.Second
+)
+
+// Listener records the packets logged to an NFLOG group until it is closed,
+// the errors reading and parsing the logged packets are logged
+type Listener struct {
+	fd     int
+	closed int32
+}
+
+// Listen binds to the NFLOG group in the namespace and records the packets
+// blocked by managed rules in the log
+func Listen(ns resource.NS, group uint16, log *Log) (*Listener, error) {
+	fd, err := socketIn(ns)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{fd: fd}
+	if err := l.bind(group); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to bind to NFLOG group %d in %s: %w", group, ns, err)
+	}
+	go l.receive(log)
+	return l, nil
+}
+
+// socketIn opens the netlink socket in the namespace
+func socketIn(ns resource.NS) (int, error) {
+	fd := -1
+	err := ns.Enter(func() error {
+		var err error
+		fd, err = socket()
+		return err
+	})
+	return fd, err
+}
+
+func socket() (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return -1, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	// wake up the receive loop to check if it is closed
+	tv := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// bind sends the config to bind to the group and copy the start of each packet
+func (l *Listener) bind(group uint16) error {
+	cmd := []byte{NFULNL_CFG_CMD_BIND}
+	mode := make([]byte, 6)
+	// the copy range is big endian, followed by the copy mode and padding
+	mode[0], mode[1], mode[2], mode[3] = 0, 0, 0, COPY_RANGE
+	mode[4] = NFULNL_COPY_PACKET
+	for seq, attr := range [][]byte{attribute(NFULA_CFG_CMD, cmd), attribute(NFULA_CFG_MODE, mode)} {
+		if err := l.request(group, uint32(seq+1), attr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func attribute(attrType uint16, value []byte) []byte {
+	attr := make([]byte, (4+len(value)+3)&^3)
+	nativeEndian.PutUint16(attr[0:2], uint16(4+len(value)))
+	nativeEndian.PutUint16(attr[2:4], attrType)
+	copy(attr[4:], value)
+	return attr
+}
+
+// request sends a config message for the group and waits for the ack
+func (l *Listener) request(group uint16, seq uint32, attr []byte) error {
+	msg := make([]byte, syscall.NLMSG_HDRLEN+nfgenmsgLen+len(attr))
+	nativeEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	nativeEndian.PutUint16(msg[4:6], NFNL_SUBSYS_ULOG<<8|NFULNL_MSG_CONFIG)
+	nativeEndian.PutUint16(msg[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	nativeEndian.PutUint32(msg[8:12], seq)
+	// nfgenmsg with an unspecified family, version 0, and the group in network order
+	msg[16], msg[17] = syscall.AF_UNSPEC, 0
+	msg[18], msg[19] = byte(group>>8), byte(group)
+	copy(msg[20:], attr)
+	if err := syscall.Sendto(l.fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+	buf := make([]byte, syscall.Getpagesize())
+	n, _, err := syscall.Recvfrom(l.fd, buf, 0)
+	if err != nil {
+		return err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Header.Type == syscall.NLMSG_ERROR && len(m.Data) >= 4 {
+			if errno := int32(nativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+				return syscall.Errno(-errno)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Listener) receive(log *Log) {
+	buf := make([]byte, 65536)
+	backoff := time.Duration(0)
+	for atomic.LoadInt32(&l.closed) == 0 {
+		n, _, err := syscall.Recvfrom(l.fd, buf, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			// the error may persist, like ENOBUFS when the packets come faster than they are read
+			if backoff = backoff * 2; backoff < MIN_BACKOFF {
+				backoff = MIN_BACKOFF
+			} else if backoff > MAX_BACKOFF {
+				backoff = MAX_BACKOFF
+			}
+			logs.Warnf("failed to receive the logged packets, retrying in %s: %s\n", backoff, err)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			logs.Warnf("failed to parse the logged packets: %s\n", err)
+			continue
+		}
+		for _, m := range msgs {
+			if m.Header.Type != NFNL_SUBSYS_ULOG<<8|NFULNL_MSG_PACKET {
+				continue
+			}
+			packet, err := ParsePacket(m.Data)
+			if err == nil {
+				err = log.Record(packet, time.Now())
+			}
+			if err != nil {
+				logs.Warnf("failed to record a logged packet: %s\n", err)
+			}
+		}
+	}
+	syscall.Close(l.fd)
+}
+
+// Close stops receiving within a second
+func (l *Listener) Close() {
+	atomic.StoreInt32(&l.closed, 1)
+}
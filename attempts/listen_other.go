@@ -0,0 +1,17 @@
+//go:build !linux
+
+package attempts
+
+import (
+	"fmt"
+
+	"github.com/plockc/gateway/resource"
+)
+
+type Listener struct{}
+
+func Listen(ns resource.NS, group uint16, log *Log) (*Listener, error) {
+	return nil, fmt.Errorf("NFLOG needs linux")
+}
+
+func (l *Listener) Close() {}
@@ -0,0 +1,114 @@
+package attempts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+	"unsafe"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/iptables"
+)
+
+// netfilter log netlink constants from linux/netfilter/nfnetlink_log.h
+const (
+	NFNL_SUBSYS_ULOG    = 4
+	NFULNL_MSG_PACKET   = 0
+	NFULNL_MSG_CONFIG   = 1
+	NFULA_HWADDR        = 8
+	NFULA_PAYLOAD       = 9
+	NFULA_PREFIX        = 10
+	NFULA_CFG_CMD       = 1
+	NFULA_CFG_MODE      = 2
+	NFULNL_CFG_CMD_BIND = 1
+	NFULNL_COPY_PACKET  = 2
+
+	// nlattr types have flags in the top bits
+	nlaTypeMask = 0x3fff
+	// nfgenmsg has the family, version and resource id
+	nfgenmsgLen = 4
+)
+
+// the netlink headers and attributes use the byte order of the host
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// Packet is a packet logged by NFLOG
+type Packet struct {
+	Prefix  string
+	MAC     address.MAC
+	Payload []byte
+}
+
+// Destination is the destination of the IPv4 payload
+func (p Packet) Destination() (net.IP, error) {
+	if len(p.Payload) < 20 || p.Payload[0]>>4 != 4 {
+		return nil, fmt.Errorf("payload is not IPv4")
+	}
+	return net.IP(p.Payload[16:20]), nil
+}
+
+// RuleId is the id of the rule that blocked the packet, from the prefix of the log rule
+func (p Packet) RuleId() (string, bool) {
+	matches := iptables.LogIdRegex.FindStringSubmatch(p.Prefix)
+	if len(matches) < 2 {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// ParsePacket parses the attributes of an NFULNL_MSG_PACKET after the netlink header
+func ParsePacket(data []byte) (Packet, error) {
+	packet := Packet{}
+	if len(data) < nfgenmsgLen {
+		return packet, fmt.Errorf("packet message is too short: %d", len(data))
+	}
+	attrs := data[nfgenmsgLen:]
+	for len(attrs) >= 4 {
+		attrLen := int(nativeEndian.Uint16(attrs[0:2]))
+		attrType := nativeEndian.Uint16(attrs[2:4]) & nlaTypeMask
+		if attrLen < 4 || attrLen > len(attrs) {
+			return packet, fmt.Errorf("attribute %d has bad length %d", attrType, attrLen)
+		}
+		value := attrs[4:attrLen]
+		switch attrType {
+		case NFULA_PREFIX:
+			packet.Prefix = string(bytes.TrimRight(value, "\x00"))
+		case NFULA_HWADDR:
+			// the address length is big endian followed by padding then the address
+			if len(value) < 4 || binary.BigEndian.Uint16(value[0:2]) != 6 || len(value) < 10 {
+				return packet, fmt.Errorf("hardware address is not a MAC")
+			}
+			copy(packet.MAC[:], value[4:10])
+		case NFULA_PAYLOAD:
+			packet.Payload = value
+		}
+		// attributes are aligned to 4 bytes
+		next := (attrLen + 3) &^ 3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	return packet, nil
+}
+
+// Record adds a packet blocked by a managed rule to the log
+func (l *Log) Record(packet Packet, at time.Time) error {
+	if _, ok := packet.RuleId(); !ok {
+		return fmt.Errorf("packet was not logged by a managed rule: '%s'", packet.Prefix)
+	}
+	dst, err := packet.Destination()
+	if err != nil {
+		return err
+	}
+	l.Add(packet.MAC.String(), dst.String(), at)
+	return nil
+}
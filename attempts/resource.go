@@ -0,0 +1,62 @@
+package attempts
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/resource"
+)
+
+// Query finds the attempts blocked in a namespace
+type Query struct {
+	resource.NS `json:"-"`
+	// MAC of the device, all devices if empty
+	MAC string `json:"mac"`
+	// Since is the earliest hour of the attempts, all retained attempts if zero
+	Since    time.Time `json:"since"`
+	Attempts []Attempt `json:"attempts"`
+}
+
+func NewQuery(ns resource.NS) Query {
+	return Query{NS: ns}
+}
+
+var _ resource.Resource = AttemptsRes{}
+
+type AttemptsRes struct {
+	Query
+	resource.FailUnimplementedMethods
+}
+
+func (q Query) AttemptsResource() *AttemptsRes {
+	return &AttemptsRes{Query: q}
+}
+
+func (q AttemptsRes) Id() string {
+	return q.MAC
+}
+
+// Filter sets the mac and since of the query from the query parameters
+func (q *AttemptsRes) Filter(values url.Values) error {
+	if mac := values.Get("mac"); mac != "" {
+		parsed, err := address.MACFromString(mac)
+		if err != nil {
+			return resource.Invalid("bad mac '%s': %w", mac, err)
+		}
+		q.MAC = parsed.String()
+	}
+	if since := values.Get("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return resource.Invalid("since needs RFC 3339 like 2006-01-02T15:04:05Z: %w", err)
+		}
+		q.Since = parsed
+	}
+	return nil
+}
+
+func (q *AttemptsRes) Load() error {
+	q.Attempts = For(q.NS).Query(q.MAC, q.Since)
+	return nil
+}
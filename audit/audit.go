@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/exec"
+)
+
+const (
+	// DEFAULT_MAX_SIZE is the size of the file before it is rotated
+	DEFAULT_MAX_SIZE = 10 * 1024 * 1024
+	// DEFAULT_MAX_FILES is how many rotated files are kept, like audit.jsonl.1 to audit.jsonl.5
+	DEFAULT_MAX_FILES = 5
+)
+
+// Record is a change made through the API
+type Record struct {
+	Time time.Time `json:"time"`
+	// Caller is the user that made the change, empty if the API has no credentials
+	Caller string `json:"caller,omitempty"`
+	// Remote is the address the request came from
+	Remote string `json:"remote,omitempty"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+	// Code is the status of the response
+	Code int `json:"code"`
+	// Commands are the commands run while making the change
+	Commands []exec.Command `json:"commands"`
+}
+
+// Query selects the records, the zero Query has all of them
+type Query struct {
+	// From and To are the range of the time of the records, unbounded if zero
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Path is a prefix of the paths of the records
+	Path   string `json:"path"`
+	Caller string `json:"caller"`
+}
+
+func (f Query) Matches(r Record) bool {
+	return (f.From.IsZero() || !r.Time.Before(f.From)) &&
+		(f.To.IsZero() || r.Time.Before(f.To)) &&
+		strings.HasPrefix(r.Path, f.Path) &&
+		(f.Caller == "" || r.Caller == f.Caller)
+}
+
+// Log appends the records as JSON lines to the file of the Path, the file is rotated
+// to Path.1 when it would be larger than MaxSize, keeping MaxFiles of the rotated files
+type Log struct {
+	lock     sync.Mutex
+	Path     string
+	MaxSize  int64
+	MaxFiles int
+}
+
+func NewLog(path string) *Log {
+	return &Log{Path: path, MaxSize: DEFAULT_MAX_SIZE, MaxFiles: DEFAULT_MAX_FILES}
+}
+
+// Append writes the record at the end of the log
+func (l *Log) Append(r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return err
+	}
+	if info, err := os.Stat(l.Path); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > l.MaxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate the audit log: %w", err)
+		}
+	}
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotated is the nth rotated file, the higher the older, the Path for 0
+func (l *Log) rotated(n int) string {
+	if n == 0 {
+		return l.Path
+	}
+	return fmt.Sprintf("%s.%d", l.Path, n)
+}
+
+// rotate shifts the files, the oldest is removed
+func (l *Log) rotate() error {
+	if err := os.Remove(l.rotated(l.MaxFiles)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for n := l.MaxFiles - 1; n >= 0; n-- {
+		if err := os.Rename(l.rotated(n), l.rotated(n+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query has the records matching the filter, oldest first
+func (l *Log) Query(filter Query) ([]Record, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	found := []Record{}
+	for n := l.MaxFiles; n >= 0; n-- {
+		records, err := read(l.rotated(n))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if filter.Matches(r) {
+				found = append(found, r)
+			}
+		}
+	}
+	return found, nil
+}
+
+// read has the records of a file, none if it does not exist
+func read(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records := []Record{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		r := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of %s: %w", line, path, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
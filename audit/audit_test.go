@@ -0,0 +1,95 @@
+package audit_test
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/audit"
+	"github.com/plockc/gateway/exec"
+)
+
+func paths(records []audit.Record) []string {
+	found := []string{}
+	for _, r := range records {
+		found = append(found, r.Path)
+	}
+	return found
+}
+
+func TestLog(t *testing.T) {
+	l := audit.NewLog(filepath.Join(t.TempDir(), "gateway", "audit.jsonl"))
+	start := time.Date(2030, 1, 1, 7, 0, 0, 0, time.UTC)
+	for i, r := range []audit.Record{
+		{Caller: "parent", Path: "/api/v1/netns/gw/ipsets/kids"},
+		{Caller: "parent", Path: "/api/v1/netns/gw/ipsets/kids/members/12:12:12:12:12:AB"},
+		{Caller: "sitter", Path: "/api/v1/netns/gw/iptables/filter/chains/FORWARD/rules/a"},
+	} {
+		r.Time, r.Method, r.Code = start.Add(time.Duration(i)*time.Hour), "PUT", 201
+		r.Commands = []exec.Command{{Cmd: []string{"ipset", "create", "kids"}}}
+		if err := l.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, tc := range map[string]struct {
+		query    audit.Query
+		expected []string
+	}{
+		"all":       {audit.Query{}, []string{"/api/v1/netns/gw/ipsets/kids", "/api/v1/netns/gw/ipsets/kids/members/12:12:12:12:12:AB", "/api/v1/netns/gw/iptables/filter/chains/FORWARD/rules/a"}},
+		"from":      {audit.Query{From: start.Add(time.Hour)}, []string{"/api/v1/netns/gw/ipsets/kids/members/12:12:12:12:12:AB", "/api/v1/netns/gw/iptables/filter/chains/FORWARD/rules/a"}},
+		"to":        {audit.Query{To: start.Add(time.Hour)}, []string{"/api/v1/netns/gw/ipsets/kids"}},
+		"path":      {audit.Query{Path: "/api/v1/netns/gw/ipsets/kids/"}, []string{"/api/v1/netns/gw/ipsets/kids/members/12:12:12:12:12:AB"}},
+		"caller":    {audit.Query{Caller: "sitter"}, []string{"/api/v1/netns/gw/iptables/filter/chains/FORWARD/rules/a"}},
+		"no record": {audit.Query{Caller: "laptop"}, []string{}},
+	} {
+		records, err := l.Query(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := paths(records); !reflect.DeepEqual(got, tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, tc.expected, got)
+		}
+	}
+	records, _ := l.Query(audit.Query{})
+	if len(records[0].Commands) != 1 || records[0].Caller != "parent" || !records[0].Time.Equal(start) {
+		t.Fatalf("expected the record as appended, got %+v", records[0])
+	}
+}
+
+func TestRotate(t *testing.T) {
+	l := audit.NewLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	// each record is in its own file
+	l.MaxSize, l.MaxFiles = 1, 2
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		if err := l.Append(audit.Record{Time: time.Now(), Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := l.Query(audit.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(records); !reflect.DeepEqual(got, []string{"/b", "/c", "/d"}) {
+		t.Fatalf("expected the oldest rotated out, got %v", got)
+	}
+	if _, err := os.Stat(l.Path + ".3"); err == nil {
+		t.Fatal("expected only 2 rotated files")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	q := audit.NewLog("audit.jsonl").QueryResource()
+	if err := q.Filter(url.Values{"from": {"2030-01-01T07:00:00Z"}, "path": {"/api/v1/netns/gw"}, "caller": {"parent"}}); err != nil {
+		t.Fatal(err)
+	}
+	expected := audit.Query{From: time.Date(2030, 1, 1, 7, 0, 0, 0, time.UTC), Path: "/api/v1/netns/gw", Caller: "parent"}
+	if q.Query != expected {
+		t.Fatalf("expected %+v, got %+v", expected, q.Query)
+	}
+	if err := q.Filter(url.Values{"to": {"tomorrow"}}); err == nil {
+		t.Fatal("expected the time to need RFC 3339")
+	}
+}
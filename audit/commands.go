@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"sync"
+
+	"github.com/plockc/gateway/exec"
+)
+
+// Commands runs the commands with the Executor, keeping the commands run between
+// Start and Stop. Runners create their own transcripts deep in the resources, so the
+// commands of a change are recorded where they all run, with one change at a time
+type Commands struct {
+	exec.Executor
+	lock      sync.Mutex
+	recording *exec.Transcript
+}
+
+func NewCommands(executor exec.Executor) *Commands {
+	return &Commands{Executor: executor}
+}
+
+func (c *Commands) Exec(cmd []string) (int, string, error) {
+	code, out, err := c.Executor.Exec(cmd)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.recording != nil {
+		c.recording.Commands = append(c.recording.Commands, exec.Command{Cmd: cmd, Out: out, Code: code})
+	}
+	return code, out, err
+}
+
+// Start records the commands, dropping those recorded before
+func (c *Commands) Start() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.recording = &exec.Transcript{Commands: []exec.Command{}}
+}
+
+// Stop has the commands run since Start
+func (c *Commands) Stop() []exec.Command {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.recording == nil {
+		return []exec.Command{}
+	}
+	commands := c.recording.Commands
+	c.recording = nil
+	return commands
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/plockc/gateway/resource"
+)
+
+var _ resource.Resource = &QueryRes{}
+
+// QueryRes finds the records of the Log matching the Query
+type QueryRes struct {
+	resource.FailUnimplementedMethods
+	Query
+	Log     *Log     `json:"-"`
+	Records []Record `json:"records"`
+}
+
+func (l *Log) QueryResource() *QueryRes {
+	return &QueryRes{Log: l}
+}
+
+func (q QueryRes) Id() string {
+	return ""
+}
+
+// Filter sets the filter from the from, to, path and caller query parameters
+func (q *QueryRes) Filter(values url.Values) error {
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return resource.Invalid("%s needs RFC 3339 like 2006-01-02T15:04:05Z: %w", name, err)
+		}
+		*t = parsed
+	}
+	q.Path, q.Caller = values.Get("path"), values.Get("caller")
+	return nil
+}
+
+func (q *QueryRes) Load() error {
+	records, err := q.Log.Query(q.Query)
+	if err != nil {
+		return fmt.Errorf("failed to read the audit log: %w", err)
+	}
+	q.Records = records
+	return nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Role string
+
+const (
+	// ADMIN can make any request
+	ADMIN Role = "admin"
+	// VIEWER can only GET
+	VIEWER Role = "viewer"
+	// DEVICE can only GET its own membership of the sets and its own blocked attempts
+	DEVICE Role = "device"
+)
+
+var Roles = []Role{ADMIN, VIEWER, DEVICE}
+
+// User has the hashes of the password for HTTP basic auth and of the bearer token,
+// either can be empty to not allow that way of authenticating
+type User struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	// PasswordHash is the bcrypt of the password
+	PasswordHash string `json:"passwordHash,omitempty"`
+	// TokenHash is the SHA-256 in hex of the token, the tokens are random so do not need bcrypt
+	TokenHash string `json:"tokenHash,omitempty"`
+	// Device is the MAC or IPv4 address of a user with the DEVICE role
+	Device string `json:"device,omitempty"`
+}
+
+func (u User) String() string {
+	return u.Name + "(" + string(u.Role) + ")"
+}
+
+func (u User) Validate() error {
+	if u.Name == "" || strings.ContainsAny(u.Name, ": ") {
+		return fmt.Errorf("user name '%s' needs to be non-empty without spaces or colons", u.Name)
+	}
+	switch u.Role {
+	case ADMIN, VIEWER:
+	case DEVICE:
+		if u.Device == "" {
+			return fmt.Errorf("user '%s' with role %s needs a device", u.Name, u.Role)
+		}
+	default:
+		return fmt.Errorf("role '%s' of user '%s' is not one of %v", u.Role, u.Name, Roles)
+	}
+	return nil
+}
+
+// Credentials are the users from the credentials file, keyed by name
+type Credentials map[string]User
+
+// LoadCredentials reads the JSON list of users
+func LoadCredentials(path string) (Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+	users := []User{}
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials '%s': %w", path, err)
+	}
+	creds := Credentials{}
+	for _, u := range users {
+		if err := u.Validate(); err != nil {
+			return nil, err
+		}
+		creds[u.Name] = u
+	}
+	return creds, nil
+}
+
+// Save writes the users in order of their names, only readable by the owner
+func (c Credentials) Save(path string) error {
+	users := []User{}
+	for _, u := range c {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken is a random token and its hash to keep in the credentials
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+var ErrUnauthenticated = errors.New("missing or bad credentials")
+
+// Authenticate finds the user of the bearer token or the basic auth of the request
+func (c Credentials) Authenticate(req *http.Request) (User, error) {
+	if header := req.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		hash := HashToken(strings.TrimPrefix(header, "Bearer "))
+		for _, u := range c {
+			if u.TokenHash != "" && subtle.ConstantTimeCompare([]byte(u.TokenHash), []byte(hash)) == 1 {
+				return u, nil
+			}
+		}
+		return User{}, ErrUnauthenticated
+	}
+	name, password, ok := req.BasicAuth()
+	if !ok {
+		return User{}, ErrUnauthenticated
+	}
+	u, found := c[name]
+	if !found || u.PasswordHash == "" ||
+		bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return User{}, ErrUnauthenticated
+	}
+	return u, nil
+}
+
+// Allowed is whether the role of the user can make the request
+func (u User) Allowed(req *http.Request) bool {
+	switch u.Role {
+	case ADMIN:
+		return true
+	case VIEWER:
+		return req.Method == http.MethodGet
+	case DEVICE:
+		return req.Method == http.MethodGet && u.ownStatus(req)
+	}
+	return false
+}
+
+// ownStatus is a member of a set that is the device, or the blocked attempts of the device
+func (u User) ownStatus(req *http.Request) bool {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	last := parts[len(parts)-1]
+	if len(parts) >= 2 && parts[len(parts)-2] == "members" {
+		return strings.EqualFold(last, u.Device)
+	}
+	return last == "blocked-attempts" && strings.EqualFold(req.URL.Query().Get("mac"), u.Device)
+}
+
+type userKey struct{}
+
+func WithUser(ctx context.Context, u User) context.Context {
+	return context.WithValue(ctx, userKey{}, u)
+}
+
+// UserOf is the user that made the request, if it was authenticated
+func UserOf(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(userKey{}).(User)
+	return u, ok
+}
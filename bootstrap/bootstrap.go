@@ -0,0 +1,171 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+const FORWARDING_SYSCTL = "net.ipv4.ip_forward"
+
+// the rules have Ids from RULE_ID_BASE so they are found without keeping any state
+const (
+	RULE_ID_BASE         = 0x7e000000
+	MASQUERADE_RULE_ID   = RULE_ID_BASE
+	FORWARD_JUMP_RULE_ID = RULE_ID_BASE + 1
+)
+
+// Bootstrap is the setup that turns a namespace into a downtime gateway,
+// forwarding from the LAN and masquerading out the Internet device,
+// with the forwarded traffic going through the downtime chain
+type Bootstrap struct {
+	resource.NS `json:"-"`
+	// Device is the Internet device, detected if empty
+	Device string `json:"device"`
+}
+
+func NewBootstrap(ns resource.NS) Bootstrap {
+	return Bootstrap{NS: ns}
+}
+
+func (b Bootstrap) String() string {
+	return b.NS.String() + ":bootstrap[" + b.Device + "]"
+}
+
+// InternetDevice is the Device, or detected when empty
+func (b Bootstrap) InternetDevice() (string, error) {
+	if b.Device == "" {
+		return iptables.DetectInternetDevice(b.NS)
+	}
+	return b.Device, nil
+}
+
+// Status has each part of the bootstrap and if it is set up
+type Status struct {
+	// InternetDevice is empty if it could not be detected
+	InternetDevice string `json:"internetDevice"`
+	Forwarding     bool   `json:"forwarding"`
+	Masquerade     bool   `json:"masquerade"`
+	DowntimeChain  bool   `json:"downtimeChain"`
+	ForwardJump    bool   `json:"forwardJump"`
+	// Missing describes each part that is not set up
+	Missing []string `json:"missing"`
+}
+
+func (b Bootstrap) filterTable() iptables.Table {
+	return iptables.FilterTable(b.NS)
+}
+
+func (b Bootstrap) postrouting() iptables.Chain {
+	return iptables.NewChain(iptables.NewTable(b.NS, "nat"), "POSTROUTING")
+}
+
+func (b Bootstrap) forward() iptables.Chain {
+	return iptables.NewChain(b.filterTable(), "FORWARD")
+}
+
+func (b Bootstrap) downtime() iptables.Chain {
+	return iptables.NewChain(b.filterTable(), iptables.DOWNTIME_CHAIN)
+}
+
+// MasqueradeRule sends traffic out the Internet device from the address of the device
+func (b Bootstrap) MasqueradeRule(device string) iptables.Rule {
+	rule := iptables.NewRule(b.postrouting())
+	rule.Id = MASQUERADE_RULE_ID
+	rule.Target = iptables.MASQUERADE
+	rule.OutInterface = device
+	rule.Comment = "bootstrap masquerade"
+	return rule
+}
+
+// ForwardJumpRule sends all forwarded traffic through the downtime chain
+func (b Bootstrap) ForwardJumpRule() iptables.Rule {
+	rule := iptables.NewRule(b.forward())
+	rule.Id = FORWARD_JUMP_RULE_ID
+	rule.Target = iptables.DOWNTIME_CHAIN
+	rule.Comment = "bootstrap downtime"
+	return rule
+}
+
+// Status checks each part of the bootstrap
+func (b Bootstrap) Status() (Status, error) {
+	status := Status{Missing: []string{}}
+	var err error
+	if status.Forwarding, err = b.forwarding(); err != nil {
+		return status, err
+	}
+	if !status.Forwarding {
+		status.Missing = append(status.Missing, "IPv4 forwarding is disabled")
+	}
+	fw := firewall.For(b.NS)
+	if device, err := b.InternetDevice(); err != nil {
+		status.Missing = append(status.Missing, "Internet device: "+err.Error())
+	} else {
+		status.InternetDevice = device
+		if status.Masquerade, err = firewall.HasRule(fw, b.MasqueradeRule(device)); err != nil {
+			return status, err
+		}
+		if !status.Masquerade {
+			status.Missing = append(status.Missing, "MASQUERADE out "+device+" in nat POSTROUTING")
+		}
+	}
+	if status.DowntimeChain, err = resource.NewLifecycle(fw.ChainResource(b.downtime())).Exists(); err != nil {
+		return status, err
+	}
+	if !status.DowntimeChain {
+		status.Missing = append(status.Missing, "chain "+iptables.DOWNTIME_CHAIN+" in filter")
+	}
+	if status.DowntimeChain {
+		if status.ForwardJump, err = firewall.HasRule(fw, b.ForwardJumpRule()); err != nil {
+			return status, err
+		}
+	}
+	if !status.ForwardJump {
+		status.Missing = append(status.Missing, "jump to "+iptables.DOWNTIME_CHAIN+" in filter FORWARD")
+	}
+	return status, nil
+}
+
+// Ensure sets up the parts that are missing, returning true if anything changed
+func (b Bootstrap) Ensure() (bool, error) {
+	status, err := b.Status()
+	if err != nil {
+		return false, err
+	}
+	if status.InternetDevice == "" {
+		return false, fmt.Errorf("cannot masquerade without an Internet device")
+	}
+	fw := firewall.For(b.NS)
+	if !status.Forwarding {
+		if err := b.NS.Runner().RunLine("sysctl -w " + FORWARDING_SYSCTL + "=1"); err != nil {
+			return false, fmt.Errorf("failed to enable forwarding: %w", err)
+		}
+	}
+	if !status.Masquerade {
+		if err := fw.RuleResource(b.MasqueradeRule(status.InternetDevice)).Create(); err != nil {
+			return false, fmt.Errorf("failed to masquerade: %w", err)
+		}
+	}
+	if !status.DowntimeChain {
+		if err := fw.ChainResource(b.downtime()).Create(); err != nil {
+			return false, fmt.Errorf("failed to create downtime chain: %w", err)
+		}
+	}
+	if !status.ForwardJump {
+		if err := fw.RuleResource(b.ForwardJumpRule()).Create(); err != nil {
+			return false, fmt.Errorf("failed to jump to downtime chain: %w", err)
+		}
+	}
+	return len(status.Missing) > 0, nil
+}
+
+func (b Bootstrap) forwarding() (bool, error) {
+	res, err := b.NS.Runner().ExecLine("sysctl -n " + FORWARDING_SYSCTL)
+	if err != nil {
+		return false, fmt.Errorf("failed to check forwarding: %w", err)
+	}
+	return strings.TrimSpace(res.Out) == "1", nil
+}
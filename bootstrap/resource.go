@@ -0,0 +1,54 @@
+package bootstrap
+
+import (
+	"github.com/plockc/gateway/resource"
+)
+
+var _ resource.Resource = BootstrapRes{}
+
+// BootstrapRes exists once everything is set up, creating it sets up what is missing
+type BootstrapRes struct {
+	Bootstrap
+	Status
+	resource.FailUnimplementedMethods
+}
+
+func (b Bootstrap) BootstrapResource() *BootstrapRes {
+	return &BootstrapRes{Bootstrap: b}
+}
+
+// Id is the Internet device, detected when not set, or the name of the namespace without one
+func (b BootstrapRes) Id() string {
+	if b.Status.InternetDevice != "" {
+		return b.Status.InternetDevice
+	}
+	if device, err := b.Bootstrap.InternetDevice(); err == nil {
+		return device
+	}
+	return b.NS.Name
+}
+
+func (b BootstrapRes) List() ([]string, error) {
+	status, err := b.Bootstrap.Status()
+	if err != nil {
+		return nil, err
+	}
+	if len(status.Missing) > 0 {
+		return []string{}, nil
+	}
+	return []string{status.InternetDevice}, nil
+}
+
+func (b BootstrapRes) Create() error {
+	_, err := b.Ensure()
+	return err
+}
+
+func (b *BootstrapRes) Load() error {
+	status, err := b.Bootstrap.Status()
+	if err != nil {
+		return err
+	}
+	b.Status = status
+	return nil
+}
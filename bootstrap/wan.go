@@ -0,0 +1,69 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+// WAN is the Internet device of a namespace
+type WAN struct {
+	resource.NS `json:"-"`
+	Device      string `json:"device"`
+	// Detected is false when the device is from iptables.InternetDevice
+	Detected  bool     `json:"detected"`
+	MAC       string   `json:"mac"`
+	OperState string   `json:"operState"`
+	Addresses []string `json:"addresses"`
+}
+
+func NewWAN(ns resource.NS) WAN {
+	return WAN{NS: ns}
+}
+
+func (w WAN) String() string {
+	return w.NS.String() + ":wan[" + w.Device + "]"
+}
+
+var _ resource.Resource = WANRes{}
+
+type WANRes struct {
+	WAN
+	resource.FailUnimplementedMethods
+}
+
+func (w WAN) WANResource() *WANRes {
+	return &WANRes{WAN: w}
+}
+
+func (w WANRes) Id() string {
+	return w.Device
+}
+
+// Load detects the device then shows its addresses and link state
+func (w *WANRes) Load() error {
+	device, err := iptables.DetectInternetDevice(w.NS)
+	if err != nil {
+		return err
+	}
+	w.Device, w.Detected = device, iptables.InternetDevice == ""
+	res, err := w.Runner().Exec(address.NetInterface(device).IPAddrJsonCmd())
+	if err != nil {
+		return fmt.Errorf("failed to show Internet device '%s': %w", device, err)
+	}
+	addrsOut, err := address.IPAddrsOutFromString(res.Out)
+	if err != nil {
+		return fmt.Errorf("failed to parse addresses of '%s': %w", device, err)
+	}
+	if len(addrsOut) != 1 {
+		return fmt.Errorf("expected one Internet device '%s', found %d", device, len(addrsOut))
+	}
+	w.MAC, w.OperState = addrsOut[0].Address, addrsOut[0].OperState
+	w.Addresses = []string{}
+	for _, ipNet := range addrsOut[0].IPNets() {
+		w.Addresses = append(w.Addresses, ipNet.String())
+	}
+	return nil
+}
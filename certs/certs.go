@@ -0,0 +1,164 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VALIDITY of the self-signed certificates, they are replaced by deleting the files
+const VALIDITY = 10 * 365 * 24 * time.Hour
+
+// Certificate is loaded from the files, and can be reloaded while serving
+type Certificate struct {
+	CertFile string
+	KeyFile  string
+
+	lock sync.RWMutex
+	cert *tls.Certificate
+}
+
+func NewCertificate(certFile, keyFile string) *Certificate {
+	return &Certificate{CertFile: certFile, KeyFile: keyFile}
+}
+
+// Load reads the certificate and key from the files, keeping the current ones if that fails
+func (c *Certificate) Load() error {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the certificate '%s' and key '%s': %w", c.CertFile, c.KeyFile, err)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+// GetCertificate is for the tls.Config so reloaded certificates are used for new connections
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.cert == nil {
+		return nil, errors.New("certificate is not loaded")
+	}
+	return c.cert, nil
+}
+
+// Fingerprint is the SHA-256 of the certificate in hex separated by colons, as browsers show it
+func (c *Certificate) Fingerprint() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.cert == nil || len(c.cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(c.cert.Certificate[0])
+	pairs := []string{}
+	for _, b := range sum {
+		pairs = append(pairs, fmt.Sprintf("%02X", b))
+	}
+	return strings.Join(pairs, ":")
+}
+
+// EnsureSelfSigned generates a self-signed certificate for the hosts unless the files exist,
+// the hosts are names or IP addresses
+func EnsureSelfSigned(certFile, keyFile string, hosts ...string) (bool, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return false, nil
+	}
+	for _, err := range []error{certErr, keyErr} {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	certPEM, keyPEM, err := SelfSigned(time.Now(), hosts...)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range []struct {
+		name string
+		data []byte
+		mode fs.FileMode
+	}{{certFile, certPEM, 0644}, {keyFile, keyPEM, 0600}} {
+		if err := os.MkdirAll(filepath.Dir(f.name), 0700); err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(f.name, f.data, f.mode); err != nil {
+			return false, fmt.Errorf("failed to save the self-signed certificate: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// SelfSigned is a PEM certificate and key for the hosts, valid from the time
+func SelfSigned(now time.Time, hosts ...string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"gateway"}, CommonName: "gateway"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(VALIDITY),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if h != "" {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// LocalHosts are the host name, localhost and the addresses of the interfaces of the host
+func LocalHosts() []string {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return hosts
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			hosts = append(hosts, ipNet.IP.String())
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,69 @@
+package certs_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plockc/gateway/certs"
+)
+
+func TestSelfSigned(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "gateway")
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if generated, err := certs.EnsureSelfSigned(certFile, keyFile, "gateway.lan", "192.168.1.1"); err != nil || !generated {
+		t.Fatalf("expected the certificate to be generated: %v", err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the key to only be readable by the owner: %v", err)
+	}
+	cert := certs.NewCertificate(certFile, keyFile)
+	if err := cert.Load(); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := cert.Fingerprint()
+	if len(fingerprint) != 32*3-1 {
+		t.Fatalf("expected a SHA-256 fingerprint, got %s", fingerprint)
+	}
+	served, err := cert.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(served.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.VerifyHostname("gateway.lan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.VerifyHostname("192.168.1.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the persisted certificate is kept on the next start
+	if generated, err := certs.EnsureSelfSigned(certFile, keyFile); err != nil || generated {
+		t.Fatalf("expected the certificate to be kept: %v", err)
+	}
+	if err := cert.Load(); err != nil || cert.Fingerprint() != fingerprint {
+		t.Fatalf("expected the same certificate: %v", err)
+	}
+
+	// a replaced certificate is used once reloaded, a broken one is not
+	os.Remove(certFile)
+	os.Remove(keyFile)
+	if _, err := certs.EnsureSelfSigned(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Load(); err != nil || cert.Fingerprint() == fingerprint {
+		t.Fatalf("expected a new certificate: %v", err)
+	}
+	fingerprint = cert.Fingerprint()
+	if err := os.WriteFile(certFile, []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Load(); err == nil || cert.Fingerprint() != fingerprint {
+		t.Fatalf("expected the certificate to be kept when failing to load: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/plockc/gateway/audit"
+)
+
+// Audit has the changes made through the API matching the query, oldest first
+func (c *Client) Audit(ctx context.Context, query audit.Query) ([]audit.Record, error) {
+	values := url.Values{}
+	for name, t := range map[string]time.Time{"from": query.From, "to": query.To} {
+		if !t.IsZero() {
+			values.Set(name, t.Format(time.RFC3339Nano))
+		}
+	}
+	for name, value := range map[string]string{"path": query.Path, "caller": query.Caller} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	path := "/v1/audit"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	q := audit.QueryRes{}
+	err := c.get(ctx, path, &q)
+	return q.Records, err
+}
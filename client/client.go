@@ -0,0 +1,173 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/plockc/gateway/resource"
+)
+
+// Client calls the API of a gateway, the paths are under /api
+type Client struct {
+	// BaseURL is like https://192.168.1.1:8443
+	BaseURL string
+	// Token is the bearer token of the user, no authentication if empty
+	Token string
+	HTTP  *http.Client
+}
+
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token, HTTP: http.DefaultClient}
+}
+
+// ErrUnauthenticated and ErrForbidden are wrapped by the errors of the API
+// for the 401 and 403 responses
+var (
+	ErrUnauthenticated = errors.New("not authenticated")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// Error is a response of the API with an error status, with the kind of the error if it has one,
+// so resource.KindOf finds the kind of the error on the server
+type Error struct {
+	Status int
+	resource.Kind
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Kind == "" {
+		return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+	}
+	return fmt.Sprintf("%d %s (%s): %s", e.Status, http.StatusText(e.Status), e.Kind, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	switch {
+	case e.Kind != "":
+		return resource.WithKind(e.Kind, errors.New(e.Message))
+	case e.Status == http.StatusUnauthorized:
+		return ErrUnauthenticated
+	case e.Status == http.StatusForbidden:
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Response is what the API responded with when successful
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Do sends the body as JSON to the path under /api, and decodes the response into out if not nil
+func (c *Client) Do(ctx context.Context, method, path string, body, out any) (Response, error) {
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return Response{}, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/api"+path, reqBody)
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+	if resp.StatusCode >= 400 {
+		return Response{}, responseError(resp.StatusCode, data)
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return Response{}, fmt.Errorf("failed to parse the response of %s %s: %w", method, path, err)
+		}
+	}
+	return Response{Status: resp.StatusCode, Header: resp.Header, Body: data}, nil
+}
+
+// responseError is the error in the body of a failed response
+func responseError(status int, data []byte) *Error {
+	apiErr := &Error{Status: status, Message: strings.TrimSpace(string(data))}
+	errBody := struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}{}
+	if json.Unmarshal(data, &errBody) == nil && errBody.Error != "" {
+		apiErr.Message, apiErr.Kind = errBody.Error, resource.Kind(errBody.Code)
+	}
+	return apiErr
+}
+
+// PinnedHTTP only trusts the certificate with the SHA-256 fingerprint, like the self-signed
+// certificate the gateway shows on startup, the fingerprint is hex with or without colons
+func PinnedHTTP(fingerprint string) *http.Client {
+	want := strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		// the chain is not verified, only that the certificate is the pinned one
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no certificate")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if got := fmt.Sprintf("%x", sum); got != want {
+				return fmt.Errorf("certificate fingerprint %s is not the pinned %s", got, want)
+			}
+			return nil
+		},
+	}}}
+}
+
+// nsPath is the path under /api of the network namespace then the elements, which are escaped
+func nsPath(ns string, elems ...string) string {
+	path := "/v1/netns/" + url.PathEscape(ns)
+	for _, elem := range elems {
+		path += "/" + url.PathEscape(elem)
+	}
+	return path
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	_, err := c.Do(ctx, http.MethodGet, path, nil, out)
+	return err
+}
+
+// put is true if the resource was created, out is the body of the response, like the flushed connections
+func (c *Client) put(ctx context.Context, path string, body, out any) (bool, error) {
+	resp, err := c.Do(ctx, http.MethodPut, path, body, out)
+	return resp.Status == http.StatusCreated, err
+}
+
+// delete is true if there was anything to delete
+func (c *Client) delete(ctx context.Context, path string) (bool, error) {
+	resp, err := c.Do(ctx, http.MethodDelete, path, nil, nil)
+	return resp.Status == http.StatusNoContent, err
+}
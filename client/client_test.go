@@ -0,0 +1,60 @@
+package client_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plockc/gateway/client"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret" || req.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"who are you"}`))
+			return
+		}
+		if req.URL.Path != "/api/v1/netns" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"no such path","code":"not_found"}`))
+			return
+		}
+		w.Write([]byte(`["test"]`))
+	}))
+	defer server.Close()
+
+	list := []string{}
+	if _, err := client.New(server.URL, "secret").Do(context.Background(), "GET", "/v1/netns", nil, &list); err != nil || len(list) != 1 || list[0] != "test" {
+		t.Fatalf("expected the list, got %v: %v", list, err)
+	}
+	_, err := client.New(server.URL, "secret").Do(context.Background(), "GET", "/v1/other", nil, nil)
+	apiErr := &client.Error{}
+	if !errors.As(err, &apiErr) || apiErr.Status != 404 || resource.KindOf(err) != resource.NOT_FOUND || apiErr.Message != "no such path" {
+		t.Fatalf("expected a not found error, got %#v", err)
+	}
+	_, err = client.New(server.URL, "").Do(context.Background(), "GET", "/v1/netns", nil, nil)
+	if !errors.Is(err, client.ErrUnauthenticated) || !errors.As(err, &apiErr) || apiErr.Message != "who are you" {
+		t.Fatalf("expected an unauthorized error, got %#v", err)
+	}
+}
+
+func TestPinnedHTTP(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	sum := sha256.Sum256(server.Certificate().Raw)
+
+	if resp, err := client.PinnedHTTP(fmt.Sprintf("%X", sum)).Get(server.URL); err != nil {
+		t.Fatalf("expected the pinned certificate to be trusted: %s", err)
+	} else {
+		resp.Body.Close()
+	}
+	if _, err := client.PinnedHTTP(fmt.Sprintf("%x", sha256.Sum256(nil))).Get(server.URL); err == nil {
+		t.Fatal("expected another certificate to not be trusted")
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/plockc/gateway/events"
+)
+
+// Events calls the handler with each event as it is published, until the context is done,
+// the handler fails or the stream ends. Calling again with the Id of the last event resumes
+// after it, with a RESYNC event first if the events after it are no longer kept,
+// a lastId of 0 only has the new events
+func (c *Client) Events(ctx context.Context, lastId uint64, handler func(events.Event) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/v1/events", http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastId != 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(lastId, 10))
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(resp.Body)
+		return responseError(resp.StatusCode, data)
+	}
+	// the data of each event is the event as JSON, the id and type are also in it
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1024*1024)
+	data := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && data != "" {
+			e := events.Event{}
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				return fmt.Errorf("failed to parse the event %s: %w", data, err)
+			}
+			if err := handler(e); err != nil {
+				return err
+			}
+			data = ""
+			continue
+		}
+		if strings.HasPrefix(line, "data: ") {
+			data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,41 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/events"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestEvents(t *testing.T) {
+	ns := resource.NewNS("client-events")
+	c := newAPI(t, ns)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// resuming from the last event has the events published before the stream started
+	lastId := events.Default.Last()
+	sets := c.IPSets(ns.Name)
+	if _, err := sets.Ensure(ctx, iptables.NewIPSet(ns, "kids")); err != nil {
+		t.Fatal(err)
+	}
+	mac, _ := address.MACFromString("12:12:12:12:12:ab")
+	if _, err := sets.Members("kids").Add(ctx, mac); err != nil {
+		t.Fatal(err)
+	}
+	found := errors.New("found")
+	err := c.Events(ctx, lastId, func(e events.Event) error {
+		if e.Type == events.MEMBER_ADDED && e.Path == "/api/v1/netns/client-events/ipsets/kids/members/12:12:12:12:12:AB" {
+			return found
+		}
+		return nil
+	})
+	if err != found {
+		t.Fatalf("expected the member added, got %v", err)
+	}
+}
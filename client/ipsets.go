@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"net"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/conntrack"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+// IPSets are the sets of a network namespace
+type IPSets struct {
+	c  *Client
+	ns string
+}
+
+func (c *Client) IPSets(ns string) IPSets {
+	return IPSets{c: c, ns: ns}
+}
+
+// List has the names of the sets
+func (s IPSets) List(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := s.c.get(ctx, nsPath(s.ns, "ipsets"), &names)
+	return names, err
+}
+
+// Get fails with a NOT_FOUND kind if the set is missing, the API does not have the type of the set
+func (s IPSets) Get(ctx context.Context, name string) (iptables.IPSet, error) {
+	set := iptables.NewIPSet(resource.NewNS(s.ns), name)
+	err := s.c.get(ctx, nsPath(s.ns, "ipsets", name), &set)
+	return set, err
+}
+
+// Ensure creates the set if it is missing, true if it was created
+func (s IPSets) Ensure(ctx context.Context, set iptables.IPSet) (bool, error) {
+	return s.c.put(ctx, nsPath(s.ns, "ipsets", set.Name), set, nil)
+}
+
+// Delete is true if the set was deleted, false if it was already missing
+func (s IPSets) Delete(ctx context.Context, name string) (bool, error) {
+	return s.c.delete(ctx, nsPath(s.ns, "ipsets", name))
+}
+
+func (s IPSets) Clear(ctx context.Context) (bool, error) {
+	return s.c.delete(ctx, nsPath(s.ns, "ipsets"))
+}
+
+func (s IPSets) Members(set string) Members {
+	return Members{c: s.c, ns: s.ns, set: set}
+}
+
+// Members are the MACs of a hash:mac set or the IPs of a hash:ip set
+type Members struct {
+	c   *Client
+	ns  string
+	set string
+}
+
+func (m Members) ipSet() iptables.IPSet {
+	return iptables.NewIPSet(resource.NewNS(m.ns), m.set)
+}
+
+func (m Members) List(ctx context.Context) ([]iptables.Member, error) {
+	elements := []string{}
+	if err := m.c.get(ctx, nsPath(m.ns, "ipsets", m.set, "members"), &elements); err != nil {
+		return nil, err
+	}
+	members := []iptables.Member{}
+	for _, element := range elements {
+		member, err := iptables.MemberFromString(m.ipSet(), element)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// Add adds the MAC to a hash:mac set, the report has the connections flushed
+// by the rules blocking the set
+func (m Members) Add(ctx context.Context, mac address.MAC) (conntrack.Report, error) {
+	return m.add(ctx, iptables.NewMember(m.ipSet(), mac))
+}
+
+// AddIP adds the IPv4 address to a hash:ip set
+func (m Members) AddIP(ctx context.Context, ip net.IP) (conntrack.Report, error) {
+	return m.add(ctx, iptables.NewIPMember(m.ipSet(), ip))
+}
+
+func (m Members) add(ctx context.Context, member iptables.Member) (conntrack.Report, error) {
+	report := conntrack.Report{}
+	_, err := m.c.put(ctx, nsPath(m.ns, "ipsets", m.set, "members", member.Element()), nil, &report)
+	return report, err
+}
+
+// Delete is true if the member was removed, false if it was not in the set
+func (m Members) Delete(ctx context.Context, member iptables.Member) (bool, error) {
+	return m.c.delete(ctx, nsPath(m.ns, "ipsets", m.set, "members", member.Element()))
+}
+
+func (m Members) Clear(ctx context.Context) (bool, error) {
+	return m.c.delete(ctx, nsPath(m.ns, "ipsets", m.set, "members"))
+}
@@ -0,0 +1,82 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/client"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+// newAPI serves the API, publishing its events, for the namespace with the fake firewall backend
+func newAPI(t *testing.T, ns resource.NS) *client.Client {
+	firewalltest.Use(t, ns)
+	server := httptest.NewServer(handle.Publishing{Next: handle.Api{}})
+	t.Cleanup(server.Close)
+	return client.New(server.URL, "")
+}
+
+func TestIPSets(t *testing.T) {
+	ns := resource.NewNS("client-ipsets")
+	ctx := context.Background()
+	sets := newAPI(t, ns).IPSets(ns.Name)
+
+	if created, err := sets.Ensure(ctx, iptables.NewIPSet(ns, "tvs")); err != nil || !created {
+		t.Fatalf("expected the set to be created: %v", err)
+	}
+	if created, err := sets.Ensure(ctx, iptables.IPSet{Name: "games", Type: iptables.HASH_IP}); err != nil || !created {
+		t.Fatalf("expected the set to be created: %v", err)
+	}
+	if created, err := sets.Ensure(ctx, iptables.NewIPSet(ns, "tvs")); err != nil || created {
+		t.Fatalf("expected the set to already exist: %v", err)
+	}
+	if names, err := sets.List(ctx); err != nil || !reflect.DeepEqual(names, []string{"tvs", "games"}) {
+		t.Fatalf("expected the sets, got %v: %v", names, err)
+	}
+	if set, err := sets.Get(ctx, "games"); err != nil || set.Name != "games" || set.NS != ns {
+		t.Fatalf("expected the set, got %+v: %v", set, err)
+	}
+	if _, err := sets.Get(ctx, "missing"); resource.KindOf(err) != resource.NOT_FOUND {
+		t.Fatalf("expected the set to be missing, got %v", err)
+	}
+
+	mac, err := address.MACFromString("12:12:12:12:12:AB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sets.Members("tvs").Add(ctx, mac); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sets.Members("games").AddIP(ctx, net.ParseIP("44.44.44.44").To4()); err != nil {
+		t.Fatal(err)
+	}
+	members, err := sets.Members("tvs").List(ctx)
+	if err != nil || len(members) != 1 || members[0].MAC != mac || members[0].IPSet.Name != "tvs" {
+		t.Fatalf("expected the MAC, got %+v: %v", members, err)
+	}
+	if deleted, err := sets.Members("tvs").Delete(ctx, members[0]); err != nil || !deleted {
+		t.Fatalf("expected the member to be deleted: %v", err)
+	}
+	if deleted, err := sets.Delete(ctx, "tvs"); err != nil || !deleted {
+		t.Fatalf("expected the set to be deleted: %v", err)
+	}
+
+	// the errors of the server have their kind
+	_, err = sets.Members("missing").Add(ctx, mac)
+	apiErr := &client.Error{}
+	if resource.KindOf(err) != resource.NOT_FOUND || !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if _, err := sets.Ensure(ctx, iptables.IPSet{Name: "bad", Type: "hash:net"}); resource.KindOf(err) != resource.INVALID {
+		t.Fatalf("expected an invalid error, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/attempts"
+	"github.com/plockc/gateway/bootstrap"
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+	"github.com/plockc/gateway/throttle"
+)
+
+// Namespaces has the names of the network namespaces
+func (c *Client) Namespaces(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := c.get(ctx, "/v1/netns", &names)
+	return names, err
+}
+
+// Status has what is missing from the bootstrap of the namespace
+func (c *Client) Status(ctx context.Context, ns string) (bootstrap.Status, error) {
+	status := bootstrap.Status{}
+	err := c.get(ctx, nsPath(ns, "status"), &status)
+	return status, err
+}
+
+// Bootstrap sets up anything missing, true if anything was set up
+func (c *Client) Bootstrap(ctx context.Context, b bootstrap.Bootstrap) (bool, error) {
+	return c.put(ctx, nsPath(b.NS.Name, "bootstrap"), b, nil)
+}
+
+func (c *Client) WAN(ctx context.Context, ns string) (bootstrap.WAN, error) {
+	wan := bootstrap.NewWAN(resource.NewNS(ns))
+	err := c.get(ctx, nsPath(ns, "wan"), &wan)
+	return wan, err
+}
+
+// BlockedAttempts has the attempts of the device since the time, all devices if the MAC is nil
+// and all the retained attempts if the time is zero
+func (c *Client) BlockedAttempts(ctx context.Context, ns string, mac *address.MAC, since time.Time) ([]attempts.Attempt, error) {
+	query := url.Values{}
+	if mac != nil {
+		query.Set("mac", mac.String())
+	}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+	path := nsPath(ns, "blocked-attempts")
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	q := attempts.NewQuery(resource.NewNS(ns))
+	err := c.get(ctx, path, &q)
+	return q.Attempts, err
+}
+
+// Limits are the rate limits of a network namespace
+type Limits struct {
+	c  *Client
+	ns string
+}
+
+func (c *Client) Limits(ns string) Limits {
+	return Limits{c: c, ns: ns}
+}
+
+func (l Limits) Ids(ctx context.Context) ([]uint16, error) {
+	limitIds := []string{}
+	if err := l.c.get(ctx, nsPath(l.ns, "limits"), &limitIds); err != nil {
+		return nil, err
+	}
+	ids := []uint16{}
+	for _, limitId := range limitIds {
+		id, err := throttle.ParseLimitId(limitId)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (l Limits) Get(ctx context.Context, id uint16) (throttle.Limit, error) {
+	limit := throttle.NewLimit(resource.NewNS(l.ns), id)
+	err := l.c.get(ctx, nsPath(l.ns, "limits", limit.LimitId()), &limit)
+	return limit, err
+}
+
+// Ensure creates the limit with its Id if it is missing, or else replaces it
+func (l Limits) Ensure(ctx context.Context, limit throttle.Limit) (bool, error) {
+	return l.c.put(ctx, nsPath(l.ns, "limits", limit.LimitId()), limit, nil)
+}
+
+func (l Limits) Delete(ctx context.Context, id uint16) (bool, error) {
+	return l.c.delete(ctx, nsPath(l.ns, "limits", throttle.NewLimit(resource.NewNS(l.ns), id).LimitId()))
+}
+
+// DomainsList are the domains resolved into sets in a network namespace
+type DomainsList struct {
+	c  *Client
+	ns string
+}
+
+func (c *Client) Domains(ns string) DomainsList {
+	return DomainsList{c: c, ns: ns}
+}
+
+func (d DomainsList) List(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := d.c.get(ctx, nsPath(d.ns, "domains"), &names)
+	return names, err
+}
+
+// Get has the domains with the IPs they last resolved to
+func (d DomainsList) Get(ctx context.Context, name string) (domains.DomainsRes, error) {
+	res := domains.DomainsRes{Domains: domains.NewDomains(resource.NewNS(d.ns), name)}
+	err := d.c.get(ctx, nsPath(d.ns, "domains", name), &res)
+	return res, err
+}
+
+// Ensure starts resolving the domains if they are missing, or else replaces them
+func (d DomainsList) Ensure(ctx context.Context, ds domains.Domains) (bool, error) {
+	return d.c.put(ctx, nsPath(d.ns, "domains", ds.Name), ds, nil)
+}
+
+func (d DomainsList) Delete(ctx context.Context, name string) (bool, error) {
+	return d.c.delete(ctx, nsPath(d.ns, "domains", name))
+}
+
+// Apply makes the network namespace the desired state, the changes are the ones
+// that would be made for a dry run
+func (c *Client) Apply(ctx context.Context, ns string, desired state.State, opts state.Options) ([]state.Change, error) {
+	query := url.Values{}
+	query.Set("prune", strconv.FormatBool(opts.Prune))
+	query.Set("dryRun", strconv.FormatBool(opts.DryRun))
+	applied := struct {
+		Changes []state.Change `json:"changes"`
+	}{}
+	_, err := c.Do(ctx, http.MethodPost, nsPath(ns, "apply")+"?"+query.Encode(), desired, &applied)
+	return applied.Changes, err
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/plockc/gateway/conntrack"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+// Chains are the chains of a table, like filter, in a network namespace
+type Chains struct {
+	c     *Client
+	table iptables.Table
+}
+
+func (c *Client) Chains(ns, table string) Chains {
+	return Chains{c: c, table: iptables.NewTable(resource.NewNS(ns), table)}
+}
+
+func (ch Chains) path(elems ...string) string {
+	return nsPath(ch.table.NS.Name, append([]string{"iptables", ch.table.Name, "chains"}, elems...)...)
+}
+
+func (ch Chains) List(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := ch.c.get(ctx, ch.path(), &names)
+	return names, err
+}
+
+// Ensure creates the chain if it is missing, true if it was created
+func (ch Chains) Ensure(ctx context.Context, name string) (bool, error) {
+	return ch.c.put(ctx, ch.path(name), nil, nil)
+}
+
+func (ch Chains) Delete(ctx context.Context, name string) (bool, error) {
+	return ch.c.delete(ctx, ch.path(name))
+}
+
+func (ch Chains) Rules(chain string) Rules {
+	return Rules{c: ch.c, chain: iptables.NewChain(ch.table, chain)}
+}
+
+// Rules are the rules managed by the gateway in a chain
+type Rules struct {
+	c     *Client
+	chain iptables.Chain
+}
+
+func (c *Client) Rules(ns, table, chain string) Rules {
+	return c.Chains(ns, table).Rules(chain)
+}
+
+func (r Rules) path(elems ...string) string {
+	return nsPath(r.chain.NS.Name, append([]string{"iptables", r.chain.Table.Name, "chains", r.chain.Name, "rules"}, elems...)...)
+}
+
+// Ids has the Ids of the rules in the order of the chain
+func (r Rules) Ids(ctx context.Context) ([]uint32, error) {
+	ruleIds := []string{}
+	if err := r.c.get(ctx, r.path(), &ruleIds); err != nil {
+		return nil, err
+	}
+	ids := []uint32{}
+	for _, ruleId := range ruleIds {
+		id, err := iptables.ParseRuleId(ruleId)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// List gets each of the rules in the order of the chain
+func (r Rules) List(ctx context.Context) ([]iptables.Rule, error) {
+	ids, err := r.Ids(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules := []iptables.Rule{}
+	for _, id := range ids {
+		rule, err := r.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r Rules) Get(ctx context.Context, id uint32) (iptables.Rule, error) {
+	rule := iptables.Rule{Id: id, Chain: r.chain}
+	if err := r.c.get(ctx, r.path(rule.RuleId()), &rule); err != nil {
+		return rule, err
+	}
+	rule.Chain = r.chain
+	return rule, nil
+}
+
+// Create adds the rule to the end of the chain, the server picks the Id if it is 0,
+// the rule is returned with its Id
+func (r Rules) Create(ctx context.Context, rule iptables.Rule) (iptables.Rule, conntrack.Report, error) {
+	rule.Chain = r.chain
+	var body any = rule
+	if rule.Id == 0 {
+		fields := map[string]any{}
+		data, err := json.Marshal(rule)
+		if err == nil {
+			err = json.Unmarshal(data, &fields)
+		}
+		if err != nil {
+			return rule, conntrack.Report{}, err
+		}
+		delete(fields, "Id")
+		body = fields
+	}
+	report := conntrack.Report{}
+	resp, err := r.c.Do(ctx, "PUT", r.path(), body, &report)
+	if err != nil {
+		return rule, report, err
+	}
+	id, err := iptables.ParseRuleId(path.Base(resp.Header.Get("Location")))
+	if err != nil {
+		return rule, report, fmt.Errorf("failed to find the Id of the created rule: %w", err)
+	}
+	rule.Id = id
+	return rule, report, nil
+}
+
+// Ensure creates the rule with its Id if it is missing, or else replaces it
+func (r Rules) Ensure(ctx context.Context, rule iptables.Rule) (bool, error) {
+	rule.Chain = r.chain
+	return r.c.put(ctx, r.path(rule.RuleId()), rule, nil)
+}
+
+func (r Rules) Delete(ctx context.Context, id uint32) (bool, error) {
+	return r.c.delete(ctx, r.path(iptables.Rule{Id: id}.RuleId()))
+}
+
+func (r Rules) Clear(ctx context.Context) (bool, error) {
+	return r.c.delete(ctx, r.path())
+}
@@ -0,0 +1,55 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestRules(t *testing.T) {
+	ns := resource.NewNS("client-rules")
+	ctx := context.Background()
+	c := newAPI(t, ns)
+	if _, err := c.IPSets(ns.Name).Ensure(ctx, iptables.NewIPSet(ns, "kids")); err != nil {
+		t.Fatal(err)
+	}
+	if created, err := c.Chains(ns.Name, "filter").Ensure(ctx, "downtime"); err != nil || !created {
+		t.Fatalf("expected the chain to be created: %v", err)
+	}
+	rules := c.Rules(ns.Name, "filter", "downtime")
+
+	end := time.Now().Add(time.Hour).Truncate(time.Second)
+	created, _, err := rules.Create(ctx, iptables.Rule{Target: "REJECT", MatchSetSrc: "kids", End: &end, Comment: "homework"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id == 0 || created.Chain.Name != "downtime" {
+		t.Fatalf("expected the rule to have an Id in the chain, got %+v", created)
+	}
+	withId := iptables.Rule{Id: 0xabc, Target: "DROP", MatchSetSrc: "kids"}
+	if ensured, err := rules.Ensure(ctx, withId); err != nil || !ensured {
+		t.Fatalf("expected the rule to be created: %v", err)
+	}
+	if ids, err := rules.Ids(ctx); err != nil || len(ids) != 2 || ids[0] != created.Id || ids[1] != 0xabc {
+		t.Fatalf("expected the rules in order, got %x: %v", ids, err)
+	}
+	list, err := rules.List(ctx)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("expected the rules, got %+v: %v", list, err)
+	}
+	if got := list[0]; got.Target != "REJECT" || got.Comment != "homework" || got.End == nil || !got.End.Equal(end) || got.Chain.NS != ns {
+		t.Fatalf("expected the created rule, got %+v", got)
+	}
+	if deleted, err := rules.Delete(ctx, 0xabc); err != nil || !deleted {
+		t.Fatalf("expected the rule to be deleted: %v", err)
+	}
+	if _, err := rules.Get(ctx, 0xabc); resource.KindOf(err) != resource.NOT_FOUND {
+		t.Fatalf("expected the rule to be missing, got %v", err)
+	}
+	if _, _, err := rules.Create(ctx, iptables.Rule{Target: "DNAT"}); resource.KindOf(err) != resource.INVALID {
+		t.Fatalf("expected an invalid rule, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/plockc/gateway/ctl"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] <resource> <verb> [ids] [--id-name id] [field=value]\n", os.Args[0])
+	fmt.Fprintf(out, "   or: %s [flags] apply -f <file> [-prune] [-dry-run]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Verbs: list, get, add, set, delete, clear")
+	fmt.Fprintln(out, "\nResources, with the ids they need:")
+	for _, node := range ctl.Nodes() {
+		ids := []string{}
+		for _, param := range node.Params {
+			ids = append(ids, param.Name)
+		}
+		if !node.Resources.Singleton {
+			ids = append(ids, "["+node.Resources.IdParam.Name+"]")
+		}
+		fmt.Fprintf(out, "  %-28s %s\n", strings.Join(node.Path, " "), strings.Join(ids, " "))
+	}
+	fmt.Fprintln(out, "\nExamples:")
+	fmt.Fprintln(out, "  gatewayctl ipset members add tvs 12:12:12:12:12:12")
+	fmt.Fprintln(out, "  gatewayctl rules list --chain downtime")
+	fmt.Fprintln(out, "  gatewayctl rules add --chain downtime target=DROP matchSetSrc=kids")
+	fmt.Fprintln(out, "  gatewayctl apply -f policy.yaml -prune -dry-run")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	path := flag.String("config", "", "the config file, "+ctl.DefaultFile()+" is used if it exists")
+	server := flag.String("server", "", "the URL of the gateway, like https://192.168.1.1:8443")
+	token := flag.String("token", "", "the token of the user")
+	tokenFile := flag.String("token-file", "", "a file with the token of the user")
+	fingerprint := flag.String("fingerprint", "", "the SHA-256 fingerprint of the self-signed certificate of the gateway")
+	namespace := flag.String("netns", "", "the network namespace of the gateway")
+	output := flag.String("o", "", "the output, table or json")
+	flag.Parse()
+
+	cfg, err := ctl.Load(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "server":
+			cfg.Server = *server
+		case "token":
+			cfg.Token = *token
+		case "token-file":
+			cfg.Token, cfg.TokenFile = "", *tokenFile
+		case "fingerprint":
+			cfg.Fingerprint = *fingerprint
+		case "netns":
+			cfg.Namespace = *namespace
+		case "o":
+			cfg.Output = *output
+		}
+	})
+	if cfg.Output != "table" && cfg.Output != "json" {
+		fmt.Fprintf(os.Stderr, "output '%s' is not table or json\n", cfg.Output)
+		os.Exit(2)
+	}
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cl, err := cfg.Client()
+	if err == nil {
+		err = ctl.Run(context.Background(), cl, cfg.Namespace, cfg.Output, flag.Args(), os.Stdout)
+	}
+	// the errors of the API have the status and the message of the server
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
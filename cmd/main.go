@@ -1,20 +1,276 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
 	"os"
+	"sort"
+	"strings"
 
-	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/attempts"
+	"github.com/plockc/gateway/auth"
+	"github.com/plockc/gateway/bootstrap"
+	"github.com/plockc/gateway/config"
+	"github.com/plockc/gateway/firewall"
 	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/notice"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
 )
 
+// commands are run with the arguments after the name of the command
+var commands = map[string]struct {
+	usage string
+	run   func(args []string) error
+	// changes is true for the commands changing the firewall, which are run as root
+	changes bool
+}{
+	"serve":     {"serve the API, the default", runServe, true},
+	"bootstrap": {"set up anything missing for the gateway, then show what is still missing", runBootstrap, true},
+	"status":    {"show the bootstrap, firewall backend, sets and chains", runStatus, false},
+	"export":    {"write the sets, members, chains and managed rules as JSON", runExport, false},
+	"import":    {"create the sets, members, chains and rules from an export", runImport, true},
+	"user":      {"add or replace a user of the API with a new token", runUser, false},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [command flags]\n\nCommands:\n", os.Args[0])
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-10s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
 func main() {
-	if _, out, err := exec.ExecLine("id -u"); err != nil {
-		fmt.Println("Could not determine user id: " + err.Error())
+	flag.Usage = usage
+	cfg, err := config.Parse(flag.CommandLine, os.Args[1:])
+	if err == nil {
+		err = cfg.Apply()
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	if name == "" {
+		name = "serve"
+	}
+	command, ok := commands[name]
+	if !ok {
+		fmt.Printf("unknown command '%s'\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	if command.changes && os.Geteuid() != 0 {
+		fmt.Printf("%s changes the firewall so must be run as root\n", name)
 		os.Exit(1)
-	} else if out != "0" {
-		fmt.Println("must be run as root")
+	}
+	args := []string{}
+	if flag.NArg() > 0 {
+		args = flag.Args()[1:]
+	}
+	if err := command.run(args); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
+}
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	restore := flags.Bool("restore", true, "restore the snapshots of the sets, chains, rules and limits in the data dir")
+	flags.Parse(args)
+
+	if *restore && handle.SnapshotDir != "" {
+		restoreSnapshots(state.NewSnapshots(handle.SnapshotDir))
+	}
+	// the blocked attempts are only logged if the kernel supports NFLOG
+	if _, err := attempts.Listen(handle.NS, iptables.NFLOG_GROUP, attempts.For(handle.NS)); err != nil {
+		fmt.Println("not logging blocked attempts: " + err.Error())
+	}
+	// the notice is on its own port as the HTTP of blocked devices is redirected to it
+	if l, err := notice.Listen(handle.NS, iptables.NoticePort); err != nil {
+		fmt.Println("not showing the downtime notice: " + err.Error())
+	} else {
+		go http.Serve(l, notice.Handler{NS: handle.NS})
+	}
 	handle.Serve()
+	return nil
+}
+
+// restoreSnapshots restores the namespaces after a reboot, reporting what could not be restored
+// as the API can still fix it
+func restoreSnapshots(snapshots *state.Snapshots) {
+	namespaces, err := snapshots.Namespaces()
+	if err != nil {
+		fmt.Println("not restoring the snapshots: " + err.Error())
+		return
+	}
+	for _, ns := range namespaces {
+		if err := snapshots.Restore(ns); err != nil {
+			fmt.Printf("failed to restore %s from %s: %s\n", ns, snapshots.File(ns), err)
+			continue
+		}
+		fmt.Printf("restored %s from %s\n", ns, snapshots.File(ns))
+	}
+}
+
+// runUser adds or replaces a user in the credentials file with a new token,
+// and with the password read from stdin if asked for
+func runUser(args []string) error {
+	flags := flag.NewFlagSet("user", flag.ExitOnError)
+	name := flags.String("name", "", "name of the user")
+	role := flags.String("role", string(auth.VIEWER), fmt.Sprintf("one of %v", auth.Roles))
+	device := flags.String("device", "", "the MAC or IPv4 address of the device for the device role")
+	password := flags.Bool("password", false, "read a password for HTTP basic auth from stdin")
+	flags.Parse(args)
+
+	if handle.CredentialsFile == "" {
+		return errors.New("the credentials file is needed to add a user, set it with -credentials")
+	}
+	creds, err := auth.LoadCredentials(handle.CredentialsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		creds = auth.Credentials{}
+	} else if err != nil {
+		return err
+	}
+	user := auth.User{Name: *name, Role: auth.Role(*role), Device: *device}
+	if err := user.Validate(); err != nil {
+		return err
+	}
+	if *password {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read the password: %w", err)
+		}
+		if user.PasswordHash, err = auth.HashPassword(strings.TrimRight(line, "\r\n")); err != nil {
+			return err
+		}
+	}
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	user.TokenHash = hash
+	creds[user.Name] = user
+	if err := creds.Save(handle.CredentialsFile); err != nil {
+		return err
+	}
+	fmt.Println("token for", user, "is", token)
+	return nil
+}
+
+// runBootstrap sets up anything missing from the bootstrap then shows the status
+func runBootstrap(args []string) error {
+	flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	nsName := flags.String("netns", handle.NS.Name, "network namespace of the gateway, the host if empty")
+	device := flags.String("device", "", "the Internet device, defaults to -wan or the detected device")
+	statusOnly := flags.Bool("status", false, "only show what is missing")
+	flags.Parse(args)
+
+	b := bootstrap.NewBootstrap(resource.NewNS(*nsName))
+	b.Device = *device
+	if !*statusOnly {
+		changed, err := b.Ensure()
+		if err != nil {
+			return err
+		}
+		if changed {
+			fmt.Println("bootstrapped", b)
+		} else {
+			fmt.Println("already bootstrapped", b)
+		}
+	}
+	status, err := b.Status()
+	if err != nil {
+		return err
+	}
+	for _, missing := range status.Missing {
+		fmt.Println("missing:", missing)
+	}
+	return nil
+}
+
+// runStatus shows what is missing from the bootstrap, then what the firewall has
+func runStatus(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	flags.Parse(args)
+
+	status, err := bootstrap.NewBootstrap(handle.NS).Status()
+	if err != nil {
+		return err
+	}
+	fmt.Println("namespace:", handle.NS)
+	fmt.Println("internet device:", status.InternetDevice)
+	for _, missing := range status.Missing {
+		fmt.Println("missing:", missing)
+	}
+	fmt.Println("firewall backend:", firewall.For(handle.NS).Name())
+	s, err := state.Export(handle.NS)
+	if err != nil {
+		return err
+	}
+	for _, set := range s.IPSets {
+		fmt.Printf("set %s (%s): %d members\n", set.Name, iptables.IPSet{Type: set.Type}.SetType(), len(set.Members))
+	}
+	for _, chain := range s.Chains {
+		fmt.Printf("chain %s %s: %d managed rules\n", chain.Table, chain.Name, len(chain.Rules))
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "the file to write, stdout if empty")
+	flags.Parse(args)
+
+	s, err := state.Export(handle.NS)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0600)
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	input := flags.String("f", "", "the file of an export, stdin if empty")
+	flags.Parse(args)
+
+	var data []byte
+	var err error
+	if *input == "" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*input)
+	}
+	if err != nil {
+		return err
+	}
+	s := state.State{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("failed to parse the export: %w", err)
+	}
+	return state.Import(handle.NS, s)
 }
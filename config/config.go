@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+)
+
+// DEFAULT_FILE is read if it exists when no config file is given
+const DEFAULT_FILE = "/etc/gateway/config.json"
+
+// names of namespaces and devices, as accepted by ip
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+
+// Config is the settings of the gateway from the config file, which can be overridden by flags
+type Config struct {
+	// Listen is the address serving HTTP
+	Listen string `json:"listen"`
+	// HTTPS is the address serving HTTPS, no HTTPS if empty
+	HTTPS string `json:"https"`
+	// RedirectHTTP has HTTP redirect to HTTPS instead of serving the API
+	RedirectHTTP bool `json:"redirectHTTP"`
+	// Cert and Key are for HTTPS, a self-signed certificate is generated in the DataDir if empty
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	// Credentials has the users of the API, anyone can use the API if empty
+	Credentials string `json:"credentials"`
+	// Namespace is the network namespace of the gateway, the host if empty
+	Namespace string `json:"namespace"`
+	// WAN is the Internet device, detected from the default route if empty
+	WAN string `json:"wan"`
+	// DataDir keeps the state of the gateway, like the self-signed certificate, the firewall backends
+	// selected, the snapshots of the sets, chains, rules, limits and watched domains restored on startup and the audit log
+	DataDir string `json:"dataDir"`
+	// LogLevel is debug, info, warn or error
+	LogLevel string `json:"logLevel"`
+	// Notice is the port of the downtime notice
+	Notice int `json:"notice"`
+	// DNS is the server resolving domains, like 127.0.0.1:53, the resolvers of the host if empty
+	DNS string `json:"dns"`
+}
+
+func Default() Config {
+	return Config{
+		Listen:   ":8000",
+		HTTPS:    ":8443",
+		DataDir:  "/var/lib/gateway",
+		LogLevel: "info",
+		Notice:   iptables.NoticePort,
+	}
+}
+
+// bind has the flags set the settings
+func (c *Config) bind(flags *flag.FlagSet) {
+	flags.StringVar(&c.Listen, "listen", c.Listen, "the address serving HTTP")
+	flags.StringVar(&c.HTTPS, "https", c.HTTPS, "the address serving HTTPS, no HTTPS if empty")
+	flags.BoolVar(&c.RedirectHTTP, "redirect-http", c.RedirectHTTP, "redirect HTTP to HTTPS instead of serving the API")
+	flags.StringVar(&c.Cert, "cert", c.Cert, "the certificate for HTTPS, a self-signed one is generated if empty")
+	flags.StringVar(&c.Key, "key", c.Key, "the key of the certificate for HTTPS")
+	flags.StringVar(&c.Credentials, "credentials", c.Credentials, "the users of the API, added with the user command, anyone can use the API if empty")
+	flags.StringVar(&c.Namespace, "netns", c.Namespace, "the network namespace of the gateway, the host if empty")
+	flags.StringVar(&c.WAN, "wan", c.WAN, "the Internet device, detected from the default route if empty")
+	flags.StringVar(&c.DataDir, "data-dir", c.DataDir, "where the state of the gateway is kept")
+	flags.StringVar(&c.LogLevel, "log-level", c.LogLevel, "debug, info, warn or error")
+	flags.IntVar(&c.Notice, "notice", c.Notice, "the port of the downtime notice, rules with notice redirect HTTP to it")
+	flags.StringVar(&c.DNS, "dns", c.DNS, "the DNS server resolving domains, like 127.0.0.1:53, the resolvers of the host if empty")
+}
+
+// Parse has the settings of the config file from the -config flag, or the DEFAULT_FILE,
+// with the flags that are set overriding them
+func Parse(flags *flag.FlagSet, args []string) (Config, error) {
+	path := flags.String("config", "", "the config file, "+DEFAULT_FILE+" is used if it exists")
+	parsed := Default()
+	parsed.bind(flags)
+	if err := flags.Parse(args); err != nil {
+		return parsed, err
+	}
+	c, err := Load(*path)
+	if err != nil {
+		return c, err
+	}
+	overrides := flag.NewFlagSet(flags.Name(), flag.ContinueOnError)
+	c.bind(overrides)
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && err == nil {
+			err = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+	return c, err
+}
+
+// Load has the settings in the file on top of the defaults, a missing file is an error
+// unless it is the DEFAULT_FILE
+func Load(path string) (Config, error) {
+	c := Default()
+	if path == "" {
+		path = DEFAULT_FILE
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && path == DEFAULT_FILE {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read config: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return c, fmt.Errorf("config file '%s' is not valid: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate has an error for each of the settings that are not valid
+func (c Config) Validate() error {
+	errs := []string{}
+	invalid := func(setting string, format string, args ...any) {
+		errs = append(errs, setting+": "+fmt.Sprintf(format, args...))
+	}
+	for _, addr := range []struct{ setting, value string }{{"listen", c.Listen}, {"https", c.HTTPS}, {"dns", c.DNS}} {
+		if addr.value == "" && addr.setting != "listen" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr.value); err != nil {
+			invalid(addr.setting, "'%s' is not an address like :8000 or 192.168.1.1:8000", addr.value)
+		}
+	}
+	if c.RedirectHTTP && c.HTTPS == "" {
+		invalid("redirectHTTP", "needs the https address")
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		invalid("cert", "both the cert and the key are needed")
+	}
+	if c.Namespace != "" && !nameRegex.MatchString(c.Namespace) {
+		invalid("namespace", "'%s' is not a name of up to 15 letters, digits, '_', '.' or '-'", c.Namespace)
+	}
+	if c.WAN != "" && !nameRegex.MatchString(c.WAN) {
+		invalid("wan", "'%s' is not a device name of up to 15 letters, digits, '_', '.' or '-'", c.WAN)
+	}
+	if !filepath.IsAbs(c.DataDir) {
+		invalid("dataDir", "'%s' is not an absolute path", c.DataDir)
+	}
+	if _, err := logs.ParseLevel(c.LogLevel); err != nil {
+		invalid("logLevel", "%s", err)
+	}
+	if c.Notice < 1 || c.Notice > 65535 {
+		invalid("notice", "port %d is not 1 to 65535", c.Notice)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+}
+
+// Apply validates the settings then sets them in the packages that use them
+func (c Config) Apply() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	level, err := logs.ParseLevel(c.LogLevel)
+	if err != nil {
+		return err
+	}
+	logs.Threshold = level
+	handle.ListenAddr, handle.HTTPSAddr, handle.RedirectHTTP = c.Listen, c.HTTPS, c.RedirectHTTP
+	handle.CertFile, handle.KeyFile, handle.CertDir = c.Cert, c.Key, c.DataDir
+	handle.CredentialsFile = c.Credentials
+	handle.SnapshotDir = c.DataDir
+	firewall.SelectionFile = filepath.Join(c.DataDir, "firewall.json")
+	handle.AuditFile = filepath.Join(c.DataDir, "audit.jsonl")
+	handle.NS = resource.NewNS(c.Namespace)
+	iptables.InternetDevice = c.WAN
+	iptables.NoticePort = c.Notice
+	domains.Server = c.DNS
+	return nil
+}
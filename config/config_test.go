@@ -0,0 +1,57 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/plockc/gateway/config"
+)
+
+func TestParse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"listen": ":9000", "wan": "eth1", "logLevel": "debug"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	flags := flag.NewFlagSet("gateway", flag.ContinueOnError)
+	c, err := config.Parse(flags, []string{"-config", path, "-wan", "eth2", "status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the flags that are set override the file, which overrides the defaults
+	if c.Listen != ":9000" || c.WAN != "eth2" || c.LogLevel != "debug" || c.HTTPS != config.Default().HTTPS {
+		t.Fatalf("unexpected config %+v", c)
+	}
+	if flags.Arg(0) != "status" {
+		t.Fatalf("expected the command to be left, got %v", flags.Args())
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := config.Parse(flag.NewFlagSet("gateway", flag.ContinueOnError), []string{"-config", path + ".missing"}); err == nil {
+		t.Fatal("expected a missing config file to fail")
+	}
+	if err := os.WriteFile(path, []byte(`{"listen": ":9000", "logleve": "debug"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), "logleve") {
+		t.Fatalf("expected the unknown setting to fail, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := config.Default()
+	c.Listen, c.Namespace, c.DataDir, c.LogLevel, c.Cert = "8000", "a namespace", "data", "loud", "cert.pem"
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected the config to be invalid")
+	}
+	for _, setting := range []string{"listen:", "namespace:", "dataDir:", "logLevel:", "cert:"} {
+		if !strings.Contains(err.Error(), setting) {
+			t.Errorf("expected an error for %s got %v", setting, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package conntrack
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+var deletedRegex = regexp.MustCompile(`(\d+) flow entries have been deleted`)
+
+// Flushed has the connections deleted for a device
+type Flushed struct {
+	MAC         string   `json:"mac"`
+	IPs         []string `json:"ips"`
+	Connections int      `json:"connections"`
+}
+
+// Report has the devices with connections flushed when blocking started
+type Report struct {
+	Flushed []Flushed `json:"flushed"`
+}
+
+// Flush deletes the tracked connections from the addresses the devices have
+// in the neighbor table of the namespace, all the neighbors on the device if macs is nil,
+// and any device if dev is empty. The neighbors on the Internet device are never flushed,
+// as they are the upstream gateway
+func Flush(ns resource.NS, dev string, macs []address.MAC) (Report, error) {
+	report := Report{Flushed: []Flushed{}}
+	wan, err := iptables.DetectInternetDevice(ns)
+	if err != nil {
+		return report, err
+	}
+	runner := ns.Runner()
+	res, err := runner.Exec(address.NeighJsonCmd())
+	if err != nil {
+		return report, fmt.Errorf("failed to show neighbors: %w", err)
+	}
+	all, err := address.NeighsOutFromString(res.Out)
+	if err != nil {
+		return report, fmt.Errorf("failed to parse neighbors: %w", err)
+	}
+	neighs := address.NeighsOut{}
+	for _, n := range all {
+		if n.Dev != wan {
+			neighs = append(neighs, n)
+		}
+	}
+	if macs == nil {
+		macs = neighs.MACs(dev)
+	}
+	for _, mac := range macs {
+		flushed := Flushed{MAC: mac.String(), IPs: neighs.IPs(mac, dev)}
+		for _, ip := range flushed.IPs {
+			deleted, err := deleteFrom(runner, ip)
+			if err != nil {
+				return report, err
+			}
+			flushed.Connections += deleted
+		}
+		report.Flushed = append(report.Flushed, flushed)
+	}
+	return report, nil
+}
+
+// deleteFrom deletes the connections from the ip and has the number deleted
+func deleteFrom(runner *resource.Runner, ip string) (int, error) {
+	cmd := []string{"conntrack", "-D", "-s", ip}
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		cmd = append(cmd, "-f", "ipv6")
+	}
+	// conntrack fails when there was nothing to delete
+	err := runner.Run(cmd)
+	matches := deletedRegex.FindStringSubmatch(runner.LastOut())
+	if len(matches) < 2 {
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete connections from %s: %w", ip, err)
+		}
+		return 0, fmt.Errorf("failed to find the connections deleted from %s: %s", ip, runner.LastOut())
+	}
+	return strconv.Atoi(matches[1])
+}
+
+// FlushRule flushes the connections of the devices blocked by the rule if it has FlushConnections
+// and is active at the time, which are the members of the set it matches
+func FlushRule(rule iptables.Rule, now time.Time) (Report, error) {
+	if !rule.FlushConnections || rule.MatchSetSrc == "" || !slices.Contains(iptables.BlockingTargets, rule.Target) ||
+		!rule.Active(now) {
+		return Report{Flushed: []Flushed{}}, nil
+	}
+	set := iptables.NewIPSet(rule.NS, rule.MatchSetSrc)
+	macIds, err := firewall.For(rule.NS).MemberResource(iptables.NewMember(set, address.MAC{})).List()
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to list members of '%s': %w", set.Name, err)
+	}
+	macs := []address.MAC{}
+	for _, macId := range macIds {
+		mac, err := address.MACFromString(macId)
+		if err != nil {
+			return Report{}, err
+		}
+		macs = append(macs, mac)
+	}
+	return Flush(rule.NS, rule.InInterface, macs)
+}
+
+// FlushMember flushes the connections of the member if a rule with FlushConnections
+// in a chain of the filter table blocks the set of the member at the time
+func FlushMember(member iptables.Member, now time.Time) (Report, error) {
+	report := Report{Flushed: []Flushed{}}
+	rules, err := flushingRules(member.NS)
+	if err != nil {
+		return report, err
+	}
+	for _, rule := range rules {
+		if rule.MatchSetSrc == member.IPSet.Name && rule.Active(now) {
+			return Flush(member.NS, rule.InInterface, []address.MAC{member.MAC})
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,209 @@
+package conntrack_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/conntrack"
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/funcs"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+var testNS = resource.NewNS("conntrack")
+
+const neighs = `[
+	{"dst":"192.168.100.20","dev":"lan","lladdr":"12:12:12:12:12:ab","state":["REACHABLE"]},
+	{"dst":"fd00::20","dev":"lan","lladdr":"12:12:12:12:12:ab","state":["STALE"]},
+	{"dst":"192.168.100.30","dev":"lan","lladdr":"12:12:12:12:12:cd","state":["STALE"]},
+	{"dst":"192.168.100.40","dev":"lan","state":["FAILED"]},
+	{"dst":"44.44.0.1","dev":"wan","lladdr":"44:44:44:44:44:44","state":["REACHABLE"]}
+]`
+
+// neighborExecutor has the neighbors and deletes 2 connections for each address,
+// except 192.168.100.30 which has none
+type neighborExecutor struct {
+	deleted []string
+}
+
+func (n *neighborExecutor) Exec(cmd []string) (int, string, error) {
+	line := strings.Join(cmd, " ")
+	switch {
+	case strings.HasSuffix(line, strings.Join(address.NeighJsonCmd(), " ")):
+		return 0, neighs, nil
+	case strings.HasSuffix(line, strings.Join(address.DefaultRouteJsonCmd(), " ")):
+		return 0, `[{"dst":"default","gateway":"44.44.0.1","dev":"wan","flags":[]}]`, nil
+	case strings.Contains(line, "conntrack -D -s 192.168.100.30"):
+		out := "conntrack v1.4.6 (conntrack-tools): 0 flow entries have been deleted."
+		return 1, out, exec.ExitError(cmd, 1, out)
+	case strings.Contains(line, "conntrack -D -s "):
+		n.deleted = append(n.deleted, strings.SplitN(line, "conntrack -D -s ", 2)[1])
+		return 0, "conntrack v1.4.6 (conntrack-tools): 2 flow entries have been deleted.", nil
+	}
+	return 1, "", fmt.Errorf("unexpected command: %s", line)
+}
+
+func TestFlush(t *testing.T) {
+	defer func(executor exec.Executor) { resource.DefaultExecutor = executor }(resource.DefaultExecutor)
+	executor := &neighborExecutor{}
+	resource.DefaultExecutor = executor
+
+	fake := firewalltest.Use(t, testNS)
+
+	now := time.Now()
+	tvMAC, _ := address.MACFromString("12:12:12:12:12:ab")
+	set := iptables.NewIPSet(testNS, "tvs")
+	chain := iptables.NewChain(iptables.FilterTable(testNS), iptables.DOWNTIME_CHAIN)
+	rule := iptables.NewRule(chain)
+	rule.Target = iptables.DROP
+	rule.MatchSetSrc = set.Name
+	rule.FlushConnections = true
+	if err := funcs.Do(
+		fake.IPSetResource(set).Create,
+		fake.MemberResource(iptables.NewMember(set, tvMAC)).Create,
+		fake.ChainResource(chain).Create,
+		fake.RuleResource(rule).Create,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	tvFlushed := conntrack.Report{Flushed: []conntrack.Flushed{{
+		MAC: tvMAC.String(), IPs: []string{"192.168.100.20", "fd00::20"}, Connections: 4,
+	}}}
+
+	t.Run("rule flushes the members of its set", func(t *testing.T) {
+		executor.deleted = nil
+		report, err := conntrack.FlushRule(rule, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(report, tvFlushed) {
+			t.Fatalf("expected %+v, got %+v", tvFlushed, report)
+		}
+		if expected := []string{"192.168.100.20", "fd00::20 -f ipv6"}; !reflect.DeepEqual(executor.deleted, expected) {
+			t.Fatalf("expected deleting %v, got %v", expected, executor.deleted)
+		}
+	})
+
+	t.Run("member of a flushing set", func(t *testing.T) {
+		report, err := conntrack.FlushMember(iptables.NewMember(set, tvMAC), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(report, tvFlushed) {
+			t.Fatalf("expected %+v, got %+v", tvFlushed, report)
+		}
+	})
+
+	t.Run("member of another set", func(t *testing.T) {
+		report, err := conntrack.FlushMember(iptables.NewMember(iptables.NewIPSet(testNS, "phones"), tvMAC), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Flushed) != 0 {
+			t.Fatalf("expected nothing flushed, got %+v", report)
+		}
+	})
+
+	t.Run("rule that has not started", func(t *testing.T) {
+		executor.deleted = nil
+		rule := rule
+		start := now.Add(6 * time.Hour)
+		rule.Start = &start
+		report, err := conntrack.FlushRule(rule, now)
+		if err != nil || len(report.Flushed) != 0 || len(executor.deleted) != 0 {
+			t.Fatalf("expected nothing flushed before the start, got %+v, %v, deleted %v", report, err, executor.deleted)
+		}
+		if report, err := conntrack.FlushRule(rule, start); err != nil || !reflect.DeepEqual(report, tvFlushed) {
+			t.Fatalf("expected %+v at the start, got %+v, %v", tvFlushed, report, err)
+		}
+	})
+
+	t.Run("member of a set whose rule ended", func(t *testing.T) {
+		ended := rule
+		ended.Id++
+		end := now.Add(-time.Hour)
+		ended.End = &end
+		if err := fake.RuleResource(rule).Delete(); err != nil {
+			t.Fatal(err)
+		}
+		if err := fake.RuleResource(ended).Create(); err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			fake.RuleResource(ended).Delete()
+			fake.RuleResource(rule).Create()
+		}()
+		report, err := conntrack.FlushMember(iptables.NewMember(set, tvMAC), now)
+		if err != nil || len(report.Flushed) != 0 {
+			t.Fatalf("expected nothing flushed after the end, got %+v, %v", report, err)
+		}
+	})
+
+	t.Run("neighbors on the Internet device are kept", func(t *testing.T) {
+		executor.deleted = nil
+		gateway, _ := address.MACFromString("44:44:44:44:44:44")
+		report, err := conntrack.Flush(testNS, "", []address.MAC{gateway})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []conntrack.Flushed{{MAC: gateway.String(), IPs: []string{}}}
+		if !reflect.DeepEqual(report.Flushed, expected) || len(executor.deleted) != 0 {
+			t.Fatalf("expected nothing flushed on wan, got %+v, deleted %v", report, executor.deleted)
+		}
+	})
+
+	t.Run("rule without flushing", func(t *testing.T) {
+		rule := rule
+		rule.FlushConnections = false
+		report, err := conntrack.FlushRule(rule, now)
+		if err != nil || len(report.Flushed) != 0 {
+			t.Fatalf("expected nothing flushed, got %+v, %v", report, err)
+		}
+	})
+}
+
+func TestFlushStarted(t *testing.T) {
+	defer func(executor exec.Executor) { resource.DefaultExecutor = executor }(resource.DefaultExecutor)
+	executor := &neighborExecutor{}
+	resource.DefaultExecutor = executor
+
+	ns := resource.NewNS("scheduled")
+	fake := firewalltest.Use(t, ns)
+
+	now := time.Now()
+	bedtime := now.Add(time.Hour)
+	tvMAC, _ := address.MACFromString("12:12:12:12:12:ab")
+	set := iptables.NewIPSet(ns, "tvs")
+	chain := iptables.NewChain(iptables.FilterTable(ns), iptables.DOWNTIME_CHAIN)
+	rule := iptables.NewRule(chain)
+	rule.Target, rule.MatchSetSrc, rule.Start, rule.FlushConnections = iptables.DROP, set.Name, &bedtime, true
+	if err := funcs.Do(
+		fake.IPSetResource(set).Create,
+		fake.MemberResource(iptables.NewMember(set, tvMAC)).Create,
+		fake.ChainResource(chain).Create,
+		fake.RuleResource(rule).Create,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := conntrack.FlushStarted(ns, now.Add(-time.Minute), now)
+	if err != nil || !next.Equal(bedtime) || len(executor.deleted) != 0 {
+		t.Fatalf("expected nothing flushed until %s, got %s, %v, deleted %v", bedtime, next, err, executor.deleted)
+	}
+	next, err = conntrack.FlushStarted(ns, now, bedtime)
+	if expected := []string{"192.168.100.20", "fd00::20 -f ipv6"}; err != nil || !next.IsZero() ||
+		!reflect.DeepEqual(executor.deleted, expected) {
+		t.Fatalf("expected deleting %v when the rule starts, got %s, %v, deleted %v", expected, next, err, executor.deleted)
+	}
+	executor.deleted = nil
+	if _, err := conntrack.FlushStarted(ns, bedtime, bedtime.Add(time.Minute)); err != nil || len(executor.deleted) != 0 {
+		t.Fatalf("expected the started rule flushed only once, got %v, deleted %v", err, executor.deleted)
+	}
+}
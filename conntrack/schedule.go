@@ -0,0 +1,144 @@
+package conntrack
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+// INTERVAL is the longest between looking for the rules starting, for the rules not created through the API
+const INTERVAL = time.Minute
+
+// Guard is held while the scheduled flushes run, like the lock keeping the
+// commands of the export out of the audit of a change
+var Guard sync.Locker = &sync.Mutex{}
+
+// rescheduled wakes the schedule to look for the next start again
+var rescheduled = make(chan struct{}, 1)
+
+// Reschedule has the schedule look for the next start again, like after a rule starting later is created
+func Reschedule() {
+	select {
+	case rescheduled <- struct{}{}:
+	default:
+	}
+}
+
+// flushingRules are the rules with FlushConnections in the chains of the filter table
+func flushingRules(ns resource.NS) ([]iptables.Rule, error) {
+	fw := firewall.For(ns)
+	filter := iptables.FilterTable(ns)
+	chains, err := fw.ChainResource(iptables.NewChain(filter, "")).List()
+	if err != nil {
+		return nil, err
+	}
+	found := []iptables.Rule{}
+	for _, chain := range chains {
+		rules, err := firewall.Rules(fw, iptables.NewChain(filter, chain))
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if rule.FlushConnections && slices.Contains(iptables.BlockingTargets, rule.Target) {
+				found = append(found, rule)
+			}
+		}
+	}
+	return found, nil
+}
+
+// FlushStarted flushes the connections blocked by the rules with FlushConnections that started
+// after since until now, the rules active when they were created were flushed then.
+// It has the next start of the rules after now, zero if there is none
+func FlushStarted(ns resource.NS, since, now time.Time) (time.Time, error) {
+	rules, err := flushingRules(ns)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := time.Time{}
+	for _, rule := range rules {
+		if rule.Start == nil {
+			continue
+		}
+		if rule.Start.After(now) {
+			if next.IsZero() || rule.Start.Before(next) {
+				next = *rule.Start
+			}
+			continue
+		}
+		if !rule.Start.After(since) {
+			continue
+		}
+		report, err := FlushRule(rule, now)
+		if err != nil {
+			logs.Warnf("failed to flush the connections blocked by %s: %s\n", rule, err)
+			continue
+		}
+		logs.Infof("flushed the connections of %d devices blocked by %s\n", len(report.Flushed), rule)
+	}
+	return next, nil
+}
+
+// Namespaces are the namespace of the gateway, which can be the host, and the other network namespaces
+func Namespaces(gateway resource.NS) ([]resource.NS, error) {
+	names, err := resource.NSRes{}.List()
+	if err != nil {
+		return nil, err
+	}
+	found := []resource.NS{gateway}
+	for _, name := range names {
+		if name != gateway.Name {
+			found = append(found, resource.NewNS(name))
+		}
+	}
+	return found, nil
+}
+
+// Schedule flushes the connections of the rules in the namespaces when they start, checking
+// at the next start and at least each INTERVAL until the context is done. The namespaces
+// are listed for each check so the namespaces added later are flushed too
+func Schedule(ctx context.Context, namespaces func() ([]resource.NS, error)) {
+	checked := time.Now()
+	next := time.Time{}
+	for {
+		wait := INTERVAL
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-rescheduled:
+			timer.Stop()
+		case <-timer.C:
+		}
+		now := time.Now()
+		nss, err := namespaces()
+		if err != nil {
+			logs.Debugf("failed to list the namespaces to flush: %s\n", err)
+			continue
+		}
+		next = time.Time{}
+		Guard.Lock()
+		for _, ns := range nss {
+			start, err := FlushStarted(ns, checked, now)
+			if err != nil {
+				logs.Debugf("failed to flush the rules starting in %s: %s\n", ns, err)
+				continue
+			}
+			if !start.IsZero() && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		Guard.Unlock()
+		checked = now
+	}
+}
@@ -0,0 +1,502 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/plockc/gateway/client"
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/state"
+)
+
+// Config is the settings of gatewayctl from its config file, which can be overridden by flags
+type Config struct {
+	// Server is the URL of the gateway, like https://192.168.1.1:8443
+	Server string `json:"server"`
+	// Token is the token of the user, or TokenFile is a file with it
+	Token     string `json:"token"`
+	TokenFile string `json:"tokenFile"`
+	// Fingerprint is the SHA-256 fingerprint of the self-signed certificate of the gateway
+	Fingerprint string `json:"fingerprint"`
+	// Namespace is the network namespace of the gateway
+	Namespace string `json:"namespace"`
+	// Output is table or json
+	Output string `json:"output"`
+}
+
+func Default() Config {
+	return Config{Server: "http://localhost:8000", Output: "table"}
+}
+
+// DefaultFile is the config file read if it exists when no config file is given
+func DefaultFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gatewayctl.json")
+}
+
+// Load has the settings in the file on top of the defaults, a missing file is an error
+// unless it is the DefaultFile
+func Load(path string) (Config, error) {
+	c := Default()
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFile()
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read config: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return c, fmt.Errorf("config file '%s' is not valid: %w", path, err)
+	}
+	return c, nil
+}
+
+// Client is for the server of the config with its token and pinned certificate
+func (c Config) Client() (*client.Client, error) {
+	token := c.Token
+	if token == "" && c.TokenFile != "" {
+		data, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	cl := client.New(c.Server, token)
+	if c.Fingerprint != "" {
+		cl.HTTP = client.PinnedHTTP(c.Fingerprint)
+	}
+	return cl, nil
+}
+
+// Node is a resource below the network namespace, reached through the relationships in Path
+type Node struct {
+	Path      []string
+	Resources handle.Resources
+	// Params are the ids of the parents below the network namespace
+	Params []handle.Param
+}
+
+// Nodes has every resource below the network namespace, parents before children
+func Nodes() []Node {
+	nodes := []Node{}
+	var walk func(parent Node)
+	walk = func(parent Node) {
+		names := []string{}
+		for name := range parent.Resources.Relationships {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		params := parent.Params
+		if len(parent.Path) > 0 {
+			params = append(append([]handle.Param{}, parent.Params...), parent.Resources.IdParam)
+		}
+		for _, name := range names {
+			node := Node{
+				Path:      append(append([]string{}, parent.Path...), name),
+				Resources: parent.Resources.Relationships[name],
+				Params:    params,
+			}
+			nodes = append(nodes, node)
+			walk(node)
+		}
+	}
+	walk(Node{Resources: handle.Namespaces})
+	return nodes
+}
+
+// matches is true if the words are the end of the path, a word can leave off the plural
+func (n Node) matches(words []string) bool {
+	if len(words) > len(n.Path) {
+		return false
+	}
+	path := n.Path[len(n.Path)-len(words):]
+	for i, word := range words {
+		if word != path[i] && word+"s" != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Find is the node with the path, or the only node with a path ending in the words,
+// like "rules" for iptables chains rules
+func Find(words []string) (Node, error) {
+	found := []Node{}
+	for _, node := range Nodes() {
+		if node.matches(words) {
+			if len(node.Path) == len(words) {
+				return node, nil
+			}
+			found = append(found, node)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Node{}, fmt.Errorf("no resource '%s'", strings.Join(words, " "))
+	case 1:
+		return found[0], nil
+	}
+	paths := []string{}
+	for _, node := range found {
+		paths = append(paths, strings.Join(node.Path, " "))
+	}
+	return Node{}, fmt.Errorf("'%s' could be any of: %s", strings.Join(words, " "), strings.Join(paths, ", "))
+}
+
+// verbs have the method, and if the id of the resource is used
+var verbs = map[string]struct {
+	method string
+	item   bool
+}{
+	"list":   {http.MethodGet, false},
+	"get":    {http.MethodGet, true},
+	"add":    {http.MethodPut, true},
+	"set":    {http.MethodPut, true},
+	"delete": {http.MethodDelete, true},
+	"clear":  {http.MethodDelete, false},
+}
+
+// ParamDefaults are used for the ids of parents that are not given
+var ParamDefaults = map[string]string{"table": "filter"}
+
+// Request is the API request for a command
+type Request struct {
+	Method string
+	// Path is under /api
+	Path string
+	Body map[string]any
+	// Item is true when the response is of a resource rather than a list of ids
+	Item bool
+	Node Node
+}
+
+// Parse builds the request from the resource words, the verb, then the ids, --param value
+// flags for ids and query parameters, and key=value fields of the body
+func Parse(namespace string, args []string) (Request, error) {
+	verbAt := -1
+	for i, arg := range args {
+		if _, ok := verbs[arg]; ok {
+			verbAt = i
+			break
+		}
+	}
+	if verbAt < 1 {
+		return Request{}, fmt.Errorf("expected a resource then one of %s", verbNames())
+	}
+	node, err := Find(args[:verbAt])
+	if err != nil {
+		return Request{}, err
+	}
+	verb := verbs[args[verbAt]]
+	req := Request{Method: verb.method, Node: node, Item: verb.item || node.Resources.Singleton}
+
+	named := map[string]string{}
+	query := url.Values{}
+	positional := []string{}
+	rest := args[verbAt+1:]
+	for i := 0; i < len(rest); i++ {
+		arg := rest[i]
+		switch {
+		case strings.HasPrefix(arg, "-"):
+			name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			if !hasValue {
+				if i+1 == len(rest) {
+					return Request{}, fmt.Errorf("flag %s needs a value", arg)
+				}
+				i++
+				value = rest[i]
+			}
+			if isQueryParam(node, name) {
+				query.Set(name, value)
+			} else if isIdParam(node, name) {
+				named[name] = value
+			} else {
+				return Request{}, fmt.Errorf("unknown flag %s for %s", arg, strings.Join(node.Path, " "))
+			}
+		case strings.Contains(arg, "="):
+			key, value, _ := strings.Cut(arg, "=")
+			if req.Body == nil {
+				req.Body = map[string]any{}
+			}
+			var parsed any
+			if json.Unmarshal([]byte(value), &parsed) == nil {
+				req.Body[key] = parsed
+			} else {
+				req.Body[key] = value
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	// the named ids are taken first, then the positional ones in order, then the defaults
+	params := node.Params
+	if verb.item && !node.Resources.Singleton {
+		params = append(append([]handle.Param{}, params...), node.Resources.IdParam)
+	}
+	ids := make([]string, len(params))
+	for i, param := range params {
+		if id, ok := named[param.Name]; ok {
+			ids[i] = id
+			continue
+		}
+		if len(positional) > 0 {
+			ids[i], positional = positional[0], positional[1:]
+			continue
+		}
+		if id, ok := ParamDefaults[param.Name]; ok {
+			ids[i] = id
+			continue
+		}
+		// a PUT without the id of the resource creates one with a new id, like for rules
+		if i == len(params)-1 && verb.item && verb.method == http.MethodPut {
+			ids = ids[:i]
+			req.Item = false
+			break
+		}
+		return Request{}, fmt.Errorf("%s %s needs the %s", strings.Join(node.Path, " "), args[verbAt], param.Name)
+	}
+	if len(positional) > 0 {
+		return Request{}, fmt.Errorf("unexpected arguments %v", positional)
+	}
+
+	path := "/v1/netns/" + url.PathEscape(namespace)
+	for i, name := range node.Path {
+		path += "/" + name
+		if i < len(ids) {
+			path += "/" + url.PathEscape(ids[i])
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req.Path = path
+	return req, nil
+}
+
+func isIdParam(node Node, name string) bool {
+	for _, param := range append(node.Params, node.Resources.IdParam) {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isQueryParam(node Node, name string) bool {
+	for _, param := range node.Resources.QueryParams {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func verbNames() string {
+	names := []string{}
+	for name := range verbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Run sends the request of the command, writing the response as a table or as JSON
+func Run(ctx context.Context, cl *client.Client, namespace, output string, args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "apply" {
+		return Apply(ctx, cl, namespace, output, args[1:], out)
+	}
+	req, err := Parse(namespace, args)
+	if err != nil {
+		return err
+	}
+	var body any
+	if req.Body != nil {
+		body = req.Body
+	}
+	resp, err := cl.Do(ctx, req.Method, req.Path, body, nil)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(resp.Body)) == 0 || string(bytes.TrimSpace(resp.Body)) == "null" {
+		if output != "json" {
+			fmt.Fprintln(out, statusMessage(req.Method, resp.Status))
+		}
+		return nil
+	}
+	if output == "json" {
+		indented := bytes.Buffer{}
+		if err := json.Indent(&indented, resp.Body, "", "  "); err != nil {
+			return err
+		}
+		indented.WriteByte('\n')
+		_, err := out.Write(indented.Bytes())
+		return err
+	}
+	var parsed any
+	if err := json.Unmarshal(resp.Body, &parsed); err != nil {
+		return fmt.Errorf("failed to parse the response: %w", err)
+	}
+	header := ""
+	if !req.Item {
+		header = req.Node.Resources.IdParam.Name
+	}
+	return WriteTable(out, header, parsed)
+}
+
+func statusMessage(method string, status int) string {
+	switch {
+	case status == http.StatusCreated:
+		return "created"
+	case method == http.MethodDelete && status == http.StatusNoContent:
+		return "deleted"
+	case method == http.MethodDelete:
+		return "already deleted"
+	case method == http.MethodPut:
+		return "unchanged"
+	}
+	return http.StatusText(status)
+}
+
+// WriteTable writes a list of ids under the header, an object as fields and values,
+// and a list of objects with a column for each field
+func WriteTable(out io.Writer, header string, value any) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	switch v := value.(type) {
+	case []any:
+		rows := []map[string]any{}
+		for _, item := range v {
+			if row, ok := item.(map[string]any); ok {
+				rows = append(rows, row)
+			}
+		}
+		if len(rows) == 0 || len(rows) != len(v) {
+			if header != "" {
+				fmt.Fprintln(w, strings.ToUpper(header))
+			}
+			for _, item := range v {
+				fmt.Fprintln(w, cell(item))
+			}
+			break
+		}
+		columns := []string{}
+		seen := map[string]bool{}
+		for _, row := range rows {
+			for key := range row {
+				if !seen[key] {
+					seen[key] = true
+					columns = append(columns, key)
+				}
+			}
+		}
+		sort.Strings(columns)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, row := range rows {
+			cells := []string{}
+			for _, column := range columns {
+				cells = append(cells, cell(row[column]))
+			}
+			fmt.Fprintln(w, strings.Join(cells, "\t"))
+		}
+	case map[string]any:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", key, cell(v[key]))
+		}
+	default:
+		fmt.Fprintln(w, cell(v))
+	}
+	return w.Flush()
+}
+
+// cell is a string as is, nothing for null, and anything else as JSON
+func cell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// Apply sends the desired state in the YAML or JSON file of -f, stdin if it is -,
+// then writes the changes
+func Apply(ctx context.Context, cl *client.Client, namespace, output string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	file := flags.String("f", "", "the YAML or JSON file of the desired state, - for stdin")
+	prune := flags.Bool("prune", false, "delete the members and managed rules of the sets and chains in the file that are not in it")
+	dryRun := flags.Bool("dry-run", false, "only show the changes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("apply needs the file of the desired state with -f")
+	}
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+	desired, err := state.Parse(data)
+	if err != nil {
+		return err
+	}
+	changes, err := cl.Apply(ctx, namespace, desired, state.Options{Prune: *prune, DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		data, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	for _, change := range changes {
+		fmt.Fprintln(out, change)
+	}
+	switch {
+	case len(changes) == 0:
+		fmt.Fprintln(out, "no changes")
+	case *dryRun:
+		fmt.Fprintf(out, "%d changes not made for the dry run\n", len(changes))
+	default:
+		fmt.Fprintf(out, "%d changes made\n", len(changes))
+	}
+	return nil
+}
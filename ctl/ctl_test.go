@@ -0,0 +1,84 @@
+package ctl_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plockc/gateway/client"
+	"github.com/plockc/gateway/ctl"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		args   []string
+		method string
+		path   string
+	}{
+		{[]string{"ipset", "members", "add", "tvs", "12:12:12:12:12:12"}, http.MethodPut, "/v1/netns/ctl/ipsets/tvs/members/12:12:12:12:12:12"},
+		{[]string{"members", "list", "--set", "tvs"}, http.MethodGet, "/v1/netns/ctl/ipsets/tvs/members"},
+		{[]string{"rules", "list", "--chain", "downtime"}, http.MethodGet, "/v1/netns/ctl/iptables/filter/chains/downtime/rules"},
+		{[]string{"rules", "add", "--chain=downtime", "target=DROP"}, http.MethodPut, "/v1/netns/ctl/iptables/filter/chains/downtime/rules"},
+		{[]string{"rules", "delete", "nat", "POSTROUTING", "a"}, http.MethodDelete, "/v1/netns/ctl/iptables/nat/chains/POSTROUTING/rules/a"},
+		{[]string{"blocked-attempts", "get", "--mac", "12:12:12:12:12:12"}, http.MethodGet, "/v1/netns/ctl/blocked-attempts?mac=12%3A12%3A12%3A12%3A12%3A12"},
+		{[]string{"ipsets", "clear"}, http.MethodDelete, "/v1/netns/ctl/ipsets"},
+	} {
+		req, err := ctl.Parse("ctl", tc.args)
+		if err != nil {
+			t.Fatalf("%v: %s", tc.args, err)
+		}
+		if req.Method != tc.method || req.Path != tc.path {
+			t.Fatalf("%v: expected %s %s, got %s %s", tc.args, tc.method, tc.path, req.Method, req.Path)
+		}
+	}
+	for _, args := range [][]string{
+		{"ipsets"},
+		{"nothing", "list"},
+		{"ipsets", "get"},
+		{"ipsets", "list", "--chain", "downtime"},
+		{"ipsets", "list", "extra"},
+	} {
+		if _, err := ctl.Parse("ctl", args); err == nil {
+			t.Fatalf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	ns := resource.NewNS("ctl")
+	firewalltest.Use(t, ns)
+	server := httptest.NewServer(handle.Api{})
+	defer server.Close()
+	cl := client.New(server.URL, "")
+
+	run := func(output string, args ...string) (string, error) {
+		out := bytes.Buffer{}
+		err := ctl.Run(context.Background(), cl, ns.Name, output, args, &out)
+		return out.String(), err
+	}
+	if out, err := run("table", "ipsets", "add", "tvs", "type=hash:mac"); err != nil || out != "created\n" {
+		t.Fatalf("expected the set to be created, got %q: %v", out, err)
+	}
+	if _, err := run("table", "ipset", "members", "add", "tvs", "12:12:12:12:12:12"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := run("table", "ipset", "members", "list", "tvs"); err != nil || out != "MEMBER\n12:12:12:12:12:12\n" {
+		t.Fatalf("expected a table of members, got %q: %v", out, err)
+	}
+	if out, err := run("json", "ipset", "members", "list", "tvs"); err != nil || out != "[\n  \"12:12:12:12:12:12\"\n]\n" {
+		t.Fatalf("expected JSON of members, got %q: %v", out, err)
+	}
+	// the error has the status and the message of the server
+	_, err := run("table", "ipset", "members", "add", "missing", "12:12:12:12:12:12")
+	apiErr := &client.Error{}
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || !strings.Contains(err.Error(), apiErr.Message) {
+		t.Fatalf("expected a not found error from the server, got %v", err)
+	}
+}
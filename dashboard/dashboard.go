@@ -0,0 +1,39 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// PATH is where the dashboard is served, the root redirects to it
+const PATH = "/ui/"
+
+//go:embed static
+var static embed.FS
+
+// Files are the files of the dashboard, index.html and what it loads
+func Files() fs.FS {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic("the dashboard has no static files: " + err.Error())
+	}
+	return files
+}
+
+// Handler serves the dashboard under PATH and redirects the root to it,
+// the dashboard only uses the API so it needs nothing else from the gateway
+func Handler() http.Handler {
+	files := http.StripPrefix(PATH, http.FileServer(http.FS(Files())))
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/":
+			http.Redirect(w, req, PATH, http.StatusFound)
+		case strings.HasPrefix(req.URL.Path, PATH):
+			files.ServeHTTP(w, req)
+		default:
+			http.NotFound(w, req)
+		}
+	})
+}
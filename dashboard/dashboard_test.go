@@ -0,0 +1,183 @@
+package dashboard_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/dashboard"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+var pathRegex = regexp.MustCompile(`(\w+): "(/api/[^"]+)"`)
+
+// paths are the PATHS of app.js
+func paths(t *testing.T) map[string]string {
+	data, err := fs.ReadFile(dashboard.Files(), "app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]string{}
+	for _, match := range pathRegex.FindAllStringSubmatch(string(data), -1) {
+		paths[match[1]] = match[2]
+	}
+	if len(paths) == 0 {
+		t.Fatal("expected the PATHS in app.js")
+	}
+	return paths
+}
+
+func fill(path string, params map[string]string) string {
+	for name, value := range params {
+		path = strings.ReplaceAll(path, "{"+name+"}", value)
+	}
+	return path
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/api/", handle.Api{})
+	mux.Handle("/", dashboard.Handler())
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func request(t *testing.T, server *httptest.Server, method, path string, body any, expectedCode int) []byte {
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, server.URL+path, reqBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != expectedCode {
+		t.Fatalf("%s %s: expected %d, got %d: %s", method, path, expectedCode, resp.StatusCode, data)
+	}
+	return data
+}
+
+func TestStatic(t *testing.T) {
+	server := newServer(t)
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != dashboard.PATH {
+		t.Fatalf("expected a redirect to the dashboard, got %d to '%s'", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	for file, contentType := range map[string]string{"": "text/html", "app.js": "javascript", "style.css": "text/css"} {
+		resp, err := client.Get(server.URL + dashboard.PATH + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), contentType) {
+			t.Fatalf("expected '%s' as %s, got %d %s", file, contentType, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	}
+	resp, err = client.Get(server.URL + "/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected only the dashboard to be served, got %d", resp.StatusCode)
+	}
+}
+
+// TestPaths checks the dashboard only uses paths of the API
+func TestPaths(t *testing.T) {
+	doc := handle.OpenAPI()
+	for name, path := range paths(t) {
+		if _, ok := doc.Paths[strings.Replace(path, "/v1/", "/{version}/", 1)]; !ok {
+			t.Fatalf("the dashboard path %s '%s' is not in the API", name, path)
+		}
+	}
+}
+
+// TestAPI makes the requests of the dashboard for adding and removing a device,
+// and creating a rule with a start and end
+func TestAPI(t *testing.T) {
+	ns := resource.NewNS("dashboard")
+	firewalltest.Use(t, ns)
+	server := newServer(t)
+	paths := paths(t)
+	params := map[string]string{"netns": ns.Name, "table": "filter", "set": "kids", "member": "12:12:12:12:12:AB", "chain": "downtime"}
+
+	// the set and chain are made by the gateway or other tools, not by the dashboard
+	request(t, server, http.MethodPut, fill("/api/v1/netns/{netns}/ipsets/{set}", params), map[string]any{"type": "hash:mac"}, 201)
+	request(t, server, http.MethodPut, fill("/api/v1/netns/{netns}/iptables/{table}/chains/{chain}", params), nil, 201)
+
+	request(t, server, http.MethodPut, fill(paths["member"], params), nil, 201)
+	members := []string{}
+	if err := json.Unmarshal(request(t, server, http.MethodGet, fill(paths["members"], params), nil, 200), &members); err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0] != params["member"] {
+		t.Fatalf("expected the member, got %v", members)
+	}
+
+	chains := []string{}
+	if err := json.Unmarshal(request(t, server, http.MethodGet, fill(paths["chains"], params), nil, 200), &chains); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(chains, "downtime") {
+		t.Fatalf("expected the downtime chain, got %v", chains)
+	}
+	start, end := time.Now().Truncate(time.Second).UTC(), time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	request(t, server, http.MethodPut, fill(paths["rules"], params), map[string]any{
+		"target": "REJECT", "matchSetSrc": "kids", "start": start, "end": end, "comment": "homework",
+	}, 201)
+	ruleIds := []string{}
+	if err := json.Unmarshal(request(t, server, http.MethodGet, fill(paths["rules"], params), nil, 200), &ruleIds); err != nil {
+		t.Fatal(err)
+	}
+	if len(ruleIds) != 1 {
+		t.Fatalf("expected the rule, got %v", ruleIds)
+	}
+	params["ruleId"] = ruleIds[0]
+	rule := struct {
+		Target      string     `json:"target"`
+		MatchSetSrc string     `json:"matchSetSrc"`
+		End         *time.Time `json:"end"`
+	}{}
+	if err := json.Unmarshal(request(t, server, http.MethodGet, fill(paths["rule"], params), nil, 200), &rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Target != "REJECT" || rule.MatchSetSrc != "kids" || rule.End == nil || !rule.End.Equal(end) {
+		t.Fatalf("expected the rule blocking kids until %s, got %+v", end, rule)
+	}
+
+	request(t, server, http.MethodDelete, fill(paths["rule"], params), nil, 204)
+	request(t, server, http.MethodDelete, fill(paths["member"], params), nil, 204)
+}
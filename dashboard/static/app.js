@@ -0,0 +1,244 @@
+"use strict";
+
+// PATHS are the paths of the API the dashboard uses, as in /api/openapi.json
+const PATHS = {
+  namespaces: "/api/v1/netns",
+  ipsets: "/api/v1/netns/{netns}/ipsets",
+  members: "/api/v1/netns/{netns}/ipsets/{set}/members",
+  member: "/api/v1/netns/{netns}/ipsets/{set}/members/{member}",
+  chains: "/api/v1/netns/{netns}/iptables/{table}/chains",
+  rules: "/api/v1/netns/{netns}/iptables/{table}/chains/{chain}/rules",
+  rule: "/api/v1/netns/{netns}/iptables/{table}/chains/{chain}/rules/{ruleId}",
+  events: "/api/v1/events",
+};
+
+// EVENTS are the types of the events that change what the dashboard shows
+const EVENTS = [
+  "member-added", "member-removed", "rule-created", "rule-deleted",
+  "downtime-started", "downtime-ended", "grant-expired", "resync",
+];
+
+// the rules with these targets block the devices of their source set
+const BLOCKING = ["DROP", "REJECT"];
+
+const $ = (selector) => document.querySelector(selector);
+
+function path(name, params) {
+  return PATHS[name].replace(/{(\w+)}/g, (_, param) =>
+    encodeURIComponent(params[param] === undefined ? "" : params[param])
+  );
+}
+
+// api sends the body as JSON, the API needs the content type even without a body
+async function api(method, name, params, body) {
+  const resp = await fetch(path(name, params), {
+    method: method,
+    headers: { "Content-Type": "application/json" },
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const text = await resp.text();
+  const data = text ? JSON.parse(text) : null;
+  if (!resp.ok) {
+    throw new Error((data && data.error) || resp.status + " " + resp.statusText);
+  }
+  return data;
+}
+
+function showError(err) {
+  const el = $("#error");
+  el.textContent = err ? err.message : "";
+  el.hidden = !err;
+}
+
+function element(tag, text, attrs) {
+  const el = document.createElement(tag);
+  if (text !== undefined) {
+    el.textContent = text;
+  }
+  Object.assign(el, attrs || {});
+  return el;
+}
+
+function row(cells) {
+  const tr = element("tr");
+  for (const cell of cells) {
+    const td = element("td");
+    if (cell instanceof Node) {
+      td.appendChild(cell);
+    } else {
+      td.textContent = cell === null || cell === undefined ? "" : cell;
+    }
+    tr.appendChild(td);
+  }
+  return tr;
+}
+
+function formatTime(time) {
+  return time ? new Date(time).toLocaleString() : "";
+}
+
+// active rules have started and not yet ended
+function active(rule, now) {
+  return (!rule.start || new Date(rule.start) <= now) && (!rule.end || new Date(rule.end) > now);
+}
+
+const state = { netns: "", table: "filter", sets: {}, chains: {} };
+
+async function loadNamespaces() {
+  const namespaces = await api("GET", "namespaces", {});
+  const select = $("#netns");
+  select.replaceChildren(...namespaces.filter((ns) => ns).map((ns) => element("option", ns, { value: ns })));
+  state.netns = select.value;
+}
+
+async function loadSets() {
+  const sets = {};
+  for (const set of await api("GET", "ipsets", state)) {
+    sets[set] = await api("GET", "members", { ...state, set: set });
+  }
+  state.sets = sets;
+}
+
+async function loadChains() {
+  const chains = {};
+  for (const chain of await api("GET", "chains", state)) {
+    const rules = [];
+    for (const ruleId of await api("GET", "rules", { ...state, chain: chain })) {
+      rules.push({ ruleId: ruleId, ...(await api("GET", "rule", { ...state, chain: chain, ruleId: ruleId })) });
+    }
+    chains[chain] = rules;
+  }
+  state.chains = chains;
+}
+
+function removeButton(label, onClick) {
+  const button = element("button", label, { type: "button", className: "remove" });
+  button.addEventListener("click", () => onClick().then(refresh).catch(showError));
+  return button;
+}
+
+function renderSets() {
+  const container = $("#ipsets");
+  container.replaceChildren();
+  for (const [set, members] of Object.entries(state.sets)) {
+    container.appendChild(element("h3", set));
+    const table = element("table");
+    for (const member of members) {
+      table.appendChild(row([member, removeButton("Remove", () =>
+        api("DELETE", "member", { ...state, set: set, member: member })
+      )]));
+    }
+    container.appendChild(table);
+  }
+  for (const select of [$("#add-member [name=set]"), $("#add-rule [name=matchSetSrc]")]) {
+    const keep = select.name === "matchSetSrc" ? [element("option", "any", { value: "" })] : [];
+    select.replaceChildren(...keep, ...Object.keys(state.sets).map((set) => element("option", set, { value: set })));
+  }
+}
+
+function renderChains() {
+  const container = $("#chains");
+  container.replaceChildren();
+  for (const [chain, rules] of Object.entries(state.chains)) {
+    if (rules.length === 0) {
+      continue;
+    }
+    container.appendChild(element("h3", chain));
+    const table = element("table");
+    table.appendChild(row(["Target", "Devices", "Start", "End", "Comment", ""]));
+    for (const rule of rules) {
+      table.appendChild(row([
+        rule.target, rule.matchSetSrc, formatTime(rule.start), formatTime(rule.end), rule.comment,
+        removeButton("Delete", () => api("DELETE", "rule", { ...state, chain: chain, ruleId: rule.ruleId })),
+      ]));
+    }
+    container.appendChild(table);
+  }
+  $("#add-rule [name=chain]").replaceChildren(
+    ...Object.keys(state.chains).map((chain) => element("option", chain, { value: chain }))
+  );
+}
+
+function renderBlocked() {
+  const now = new Date();
+  const body = $("#blocked tbody");
+  body.replaceChildren();
+  for (const rules of Object.values(state.chains)) {
+    for (const rule of rules) {
+      if (!BLOCKING.includes(rule.target) || !rule.matchSetSrc || !active(rule, now)) {
+        continue;
+      }
+      for (const member of state.sets[rule.matchSetSrc] || []) {
+        body.appendChild(row([member, rule.matchSetSrc, rule.comment || rule.target, formatTime(rule.end)]));
+      }
+    }
+  }
+  $("#nothing-blocked").hidden = body.children.length > 0;
+}
+
+async function refresh() {
+  try {
+    state.netns = $("#netns").value;
+    await loadSets();
+    await loadChains();
+    renderSets();
+    renderChains();
+    renderBlocked();
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+$("#add-member").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const form = event.target;
+  api("PUT", "member", { ...state, set: form.set.value, member: form.member.value.trim() })
+    .then(() => form.reset())
+    .then(refresh)
+    .catch(showError);
+});
+
+$("#add-rule").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const form = event.target;
+  const rule = {
+    target: form.target.value,
+    matchSetSrc: form.matchSetSrc.value,
+    comment: form.comment.value,
+    notice: form.notice.checked,
+  };
+  // datetime-local has no time zone, it is the time of the browser
+  if (form.start.value) {
+    rule.start = new Date(form.start.value).toISOString();
+  }
+  if (form.end.value) {
+    rule.end = new Date(form.end.value).toISOString();
+  }
+  api("PUT", "rules", { ...state, chain: form.chain.value }, rule)
+    .then(() => form.reset())
+    .then(refresh)
+    .catch(showError);
+});
+
+// the events of the namespace refresh the dashboard once they stop coming in,
+// the browser reconnects with the id of the last event to get the events it missed
+let pending;
+function listen() {
+  const source = new EventSource(path("events", {}));
+  const changed = (event) => {
+    const data = JSON.parse(event.data);
+    if (event.type === "resync" || data.netns === state.netns) {
+      clearTimeout(pending);
+      pending = setTimeout(refresh, 200);
+    }
+  };
+  for (const type of EVENTS) {
+    source.addEventListener(type, changed);
+  }
+}
+
+$("#netns").addEventListener("change", refresh);
+$("#refresh").addEventListener("click", refresh);
+
+loadNamespaces().then(refresh).then(listen).catch(showError);
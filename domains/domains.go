@@ -0,0 +1,347 @@
+package domains
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+const (
+	DEFAULT_INTERVAL = 5 * time.Minute
+	// DEFAULT_EXPIRY keeps an IP in the set for a while after the domain stops resolving to it,
+	// as the answers of domains behind a CDN rotate and devices keep using cached answers
+	DEFAULT_EXPIRY = time.Hour
+	// LOOKUP_TIMEOUT is for resolving each domain
+	LOOKUP_TIMEOUT = 5 * time.Second
+)
+
+// Server is the address of the DNS server, like 127.0.0.1:53, the resolvers of the host if empty
+var Server = ""
+
+// Guard is held while the scheduled refreshes change the sets, like the lock
+// keeping their commands out of the audit of a change
+var Guard sync.Locker = &sync.Mutex{}
+
+func resolver() *net.Resolver {
+	if Server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, Server)
+		},
+	}
+}
+
+// Domains are resolved on an interval to fill a hash:ip set of the same name,
+// which rules match with matchSetDst
+type Domains struct {
+	Name        string `json:"-"`
+	resource.NS `json:"-"`
+	Domains     []string `json:"domains"`
+	// Interval between resolving the domains, like 5m, DEFAULT_INTERVAL if empty
+	Interval string `json:"interval"`
+	// Expiry is how long an IP stays in the set after last being resolved, DEFAULT_EXPIRY if empty
+	Expiry string `json:"expiry"`
+}
+
+func NewDomains(ns resource.NS, name string) Domains {
+	return Domains{Name: name, NS: ns}
+}
+
+func (d Domains) String() string {
+	return d.NS.String() + ":domains[" + d.Name + "]"
+}
+
+func (d Domains) IPSet() iptables.IPSet {
+	set := iptables.NewIPSet(d.NS, d.Name)
+	set.Type = iptables.HASH_IP
+	return set
+}
+
+func duration(value string, defaultDuration time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultDuration, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func (d Domains) durations() (interval, expiry time.Duration, err error) {
+	if interval, err = duration(d.Interval, DEFAULT_INTERVAL); err != nil {
+		return 0, 0, resource.Invalid("bad interval '%s': %w", d.Interval, err)
+	}
+	if expiry, err = duration(d.Expiry, DEFAULT_EXPIRY); err != nil {
+		return 0, 0, resource.Invalid("bad expiry '%s': %w", d.Expiry, err)
+	}
+	return interval, expiry, nil
+}
+
+func (d Domains) Validate() error {
+	if len(d.Domains) == 0 {
+		return resource.Invalid("%s needs at least one domain", d)
+	}
+	for _, domain := range d.Domains {
+		if domain == "" || strings.ContainsAny(domain, " /:@") {
+			return resource.Invalid("'%s' is not a domain", domain)
+		}
+	}
+	interval, expiry, err := d.durations()
+	if err != nil {
+		return err
+	}
+	if interval < time.Second {
+		return resource.Invalid("interval %s is less than a second", interval)
+	}
+	if expiry < interval {
+		return resource.Invalid("expiry %s is less than the interval %s", expiry, interval)
+	}
+	return nil
+}
+
+// Resolved is an IP in the set, with the domain that last resolved to it
+type Resolved struct {
+	IP       string    `json:"ip"`
+	Domain   string    `json:"domain"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Watch resolves the domains and keeps the members of the set
+type Watch struct {
+	lock sync.Mutex
+	Domains
+	resolved map[string]Resolved
+	// Refreshed is when the domains were last resolved
+	Refreshed time.Time
+	// Errors are from the last refresh
+	Errors []string
+	stop   chan struct{}
+}
+
+func newWatch(d Domains) *Watch {
+	return &Watch{Domains: d, resolved: map[string]Resolved{}}
+}
+
+// lookup is the IPs a domain resolved to, or the error resolving it
+type lookup struct {
+	domain string
+	ips    []net.IP
+	err    error
+}
+
+// Refresh resolves the domains, adds the new IPs to the set, and removes the IPs
+// that have not been resolved within the expiry. Failing to resolve a domain does not
+// fail the refresh, it is kept in the Errors
+func (w *Watch) Refresh(now time.Time) error {
+	return w.apply(w.resolve(), now)
+}
+
+// resolve looks up the domains without locking the watch, which can take the
+// LOOKUP_TIMEOUT for each domain
+func (w *Watch) resolve() []lookup {
+	w.lock.Lock()
+	names := w.Domains.Domains
+	w.lock.Unlock()
+	lookups := []lookup{}
+	for _, domain := range names {
+		ctx, cancel := context.WithTimeout(context.Background(), LOOKUP_TIMEOUT)
+		ips, err := resolver().LookupIP(ctx, "ip4", domain)
+		cancel()
+		lookups = append(lookups, lookup{domain: domain, ips: ips, err: err})
+	}
+	return lookups
+}
+
+// apply adds the IPs looked up to the set, and expires the IPs no longer resolved
+func (w *Watch) apply(lookups []lookup, now time.Time) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	d := w.Domains
+	_, expiry, err := d.durations()
+	if err != nil {
+		return err
+	}
+	fw := firewall.For(d.NS)
+	member := func(ip string) resource.Lifecycle {
+		return resource.NewLifecycle(fw.MemberResource(iptables.NewIPMember(d.IPSet(), net.ParseIP(ip))))
+	}
+	w.Errors = nil
+	for _, l := range lookups {
+		if l.err != nil {
+			w.Errors = append(w.Errors, l.err.Error())
+			continue
+		}
+		for _, ip := range l.ips {
+			if _, ok := w.resolved[ip.String()]; !ok {
+				if _, err := member(ip.String()).Ensure(); err != nil {
+					return fmt.Errorf("failed to add %s of '%s' to %s: %w", ip, l.domain, d.IPSet(), err)
+				}
+			}
+			w.resolved[ip.String()] = Resolved{IP: ip.String(), Domain: l.domain, LastSeen: now}
+		}
+	}
+	for ip, resolved := range w.resolved {
+		if now.Sub(resolved.LastSeen) > expiry {
+			if _, err := member(ip).EnsureDeleted(); err != nil {
+				return fmt.Errorf("failed to expire %s of '%s' from %s: %w", ip, resolved.Domain, d.IPSet(), err)
+			}
+			delete(w.resolved, ip)
+		}
+	}
+	w.Refreshed = now
+	return nil
+}
+
+// Resolved has the IPs in the set, sorted
+func (w *Watch) Resolved() []Resolved {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	found := []Resolved{}
+	for _, resolved := range w.resolved {
+		found = append(found, resolved)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].IP < found[j].IP
+	})
+	return found
+}
+
+// start refreshes on the interval until stopped
+func (w *Watch) start() {
+	interval, _, _ := w.durations()
+	w.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				lookups := w.resolve()
+				Guard.Lock()
+				err := w.apply(lookups, now)
+				Guard.Unlock()
+				if err != nil {
+					w.lock.Lock()
+					w.Errors = append(w.Errors, err.Error())
+					w.lock.Unlock()
+				}
+			}
+		}
+	}(w.stop)
+}
+
+func (w *Watch) halt() {
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+var (
+	watchesLock sync.Mutex
+	// watches for each namespace, keyed by namespace name then domains name
+	watches = map[string]map[string]*Watch{}
+)
+
+// Get finds the watch of the domains in the namespace
+func Get(ns resource.NS, name string) (*Watch, bool) {
+	watchesLock.Lock()
+	defer watchesLock.Unlock()
+	w, ok := watches[ns.Name][name]
+	return w, ok
+}
+
+// List has the domains being watched in the namespace, sorted by name
+func List(ns resource.NS) []Domains {
+	found := []Domains{}
+	for _, name := range Names(ns) {
+		if w, ok := Get(ns, name); ok {
+			w.lock.Lock()
+			found = append(found, w.Domains)
+			w.lock.Unlock()
+		}
+	}
+	return found
+}
+
+// Names are the domains being watched in the namespace, sorted
+func Names(ns resource.NS) []string {
+	watchesLock.Lock()
+	defer watchesLock.Unlock()
+	names := []string{}
+	for name := range watches[ns.Name] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start creates the set, resolves the domains and keeps resolving them on the interval,
+// an existing watch of the same name has its domains replaced. The members already in the set,
+// like those restored from a snapshot, expire unless the domains still resolve to them
+func Start(d Domains, now time.Time) (*Watch, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	w, ok := Get(d.NS, d.Name)
+	if ok {
+		w.lock.Lock()
+		w.halt()
+		w.Domains = d
+		w.lock.Unlock()
+	} else {
+		set := resource.NewLifecycle(firewall.For(d.NS).IPSetResource(d.IPSet()))
+		if _, err := set.Ensure(); err != nil {
+			return nil, fmt.Errorf("failed to create the set for %s: %w", d, err)
+		}
+		w = newWatch(d)
+		existing, err := firewall.For(d.NS).MemberResource(iptables.NewIPMember(d.IPSet(), nil)).List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the members of the set for %s: %w", d, err)
+		}
+		for _, ip := range existing {
+			w.resolved[ip] = Resolved{IP: ip, LastSeen: now}
+		}
+		watchesLock.Lock()
+		if watches[d.NS.Name] == nil {
+			watches[d.NS.Name] = map[string]*Watch{}
+		}
+		watches[d.NS.Name][d.Name] = w
+		watchesLock.Unlock()
+	}
+	err := w.Refresh(now)
+	w.lock.Lock()
+	w.start()
+	w.lock.Unlock()
+	return w, err
+}
+
+// Stop stops resolving the domains and deletes the set, which fails while a rule matches the set
+func Stop(ns resource.NS, name string) error {
+	w, ok := Get(ns, name)
+	if !ok {
+		return fmt.Errorf("%s is not being watched", NewDomains(ns, name))
+	}
+	set := resource.NewLifecycle(firewall.For(ns).IPSetResource(w.IPSet()))
+	if _, err := set.EnsureDeleted(); err != nil {
+		return fmt.Errorf("failed to delete the set for %s: %w", w.Domains, err)
+	}
+	w.lock.Lock()
+	w.halt()
+	w.lock.Unlock()
+	watchesLock.Lock()
+	delete(watches[ns.Name], name)
+	watchesLock.Unlock()
+	return nil
+}
@@ -0,0 +1,203 @@
+package domains_test
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+var testNS = resource.NewNS("domains")
+
+// stubDNS answers A queries from the answers, keyed by the domain
+type stubDNS struct {
+	lock    sync.Mutex
+	answers map[string][]net.IP
+	conn    net.PacketConn
+}
+
+func newStubDNS(t *testing.T) *stubDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubDNS{answers: map[string][]net.IP{}, conn: conn}
+	go stub.serve()
+	return stub
+}
+
+func (s *stubDNS) set(domain string, ips ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.answers[domain] = nil
+	for _, ip := range ips {
+		s.answers[domain] = append(s.answers[domain], net.ParseIP(ip).To4())
+	}
+}
+
+func (s *stubDNS) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if reply := s.reply(buf[:n]); reply != nil {
+			s.conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+// reply has the header and question of the query followed by the answers
+func (s *stubDNS) reply(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	labels := []string{}
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		end := i + 1 + int(query[i])
+		if end > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:end]))
+		i = end
+	}
+	// the end of the name, the type and the class
+	questionEnd := i + 5
+	if questionEnd > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+	domain := strings.ToLower(strings.Join(labels, "."))
+	s.lock.Lock()
+	ips, ok := s.answers[domain]
+	s.lock.Unlock()
+	if qtype != 1 {
+		ips = nil
+	}
+	reply := append([]byte{}, query[:questionEnd]...)
+	// response, recursion desired and available, with NXDOMAIN for unknown domains
+	binary.BigEndian.PutUint16(reply[2:], 0x8180)
+	if !ok {
+		binary.BigEndian.PutUint16(reply[2:], 0x8183)
+	}
+	binary.BigEndian.PutUint16(reply[6:], uint16(len(ips)))
+	binary.BigEndian.PutUint16(reply[8:], 0)
+	binary.BigEndian.PutUint16(reply[10:], 0)
+	for _, ip := range ips {
+		// pointer to the name in the question, type A, class IN, ttl of 60, 4 bytes of data
+		reply = append(reply, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		reply = append(reply, ip...)
+	}
+	return reply
+}
+
+func members(t *testing.T, d domains.Domains) []string {
+	members, err := firewall.For(testNS).MemberResource(iptables.NewIPMember(d.IPSet(), nil)).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return members
+}
+
+func TestDomains(t *testing.T) {
+	stub := newStubDNS(t)
+	defer stub.conn.Close()
+	defer func(server string) { domains.Server = server }(domains.Server)
+	domains.Server = stub.conn.LocalAddr().String()
+
+	firewalltest.Use(t, testNS)
+
+	stub.set("youtube.test", "10.0.0.1", "10.0.0.2")
+	stub.set("games.test", "10.0.1.1")
+
+	d := domains.NewDomains(testNS, "homework")
+	d.Domains = []string{"youtube.test", "games.test", "missing.test"}
+	d.Interval, d.Expiry = "1h", "2h"
+	start := time.Date(2026, 10, 19, 16, 0, 0, 0, time.UTC)
+	w, err := domains.Start(d, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer domains.Stop(testNS, d.Name)
+
+	if got := members(t, d); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2", "10.0.1.1"}) {
+		t.Fatalf("unexpected members %v", got)
+	}
+	if len(w.Errors) != 1 || !strings.Contains(w.Errors[0], "missing.test") {
+		t.Fatalf("expected an error for missing.test, got %v", w.Errors)
+	}
+
+	// a rule matches the set as the destination
+	chain := iptables.NewChain(iptables.FilterTable(testNS), "FORWARD")
+	rule := iptables.NewRule(chain)
+	rule.Target, rule.MatchSetDst = iptables.DROP, d.Name
+	if err := firewall.For(testNS).RuleResource(rule).Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := domains.Stop(testNS, d.Name); err == nil {
+		t.Fatal("expected failure stopping domains with a set matched by a rule")
+	}
+	if err := firewall.For(testNS).RuleResource(rule).Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the answers rotate, the old IP is kept until it expires
+	stub.set("youtube.test", "10.0.0.3")
+	if err := w.Refresh(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := members(t, d); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.1.1"}) {
+		t.Fatalf("unexpected members %v", got)
+	}
+	if err := w.Refresh(start.Add(3 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := members(t, d); !reflect.DeepEqual(got, []string{"10.0.0.3", "10.0.1.1"}) {
+		t.Fatalf("expected the stale IPs to expire, got %v", got)
+	}
+	resolved := w.Resolved()
+	if len(resolved) != 2 || resolved[0].Domain != "youtube.test" || !resolved[0].LastSeen.Equal(start.Add(3*time.Hour)) {
+		t.Fatalf("unexpected resolved %v", resolved)
+	}
+
+	// replacing the domains keeps the set
+	d.Domains = []string{"games.test"}
+	if _, err := domains.Start(d, start.Add(4*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if names := domains.Names(testNS); !reflect.DeepEqual(names, []string{"homework"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+
+	if err := domains.Stop(testNS, d.Name); err != nil {
+		t.Fatal(err)
+	}
+	if sets, _ := firewall.For(testNS).IPSetResource(d.IPSet()).List(); len(sets) != 0 {
+		t.Fatalf("expected the set to be deleted, got %v", sets)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d := domains.NewDomains(testNS, "bad")
+	for _, bad := range []domains.Domains{
+		d,
+		{Domains: []string{"https://youtube.com"}},
+		{Domains: []string{"youtube.com"}, Interval: "soon"},
+		{Domains: []string{"youtube.com"}, Interval: "10m", Expiry: "5m"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Fatalf("expected %+v to be invalid", bad)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package domains
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/plockc/gateway/resource"
+)
+
+var _ resource.Resource = DomainsRes{}
+
+// DomainsRes has the IPs resolved for the domains when loaded
+type DomainsRes struct {
+	Domains
+	resource.FailUnimplementedMethods
+	Resolved  []Resolved `json:"resolved"`
+	Refreshed time.Time  `json:"refreshed"`
+	Errors    []string   `json:"errors"`
+}
+
+func (d Domains) DomainsResource() *DomainsRes {
+	return &DomainsRes{Domains: d}
+}
+
+func (d DomainsRes) Id() string {
+	return d.Name
+}
+
+func (d DomainsRes) Create() error {
+	_, err := Start(d.Domains, time.Now())
+	return err
+}
+
+// Update replaces the domains and resolves them again
+func (d DomainsRes) Update() error {
+	return d.Create()
+}
+
+func (d DomainsRes) Delete() error {
+	return Stop(d.NS, d.Name)
+}
+
+func (d DomainsRes) List() ([]string, error) {
+	return Names(d.NS), nil
+}
+
+func (d DomainsRes) Clear() error {
+	for _, name := range Names(d.NS) {
+		if err := Stop(d.NS, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DomainsRes) Load() error {
+	w, ok := Get(d.NS, d.Name)
+	if !ok {
+		return fmt.Errorf("%s is not being watched", d.Domains)
+	}
+	d.Resolved = w.Resolved()
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	d.Domains = w.Domains
+	d.Refreshed = w.Refreshed
+	d.Errors = w.Errors
+	return nil
+}
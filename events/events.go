@@ -0,0 +1,129 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/iptables"
+)
+
+const (
+	MEMBER_ADDED     = "member-added"
+	MEMBER_REMOVED   = "member-removed"
+	RULE_CREATED     = "rule-created"
+	RULE_DELETED     = "rule-deleted"
+	DOWNTIME_STARTED = "downtime-started"
+	DOWNTIME_ENDED   = "downtime-ended"
+	GRANT_EXPIRED    = "grant-expired"
+	// RESYNC is sent to a client resuming after events that are no longer buffered,
+	// it needs to load the state again
+	RESYNC = "resync"
+
+	// DEFAULT_BUFFER is how many events are kept for the clients resuming
+	DEFAULT_BUFFER = 1000
+	// SUBSCRIBER_BUFFER is how many events a client can be behind before it is dropped,
+	// it can resume when it reconnects
+	SUBSCRIBER_BUFFER = 64
+)
+
+// Event is a change of the state of a namespace
+type Event struct {
+	Id   uint64    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// NS is the name of the network namespace, empty for the host
+	NS string `json:"netns"`
+	// Path is the resource in the API, like /api/v1/netns/gw/ipsets/kids/members/12:12:12:12:12:AB,
+	// the set for a downtime and the rule for a grant
+	Path string `json:"path"`
+	// Rule is the rule created or deleted, the rule blocking the set for a downtime, or the grant
+	Rule *iptables.Rule `json:"rule,omitempty"`
+}
+
+// Bus sends the events to the subscribers, keeping the last Size events
+// for the subscribers resuming after the Id of the last event they had
+type Bus struct {
+	lock        sync.Mutex
+	Size        int
+	events      []Event
+	last        uint64
+	subscribers map[chan Event]bool
+}
+
+func NewBus(size int) *Bus {
+	return &Bus{
+		Size: size,
+		// the ids continue from the time the bus started, so the ids from an earlier run
+		// are older than the buffer, and stay exact as numbers in JavaScript
+		last:        uint64(time.Now().UnixMicro()),
+		subscribers: map[chan Event]bool{},
+	}
+}
+
+// Default is the bus of the events of all the namespaces
+var Default = NewBus(DEFAULT_BUFFER)
+
+// Publish gives the event the next Id and sends it, the subscribers that are
+// too far behind are dropped
+func (b *Bus) Publish(e Event) Event {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.last++
+	e.Id = b.last
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.events = append(b.events, e)
+	if len(b.events) > b.Size {
+		b.events = b.events[len(b.events)-b.Size:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return e
+}
+
+// Last is the Id of the last event
+func (b *Bus) Last() uint64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.last
+}
+
+// Subscribe has the events after the Id of the last event when resuming, and the channel
+// of the next events, which is closed if the subscriber is too far behind. Resuming is
+// not complete if events after the last Id are no longer buffered.
+// Cancel stops the events
+func (b *Bus) Subscribe(lastId uint64, resume bool) (missed []Event, complete bool, next <-chan Event, cancel func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	missed, complete = []Event{}, true
+	if resume {
+		oldest := b.last + 1
+		if len(b.events) > 0 {
+			oldest = b.events[0].Id
+		}
+		complete = lastId+1 >= oldest && lastId <= b.last
+		for _, e := range b.events {
+			if complete && e.Id > lastId {
+				missed = append(missed, e)
+			}
+		}
+	}
+	ch := make(chan Event, SUBSCRIBER_BUFFER)
+	b.subscribers[ch] = true
+	cancel = func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if b.subscribers[ch] {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return missed, complete, ch, cancel
+}
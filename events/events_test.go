@@ -0,0 +1,128 @@
+package events_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/events"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+)
+
+func TestBus(t *testing.T) {
+	bus := events.NewBus(3)
+	first := bus.Publish(events.Event{Type: events.MEMBER_ADDED, Path: "/a"})
+	for _, path := range []string{"/b", "/c", "/d"} {
+		bus.Publish(events.Event{Type: events.MEMBER_ADDED, Path: path})
+	}
+	if bus.Last() != first.Id+3 {
+		t.Fatalf("expected the ids in order after %d, last is %d", first.Id, bus.Last())
+	}
+	missedPaths := func(lastId uint64) ([]string, bool) {
+		missed, complete, _, cancel := bus.Subscribe(lastId, true)
+		defer cancel()
+		paths := []string{}
+		for _, e := range missed {
+			paths = append(paths, e.Path)
+		}
+		return paths, complete
+	}
+	for name, tc := range map[string]struct {
+		lastId   uint64
+		expected []string
+		complete bool
+	}{
+		"buffered":         {first.Id + 1, []string{"/c", "/d"}, true},
+		"oldest buffered":  {first.Id, []string{"/b", "/c", "/d"}, true},
+		"up to date":       {first.Id + 3, []string{}, true},
+		"no longer kept":   {first.Id - 1, []string{}, false},
+		"from another run": {first.Id + 10, []string{}, false},
+	} {
+		if paths, complete := missedPaths(tc.lastId); !reflect.DeepEqual(paths, tc.expected) || complete != tc.complete {
+			t.Fatalf("%s: expected %v %v, got %v %v", name, tc.expected, tc.complete, paths, complete)
+		}
+	}
+
+	// the subscribers get the next events, those too far behind are dropped
+	_, _, next, cancel := bus.Subscribe(0, false)
+	defer cancel()
+	e := bus.Publish(events.Event{Type: events.RULE_CREATED})
+	if got := <-next; got.Id != e.Id {
+		t.Fatalf("expected event %d, got %+v", e.Id, got)
+	}
+	for i := 0; i <= events.SUBSCRIBER_BUFFER; i++ {
+		bus.Publish(events.Event{Type: events.RULE_CREATED})
+	}
+	for range next {
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	ns := resource.NewNS("events")
+	firewalltest.Use(t, ns)
+
+	bus := events.NewBus(events.DEFAULT_BUFFER)
+	w := events.NewWatcher(ns, bus)
+	_, _, next, cancel := bus.Subscribe(0, false)
+	defer cancel()
+	received := func() []string {
+		found := []string{}
+		for {
+			select {
+			case e := <-next:
+				found = append(found, e.Type+" "+e.Path)
+			default:
+				return found
+			}
+		}
+	}
+	now := time.Date(2030, 1, 1, 19, 0, 0, 0, time.UTC)
+	check := func(at time.Time, expected ...string) {
+		t.Helper()
+		if err := w.Check(at); err != nil {
+			t.Fatal(err)
+		}
+		if got := received(); !reflect.DeepEqual(got, append([]string{}, expected...)) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+	apply := func(s state.State) {
+		t.Helper()
+		if _, err := state.Reconcile(ns, s, state.Options{Prune: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(now)
+
+	bedtime, morning, later := now.Add(time.Hour), now.Add(12*time.Hour), now.Add(13*time.Hour)
+	kids := state.IPSet{Name: "kids", Members: []string{"12:12:12:12:12:AB"}}
+	downtime := iptables.Rule{Id: 0xa, Target: iptables.DROP, MatchSetSrc: "kids", Start: &bedtime, End: &morning}
+	grant := iptables.Rule{Id: 0xb, Target: iptables.ACCEPT, MatchSetSrc: "kids", End: &bedtime}
+	apply(state.State{
+		IPSets: []state.IPSet{kids},
+		Chains: []state.Chain{{Table: "filter", Name: "FORWARD", Rules: []iptables.Rule{grant, downtime}}},
+	})
+	check(now,
+		"member-added /api/v1/netns/events/ipsets/kids/members/12:12:12:12:12:AB",
+		"rule-created /api/v1/netns/events/iptables/filter/chains/FORWARD/rules/b",
+		"rule-created /api/v1/netns/events/iptables/filter/chains/FORWARD/rules/a",
+	)
+	if next := w.Next(now); !next.Equal(bedtime) {
+		t.Fatalf("expected the next check at %s, got %s", bedtime, next)
+	}
+	check(bedtime,
+		"downtime-started /api/v1/netns/events/ipsets/kids",
+		"grant-expired /api/v1/netns/events/iptables/filter/chains/FORWARD/rules/b",
+	)
+	check(morning, "downtime-ended /api/v1/netns/events/ipsets/kids")
+
+	apply(state.State{IPSets: []state.IPSet{{Name: "kids"}}, Chains: []state.Chain{{Table: "filter", Name: "FORWARD"}}})
+	check(later,
+		"member-removed /api/v1/netns/events/ipsets/kids/members/12:12:12:12:12:AB",
+		"rule-deleted /api/v1/netns/events/iptables/filter/chains/FORWARD/rules/b",
+		"rule-deleted /api/v1/netns/events/iptables/filter/chains/FORWARD/rules/a",
+	)
+}
@@ -0,0 +1,279 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+	"golang.org/x/exp/slices"
+)
+
+// INTERVAL is the longest between the checks of a namespace, for the changes not made through the API
+const INTERVAL = time.Minute
+
+// Guard is held while the watchers check in the background, like the lock
+// keeping the commands of the export out of the audit of a change
+var Guard sync.Locker = &sync.Mutex{}
+
+// Watcher publishes the differences in the state of a namespace between checks,
+// and the downtimes and grants starting or ending by the start and end of their rules.
+// A downtime of a set is a DROP or REJECT rule matching the set as the source,
+// a grant is an ACCEPT rule with an end
+type Watcher struct {
+	NS   resource.NS
+	Bus  *Bus
+	lock sync.Mutex
+	// last is the state at the last check, nil before the first
+	last     *state.State
+	checked  time.Time
+	downtime map[string]iptables.Rule
+	// stop ends checking in the background, nil until started
+	stop context.CancelFunc
+}
+
+func NewWatcher(ns resource.NS, bus *Bus) *Watcher {
+	return &Watcher{NS: ns, Bus: bus, downtime: map[string]iptables.Rule{}}
+}
+
+var (
+	watchersLock sync.Mutex
+	// watchers for each namespace, keyed by namespace name
+	watchers = map[string]*Watcher{}
+)
+
+// Watch is the watcher of the namespace publishing to the Default bus, the first
+// call checks the namespace for the state to compare with and starts checking in
+// the background
+func Watch(ns resource.NS) *Watcher {
+	if w, ok := Watching(ns); ok {
+		return w
+	}
+	w := NewWatcher(ns, Default)
+	if err := w.Check(time.Now()); err != nil {
+		logs.Debugf("failed to check %s: %s\n", ns, err)
+	}
+	return Start(w)
+}
+
+// Watching has the watcher of the namespace if it is watched
+func Watching(ns resource.NS) (*Watcher, bool) {
+	watchersLock.Lock()
+	defer watchersLock.Unlock()
+	w, ok := watchers[ns.Name]
+	return w, ok
+}
+
+// Start has the watcher check its namespace in the background until it is unwatched,
+// unless the namespace already has a watcher, which is returned instead
+func Start(w *Watcher) *Watcher {
+	watchersLock.Lock()
+	defer watchersLock.Unlock()
+	if existing, ok := watchers[w.NS.Name]; ok {
+		return existing
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w.stop = cancel
+	watchers[w.NS.Name] = w
+	go w.Run(ctx)
+	return w
+}
+
+// Unwatch stops checking the namespace, like when it is deleted
+func Unwatch(ns resource.NS) {
+	watchersLock.Lock()
+	defer watchersLock.Unlock()
+	if w, ok := watchers[ns.Name]; ok {
+		w.stop()
+		delete(watchers, ns.Name)
+	}
+}
+
+// path is like /api/v1/netns/gw/ipsets/kids
+func (w *Watcher) path(elems ...string) string {
+	path := "/api/v1/netns/" + w.NS.Name
+	for _, elem := range elems {
+		path += "/" + elem
+	}
+	return path
+}
+
+func (w *Watcher) publish(eventType, path string, rule *iptables.Rule, now time.Time) {
+	w.Bus.Publish(Event{Type: eventType, Time: now, NS: w.NS.Name, Path: path, Rule: rule})
+}
+
+// Check publishes the changes since the last check, the first check only has the state to compare with
+func (w *Watcher) Check(now time.Time) error {
+	current, err := state.Export(w.NS)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", w.NS, err)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	previous, previousChecked, previousDowntime := w.last, w.checked, w.downtime
+	downtime := downtimes(current, now)
+	w.last, w.checked, w.downtime = &current, now, downtime
+	if previous == nil {
+		return nil
+	}
+
+	// members
+	previousMembers, currentMembers := members(*previous), members(current)
+	for _, set := range current.IPSets {
+		for _, member := range set.Members {
+			if !previousMembers[set.Name+" "+member] {
+				w.publish(MEMBER_ADDED, w.path("ipsets", set.Name, "members", member), nil, now)
+			}
+		}
+	}
+	for _, set := range previous.IPSets {
+		for _, member := range set.Members {
+			if !currentMembers[set.Name+" "+member] {
+				w.publish(MEMBER_REMOVED, w.path("ipsets", set.Name, "members", member), nil, now)
+			}
+		}
+	}
+
+	// rules
+	previousRules, currentRules := rules(*previous), rules(current)
+	for _, c := range current.Chains {
+		for _, rule := range c.Rules {
+			if _, ok := previousRules[ruleKey(c, rule)]; !ok {
+				rule := rule
+				w.publish(RULE_CREATED, w.rulePath(c, rule), &rule, now)
+			}
+		}
+	}
+	for _, c := range previous.Chains {
+		for _, rule := range c.Rules {
+			if _, ok := currentRules[ruleKey(c, rule)]; !ok {
+				rule := rule
+				w.publish(RULE_DELETED, w.rulePath(c, rule), &rule, now)
+			}
+		}
+	}
+
+	// the downtimes of the sets, and the grants that ended since the last check
+	for _, set := range sortedKeys(downtime) {
+		if _, ok := previousDowntime[set]; !ok {
+			rule := downtime[set]
+			w.publish(DOWNTIME_STARTED, w.path("ipsets", set), &rule, now)
+		}
+	}
+	for _, set := range sortedKeys(previousDowntime) {
+		if _, ok := downtime[set]; !ok {
+			rule := previousDowntime[set]
+			w.publish(DOWNTIME_ENDED, w.path("ipsets", set), &rule, now)
+		}
+	}
+	for _, c := range previous.Chains {
+		for _, rule := range c.Rules {
+			if rule.Target == iptables.ACCEPT && rule.End != nil && rule.End.After(previousChecked) && !rule.End.After(now) {
+				rule := rule
+				w.publish(GRANT_EXPIRED, w.rulePath(c, rule), &rule, now)
+			}
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) rulePath(c state.Chain, rule iptables.Rule) string {
+	return w.path("iptables", c.Table, "chains", c.Name, "rules", rule.RuleId())
+}
+
+// Next is the next start or end of a rule after the time, zero if there is none
+func (w *Watcher) Next(after time.Time) time.Time {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	next := time.Time{}
+	if w.last == nil {
+		return next
+	}
+	for _, c := range w.last.Chains {
+		for _, rule := range c.Rules {
+			for _, t := range []*time.Time{rule.Start, rule.End} {
+				if t != nil && t.After(after) && (next.IsZero() || t.Before(next)) {
+					next = *t
+				}
+			}
+		}
+	}
+	return next
+}
+
+// Run checks at each start and end of the rules, and at least each INTERVAL, until the context is done
+func (w *Watcher) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		wait := INTERVAL
+		if next := w.Next(now); !next.IsZero() && next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		Guard.Lock()
+		err := w.Check(time.Now())
+		Guard.Unlock()
+		if err != nil {
+			logs.Debugf("%s\n", err)
+		}
+	}
+}
+
+// downtimes has the rules blocking each set at the time
+func downtimes(s state.State, now time.Time) map[string]iptables.Rule {
+	blocked := map[string]iptables.Rule{}
+	for _, c := range s.Chains {
+		for _, rule := range c.Rules {
+			if rule.MatchSetSrc == "" || !slices.Contains(iptables.BlockingTargets, rule.Target) || !rule.Active(now) {
+				continue
+			}
+			if _, ok := blocked[rule.MatchSetSrc]; !ok {
+				blocked[rule.MatchSetSrc] = rule
+			}
+		}
+	}
+	return blocked
+}
+
+func members(s state.State) map[string]bool {
+	found := map[string]bool{}
+	for _, set := range s.IPSets {
+		for _, member := range set.Members {
+			found[set.Name+" "+member] = true
+		}
+	}
+	return found
+}
+
+func ruleKey(c state.Chain, rule iptables.Rule) string {
+	return c.Table + " " + c.Name + " " + rule.RuleId()
+}
+
+func rules(s state.State) map[string]iptables.Rule {
+	found := map[string]iptables.Rule{}
+	for _, c := range s.Chains {
+		for _, rule := range c.Rules {
+			found[ruleKey(c, rule)] = rule
+		}
+	}
+	return found
+}
+
+func sortedKeys(m map[string]iptables.Rule) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -6,13 +6,46 @@ import (
 	"strings"
 )
 
+// Executor runs a command and returns the exit code and combined output
+// with the trailing new lines trimmed
+type Executor interface {
+	Exec(cmd []string) (int, string, error)
+}
+
+// Default runs the commands for Exec and ExecLine
+var Default Executor = System{}
+
 func ExecLine(cmd string) (int, string, error) {
 	return Exec(strings.Split(cmd, " "))
 }
 
+func Exec(cmd []string) (int, string, error) {
+	return Default.Exec(cmd)
+}
+
+// CommandError is for a command that ran and had a non-zero exit code,
+// the code and output are kept so the failure can be classified
+type CommandError struct {
+	Cmd  string
+	Code int
+	Out  string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("`%s` failed with exit code %d: %s", e.Cmd, e.Code, e.Out)
+}
+
+// ExitError is the error for a command that ran and had a non-zero exit code
+func ExitError(cmd []string, code int, out string) error {
+	return &CommandError{Cmd: strings.Join(cmd, " "), Code: code, Out: out}
+}
+
+// System runs the commands on the host using os/exec
+type System struct{}
+
 // Exec will trim the trailing new line
 // TODO: add variadic option parameter to keep trailing newline
-func Exec(cmd []string) (int, string, error) {
+func (System) Exec(cmd []string) (int, string, error) {
 	c := exec.Command(cmd[0], cmd[1:]...)
 	out, err := c.CombinedOutput()
 	outString := ""
@@ -24,10 +57,7 @@ func Exec(cmd []string) (int, string, error) {
 	})
 	switch t := err.(type) {
 	case *exec.ExitError:
-		return t.ExitCode(), outString, fmt.Errorf(
-			"`%s` failed with exit code %d: %s",
-			c.String(), t.ExitCode(), string(outString),
-		)
+		return t.ExitCode(), outString, &CommandError{Cmd: c.String(), Code: t.ExitCode(), Out: outString}
 	case error:
 		return 1, outString, fmt.Errorf(
 			"failed to run `%s`: %w", c.String(), err,
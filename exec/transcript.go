@@ -0,0 +1,142 @@
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// Transcript is the commands that were run in order along with their results,
+// saved as JSON so they can be kept in testdata and replayed
+type Transcript struct {
+	Commands []Command `json:"commands"`
+}
+
+type Command struct {
+	Cmd  []string `json:"cmd"`
+	Out  string   `json:"out"`
+	Code int      `json:"code"`
+}
+
+func LoadTranscript(path string) (Transcript, error) {
+	transcript := Transcript{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return transcript, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return transcript, fmt.Errorf("failed to parse transcript '%s': %w", path, err)
+	}
+	return transcript, nil
+}
+
+func (t Transcript) Save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Recorder runs the commands with the Executor and keeps the results in the Transcript
+type Recorder struct {
+	Executor
+	Transcript
+	lock sync.Mutex
+}
+
+func NewRecorder(executor Executor) *Recorder {
+	return &Recorder{Executor: executor}
+}
+
+func (r *Recorder) Exec(cmd []string) (int, string, error) {
+	code, out, err := r.Executor.Exec(cmd)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Commands = append(r.Commands, Command{Cmd: cmd, Out: out, Code: code})
+	return code, out, err
+}
+
+// Replayer has the results from a Transcript for the same commands in the same order
+type Replayer struct {
+	Transcript
+	next int
+	lock sync.Mutex
+}
+
+func NewReplayer(transcript Transcript) *Replayer {
+	return &Replayer{Transcript: transcript}
+}
+
+func LoadReplayer(path string) (*Replayer, error) {
+	transcript, err := LoadTranscript(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(transcript), nil
+}
+
+func (r *Replayer) Exec(cmd []string) (int, string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.next >= len(r.Commands) {
+		return 1, "", fmt.Errorf(
+			"transcript has no more commands, received `%s`", strings.Join(cmd, " "),
+		)
+	}
+	expected := r.Commands[r.next]
+	if !slices.Equal(expected.Cmd, cmd) {
+		return 1, "", fmt.Errorf(
+			"transcript expected command %d to be `%s`, received `%s`",
+			r.next+1, strings.Join(expected.Cmd, " "), strings.Join(cmd, " "),
+		)
+	}
+	r.next++
+	if expected.Code != 0 {
+		return expected.Code, expected.Out, ExitError(cmd, expected.Code, expected.Out)
+	}
+	return 0, expected.Out, nil
+}
+
+// Done fails if some of the commands in the transcript were not replayed
+func (r *Replayer) Done() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.next < len(r.Commands) {
+		return fmt.Errorf(
+			"transcript has %d commands not replayed, next is `%s`",
+			len(r.Commands)-r.next, strings.Join(r.Commands[r.next].Cmd, " "),
+		)
+	}
+	return nil
+}
+
+// FaultInjector runs commands with the Executor except the FailAt command (counting from 1),
+// which fails with the Code and Out without running
+type FaultInjector struct {
+	Executor
+	FailAt int
+	Code   int
+	Out    string
+	count  int
+	lock   sync.Mutex
+}
+
+func NewFaultInjector(executor Executor, failAt int) *FaultInjector {
+	return &FaultInjector{Executor: executor, FailAt: failAt, Code: 1, Out: "injected fault"}
+}
+
+func (f *FaultInjector) Exec(cmd []string) (int, string, error) {
+	f.lock.Lock()
+	f.count++
+	fail := f.count == f.FailAt
+	f.lock.Unlock()
+	if fail {
+		return f.Code, f.Out, ExitError(cmd, f.Code, f.Out)
+	}
+	return f.Executor.Exec(cmd)
+}
@@ -0,0 +1,67 @@
+package exec_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/exec"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	recorder := exec.NewRecorder(exec.System{})
+	if _, _, err := recorder.Exec([]string{"echo", "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, err := recorder.Exec([]string{"false"}); err == nil || code != 1 {
+		t.Fatalf("expected false to fail with exit code 1, got %d", code)
+	}
+	expected := []exec.Command{
+		{Cmd: []string{"echo", "hello"}, Out: "hello"},
+		{Cmd: []string{"false"}, Code: 1},
+	}
+	if !reflect.DeepEqual(recorder.Commands, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorder.Commands)
+	}
+
+	path := filepath.Join(t.TempDir(), "transcript.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	replayer, err := exec.LoadReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, out, err := replayer.Exec([]string{"echo", "hello"}); err != nil || out != "hello" {
+		t.Fatalf("expected hello, got '%s': %v", out, err)
+	}
+	if err := replayer.Done(); err == nil {
+		t.Fatal("expected failure for commands left in the transcript")
+	}
+	if _, _, err := replayer.Exec([]string{"true"}); err == nil {
+		t.Fatal("expected failure for command not in the transcript")
+	}
+	if code, _, err := replayer.Exec([]string{"false"}); err == nil || code != 1 {
+		t.Fatalf("expected replayed false to fail with exit code 1, got %d", code)
+	}
+	if err := replayer.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := replayer.Exec([]string{"false"}); err == nil {
+		t.Fatal("expected failure after the transcript is done")
+	}
+}
+
+func TestFaultInjector(t *testing.T) {
+	faults := exec.NewFaultInjector(exec.System{}, 2)
+	for i, expectFail := range []bool{false, true, false} {
+		code, out, err := faults.Exec([]string{"echo", "hello"})
+		if expectFail {
+			if err == nil || code != 1 || out != "injected fault" {
+				t.Fatalf("expected command %d to fail, got code %d and '%s'", i+1, code, out)
+			}
+		} else if err != nil || out != "hello" {
+			t.Fatalf("expected command %d to succeed, got '%s': %v", i+1, out, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package firewall
+
+import (
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/nftables"
+	"github.com/plockc/gateway/resource"
+)
+
+// IPTables uses the legacy iptables and ipset commands
+type IPTables struct{}
+
+var _ Backend = IPTables{}
+
+func (IPTables) Name() string {
+	return "iptables"
+}
+
+func (IPTables) TableResource(t iptables.Table) resource.Resource {
+	return t.TableResource()
+}
+
+func (IPTables) ChainResource(c iptables.Chain) resource.Resource {
+	return c.ChainResource()
+}
+
+func (IPTables) RuleResource(r iptables.Rule) resource.Resource {
+	return r.RuleResource()
+}
+
+func (IPTables) IPSetResource(s iptables.IPSet) resource.Resource {
+	return s.IPSetResource()
+}
+
+func (IPTables) MemberResource(m iptables.Member) resource.Resource {
+	return m.MemberResource()
+}
+
+// NFTables uses nft, with named sets in place of ipsets
+type NFTables struct{}
+
+var _ Backend = NFTables{}
+
+func (NFTables) Name() string {
+	return "nftables"
+}
+
+func (NFTables) TableResource(t iptables.Table) resource.Resource {
+	return nftables.NewTableResource(t)
+}
+
+func (NFTables) ChainResource(c iptables.Chain) resource.Resource {
+	return nftables.NewChainResource(c)
+}
+
+func (NFTables) RuleResource(r iptables.Rule) resource.Resource {
+	return nftables.NewRuleResource(r)
+}
+
+func (NFTables) IPSetResource(s iptables.IPSet) resource.Resource {
+	return nftables.NewSetResource(s)
+}
+
+func (NFTables) MemberResource(m iptables.Member) resource.Resource {
+	return nftables.NewMemberResource(m)
+}
@@ -0,0 +1,411 @@
+package firewall
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+// Fake keeps tables, chains, rules and sets in memory with the same
+// semantics as iptables, so the handlers can be tested without root
+type Fake struct {
+	lock sync.Mutex
+	// state for each namespace, keyed by namespace name
+	namespaces map[string]*fakeNS
+}
+
+type fakeNS struct {
+	// chain names in order of creation, keyed by table name
+	chains map[string][]string
+	// rules in order, keyed by table and chain name
+	rules map[string][]iptables.Rule
+	// set names in order of creation
+	sets []string
+	// set types, keyed by set name
+	types map[string]string
+	// elements of the members in order of being added, keyed by set name
+	members map[string][]string
+}
+
+var _ Backend = &Fake{}
+
+func NewFake() *Fake {
+	return &Fake{namespaces: map[string]*fakeNS{}}
+}
+
+func (*Fake) Name() string {
+	return "fake"
+}
+
+// Reset removes all the state for all the namespaces
+func (f *Fake) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.namespaces = map[string]*fakeNS{}
+}
+
+// do runs the function with the lock held on the state for the namespace
+func (f *Fake) do(ns resource.NS, fn func(*fakeNS) error) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	state, ok := f.namespaces[ns.Name]
+	if !ok {
+		state = &fakeNS{
+			chains:  map[string][]string{},
+			rules:   map[string][]iptables.Rule{},
+			types:   map[string]string{},
+			members: map[string][]string{},
+		}
+		f.namespaces[ns.Name] = state
+	}
+	return fn(state)
+}
+
+func (state *fakeNS) chainNames(table string) []string {
+	return append(append([]string{}, iptables.BuiltinChains[table]...), state.chains[table]...)
+}
+
+func ruleKey(c iptables.Chain) string {
+	return c.Table.Name + "/" + c.Name
+}
+
+// referenced is true if any rule jumps to the chain or matches the set
+func (state *fakeNS) referenced(isRef func(iptables.Rule) bool) bool {
+	for _, rules := range state.rules {
+		for _, r := range rules {
+			if isRef(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *Fake) TableResource(t iptables.Table) resource.Resource {
+	return FakeTableRes{Table: t, fake: f}
+}
+
+func (f *Fake) ChainResource(c iptables.Chain) resource.Resource {
+	return &FakeChainRes{Chain: c, fake: f}
+}
+
+func (f *Fake) RuleResource(r iptables.Rule) resource.Resource {
+	return &FakeRuleRes{Rule: r, fake: f}
+}
+
+func (f *Fake) IPSetResource(s iptables.IPSet) resource.Resource {
+	return &FakeIPSetRes{IPSet: s, fake: f}
+}
+
+func (f *Fake) MemberResource(m iptables.Member) resource.Resource {
+	return &FakeMemberRes{Member: m, fake: f}
+}
+
+var _ resource.Resource = FakeTableRes{}
+
+// FakeTableRes has the tables that iptables has, which always exist
+type FakeTableRes struct {
+	iptables.Table
+	resource.FailUnimplementedMethods
+	fake *Fake
+}
+
+func (t FakeTableRes) Id() string {
+	return t.Name
+}
+
+func (t FakeTableRes) List() ([]string, error) {
+	return iptables.TableNames(), nil
+}
+
+// Clear removes the rules and the chains that are not built in for every table
+func (t FakeTableRes) Clear() error {
+	return t.fake.do(t.NS, func(state *fakeNS) error {
+		state.rules = map[string][]iptables.Rule{}
+		state.chains = map[string][]string{}
+		return nil
+	})
+}
+
+var _ resource.Resource = FakeChainRes{}
+
+type FakeChainRes struct {
+	iptables.Chain
+	resource.FailUnimplementedMethods
+	fake *Fake
+}
+
+func (c FakeChainRes) Id() string {
+	return c.Name
+}
+
+func (c FakeChainRes) Create() error {
+	return c.fake.do(c.NS, func(state *fakeNS) error {
+		if slices.Contains(state.chainNames(c.Table.Name), c.Name) {
+			return resource.Conflict("chain '%s' already exists in table '%s'", c.Name, c.Table.Name)
+		}
+		state.chains[c.Table.Name] = append(state.chains[c.Table.Name], c.Name)
+		return nil
+	})
+}
+
+func (c FakeChainRes) Delete() error {
+	return c.fake.do(c.NS, func(state *fakeNS) error {
+		return state.deleteChain(c.Table.Name, c.Name)
+	})
+}
+
+func (state *fakeNS) deleteChain(table, chain string) error {
+	i := slices.Index(state.chains[table], chain)
+	if i < 0 {
+		return resource.NotFound("chain '%s' does not exist in table '%s'", chain, table)
+	}
+	if len(state.rules[table+"/"+chain]) > 0 {
+		return resource.Conflict("chain '%s' in table '%s' is not empty", chain, table)
+	}
+	if state.referenced(func(r iptables.Rule) bool {
+		return r.Table.Name == table && r.Target == chain
+	}) {
+		return resource.Conflict("chain '%s' in table '%s' is referenced by a rule", chain, table)
+	}
+	state.chains[table] = slices.Delete(state.chains[table], i, i+1)
+	return nil
+}
+
+func (c FakeChainRes) List() ([]string, error) {
+	var names []string
+	err := c.fake.do(c.NS, func(state *fakeNS) error {
+		names = state.chainNames(c.Table.Name)
+		return nil
+	})
+	return names, err
+}
+
+// Clear deletes all the chains that are not built in
+func (c FakeChainRes) Clear() error {
+	return c.fake.do(c.NS, func(state *fakeNS) error {
+		for _, name := range append([]string{}, state.chains[c.Table.Name]...) {
+			if err := state.deleteChain(c.Table.Name, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+var _ resource.Resource = FakeRuleRes{}
+
+type FakeRuleRes struct {
+	iptables.Rule
+	resource.FailUnimplementedMethods
+	fake *Fake
+}
+
+func (r FakeRuleRes) Id() string {
+	return r.RuleId()
+}
+
+func (r FakeRuleRes) Create() error {
+	return r.fake.do(r.NS, func(state *fakeNS) error {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		chains := state.chainNames(r.Table.Name)
+		if !slices.Contains(chains, r.Chain.Name) {
+			return resource.NotFound("chain '%s' does not exist in table '%s'", r.Chain.Name, r.Table.Name)
+		}
+		if _, ok := iptables.Targets[r.Target]; !ok && !slices.Contains(chains, r.Target) {
+			return resource.NotFound("target '%s' is not a target or chain in table '%s'", r.Target, r.Table.Name)
+		}
+		if r.MatchSetSrc != "" && state.types[r.MatchSetSrc] != iptables.HASH_MAC {
+			return resource.NotFound("set '%s' does not exist as a %s set", r.MatchSetSrc, iptables.HASH_MAC)
+		}
+		if r.MatchSetDst != "" && state.types[r.MatchSetDst] != iptables.HASH_IP {
+			return resource.NotFound("set '%s' does not exist as a %s set", r.MatchSetDst, iptables.HASH_IP)
+		}
+		key := ruleKey(r.Chain)
+		state.rules[key] = append(state.rules[key], r.Rule)
+		return nil
+	})
+}
+
+func (r FakeRuleRes) Delete() error {
+	return r.fake.do(r.NS, func(state *fakeNS) error {
+		key := ruleKey(r.Chain)
+		i := slices.IndexFunc(state.rules[key], func(existing iptables.Rule) bool {
+			return existing.Id == r.Rule.Id
+		})
+		if i < 0 {
+			return resource.NotFound("expected a matching rule for %s", r.RuleId())
+		}
+		state.rules[key] = slices.Delete(state.rules[key], i, i+1)
+		return nil
+	})
+}
+
+func (r FakeRuleRes) List() ([]string, error) {
+	ids := []string{}
+	err := r.fake.do(r.NS, func(state *fakeNS) error {
+		if !slices.Contains(state.chainNames(r.Table.Name), r.Chain.Name) {
+			return resource.NotFound("chain '%s' does not exist in table '%s'", r.Chain.Name, r.Table.Name)
+		}
+		for _, existing := range state.rules[ruleKey(r.Chain)] {
+			ids = append(ids, existing.RuleId())
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func (r FakeRuleRes) Clear() error {
+	return r.fake.do(r.NS, func(state *fakeNS) error {
+		delete(state.rules, ruleKey(r.Chain))
+		return nil
+	})
+}
+
+func (r *FakeRuleRes) Load() error {
+	return r.fake.do(r.NS, func(state *fakeNS) error {
+		for _, existing := range state.rules[ruleKey(r.Chain)] {
+			if existing.Id == r.Rule.Id {
+				// the chain is not kept as it would have come from the same request
+				chain := r.Chain
+				r.Rule = existing
+				r.Chain = chain
+				return nil
+			}
+		}
+		return resource.NotFound("expected a matching rule for %s", r.RuleId())
+	})
+}
+
+var _ resource.Resource = FakeIPSetRes{}
+
+type FakeIPSetRes struct {
+	iptables.IPSet
+	resource.FailUnimplementedMethods
+	fake *Fake
+}
+
+func (s FakeIPSetRes) Id() string {
+	return s.Name
+}
+
+func (s FakeIPSetRes) Create() error {
+	return s.fake.do(s.NS, func(state *fakeNS) error {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if slices.Contains(state.sets, s.Name) {
+			return resource.Conflict("set '%s' already exists", s.Name)
+		}
+		state.sets = append(state.sets, s.Name)
+		state.types[s.Name] = s.SetType()
+		return nil
+	})
+}
+
+func (s FakeIPSetRes) Delete() error {
+	return s.fake.do(s.NS, func(state *fakeNS) error {
+		i := slices.Index(state.sets, s.Name)
+		if i < 0 {
+			return resource.NotFound("set '%s' does not exist", s.Name)
+		}
+		if state.referenced(func(r iptables.Rule) bool {
+			return r.MatchSetSrc == s.Name || r.MatchSetDst == s.Name
+		}) {
+			return resource.Conflict("set '%s' is referenced by a rule", s.Name)
+		}
+		state.sets = slices.Delete(state.sets, i, i+1)
+		delete(state.members, s.Name)
+		delete(state.types, s.Name)
+		return nil
+	})
+}
+
+func (s FakeIPSetRes) List() ([]string, error) {
+	var names []string
+	err := s.fake.do(s.NS, func(state *fakeNS) error {
+		names = append([]string{}, state.sets...)
+		return nil
+	})
+	return names, err
+}
+
+func (s *FakeIPSetRes) LoadType() error {
+	return s.fake.do(s.NS, func(state *fakeNS) error {
+		setType, ok := state.types[s.Name]
+		if !ok {
+			return resource.NotFound("set '%s' does not exist", s.Name)
+		}
+		s.Type = setType
+		return nil
+	})
+}
+
+var _ resource.Resource = FakeMemberRes{}
+
+type FakeMemberRes struct {
+	iptables.Member `json:",inline"`
+	resource.FailUnimplementedMethods
+	fake *Fake
+}
+
+func (m FakeMemberRes) Id() string {
+	return m.Element()
+}
+
+// withSet fails if the set of the member does not exist
+func (m FakeMemberRes) withSet(fn func(*fakeNS) error) error {
+	return m.fake.do(m.NS, func(state *fakeNS) error {
+		if !slices.Contains(state.sets, m.IPSet.Name) {
+			return resource.NotFound("set '%s' does not exist", m.IPSet.Name)
+		}
+		return fn(state)
+	})
+}
+
+func (m FakeMemberRes) Create() error {
+	return m.withSet(func(state *fakeNS) error {
+		if isIP := state.types[m.IPSet.Name] == iptables.HASH_IP; isIP != (m.IP != nil) {
+			return resource.Invalid("%s is the wrong type for %s set '%s'", m.Element(), state.types[m.IPSet.Name], m.IPSet.Name)
+		}
+		if slices.Contains(state.members[m.IPSet.Name], m.Element()) {
+			return resource.Conflict("%s is already in set '%s'", m.Element(), m.IPSet.Name)
+		}
+		state.members[m.IPSet.Name] = append(state.members[m.IPSet.Name], m.Element())
+		return nil
+	})
+}
+
+func (m FakeMemberRes) Delete() error {
+	return m.withSet(func(state *fakeNS) error {
+		i := slices.Index(state.members[m.IPSet.Name], m.Element())
+		if i < 0 {
+			return resource.NotFound("%s is not in set '%s'", m.Element(), m.IPSet.Name)
+		}
+		state.members[m.IPSet.Name] = slices.Delete(state.members[m.IPSet.Name], i, i+1)
+		return nil
+	})
+}
+
+// List is sorted, the same as `ipset save -sorted`
+func (m FakeMemberRes) List() ([]string, error) {
+	ids := []string{}
+	err := m.withSet(func(state *fakeNS) error {
+		ids = append(ids, state.members[m.IPSet.Name]...)
+		return nil
+	})
+	sort.Strings(ids)
+	return ids, err
+}
+
+func (m FakeMemberRes) Clear() error {
+	return m.withSet(func(state *fakeNS) error {
+		delete(state.members, m.IPSet.Name)
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package firewall_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/funcs"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+var testNS = resource.NewNS("fake")
+
+func TestFakeChainsAndRules(t *testing.T) {
+	fake := firewall.NewFake()
+	table := iptables.FilterTable(testNS)
+	chain := iptables.NewChain(table, "downtime")
+	forward := iptables.NewChain(table, "FORWARD")
+	ipSet := iptables.NewIPSet(testNS, "tvs")
+
+	jump := iptables.NewRule(forward)
+	jump.Target = chain.Name
+	drop := iptables.NewRule(chain)
+	drop.Target = iptables.DROP
+	drop.MatchSetSrc = ipSet.Name
+	allow := iptables.NewRule(chain)
+
+	if err := funcs.Do(
+		funcs.ExpectFailFunc("rule with missing chain", fake.RuleResource(drop).Create),
+		fake.ChainResource(chain).Create,
+		funcs.ExpectFailFunc("creating chain again", fake.ChainResource(chain).Create),
+		funcs.ExpectFailFunc("rule with missing set", fake.RuleResource(drop).Create),
+		fake.IPSetResource(ipSet).Create,
+		fake.RuleResource(jump).Create,
+		fake.RuleResource(drop).Create,
+		fake.RuleResource(allow).Create,
+		funcs.ExpectFailFunc("deleting chain with rules", fake.ChainResource(chain).Delete),
+		funcs.ExpectFailFunc("deleting referenced set", fake.IPSetResource(ipSet).Delete),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	chains, err := fake.ChainResource(chain).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(chains, []string{"INPUT", "FORWARD", "OUTPUT", "downtime"}) {
+		t.Fatalf("unexpected chains: %v", chains)
+	}
+
+	ids, err := fake.RuleResource(drop).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{drop.RuleId(), allow.RuleId()}) {
+		t.Fatalf("expected rules in order of creation, got %v", ids)
+	}
+
+	loaded := iptables.Rule{Id: drop.Id, Chain: chain}
+	ruleRes := fake.RuleResource(loaded)
+	if err := ruleRes.(resource.Loader).Load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded = ruleRes.(*firewall.FakeRuleRes).Rule; !reflect.DeepEqual(loaded, drop) {
+		t.Fatalf("expected %v, loaded %v", drop, loaded)
+	}
+
+	if err := funcs.Do(
+		fake.RuleResource(drop).Delete,
+		funcs.ExpectFailFunc("deleting missing rule", fake.RuleResource(drop).Delete),
+		fake.RuleResource(allow).Clear,
+		funcs.ExpectFailFunc("deleting referenced chain", fake.ChainResource(chain).Delete),
+		fake.RuleResource(jump).Delete,
+		fake.ChainResource(chain).Clear,
+		fake.IPSetResource(ipSet).Delete,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if chains, err = fake.ChainResource(chain).List(); err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 3 {
+		t.Fatalf("expected only the built in chains, got %v", chains)
+	}
+}
+
+func TestFakeSets(t *testing.T) {
+	fake := firewall.NewFake()
+	ipSet := iptables.NewIPSet(testNS, "tvs")
+	other := iptables.NewIPSet(resource.NewNS("other"), "tvs")
+	macs := []address.MAC{{0x12, 0, 0, 0, 0, 0x34}, {0x12, 0, 0, 0, 0, 0x12}}
+	members := funcs.Map(macs, func(mac address.MAC) iptables.Member {
+		return iptables.NewMember(ipSet, mac)
+	})
+
+	if err := funcs.Do(
+		funcs.ExpectFailFunc("member of missing set", fake.MemberResource(members[0]).Create),
+		fake.IPSetResource(ipSet).Create,
+		funcs.ExpectFailFunc("creating set again", fake.IPSetResource(ipSet).Create),
+		fake.IPSetResource(other).Create,
+		fake.MemberResource(members[0]).Create,
+		fake.MemberResource(members[1]).Create,
+		funcs.ExpectFailFunc("adding member again", fake.MemberResource(members[1]).Create),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	macIds, err := fake.MemberResource(members[0]).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(macIds, []string{"12:00:00:00:00:12", "12:00:00:00:00:34"}) {
+		t.Fatalf("expected sorted members, got %v", macIds)
+	}
+	otherIds, err := fake.MemberResource(iptables.NewMember(other, macs[0])).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(otherIds) != 0 {
+		t.Fatalf("expected namespaces to have separate sets, got %v", otherIds)
+	}
+
+	if err := funcs.Do(
+		fake.MemberResource(members[0]).Delete,
+		funcs.ExpectFailFunc("deleting missing member", fake.MemberResource(members[0]).Delete),
+		fake.MemberResource(members[0]).Clear,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if macIds, err = fake.MemberResource(members[0]).List(); err != nil {
+		t.Fatal(err)
+	}
+	if len(macIds) != 0 {
+		t.Fatalf("expected no members after clear, got %v", macIds)
+	}
+}
@@ -0,0 +1,133 @@
+package firewall
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+)
+
+// Backend creates the resources for tables, chains, rules and sets
+// using one of the kernel's packet filtering frameworks
+type Backend interface {
+	Name() string
+	TableResource(iptables.Table) resource.Resource
+	ChainResource(iptables.Chain) resource.Resource
+	RuleResource(iptables.Rule) resource.Resource
+	IPSetResource(iptables.IPSet) resource.Resource
+	MemberResource(iptables.Member) resource.Resource
+}
+
+// Default is the backend for namespaces that have not selected one
+var Default Backend = IPTables{}
+
+var (
+	backends = map[string]Backend{}
+	// backend names selected for namespaces, keyed by namespace name
+	selected = map[string]string{}
+	// loaded is when the selections were read from the SelectionFile
+	loaded bool
+	lock   sync.RWMutex
+)
+
+func init() {
+	Register(IPTables{})
+	Register(NFTables{})
+}
+
+// Register makes a backend available for selection by its name
+func Register(backend Backend) {
+	lock.Lock()
+	defer lock.Unlock()
+	backends[backend.Name()] = backend
+}
+
+// Names are the registered backends, sorted
+func Names() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	names := []string{}
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Lookup(name string) (Backend, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	backend, ok := backends[name]
+	if !ok {
+		return nil, resource.NotFound("firewall backend '%s' does not exist", name)
+	}
+	return backend, nil
+}
+
+// Select will have the namespace use the named backend, which is kept in the SelectionFile
+func Select(ns resource.NS, name string) error {
+	if _, err := Lookup(name); err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+	previous, ok := selected[ns.Name]
+	selected[ns.Name] = name
+	if err := save(); err != nil {
+		if ok {
+			selected[ns.Name] = previous
+		} else {
+			delete(selected, ns.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Unselect will have the namespace return to using the Default backend
+func Unselect(ns resource.NS) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if err := load(); err != nil {
+		return err
+	}
+	previous, ok := selected[ns.Name]
+	if !ok {
+		return nil
+	}
+	delete(selected, ns.Name)
+	if err := save(); err != nil {
+		selected[ns.Name] = previous
+		return err
+	}
+	return nil
+}
+
+// For is the backend selected for the namespace, or the Default
+func For(ns resource.NS) Backend {
+	lock.RLock()
+	name, ok := selected[ns.Name]
+	ready := loaded || SelectionFile == ""
+	lock.RUnlock()
+	if !ready {
+		lock.Lock()
+		if err := load(); err != nil {
+			logs.Warnf("failed to load the selected firewall backends: %s\n", err)
+		}
+		name, ok = selected[ns.Name]
+		lock.Unlock()
+	}
+	if !ok {
+		return Default
+	}
+	backend, err := Lookup(name)
+	if err != nil {
+		return Default
+	}
+	return backend
+}
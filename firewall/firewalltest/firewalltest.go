@@ -0,0 +1,21 @@
+package firewalltest
+
+import (
+	"testing"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/resource"
+)
+
+// Use selects a new fake backend for the namespace until the test ends,
+// the new fake replaces the one registered before so the namespace starts empty
+func Use(t testing.TB, ns resource.NS) *firewall.Fake {
+	t.Helper()
+	fake := firewall.NewFake()
+	firewall.Register(fake)
+	if err := firewall.Select(ns, fake.Name()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { firewall.Unselect(ns) })
+	return fake
+}
@@ -0,0 +1,72 @@
+package firewall
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+// RuleOf is the rule of a rule resource from any of the backends, which all embed the rule
+func RuleOf(res resource.Resource) (iptables.Rule, error) {
+	ruleRes, ok := res.(interface{ RuleResource() *iptables.RuleRes })
+	if !ok {
+		return iptables.Rule{}, fmt.Errorf("%T is not a rule", res)
+	}
+	return ruleRes.RuleResource().Rule, nil
+}
+
+// MemberOf is the member of a member resource from any of the backends
+func MemberOf(res resource.Resource) (iptables.Member, error) {
+	memberRes, ok := res.(interface{ MemberResource() *iptables.MemberRes })
+	if !ok {
+		return iptables.Member{}, fmt.Errorf("%T is not a set member", res)
+	}
+	return memberRes.MemberResource().Member, nil
+}
+
+// Rules loads all the managed rules in the chain, in order
+func Rules(fw Backend, chain iptables.Chain) ([]iptables.Rule, error) {
+	ids, err := fw.RuleResource(iptables.NewRule(chain)).List()
+	if err != nil {
+		return nil, err
+	}
+	rules := []iptables.Rule{}
+	for _, id := range ids {
+		ruleId, err := iptables.ParseRuleId(id)
+		if err != nil {
+			return nil, err
+		}
+		res := fw.RuleResource(iptables.Rule{Id: ruleId, Chain: chain})
+		loader, ok := res.(resource.Loader)
+		if !ok {
+			return nil, fmt.Errorf("%s rules cannot be loaded", fw.Name())
+		}
+		if err := loader.Load(); err != nil {
+			return nil, err
+		}
+		rule, err := RuleOf(res)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// HasRule is true if a managed rule in the chain has the same matches and target,
+// the Id and comment are not compared
+func HasRule(fw Backend, rule iptables.Rule) (bool, error) {
+	rules, err := Rules(fw, rule.Chain)
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range rules {
+		existing.Id, existing.Comment = rule.Id, rule.Comment
+		if strings.Join(existing.Args(), " ") == strings.Join(rule.Args(), " ") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,124 @@
+package firewall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/plockc/gateway/resource"
+)
+
+// SelectionFile keeps the backends selected for the namespaces so they are still used after
+// a restart, as the tables and sets are only found by the backend that created them.
+// The selections are only in memory if it is empty
+var SelectionFile = ""
+
+// Load reads the selections of the SelectionFile again, replacing those in memory
+func Load() error {
+	lock.Lock()
+	defer lock.Unlock()
+	loaded = false
+	return load()
+}
+
+// load reads the SelectionFile the first time it is needed, with the lock held.
+// It is only read once even if it fails, so the error is not repeated for each lookup
+func load() error {
+	if loaded || SelectionFile == "" {
+		return nil
+	}
+	loaded = true
+	data, err := os.ReadFile(SelectionFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved := map[string]string{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", SelectionFile, err)
+	}
+	for ns, name := range saved {
+		selected[ns] = name
+	}
+	return nil
+}
+
+// save replaces the SelectionFile so it is never partly written, with the lock held
+func save() error {
+	if SelectionFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(selected, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(SelectionFile)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".firewall-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), SelectionFile)
+}
+
+// Selection is a firewall backend for a namespace, the one that is
+// selected is the only one that exists for the resource lifecycle
+type Selection struct {
+	Backend     string `json:"-"`
+	resource.NS `json:"-"`
+}
+
+func NewSelection(ns resource.NS, backend string) Selection {
+	return Selection{Backend: backend, NS: ns}
+}
+
+func (s Selection) SelectionResource() *SelectionRes {
+	return &SelectionRes{Selection: s}
+}
+
+func (s Selection) String() string {
+	return s.NS.String() + ":firewall[" + s.Backend + "]"
+}
+
+var _ resource.Resource = SelectionRes{}
+
+type SelectionRes struct {
+	Selection
+	resource.FailUnimplementedMethods
+}
+
+func (s SelectionRes) Id() string {
+	return s.Backend
+}
+
+func (s SelectionRes) Create() error {
+	return Select(s.NS, s.Backend)
+}
+
+// Delete returns the namespace to the Default backend
+func (s SelectionRes) Delete() error {
+	return Unselect(s.NS)
+}
+
+func (s SelectionRes) List() ([]string, error) {
+	return []string{For(s.NS).Name()}, nil
+}
+
+func (s SelectionRes) Clear() error {
+	return Unselect(s.NS)
+}
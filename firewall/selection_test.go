@@ -0,0 +1,47 @@
+package firewall_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestSelectionFile(t *testing.T) {
+	defer func(file string) { firewall.SelectionFile = file }(firewall.SelectionFile)
+	dir := t.TempDir()
+	firewall.SelectionFile = filepath.Join(dir, "data", "firewall.json")
+	if err := firewall.Load(); err != nil {
+		t.Fatalf("expected no selections before the first, got %v", err)
+	}
+	ns := resource.NewNS("selected")
+	if err := firewall.Select(ns, firewall.NFTables{}.Name()); err != nil {
+		t.Fatal(err)
+	}
+	defer firewall.Unselect(ns)
+
+	// the selections are read from the file after a restart
+	saved, err := os.ReadFile(firewall.SelectionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := firewall.Unselect(ns); err != nil {
+		t.Fatal(err)
+	}
+	if name := firewall.For(ns).Name(); name != firewall.Default.Name() {
+		t.Fatalf("expected the default after unselecting, got %s", name)
+	}
+	restarted := filepath.Join(dir, "restarted.json")
+	if err := os.WriteFile(restarted, saved, 0600); err != nil {
+		t.Fatal(err)
+	}
+	firewall.SelectionFile = restarted
+	if err := firewall.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if name := firewall.For(ns).Name(); name != (firewall.NFTables{}).Name() {
+		t.Fatalf("expected %s selected after loading, got %s", firewall.NFTables{}.Name(), name)
+	}
+}
@@ -0,0 +1,45 @@
+package firewall
+
+import (
+	"fmt"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+// IPSetOf is the set of a set resource from any of the backends, which all embed the set
+func IPSetOf(res resource.Resource) (iptables.IPSet, error) {
+	setRes, ok := res.(interface{ IPSetResource() *iptables.IPSetRes })
+	if !ok {
+		return iptables.IPSet{}, fmt.Errorf("%T is not a set", res)
+	}
+	return setRes.IPSetResource().IPSet, nil
+}
+
+// IPSets has the sets of the namespace with their types
+func IPSets(fw Backend, ns resource.NS) ([]iptables.IPSet, error) {
+	names, err := fw.IPSetResource(iptables.NewIPSet(ns, "")).List()
+	if err != nil {
+		return nil, err
+	}
+	sets := []iptables.IPSet{}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		res := fw.IPSetResource(iptables.NewIPSet(ns, name))
+		loader, ok := res.(interface{ LoadType() error })
+		if !ok {
+			return nil, fmt.Errorf("%s sets cannot load their type", fw.Name())
+		}
+		if err := loader.LoadType(); err != nil {
+			return nil, err
+		}
+		set, err := IPSetOf(res)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
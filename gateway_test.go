@@ -2,15 +2,23 @@ package gateway_test
 
 import (
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/attempts"
+	"github.com/plockc/gateway/bootstrap"
 	"github.com/plockc/gateway/exec"
 	"github.com/plockc/gateway/funcs"
 	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/notice"
 	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/throttle"
 )
 
 func init() {
@@ -178,6 +186,165 @@ func TestSetAllow(t *testing.T) {
 	}
 }
 
+// test the bootstrap masquerades, the server has no route back to the client
+func TestBootstrap(t *testing.T) {
+	ClearIPTables(gw, t)
+	serverRunner := server.Runner()
+	clientRunner := client.Runner()
+	b := bootstrap.NewBootstrap(gw)
+	// clears every table, including the masquerade in nat
+	defer resource.NewLifecycle(iptables.NewTableResource(iptables.FilterTable(gw))).Clear()
+	defer serverRunner.RunLine("ip route add default via " + gwWanIP.IP.String() + " dev wan-peer")
+	if err := funcs.Do(
+		serverRunner.BatchLinesFunc("ip route del default"),
+		funcs.ExpectFailFunc("ping server", clientRunner.BatchLinesFunc(PingCmd(serverIP))),
+		func() error { _, err := b.Ensure(); return err },
+		clientRunner.BatchLinesFunc(PingCmd(serverIP)),
+	); err != nil {
+		t.Error(gw.Runner())
+		t.Error(clientRunner)
+		t.Fatal(err)
+	}
+	status, err := b.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Missing) > 0 {
+		t.Fatalf("expected nothing missing after bootstrap, got %v", status.Missing)
+	}
+	if changed, err := b.Ensure(); err != nil || changed {
+		t.Fatalf("expected bootstrap again to not change anything, got %t, %v", changed, err)
+	}
+}
+
+// test the attempts blocked by a rule are logged
+func TestBlockedAttempts(t *testing.T) {
+	ClearIPTables(gw, t)
+	clientRunner := client.Runner()
+	log := attempts.NewLog()
+	listener, err := attempts.Listen(gw, iptables.NFLOG_GROUP, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	rule := iptables.NewRule(iptables.NewChain(iptables.FilterTable(gw), "FORWARD"))
+	rule.Target = iptables.DROP
+	rule.InInterface = "lan"
+	rule.LogAttempts = true
+	ruleRes := rule.RuleResource()
+	defer resource.NewLifecycle(ruleRes).EnsureDeleted()
+	if err := funcs.Do(
+		ruleRes.Create,
+		funcs.ExpectFailFunc("ping server", clientRunner.BatchLinesFunc(PingCmd(serverIP))),
+	); err != nil {
+		t.Error(gw.Runner())
+		t.Fatal(err)
+	}
+	// the listener may not have received the logged packets yet, its errors are logged
+	var found []attempts.Attempt
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+		if found = log.Query(clientMAC.String(), time.Time{}); len(found) > 0 {
+			break
+		}
+	}
+	if len(found) != 1 || found[0].Destination != serverIP.IP.String() || found[0].Count < 1 {
+		t.Fatalf("expected an attempt from %s to %s, got %v", clientMAC, serverIP.IP, found)
+	}
+}
+
+// test the HTTP of a device in downtime is redirected to the notice and HTTPS is rejected
+func TestNotice(t *testing.T) {
+	ClearIPTables(gw, t)
+	clientRunner := client.Runner()
+	l, err := notice.Listen(gw, iptables.NoticePort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, notice.Handler{NS: gw})
+	rule := iptables.NewRule(iptables.NewChain(iptables.FilterTable(gw), "FORWARD"))
+	rule.Target = iptables.DROP
+	rule.InInterface = "lan"
+	rule.Notice = true
+	rule.Comment = "bedtime"
+	ruleRes := rule.RuleResource()
+	defer resource.NewLifecycle(ruleRes).EnsureDeleted()
+	if err := funcs.Do(
+		ruleRes.Create,
+		clientRunner.BatchLinesFunc("curl -s -m 2 http://"+serverIP.IP.String()+"/"),
+		funcs.ExpectFailFunc("https to server", clientRunner.BatchLinesFunc(
+			"curl -s -m 2 https://"+serverIP.IP.String()+"/",
+		)),
+	); err != nil {
+		t.Error(gw.Runner())
+		t.Fatal(err)
+	}
+	page := clientRunner.Results[0].Out
+	if !strings.Contains(page, "Downtime") || !strings.Contains(page, "bedtime") {
+		t.Fatalf("expected the notice, got %s", page)
+	}
+}
+
+// transfer has the client download the bytes from the server through the gateway
+func transfer(t *testing.T, size int) time.Duration {
+	var l net.Listener
+	if err := server.Enter(func() (err error) {
+		l, err = net.Listen("tcp", serverIP.IP.String()+":5001")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write(make([]byte, size))
+	}()
+	var conn net.Conn
+	if err := client.Enter(func() (err error) {
+		conn, err = net.DialTimeout("tcp", serverIP.IP.String()+":5001", 2*time.Second)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	conn.SetDeadline(start.Add(20 * time.Second))
+	if n, err := io.Copy(io.Discard, conn); err != nil || n != int64(size) {
+		t.Fatalf("expected %d bytes, got %d: %v", size, n, err)
+	}
+	return time.Since(start)
+}
+
+func TestThrottle(t *testing.T) {
+	ClearIPTables(gw, t)
+	set := iptables.NewIPSet(gw, "throttled")
+	limit := throttle.NewLimit(gw, 7)
+	limit.Rate, limit.MatchSetSrc = "256kbit", set.Name
+	defer ClearIPSets(gw, t, set.Name)
+	defer resource.NewLifecycle(limit.LimitResource()).EnsureDeleted()
+	// 64KiB takes about 2 seconds at 256kbit/s
+	size := 64 * 1024
+	if elapsed := transfer(t, size); elapsed > time.Second {
+		t.Fatalf("expected a quick transfer before throttling, took %s", elapsed)
+	}
+	if err := funcs.Do(
+		set.IPSetResource().Create,
+		iptables.NewMember(set, clientMAC).MemberResource().Create,
+		limit.LimitResource().Create,
+	); err != nil {
+		t.Error(gw.Runner())
+		t.Fatal(err)
+	}
+	if elapsed := transfer(t, size); elapsed < time.Second {
+		t.Fatalf("expected a throttled transfer, took %s", elapsed)
+	}
+}
+
 func TestMain(m *testing.M) {
 	// it is the internal client outbound that can get blocked for downtime
 	exitCode := func() int {
@@ -3,3 +3,9 @@ module github.com/plockc/gateway
 go 1.19
 
 require golang.org/x/exp v0.0.0-20221114191408-850992195362
+
+require golang.org/x/sys v0.18.0
+
+require golang.org/x/crypto v0.21.0
+
+require sigs.k8s.io/yaml v1.4.0
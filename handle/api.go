@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/plockc/gateway/logs"
 	"github.com/plockc/gateway/resource"
 	"golang.org/x/exp/slices"
 )
@@ -16,9 +17,27 @@ type Api struct {
 func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	path := req.URL.Path
 
+	// the document is fetched by tools that do not set the content type
+	if path == OPENAPI_PATH && req.Method == http.MethodGet {
+		jsonResponse(w, path, 200, OpenAPI())
+		return
+	}
+
+	// the desired state can be YAML
+	if match := applyRegex.FindStringSubmatch(path); match != nil {
+		applyState(w, req, match[1])
+		return
+	}
+
+	// the browsers streaming the events do not set the content type
+	if path == EVENTS_PATH {
+		streamEvents(w, req)
+		return
+	}
+
 	ct := req.Header.Get("content-type")
 	if ct != "application/json" {
-		fmt.Println(req.Header)
+		logs.Debugf("headers without the content type: %v\n", req.Header)
 		errorResponse(w, path, http.StatusUnsupportedMediaType, fmt.Errorf(
 			"content type 'application/json' required",
 		))
@@ -49,14 +68,88 @@ func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// inside the loop can handle i==len(parts), which is a list request
 	// increment by two as relationship require path with id of parent + relationship name
 	for i := 0; i <= len(parts); i += 2 {
-		// factories just gathers the the number of IDs it needs to construct
-		res, err := handler.Factory(ids...)
+		// the chained factories take an id for each level, up to and including this one
+		levelIds := ids
+		if i/2+1 < len(ids) {
+			levelIds = ids[:i/2+1]
+		}
+		res, err := handler.Resource(levelIds...)
 		if err != nil {
-			errorResponse(w, req.URL.Path, http.StatusMethodNotAllowed, err)
+			errorResponse(w, req.URL.Path, statusFor(err, http.StatusBadRequest), err)
 			return
 		}
 		lc := resource.Lifecycle{Resource: res}
 		switch {
+		// case: a singleton has no ID, it is loaded for a GET and ensured for a PUT
+		// e.g. /api/v1/netns/test/bootstrap
+		case i == len(parts) && (len(parts)%2 == 0) && handler.Singleton:
+			switch req.Method {
+			case http.MethodGet:
+				if !slices.Contains(handler.Allowed, GET_ALLOWED) {
+					errorResponse(w, path, http.StatusMethodNotAllowed, fmt.Errorf(
+						"method '%v' is not allowed for %s", req.Method, handler.Label,
+					))
+					return
+				}
+				if filterable, ok := res.(Filterable); ok {
+					if err := filterable.Filter(req.URL.Query()); err != nil {
+						errorResponse(w, path, statusFor(err, http.StatusBadRequest), err)
+						return
+					}
+				}
+				if loader, ok := res.(resource.Loader); ok {
+					if err := loader.Load(); err != nil {
+						errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
+							"failed to get: %w", err,
+						))
+						return
+					}
+				}
+				linkedResponse(w, req, 200, res, handler.itemLinks(path))
+			case http.MethodPut:
+				if !slices.Contains(handler.Allowed, UPSERT_ALLOWED) {
+					errorResponse(w, path, http.StatusMethodNotAllowed, fmt.Errorf(
+						"method '%v' is not allowed for %s", req.Method, handler.Label,
+					))
+					return
+				}
+				defer req.Body.Close()
+				body, err := io.ReadAll(req.Body)
+				if err != nil {
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
+						"failed to read Body: %w", err,
+					))
+					return
+				}
+				if err = UpdateFromJson(body, res); err != nil {
+					errorResponse(w, path, statusFor(err, http.StatusBadRequest), fmt.Errorf(
+						"failed to process body, make sure it is valid JSON: %w", err,
+					))
+					return
+				}
+				created, err := lc.Ensure()
+				if err != nil {
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
+						"failed to ensure: %w", err,
+					))
+					return
+				}
+				if created {
+					jsonResponse(w, path, 201, nil)
+				} else {
+					jsonResponse(w, path, 200, nil)
+				}
+			default:
+				errorResponse(w, path, http.StatusMethodNotAllowed, fmt.Errorf(
+					"Method "+req.Method+" is not allowed",
+				))
+			}
+		// case: a singleton has no IDs below it
+		case handler.Singleton:
+			errorResponse(w, path, http.StatusNotFound, fmt.Errorf(
+				"%s has no ids or relationships", handler.Label,
+			))
+			return
 		// case: no ID for the requested resource, it's a GET-list() or DELETE-clear() request
 		// e.g. /api/v1/ns/test/ipsets/tvs (6 parts, so %2 == 0)
 		case i == len(parts) && (len(parts)%2 == 0):
@@ -71,11 +164,15 @@ func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				}
 				list, err := res.List()
 				if err != nil {
-					errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
 						"failed to list: %w", err,
 					))
 					return
 				}
+				if wantsLinks(req) {
+					jsonResponse(w, path, 200, List{Ids: list, Links: handler.listLinks(path, list)})
+					return
+				}
 				jsonResponse(w, path, 200, list)
 			// handle a DELETE request for a list - e.g. GET /api/v1/ns/test/ipsets/tvs
 			case http.MethodDelete:
@@ -87,7 +184,7 @@ func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				}
 				cleared, err := lc.EnsureCleared()
 				if err != nil {
-					errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
 						"failed to clear: %w", err,
 					))
 					return
@@ -101,33 +198,37 @@ func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			case http.MethodPut:
 				if !slices.Contains(handler.Allowed, UPSERT_ALLOWED) {
 					errorResponse(w, path, http.StatusMethodNotAllowed, fmt.Errorf(
-						"method '%v' is not allowed for %s", req.Method, handler.Name,
+						"method '%v' is not allowed for %s", req.Method, handler.Label,
 					))
 					return
 				}
 				defer req.Body.Close()
 				body, err := io.ReadAll(req.Body)
 				if err != nil {
-					errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
 						"failed to read Body: %w", err,
 					))
 					return
 				}
 				// NOTE: the FooResource() function must return a pointer to a Resource
 				if err = UpdateFromJson(body, res); err != nil {
-					errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+					errorResponse(w, path, statusFor(err, http.StatusBadRequest), fmt.Errorf(
 						"failed to process body, make sure it is valid JSON: %w", err,
 					))
 					return
 				}
-				_, err = lc.Ensure()
+				created, err := lc.Ensure()
 				if err != nil {
-					errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
 						"failed to PUT: %w", err,
 					))
 					return
 				}
-				locationResponse(w, path, 201, req.URL.JoinPath("./"+res.Id()).Path)
+				var data any
+				if created {
+					data = handler.created(res)
+				}
+				locationResponse(w, path, 201, req.URL.JoinPath("./"+res.Id()).Path, data)
 			default:
 				errorResponse(w, path, http.StatusMethodNotAllowed, fmt.Errorf(
 					"unsupported Method: '%s'", req.Method,
@@ -157,21 +258,21 @@ func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				}
 				exists, err := lc.Exists()
 				if err != nil {
-					errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
 						"failed to get: %w", err,
 					))
 					return
 				}
 				if loader, ok := res.(resource.Loader); ok {
 					if err := loader.Load(); err != nil {
-						errorResponse(w, path, 404, err)
+						errorResponse(w, path, statusFor(err, http.StatusNotFound), err)
 						return
 					}
 				}
 				if exists {
-					jsonResponse(w, path, 200, res)
+					linkedResponse(w, req, 200, res, handler.itemLinks(path))
 				} else {
-					errorResponse(w, path, 404, fmt.Errorf("missing %s", path))
+					errorResponse(w, path, http.StatusNotFound, resource.NotFound("missing %s", path))
 				}
 			// handle a DELETE request for a resource - e.g. DELETE /api/v1/ns/test
 			case http.MethodDelete:
@@ -183,7 +284,7 @@ func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				}
 				deleted, err := lc.EnsureDeleted()
 				if err != nil {
-					errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
 						"failed to delete: %w", err,
 					))
 					return
@@ -197,19 +298,32 @@ func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			case http.MethodPut:
 				if !slices.Contains(handler.Allowed, UPSERT_ALLOWED) {
 					errorResponse(w, path, http.StatusMethodNotAllowed, fmt.Errorf(
-						"method '%v' is not allowed for %s", req.Method, handler.Name,
+						"method '%v' is not allowed for %s", req.Method, handler.Label,
+					))
+					return
+				}
+				body, err := io.ReadAll(req.Body)
+				if err != nil {
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
+						"failed to read Body: %w", err,
+					))
+					return
+				}
+				if err = UpdateFromJson(body, res); err != nil {
+					errorResponse(w, path, statusFor(err, http.StatusBadRequest), fmt.Errorf(
+						"failed to process body, make sure it is valid JSON: %w", err,
 					))
 					return
 				}
 				created, err := lc.Ensure()
 				if err != nil {
-					errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+					errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf(
 						"failed to ensure: %w", err,
 					))
 					return
 				}
 				if created {
-					jsonResponse(w, path, 201, nil)
+					jsonResponse(w, path, 201, handler.created(res))
 				} else {
 					jsonResponse(w, path, 200, nil)
 				}
@@ -225,9 +339,8 @@ func (api Api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			var ok bool
 			handler, ok = handler.Relationships[relation]
 			if !ok {
-				errorResponse(w, path, http.StatusBadRequest, fmt.Errorf(
-					"relationship %s does not exist", relation,
-				))
+				err := resource.NotFound("relationship %s does not exist", relation)
+				errorResponse(w, path, statusFor(err, http.StatusBadRequest), err)
 				return
 			}
 		}
@@ -0,0 +1,105 @@
+package handle
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+	"golang.org/x/exp/slices"
+)
+
+// applyRegex is the path of a POST of the desired state of a network namespace
+var applyRegex = regexp.MustCompile(`^/api/v1/netns/([^/]+)/apply$`)
+
+// APPLY_CONTENT_TYPES are the types of the desired state, YAML or JSON
+var APPLY_CONTENT_TYPES = []string{"application/json", "application/yaml", "application/x-yaml", "text/yaml"}
+
+// Applied has the changes made for the desired state, or that would be made for a dry run
+type Applied struct {
+	Changes []state.Change `json:"changes"`
+	DryRun  bool           `json:"dryRun"`
+}
+
+// applyState makes the namespace the desired state in the body, the prune and dryRun
+// query parameters are the state.Options
+func applyState(w http.ResponseWriter, req *http.Request, nsName string) {
+	path := req.URL.Path
+	if req.Method != http.MethodPost {
+		errorResponse(w, path, http.StatusMethodNotAllowed, fmt.Errorf("method '%s' is not allowed, only POST", req.Method))
+		return
+	}
+	if !nsNameRegex.MatchString(nsName) {
+		errorResponse(w, path, http.StatusBadRequest, resource.Invalid("'%s' is not a name of a network namespace", nsName))
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if !slices.Contains(APPLY_CONTENT_TYPES, contentType) {
+		errorResponse(w, path, http.StatusUnsupportedMediaType, fmt.Errorf(
+			"content type '%s' is not one of %v", contentType, APPLY_CONTENT_TYPES,
+		))
+		return
+	}
+	opts := state.Options{}
+	for name, opt := range map[string]*bool{"prune": &opts.Prune, "dryRun": &opts.DryRun} {
+		value := req.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		var err error
+		if *opt, err = strconv.ParseBool(value); err != nil {
+			errorResponse(w, path, http.StatusBadRequest, resource.Invalid("%s '%s' is not true or false", name, value))
+			return
+		}
+	}
+	defer req.Body.Close()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf("failed to read Body: %w", err))
+		return
+	}
+	desired, err := state.Parse(body)
+	if err != nil {
+		errorResponse(w, path, statusFor(err, http.StatusBadRequest), err)
+		return
+	}
+	changes, err := state.Reconcile(resource.NewNS(nsName), desired, opts)
+	if err != nil {
+		errorResponse(w, path, statusFor(err, http.StatusInternalServerError), fmt.Errorf("failed to apply: %w", err))
+		return
+	}
+	jsonResponse(w, path, 200, Applied{Changes: changes, DryRun: opts.DryRun})
+}
+
+// addApply documents the POST of the desired state
+func (doc *OpenAPIDoc) addApply() {
+	stateType, appliedType := reflect.TypeOf(state.State{}), reflect.TypeOf(Applied{})
+	stateSchema := ref(doc.schemaName(stateType, typeSchema(stateType)))
+	content := map[string]MediaType{}
+	for _, contentType := range APPLY_CONTENT_TYPES {
+		content[contentType] = MediaType{Schema: stateSchema}
+	}
+	flag := func(name, description string) Parameter {
+		return Parameter{Name: name, In: "query", Description: description, Schema: Schema{"type": "boolean"}}
+	}
+	doc.Paths["/api/{version}/netns/{netns}/apply"] = map[string]Operation{"post": {
+		Summary:     "make the sets, members, chains and rules of the network namespace the desired state",
+		OperationId: "applyState",
+		Parameters: []Parameter{
+			{Name: "version", In: "path", Required: true, Schema: Versions.IdParam.schema()},
+			{Name: "netns", In: "path", Description: Namespaces.IdParam.Description, Required: true, Schema: Namespaces.IdParam.schema()},
+			flag("prune", "delete the members and managed rules of the sets and chains in the desired state that are not in it"),
+			flag("dryRun", "only respond with the changes, without making them"),
+		},
+		RequestBody: &RequestBody{Required: true, Content: content},
+		Responses: map[string]Response{
+			"200":     {Description: "the changes", Content: jsonContent(ref(doc.schemaName(appliedType, typeSchema(appliedType))))},
+			"default": {Description: "the error", Content: jsonContent(ref("Error"))},
+		},
+	}}
+}
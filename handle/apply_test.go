@@ -0,0 +1,67 @@
+package handle_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plockc/gateway/handle"
+)
+
+func postState(t *testing.T, query, contentType, body string, expectedCode int) handle.Applied {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/netns/test/apply"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := NewTestResponseWriter()
+	handle.Api{}.ServeHTTP(w, req)
+	if w.Code != expectedCode {
+		Failf(t, "expected %d, got %d: %s", expectedCode, w.Code, w.Body)
+	}
+	applied := handle.Applied{}
+	if expectedCode == http.StatusOK {
+		if err := json.Unmarshal(w.Body, &applied); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return applied
+}
+
+func TestApply(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		doc := "ipsets:\n- name: apply\n  members: [12:12:12:12:12:12]\n"
+		t.Run("dry run", func(t *testing.T) {
+			applied := postState(t, "?dryRun=true", "application/yaml", doc, 200)
+			if !applied.DryRun || len(applied.Changes) != 2 {
+				t.Fatalf("expected the set and member to be created, got %+v", applied)
+			}
+			AssertHandlerFail(t, http.MethodGet, "/api/v1/netns/test/ipsets/apply", nil, 404)
+		})
+
+		t.Run("apply", func(t *testing.T) {
+			applied := postState(t, "", "application/yaml", doc, 200)
+			if applied.DryRun || len(applied.Changes) != 2 {
+				t.Fatalf("expected the set and member to be created, got %+v", applied)
+			}
+			AssertHandler[any](t, http.MethodGet, "/api/v1/netns/test/ipsets/apply/members/12:12:12:12:12:12", nil, 200)
+		})
+
+		// pruning only deletes from the sets and chains in the state, so the other tests are kept
+		t.Run("JSON", func(t *testing.T) {
+			applied := postState(t, "?prune=true", "application/json", `{"ipsets": [{"name": "apply", "members": ["12:12:12:12:12:12"]}]}`, 200)
+			if len(applied.Changes) != 0 {
+				t.Fatalf("expected no changes, got %+v", applied)
+			}
+		})
+
+		t.Run("invalid state", func(t *testing.T) {
+			postState(t, "", "application/yaml", "ipsets: [{name: apply, members: [tv]}]", 400)
+			postState(t, "?prune=maybe", "application/yaml", doc, 400)
+			postState(t, "", "text/plain", doc, 415)
+			AssertHandlerFail(t, http.MethodGet, "/api/v1/netns/test/apply", nil, 405)
+			AssertHandlerFail(t, http.MethodPost, "/api/v1/netns/.hidden/apply", nil, 400)
+		})
+
+		AssertHandler[any](t, http.MethodDelete, "/api/v1/netns/test/ipsets/apply", nil, 204)
+	})
+}
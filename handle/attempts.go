@@ -0,0 +1,31 @@
+package handle
+
+import (
+	"github.com/plockc/gateway/attempts"
+	"github.com/plockc/gateway/resource"
+)
+
+func AttemptsChainedFactory(q *attempts.Query) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(string) (resource.Resource, error) {
+			return q.AttemptsResource(), nil
+		}
+		return NSChainedFactory(&q.NS), factory
+	}
+}
+
+// BlockedAttempts has the attempts logged by the rules, filtered with
+// the mac and since query parameters
+var BlockedAttempts = Resources{
+	Label: "Blocked Attempts",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		q := attempts.Query{}
+		return AttemptsChainedFactory(&q)()
+	},
+	Singleton: true,
+	Allowed:   []Allowed{GET_ALLOWED},
+	QueryParams: []Param{
+		{Name: "mac", Description: "only the attempts of the device", Pattern: MAC_PATTERN},
+		{Name: "since", Description: "only the attempts after the time", Format: "date-time"},
+	},
+}
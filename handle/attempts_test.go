@@ -0,0 +1,40 @@
+package handle_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/attempts"
+)
+
+func TestBlockedAttemptsHandler(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		log := attempts.For(testNS)
+		defer log.Reset()
+		start := time.Now().UTC().Truncate(time.Hour).Add(15 * time.Minute)
+		log.Add("12:12:12:12:12:AB", "44.44.44.44", start)
+		log.Add("12:12:12:12:12:AB", "44.44.44.44", start.Add(time.Hour))
+		log.Add("12:12:12:12:12:CD", "44.44.44.44", start.Add(time.Hour))
+
+		t.Run("all attempts", func(t *testing.T) {
+			q := AssertHandler[attempts.Query](t, http.MethodGet, "/api/v1/netns/test/blocked-attempts", nil, 200)
+			if len(q.Attempts) != 3 {
+				t.Fatalf("expected 3 attempts, got %v", q.Attempts)
+			}
+		})
+
+		t.Run("attempts for a mac since an hour", func(t *testing.T) {
+			since := start.Add(time.Hour).Truncate(time.Hour).Format(time.RFC3339)
+			q := AssertHandler[attempts.Query](t, http.MethodGet,
+				"/api/v1/netns/test/blocked-attempts?mac=12:12:12:12:12:ab&since="+since, nil, 200)
+			if len(q.Attempts) != 1 || q.Attempts[0].MAC != "12:12:12:12:12:AB" || q.Attempts[0].Count != 1 {
+				t.Fatalf("expected one attempt, got %v", q.Attempts)
+			}
+		})
+
+		t.Run("bad since", func(t *testing.T) {
+			AssertHandlerFail(t, http.MethodGet, "/api/v1/netns/test/blocked-attempts?since=yesterday", nil, 400)
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package handle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/audit"
+	"github.com/plockc/gateway/auth"
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+)
+
+// AuditFile has the records of the changes made through the API, no audit if empty
+var AuditFile = ""
+
+// AuditLog is where the changes are recorded and found by the audit GETs, nil without an AuditFile
+var AuditLog *audit.Log
+
+// changing has one change at a time so the commands of each are recorded alone,
+// the other requests run together while there is no change
+var changing sync.RWMutex
+
+// Auditing records each change with the user that made it and the commands run by the Commands
+type Auditing struct {
+	Log      *audit.Log
+	Commands *audit.Commands
+	Next     http.Handler
+}
+
+func (a Auditing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// the stream of the events does not run commands, and would hold back the changes
+	if req.URL.Path == EVENTS_PATH {
+		a.Next.ServeHTTP(w, req)
+		return
+	}
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		changing.RLock()
+		defer changing.RUnlock()
+		a.Next.ServeHTTP(w, req)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		errorResponse(w, req.URL.Path, http.StatusInternalServerError, fmt.Errorf("failed to read Body: %w", err))
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	changing.Lock()
+	defer changing.Unlock()
+	record := audit.Record{
+		Time: time.Now(), Remote: req.RemoteAddr, Method: req.Method,
+		Path: req.URL.Path, Query: req.URL.RawQuery, Body: string(body),
+	}
+	if user, ok := auth.UserOf(req.Context()); ok {
+		record.Caller = user.Name
+	}
+	recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	a.Commands.Start()
+	a.Next.ServeHTTP(recorder, req)
+	record.Code, record.Commands = recorder.code, a.Commands.Stop()
+	if err := a.Log.Append(record); err != nil {
+		logs.Warnf("failed to audit %s %s: %s\n", req.Method, req.URL.Path, err)
+	}
+}
+
+// Audit has the changes made through the API, filtered with the from, to, path and caller
+// query parameters
+var Audit = Resources{
+	Label: "Audit",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		factory := func(string) (resource.Resource, error) {
+			if AuditLog == nil {
+				return nil, resource.NotFound("the changes are not audited")
+			}
+			return AuditLog.QueryResource(), nil
+		}
+		return VersionChainedFactory, factory
+	},
+	Singleton: true,
+	Allowed:   []Allowed{GET_ALLOWED},
+	QueryParams: []Param{
+		{Name: "from", Description: "only the changes at or after the time", Format: "date-time"},
+		{Name: "to", Description: "only the changes before the time", Format: "date-time"},
+		{Name: "path", Description: "only the changes of paths starting with the prefix"},
+		{Name: "caller", Description: "only the changes made by the user"},
+	},
+}
@@ -0,0 +1,103 @@
+package handle_test
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/plockc/gateway/audit"
+	"github.com/plockc/gateway/auth"
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestAuditing(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		ClearIPSets(testNS, t, "audited")
+		forward := iptables.NewChain(iptables.FilterTable(testNS), "FORWARD")
+		defer func() {
+			if err := fw().RuleResource(iptables.NewRule(forward)).Clear(); err != nil {
+				t.Error(err)
+			}
+			ClearIPSets(testNS, t, "audited")
+		}()
+		host, restore := useHostExecutor()
+		defer restore()
+		commands := audit.NewCommands(host)
+		resource.DefaultExecutor = commands
+		handle.AuditLog = audit.NewLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+		defer func() { handle.AuditLog = nil }()
+		api := handle.Auditing{Log: handle.AuditLog, Commands: commands, Next: handle.Api{}}
+
+		request := func(method, path, body string, user *auth.User) *TestResponseWriter {
+			u, err := url.Parse(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := &http.Request{
+				Method: method, URL: u, Header: http.Header{"Content-Type": {"application/json"}},
+				Body: http.NoBody, RemoteAddr: "192.168.100.20:50000",
+			}
+			if body != "" {
+				req.Body = io.NopCloser(strings.NewReader(body))
+			}
+			if user != nil {
+				req = req.WithContext(auth.WithUser(req.Context(), *user))
+			}
+			w := NewTestResponseWriter()
+			api.ServeHTTP(w, req)
+			return w
+		}
+		parent := &auth.User{Name: "parent", Role: auth.ADMIN}
+		for _, tc := range []struct {
+			method, path, body string
+			user               *auth.User
+			code               int
+		}{
+			{http.MethodPut, "/api/v1/netns/test/ipsets/audited", `{"type": "hash:mac"}`, parent, 201},
+			{http.MethodGet, "/api/v1/netns/test/ipsets/audited", "", parent, 200},
+			{http.MethodPut, "/api/v1/netns/test/iptables/filter/chains/FORWARD/rules",
+				`{"target": "DROP", "matchSetSrc": "audited", "flushConnections": true}`, parent, 201},
+			{http.MethodPut, "/api/v1/netns/test/ipsets/audited/members/12:12:12:12:12:12", "", parent, 201},
+			{http.MethodDelete, "/api/v1/netns/test/ipsets/missing/members/12:12:12:12:12:12", "", nil, 404},
+		} {
+			if w := request(tc.method, tc.path, tc.body, tc.user); w.Code != tc.code {
+				t.Fatalf("%s %s: expected %d, got %d", tc.method, tc.path, tc.code, w.Code)
+			}
+		}
+
+		// only the changes are recorded, with the commands they ran
+		records, err := handle.AuditLog.Query(audit.Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 4 {
+			t.Fatalf("expected 4 changes, got %+v", records)
+		}
+		created, added, failed := records[0], records[2], records[3]
+		if created.Caller != "parent" || created.Code != 201 || created.Body != `{"type": "hash:mac"}` || created.Remote != "192.168.100.20:50000" {
+			t.Fatalf("unexpected record of creating the set %+v", created)
+		}
+		flushed := false
+		for _, c := range added.Commands {
+			flushed = flushed || strings.Contains(strings.Join(c.Cmd, " "), "conntrack -D -s 192.168.100.20")
+		}
+		if !flushed {
+			t.Fatalf("expected the commands of adding the member, got %+v", added.Commands)
+		}
+		if failed.Caller != "" || failed.Code != 404 || failed.Method != http.MethodDelete {
+			t.Fatalf("unexpected record of the failed delete %+v", failed)
+		}
+
+		// the records are found through the API
+		q := AssertHandler[audit.QueryRes](t, http.MethodGet, "/api/v1/audit?caller=parent&path=/api/v1/netns/test/ipsets/audited/", nil, 200)
+		if len(q.Records) != 1 || q.Records[0].Path != added.Path {
+			t.Fatalf("expected the member added by parent, got %+v", q.Records)
+		}
+		AssertHandlerFail(t, http.MethodGet, "/api/v1/audit?from=yesterday", nil, 400)
+	})
+}
@@ -0,0 +1,55 @@
+package handle
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/plockc/gateway/auth"
+	"github.com/plockc/gateway/logs"
+)
+
+// CredentialsFile has the users of the API, anyone can use the API if empty
+var CredentialsFile = ""
+
+// Authenticated only passes on the requests of users with a role allowing them,
+// the mutations are logged with the user that made them
+type Authenticated struct {
+	Credentials auth.Credentials
+	Next        http.Handler
+}
+
+func (a Authenticated) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	user, err := a.Credentials.Authenticate(req)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="gateway"`)
+		errorResponse(w, path, http.StatusUnauthorized, err)
+		return
+	}
+	// any user can see the document of the API
+	if !user.Allowed(req) && !(req.Method == http.MethodGet && path == OPENAPI_PATH) {
+		errorResponse(w, path, http.StatusForbidden, fmt.Errorf(
+			"%s is not allowed to %s %s", user, req.Method, path,
+		))
+		return
+	}
+	req = req.WithContext(auth.WithUser(req.Context(), user))
+	if req.Method == http.MethodGet {
+		a.Next.ServeHTTP(w, req)
+		return
+	}
+	recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	a.Next.ServeHTTP(recorder, req)
+	logs.Infof("%s %s by %s: %d\n", req.Method, path, user, recorder.code)
+}
+
+// statusRecorder keeps the status code written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,106 @@
+package handle_test
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/plockc/gateway/auth"
+	"github.com/plockc/gateway/handle"
+)
+
+func TestAuthenticated(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		ClearIPSets(testNS, t, "kids")
+		defer ClearIPSets(testNS, t, "kids")
+		hash, err := auth.HashPassword("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds := auth.Credentials{}
+		tokens := map[string]string{}
+		for _, u := range []auth.User{
+			{Name: "parent", Role: auth.ADMIN, PasswordHash: hash},
+			{Name: "sitter", Role: auth.VIEWER},
+			{Name: "laptop", Role: auth.DEVICE, Device: "12:12:12:12:12:ab"},
+		} {
+			token, tokenHash, err := auth.NewToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+			u.TokenHash, tokens[u.Name] = tokenHash, token
+			creds[u.Name] = u
+		}
+		// the credentials are saved and loaded as the server would
+		path := filepath.Join(t.TempDir(), "gateway", "credentials.json")
+		if err := creds.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		if creds, err = auth.LoadCredentials(path); err != nil {
+			t.Fatal(err)
+		}
+		api := handle.Authenticated{Credentials: creds, Next: handle.Api{}}
+
+		request := func(method, path string, setAuth func(*http.Request)) int {
+			u, err := url.Parse(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := &http.Request{
+				Method: method, URL: u, Header: http.Header{"Content-Type": {"application/json"}},
+				Body: http.NoBody,
+			}
+			if setAuth != nil {
+				setAuth(req)
+			}
+			w := NewTestResponseWriter()
+			api.ServeHTTP(w, req)
+			return w.Code
+		}
+		bearer := func(name string) func(*http.Request) {
+			return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+tokens[name]) }
+		}
+
+		for _, tc := range []struct {
+			name    string
+			method  string
+			path    string
+			setAuth func(*http.Request)
+			code    int
+		}{
+			{"no credentials", http.MethodGet, "/api/v1/netns/test/ipsets", nil, 401},
+			{"bad token", http.MethodGet, "/api/v1/netns/test/ipsets", func(req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+strings.Repeat("0", 48))
+			}, 401},
+			{"bad password", http.MethodGet, "/api/v1/netns/test/ipsets", func(req *http.Request) {
+				req.SetBasicAuth("parent", "guess")
+			}, 401},
+			{"admin with a password", http.MethodPut, "/api/v1/netns/test/ipsets/kids", func(req *http.Request) {
+				req.SetBasicAuth("parent", "secret")
+			}, 201},
+			{"admin adding a member", http.MethodPut, "/api/v1/netns/test/ipsets/kids/members/12:12:12:12:12:AB",
+				bearer("parent"), 201},
+			{"viewer listing", http.MethodGet, "/api/v1/netns/test/ipsets", bearer("sitter"), 200},
+			{"viewer deleting", http.MethodDelete, "/api/v1/netns/test/ipsets/kids", bearer("sitter"), 403},
+			{"device getting itself", http.MethodGet, "/api/v1/netns/test/ipsets/kids/members/12:12:12:12:12:AB",
+				bearer("laptop"), 200},
+			{"device getting another device", http.MethodGet, "/api/v1/netns/test/ipsets/kids/members/12:12:12:12:12:CD",
+				bearer("laptop"), 403},
+			{"device getting its attempts", http.MethodGet, "/api/v1/netns/test/blocked-attempts?mac=12:12:12:12:12:ab",
+				bearer("laptop"), 200},
+			{"device getting all attempts", http.MethodGet, "/api/v1/netns/test/blocked-attempts", bearer("laptop"), 403},
+			{"device listing", http.MethodGet, "/api/v1/netns/test/ipsets", bearer("laptop"), 403},
+			{"device removing itself", http.MethodDelete, "/api/v1/netns/test/ipsets/kids/members/12:12:12:12:12:AB",
+				bearer("laptop"), 403},
+			{"device getting the document", http.MethodGet, handle.OPENAPI_PATH, bearer("laptop"), 200},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				if code := request(tc.method, tc.path, tc.setAuth); code != tc.code {
+					t.Fatalf("expected %d, got %d", tc.code, code)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package handle
+
+import (
+	"github.com/plockc/gateway/bootstrap"
+	"github.com/plockc/gateway/resource"
+)
+
+func BootstrapChainedFactory(b *bootstrap.Bootstrap) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(string) (resource.Resource, error) {
+			return b.BootstrapResource(), nil
+		}
+		return NSChainedFactory(&b.NS), factory
+	}
+}
+
+func bootstrapChainedFactory() (ChainedFactory, Factory) {
+	b := bootstrap.Bootstrap{}
+	return BootstrapChainedFactory(&b)()
+}
+
+// Bootstrap sets up forwarding, masquerading and the downtime chain,
+// a PUT sets up anything missing and a GET shows the status
+var Bootstrap = Resources{
+	Label:          "Bootstrap",
+	ChainedFactory: bootstrapChainedFactory,
+	Singleton:      true,
+	Allowed:        []Allowed{GET_ALLOWED, UPSERT_ALLOWED},
+}
+
+// Status shows what is missing from the bootstrap
+var Status = Resources{
+	Label:          "Status",
+	ChainedFactory: bootstrapChainedFactory,
+	Singleton:      true,
+	Allowed:        []Allowed{GET_ALLOWED},
+}
+
+func WANChainedFactory(w *bootstrap.WAN) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(string) (resource.Resource, error) {
+			return w.WANResource(), nil
+		}
+		return NSChainedFactory(&w.NS), factory
+	}
+}
+
+// WAN shows the Internet device, its addresses and link state
+var WAN = Resources{
+	Label: "WAN",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		w := bootstrap.WAN{}
+		return WANChainedFactory(&w)()
+	},
+	Singleton: true,
+	Allowed:   []Allowed{GET_ALLOWED},
+}
@@ -0,0 +1,172 @@
+package handle_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/bootstrap"
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+// hostExecutor keeps the forwarding setting and has the routes, addresses, neighbors
+// and connections of a gateway instead of using the host, other commands are passed through
+type hostExecutor struct {
+	exec.Executor
+	forwarding string
+	// noRoute leaves the gateway without a default route so the Internet device is not detected
+	noRoute bool
+}
+
+func (h *hostExecutor) Exec(cmd []string) (int, string, error) {
+	line := strings.Join(cmd, " ")
+	switch {
+	case strings.HasSuffix(line, "sysctl -n "+bootstrap.FORWARDING_SYSCTL):
+		return 0, h.forwarding, nil
+	case strings.HasSuffix(line, "sysctl -w "+bootstrap.FORWARDING_SYSCTL+"=1"):
+		h.forwarding = "1"
+		return 0, bootstrap.FORWARDING_SYSCTL + " = 1", nil
+	case h.noRoute && strings.HasSuffix(line, strings.Join(address.DefaultRouteJsonCmd(), " ")):
+		return 0, "[]", nil
+	case strings.HasSuffix(line, strings.Join(address.DefaultRouteJsonCmd(), " ")):
+		return 0, `[{"dst":"default","gateway":"44.44.0.1","dev":"wan","flags":[]}]`, nil
+	case strings.HasSuffix(line, strings.Join(address.NetInterface("wan").IPAddrJsonCmd(), " ")):
+		return 0, `[{"ifname":"wan","operstate":"UP","address":"aa:bb:cc:dd:ee:ff",` +
+			`"addr_info":[{"family":"inet","local":"44.44.55.55","prefixlen":16}]}]`, nil
+	case strings.HasSuffix(line, strings.Join(address.NeighJsonCmd(), " ")):
+		return 0, `[{"dst":"192.168.100.20","dev":"lan","lladdr":"12:12:12:12:12:12","state":["REACHABLE"]}]`, nil
+	case strings.HasSuffix(line, "ip netns list"):
+		return 0, "test\ngone", nil
+	case strings.HasSuffix(line, "ip netns del gone"):
+		return 0, "", nil
+	case strings.Contains(line, "conntrack -D -s 192.168.100.20"):
+		return 0, "conntrack v1.4.6 (conntrack-tools): 3 flow entries have been deleted.", nil
+	}
+	return h.Executor.Exec(cmd)
+}
+
+func useHostExecutor() (*hostExecutor, func()) {
+	previous := resource.DefaultExecutor
+	host := &hostExecutor{Executor: previous, forwarding: "0"}
+	resource.DefaultExecutor = host
+	return host, func() { resource.DefaultExecutor = previous }
+}
+
+func TestBootstrapHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		host, restore := useHostExecutor()
+		defer restore()
+
+		filter := iptables.FilterTable(testNS)
+		defer func() {
+			for _, chain := range []iptables.Chain{
+				iptables.NewChain(filter, "FORWARD"),
+				iptables.NewChain(iptables.NewTable(testNS, "nat"), "POSTROUTING"),
+			} {
+				if err := fw().RuleResource(iptables.NewRule(chain)).Clear(); err != nil {
+					t.Error(err)
+				}
+			}
+			downtime := fw().ChainResource(iptables.NewChain(filter, iptables.DOWNTIME_CHAIN))
+			if _, err := resource.NewLifecycle(downtime).EnsureDeleted(); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		t.Run("status of a fresh namespace", func(t *testing.T) {
+			status := AssertHandler[bootstrap.Status](t, http.MethodGet, "/api/v1/netns/test/status", nil, 200)
+			if status.Forwarding || status.Masquerade || status.DowntimeChain || status.ForwardJump {
+				t.Fatalf("expected nothing set up, got %+v", status)
+			}
+			if len(status.Missing) != 4 {
+				t.Fatalf("expected 4 missing, got %v", status.Missing)
+			}
+		})
+
+		t.Run("bootstrap", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/bootstrap", nil, 201)
+			if host.forwarding != "1" {
+				t.Fatal("expected forwarding to be enabled")
+			}
+		})
+
+		t.Run("bootstrap again", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/bootstrap", nil, 200)
+		})
+
+		t.Run("status after bootstrap", func(t *testing.T) {
+			status := AssertHandler[bootstrap.Status](t, http.MethodGet, "/api/v1/netns/test/status", nil, 200)
+			if status.InternetDevice != "wan" {
+				t.Fatalf("expected detected Internet device wan, got %s", status.InternetDevice)
+			}
+			if !status.Forwarding || !status.Masquerade || !status.DowntimeChain || !status.ForwardJump {
+				t.Fatalf("expected everything set up, got %+v", status)
+			}
+			if len(status.Missing) != 0 {
+				t.Fatalf("expected nothing missing, got %v", status.Missing)
+			}
+		})
+
+		t.Run("bootstrap rules have fixed ids", func(t *testing.T) {
+			for chain, id := range map[iptables.Chain]uint32{
+				iptables.NewChain(filter, "FORWARD"):                               bootstrap.FORWARD_JUMP_RULE_ID,
+				iptables.NewChain(iptables.NewTable(testNS, "nat"), "POSTROUTING"): bootstrap.MASQUERADE_RULE_ID,
+			} {
+				rules, err := firewall.Rules(fw(), chain)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(rules) != 1 || rules[0].Id != id {
+					t.Fatalf("expected the rule %x in %s, got %v", id, chain, rules)
+				}
+			}
+		})
+
+		t.Run("status does not delete", func(t *testing.T) {
+			AssertHandlerFail(t, http.MethodDelete, "/api/v1/netns/test/status", nil, 405)
+		})
+
+		t.Run("status has no ids", func(t *testing.T) {
+			AssertHandlerFail(t, http.MethodGet, "/api/v1/netns/test/status/wan", nil, 404)
+		})
+	})
+}
+
+func TestWANHandler(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		_, restore := useHostExecutor()
+		defer restore()
+
+		t.Run("detected from the default route", func(t *testing.T) {
+			wan := AssertHandler[bootstrap.WAN](t, http.MethodGet, "/api/v1/netns/test/wan", nil, 200)
+			expected := bootstrap.WAN{
+				Device:    "wan",
+				Detected:  true,
+				MAC:       "aa:bb:cc:dd:ee:ff",
+				OperState: "UP",
+				Addresses: []string{"44.44.55.55/16"},
+			}
+			if !reflect.DeepEqual(*wan, expected) {
+				t.Fatalf("expected %+v, got %+v", expected, *wan)
+			}
+		})
+
+		t.Run("overridden", func(t *testing.T) {
+			defer func() { iptables.InternetDevice = "" }()
+			iptables.InternetDevice = "wan"
+			wan := AssertHandler[bootstrap.WAN](t, http.MethodGet, "/api/v1/netns/test/wan", nil, 200)
+			if wan.Device != "wan" || wan.Detected {
+				t.Fatalf("expected overridden wan, got %+v", *wan)
+			}
+		})
+
+		t.Run("no updates", func(t *testing.T) {
+			AssertHandlerFail(t, http.MethodPut, "/api/v1/netns/test/wan", nil, 405)
+		})
+	})
+}
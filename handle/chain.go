@@ -1,6 +1,7 @@
 package handle
 
 import (
+	"github.com/plockc/gateway/firewall"
 	"github.com/plockc/gateway/iptables"
 	"github.com/plockc/gateway/resource"
 )
@@ -9,14 +10,14 @@ func ChainChainedFactory(chain *iptables.Chain) ChainedFactory {
 	return func() (ChainedFactory, Factory) {
 		factory := func(chainName string) (resource.Resource, error) {
 			(*chain).Name = chainName
-			return chain.ChainResource(), nil
+			return firewall.For(chain.NS).ChainResource(*chain), nil
 		}
 		return TableChainedFactory(&chain.Table), factory
 	}
 }
 
 var Chains = Resources{
-	Name: "IPTable Chain",
+	Label: "IPTable Chain",
 	ChainedFactory: func() (ChainedFactory, Factory) {
 		chain := iptables.Chain{}
 		return ChainChainedFactory(&chain)()
@@ -25,4 +26,5 @@ var Chains = Resources{
 		"rules": Rules,
 	},
 	Allowed: []Allowed{LIST_ALLOWED, DELETE_ALLOWED, GET_ALLOWED, UPSERT_ALLOWED},
+	IdParam: Param{Name: "chain", Description: "name of a builtin chain like FORWARD, or of a created chain"},
 }
@@ -0,0 +1,27 @@
+package handle
+
+import (
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/resource"
+)
+
+func DomainsChainedFactory(d *domains.Domains) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(name string) (resource.Resource, error) {
+			(*d).Name = name
+			return d.DomainsResource(), nil
+		}
+		return NSChainedFactory(&d.NS), factory
+	}
+}
+
+// Domains fill a hash:ip set of the same name with the IPs they resolve to
+var Domains = Resources{
+	Label: "Domains",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		d := domains.Domains{}
+		return DomainsChainedFactory(&d)()
+	},
+	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED, DELETE_ALLOWED, UPSERT_ALLOWED},
+	IdParam: Param{Name: "domains", Description: "name of the domains, which is also the name of the set"},
+}
@@ -0,0 +1,69 @@
+package handle_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestDomainsHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		d := domains.NewDomains(testNS, "homework")
+		// localhost resolves from the hosts file so no DNS server is needed
+		d.Domains = []string{"localhost"}
+		defer domains.Stop(testNS, d.Name)
+
+		t.Run("creating domains", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/domains/homework", d, 201)
+		})
+
+		t.Run("get resolved domains", func(t *testing.T) {
+			res := AssertHandler[domains.DomainsRes](t, http.MethodGet, "/api/v1/netns/test/domains/homework", nil, 200)
+			if len(res.Resolved) != 1 || res.Resolved[0].IP != "127.0.0.1" || res.Resolved[0].Domain != "localhost" {
+				t.Fatalf("expected localhost resolved, got %+v", res)
+			}
+		})
+
+		t.Run("resolved IPs are members of the set", func(t *testing.T) {
+			members := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/ipsets/homework/members", nil, 200)
+			if !reflect.DeepEqual(*members, []string{"127.0.0.1"}) {
+				t.Fatalf("unexpected members %v", *members)
+			}
+		})
+
+		t.Run("rule matching the set as the destination", func(t *testing.T) {
+			rule := iptables.NewRule(iptables.NewChain(iptables.FilterTable(testNS), "FORWARD"))
+			rule.Target, rule.MatchSetDst = iptables.DROP, d.Name
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/iptables/filter/chains/FORWARD/rules", rule, 201)
+			AssertHandlerFailKind(t, http.MethodDelete, "/api/v1/netns/test/domains/homework", nil, 409, resource.CONFLICT)
+			AssertHandler[any](t, http.MethodDelete, "/api/v1/netns/test/iptables/filter/chains/FORWARD/rules/"+rule.RuleId(), nil, 204)
+		})
+
+		t.Run("updating domains", func(t *testing.T) {
+			d := d
+			d.Interval = "10m"
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/domains/homework", d, 200)
+			res := AssertHandler[domains.DomainsRes](t, http.MethodGet, "/api/v1/netns/test/domains/homework", nil, 200)
+			if res.Interval != "10m" {
+				t.Fatalf("expected the interval to be updated, got %+v", res)
+			}
+		})
+
+		t.Run("invalid domains", func(t *testing.T) {
+			AssertHandlerFailKind(t, http.MethodPut, "/api/v1/netns/test/domains/bad", domains.Domains{}, 400, resource.INVALID)
+		})
+
+		t.Run("list and delete domains", func(t *testing.T) {
+			names := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/domains", nil, 200)
+			if !reflect.DeepEqual(*names, []string{"homework"}) {
+				t.Fatalf("unexpected domains %v", *names)
+			}
+			AssertHandler[any](t, http.MethodDelete, "/api/v1/netns/test/domains/homework", nil, 204)
+			AssertHandlerFail(t, http.MethodGet, "/api/v1/netns/test/ipsets/homework", nil, 404)
+		})
+	})
+}
@@ -0,0 +1,164 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/plockc/gateway/events"
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+)
+
+// EVENTS_PATH streams the events of the changes as Server-Sent Events
+const EVENTS_PATH = "/api/v1/events"
+
+// KEEPALIVE is how often a comment is sent while there are no events,
+// so proxies do not close the stream
+var KEEPALIVE = 30 * time.Second
+
+// Publishing checks the namespace after each change made through the API
+// so its events are published without waiting for the next check, and stops
+// watching a namespace when it is deleted
+type Publishing struct {
+	Next http.Handler
+}
+
+func (p Publishing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if deleted, ok := deletedNS(req.URL.Path); ok && req.Method == http.MethodDelete {
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		p.Next.ServeHTTP(recorder, req)
+		if recorder.code < 400 {
+			events.Unwatch(deleted)
+		}
+		return
+	}
+	ns, ok := changedNS(req.URL.Path)
+	if req.Method == http.MethodGet || !ok {
+		p.Next.ServeHTTP(w, req)
+		return
+	}
+	// the state before the change is needed to find what changed, a namespace that is
+	// not yet watched is only watched once a change to it succeeds
+	watcher, watched := events.Watching(ns)
+	if !watched {
+		watcher = events.NewWatcher(ns, events.Default)
+		changing.RLock()
+		err := watcher.Check(time.Now())
+		changing.RUnlock()
+		if err != nil {
+			logs.Debugf("failed to check %s before the change: %s\n", ns, err)
+		}
+	}
+	recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	p.Next.ServeHTTP(recorder, req)
+	if recorder.code >= 400 {
+		return
+	}
+	if !watched {
+		watcher = events.Start(watcher)
+	}
+	changing.RLock()
+	defer changing.RUnlock()
+	if err := watcher.Check(time.Now()); err != nil {
+		logs.Warnf("failed to publish the events of %s: %s\n", ns, err)
+	}
+}
+
+// streamEvents sends the events as they are published, a client reconnecting with the
+// Last-Event-ID header first has the events it missed, or a RESYNC event if they are
+// no longer buffered
+func streamEvents(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	if req.Method != http.MethodGet {
+		errorResponse(w, path, http.StatusMethodNotAllowed, fmt.Errorf("method '%s' is not allowed, only GET", req.Method))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf("the response cannot be streamed"))
+		return
+	}
+	var lastId uint64
+	lastEventId := req.Header.Get("Last-Event-ID")
+	if lastEventId != "" {
+		var err error
+		if lastId, err = strconv.ParseUint(lastEventId, 10, 64); err != nil {
+			errorResponse(w, path, http.StatusBadRequest, resource.Invalid("Last-Event-ID '%s' is not an event id", lastEventId))
+			return
+		}
+	}
+	missed, complete, next, cancel := events.Default.Subscribe(lastId, lastEventId != "")
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if !complete {
+		missed = []events.Event{{Id: events.Default.Last(), Type: events.RESYNC, Time: time.Now()}}
+	}
+	for _, e := range missed {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(KEEPALIVE)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case e, ok := <-next:
+			// the client fell behind, it resumes when it reconnects
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes the event with its id and type, and the event as JSON for the data
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, data)
+	return err
+}
+
+// addEvents documents the stream of the events
+func (doc *OpenAPIDoc) addEvents() {
+	eventType := reflect.TypeOf(events.Event{})
+	doc.Paths["/api/{version}/events"] = map[string]Operation{"get": {
+		Summary: "stream the events of the members, rules, downtimes and grants of all the namespaces as " +
+			"Server-Sent Events, the data of each is the event as JSON",
+		OperationId: "streamEvents",
+		Parameters: []Parameter{
+			{Name: "version", In: "path", Required: true, Schema: Versions.IdParam.schema()},
+			{
+				Name: "Last-Event-ID", In: "header", Schema: Schema{"type": "string"},
+				Description: "resume after the event, a resync event is first if the events after it are no longer kept",
+			},
+		},
+		Responses: map[string]Response{
+			"200": {Description: "the events", Content: map[string]MediaType{
+				"text/event-stream": {Schema: ref(doc.schemaName(eventType, typeSchema(eventType)))},
+			}},
+			"default": {Description: "the error", Content: jsonContent(ref("Error"))},
+		},
+	}}
+}
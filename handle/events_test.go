@@ -0,0 +1,150 @@
+package handle_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/events"
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/resource"
+)
+
+// stream reads the Server-Sent Events of the response
+type stream struct {
+	t       *testing.T
+	scanner *bufio.Scanner
+	cancel  func()
+}
+
+func openStream(t *testing.T, url, lastEventId string) *stream {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+handle.EVENTS_PATH, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected a stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	t.Cleanup(func() { cancel(); resp.Body.Close() })
+	return &stream{t: t, scanner: bufio.NewScanner(resp.Body), cancel: cancel}
+}
+
+// next is the next event, checking the id and type are those of the data
+func (s *stream) next() events.Event {
+	s.t.Helper()
+	fields := map[string]string{}
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if line == "" && len(fields) > 0 {
+			e := events.Event{}
+			if err := json.Unmarshal([]byte(fields["data"]), &e); err != nil {
+				s.t.Fatal(err)
+			}
+			if fields["id"] != strconv.FormatUint(e.Id, 10) || fields["event"] != e.Type {
+				s.t.Fatalf("expected the id and type of %s, got %v", fields["data"], fields)
+			}
+			return e
+		}
+		if name, value, ok := strings.Cut(line, ": "); ok && name != "" {
+			fields[name] = value
+		}
+	}
+	s.t.Fatalf("stream ended: %v", s.scanner.Err())
+	return events.Event{}
+}
+
+// until skips the events of other changes
+func (s *stream) until(eventType, path string) events.Event {
+	s.t.Helper()
+	for {
+		if e := s.next(); e.Type == eventType && e.Path == path {
+			return e
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		ClearIPSets(testNS, t, "events")
+		defer ClearIPSets(testNS, t, "events")
+		server := httptest.NewServer(handle.Publishing{Next: handle.Api{}})
+		// closed after the streams are cancelled
+		t.Cleanup(server.Close)
+		request := func(method, path string) int {
+			t.Helper()
+			req, err := http.NewRequest(method, server.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		send := func(method, path string) {
+			t.Helper()
+			if code := request(method, path); code >= 400 {
+				t.Fatalf("%s %s failed with %d", method, path, code)
+			}
+		}
+
+		s := openStream(t, server.URL, "")
+		member := "/api/v1/netns/test/ipsets/events/members/12:12:12:12:12:AB"
+		send(http.MethodPut, "/api/v1/netns/test/ipsets/events")
+		send(http.MethodPut, member)
+		added := s.until(events.MEMBER_ADDED, member)
+		if added.NS != "test" {
+			t.Fatalf("expected the event of namespace test, got %+v", added)
+		}
+		send(http.MethodDelete, member)
+		s.until(events.MEMBER_REMOVED, member)
+
+		// reconnecting has the events after the last one
+		resumed := openStream(t, server.URL, strconv.FormatUint(added.Id, 10))
+		resumed.until(events.MEMBER_REMOVED, member)
+
+		// the events before the buffer cannot be resumed
+		if e := openStream(t, server.URL, "1").next(); e.Type != events.RESYNC {
+			t.Fatalf("expected a resync, got %+v", e)
+		}
+
+		// a failed change does not watch the namespace, a successful one does
+		if _, ok := events.Watching(testNS); !ok {
+			t.Fatal("expected the namespace to be watched after its changes")
+		}
+		if code := request(http.MethodPut, "/api/v1/netns/typo/ipsets/events"); code < 400 {
+			t.Fatalf("expected the change of a missing namespace to fail, got %d", code)
+		}
+		if _, ok := events.Watching(resource.NewNS("typo")); ok {
+			t.Fatal("expected a missing namespace to not be watched")
+		}
+
+		// a deleted namespace is no longer watched
+		_, restore := useHostExecutor()
+		defer restore()
+		gone := resource.NewNS("gone")
+		events.Watch(gone)
+		send(http.MethodDelete, "/api/v1/netns/gone")
+		if _, ok := events.Watching(gone); ok {
+			t.Fatal("expected the deleted namespace to no longer be watched")
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package handle
+
+import (
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/resource"
+)
+
+func SelectionChainedFactory(selection *firewall.Selection) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(backend string) (resource.Resource, error) {
+			(*selection).Backend = backend
+			return selection.SelectionResource(), nil
+		}
+		return NSChainedFactory(&selection.NS), factory
+	}
+}
+
+// Firewalls selects between iptables and nftables for a namespace,
+// a PUT selects the backend and listing shows the one in use
+var Firewalls = Resources{
+	Label: "Firewall Backend",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		selection := firewall.Selection{}
+		return SelectionChainedFactory(&selection)()
+	},
+	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED, DELETE_ALLOWED, UPSERT_ALLOWED},
+	IdParam: Param{Name: "backend", Description: "iptables or nftables"},
+}
@@ -0,0 +1,50 @@
+package handle_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestFirewallHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		backend := fw().Name()
+		other := "iptables"
+		if backend == other {
+			other = "nftables"
+		}
+		defer firewall.Select(testNS, backend)
+
+		t.Run("list has the backend in use", func(t *testing.T) {
+			data := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/firewall", nil, 200)
+			if data == nil || !reflect.DeepEqual(*data, []string{backend}) {
+				t.Fatalf("expected [%s], got %v", backend, data)
+			}
+		})
+
+		t.Run("selecting the backend in use", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/firewall/"+backend, nil, 200)
+		})
+
+		t.Run("selecting another backend", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/firewall/"+other, nil, 201)
+			if fw().Name() != other {
+				t.Fatalf("expected %s to be selected, got %s", other, fw().Name())
+			}
+		})
+
+		t.Run("selecting a missing backend", func(t *testing.T) {
+			AssertHandlerFailKind(t, http.MethodPut, "/api/v1/netns/test/firewall/missing", nil, 404, resource.NOT_FOUND)
+		})
+
+		t.Run("unselecting returns to the default", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodDelete, "/api/v1/netns/test/firewall/"+other, nil, 204)
+			if fw().Name() != firewall.Default.Name() {
+				t.Fatalf("expected default %s, got %s", firewall.Default.Name(), fw().Name())
+			}
+		})
+	})
+}
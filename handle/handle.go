@@ -1,20 +1,85 @@
 package handle
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
 
+	"github.com/plockc/gateway/audit"
+	"github.com/plockc/gateway/auth"
+	"github.com/plockc/gateway/conntrack"
+	"github.com/plockc/gateway/dashboard"
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/events"
 	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
 )
 
 var NS = resource.NewNS("")
 
+// ListenAddr serves the API with HTTP, or redirects to HTTPS if RedirectHTTP
+var ListenAddr = ":8000"
+
 func Serve() {
-	http.Handle("/api/", Api{})
-	fmt.Println("Listening on :8000")
-	log.Fatal(http.ListenAndServe(":8000", nil))
+	var api http.Handler = Api{}
+	if AuditFile != "" {
+		// the commands of the resources are all run with the DefaultExecutor
+		commands := audit.NewCommands(resource.DefaultExecutor)
+		resource.DefaultExecutor = commands
+		AuditLog = audit.NewLog(AuditFile)
+		api = Auditing{Log: AuditLog, Commands: commands, Next: api}
+	}
+	if SnapshotDir != "" {
+		api = Snapshotting{Snapshots: state.NewSnapshots(SnapshotDir), Next: api}
+	}
+	// the scheduled refreshes of the domains change the sets between the changes of the API
+	domains.Guard = changing.RLocker()
+	// the connections blocked by the rules are flushed when they start, in every namespace
+	conntrack.Guard = changing.RLocker()
+	go conntrack.Schedule(context.Background(), func() ([]resource.NS, error) {
+		return conntrack.Namespaces(NS)
+	})
+	// the gateway namespace is watched from the start for its downtimes and grants
+	events.Guard = changing.RLocker()
+	events.Watch(NS)
+	api = Publishing{Next: api}
+	if CredentialsFile == "" {
+		fmt.Println("No credentials file, anyone can use the API")
+	} else {
+		creds, err := auth.LoadCredentials(CredentialsFile)
+		// a fresh install has no users yet
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Fatalf(
+				"no users in %s, add an admin with '%s user -name NAME -role admin' "+
+					"or let anyone use the API without -credentials", CredentialsFile, os.Args[0],
+			)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		api = Authenticated{Credentials: creds, Next: api}
+	}
+	http.Handle("/api/", api)
+	// the dashboard only uses the API, which authenticates its requests
+	http.Handle("/", dashboard.Handler())
+	if HTTPSAddr == "" {
+		fmt.Println("Listening on", ListenAddr)
+		log.Fatal(http.ListenAndServe(ListenAddr, nil))
+	}
+	var plain http.Handler = http.DefaultServeMux
+	if RedirectHTTP {
+		plain = RedirectToHTTPS{}
+	}
+	go func() {
+		fmt.Println("Listening on", ListenAddr)
+		log.Fatal(http.ListenAndServe(ListenAddr, plain))
+	}()
+	log.Fatal(serveTLS(http.DefaultServeMux))
 }
 
 func UpdateFromJson(body []byte, target any) error {
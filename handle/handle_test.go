@@ -7,10 +7,15 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	osexec "os/exec"
 	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/firewall/firewalltest"
 	"github.com/plockc/gateway/funcs"
 	"github.com/plockc/gateway/handle"
 	"github.com/plockc/gateway/iptables"
@@ -21,6 +26,11 @@ var (
 	testNS = resource.NewNS("test")
 )
 
+// fw is the firewall backend being tested
+func fw() firewall.Backend {
+	return firewall.For(testNS)
+}
+
 func Failf(t *testing.T, errFmt string, args ...any) {
 	namespaces, err := resource.NewNS("").NSResource().List()
 	if err != nil {
@@ -28,13 +38,14 @@ func Failf(t *testing.T, errFmt string, args ...any) {
 	}
 	for _, nsName := range namespaces {
 		ns := resource.NewNS(nsName)
-		sets, err := iptables.NewIPSet(ns, "").NSResource().List()
+		fw := firewall.For(ns)
+		sets, err := fw.IPSetResource(iptables.NewIPSet(ns, "")).List()
 		if err != nil {
 			panic("could not list ip sets for ns " + ns.Name)
 		}
-		t.Logf("Namespace '%s' has IP Sets: %v\n", ns, sets)
+		t.Logf("Namespace '%s' using %s has IP Sets: %v\n", ns, fw.Name(), sets)
 		table := iptables.NewTable(ns, "filter")
-		chains, err := iptables.NewChain(table, "").ChainResource().List()
+		chains, err := fw.ChainResource(iptables.NewChain(table, "")).List()
 		if err != nil {
 			panic("could not list ip filter chains for ns " + ns.Name)
 		}
@@ -123,8 +134,12 @@ func testRequest[T any](t *testing.T, method, path string, bodyObj any, expected
 			if !ok {
 				t.Fatalf("missing error message from %v", errData)
 			}
-			if len(errData) != 1 {
-				t.Fatalf("expected only error in response body, got %v", errData)
+			code, hasCode := errData["code"]
+			if len(errData) != 1 && !(len(errData) == 2 && hasCode) {
+				t.Fatalf("expected only error and code in response body, got %v", errData)
+			}
+			if hasCode {
+				return nil, responseWriter.Headers, resource.WithKind(resource.Kind(fmt.Sprint(code)), fmt.Errorf("%v", msg))
 			}
 			return nil, responseWriter.Headers, fmt.Errorf("%v", msg)
 		} else {
@@ -144,28 +159,84 @@ func AssertHandlerFail(t *testing.T, method, path string, bodyObj any, expectedC
 	}
 }
 
-func TestMain(m *testing.M) {
-	// it is the internal client outbound that can get blocked for downtime
-	exitCode := func() int {
-		testRunner := testNS.Runner()
-		testNSLifecycle := resource.Lifecycle{Resource: testNS.NSResource()}
-		handle.NS = testNS
+// AssertHandlerFailKind also checks the code in the body is the kind of the error
+func AssertHandlerFailKind(t *testing.T, method, path string, bodyObj any, expectedCode int, kind resource.Kind) {
+	_, _, err := testRequest[any](t, method, path, bodyObj, expectedCode)
+	if resource.KindOf(err) != kind {
+		t.Fatalf("expected an error with code '%s', got %v", kind, err)
+	}
+}
 
-		testNSLifecycle.EnsureDeleted()
+// commands needed to test a backend against the kernel in a network namespace
+var integrationCommands = map[string][]string{
+	"iptables": {"iptables", "iptables-save", "ipset"},
+	"nftables": {"nft"},
+}
 
+// unavailable is why a backend cannot be tested against the kernel, which needs root and its commands
+func unavailable(backend string) string {
+	if os.Geteuid() != 0 {
+		return "testing " + backend + " against the kernel requires root"
+	}
+	for _, cmd := range integrationCommands[backend] {
+		if _, err := osexec.LookPath(cmd); err != nil {
+			return "testing " + backend + " against the kernel requires " + cmd
+		}
+	}
+	return ""
+}
+
+var (
+	// testNSOnce creates the test namespace again for the first backend tested against the kernel
+	testNSOnce sync.Once
+	testNSErr  error
+)
+
+func ensureTestNS() error {
+	testNSOnce.Do(func() {
+		testNSLifecycle := resource.NewLifecycle(testNS.NSResource())
 		// every one of these functions can error, use Do to execute, stopping if any fails
 		var ignored bool
-		if err := funcs.Do(
+		testNSErr = funcs.Do(
 			funcs.AssignFunc(testNSLifecycle.EnsureDeleted, &ignored),
 			funcs.AssignFunc(testNSLifecycle.Ensure, &ignored),
-		); err != nil {
-			fmt.Println(testRunner)
-			fmt.Println(err)
-			return 1
-		}
+		)
+	})
+	return testNSErr
+}
 
-		return m.Run()
-	}()
+// forEachBackend runs the test as the handlers need to work the same for every firewall backend,
+// first with a new fake then with the kernel backends, which are skipped when they are unavailable
+func forEachBackend(t *testing.T, test func(t *testing.T)) {
+	t.Run("fake", func(t *testing.T) {
+		firewalltest.Use(t, testNS)
+		test(t)
+	})
+	backends := []string{}
+	for backend := range integrationCommands {
+		backends = append(backends, backend)
+	}
+	sort.Strings(backends)
+	for _, backend := range backends {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			if reason := unavailable(backend); reason != "" {
+				t.Skip(reason)
+			}
+			if err := ensureTestNS(); err != nil {
+				t.Fatalf("failed to create %s: %s", testNS, err)
+			}
+			if err := firewall.Select(testNS, backend); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { firewall.Unselect(testNS) })
+			test(t)
+		})
+	}
+}
 
-	os.Exit(exitCode)
+func TestMain(m *testing.M) {
+	// it is the internal client outbound that can get blocked for downtime
+	handle.NS = testNS
+	os.Exit(m.Run())
 }
@@ -1,55 +1,77 @@
 package handle
 
 import (
-	"fmt"
+	"strings"
+	"time"
 
-	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/conntrack"
+	"github.com/plockc/gateway/firewall"
 	"github.com/plockc/gateway/iptables"
 	"github.com/plockc/gateway/resource"
 )
 
-func NewIPSet(ids ...string) (iptables.IPSet, error) {
-	switch len(ids) {
-	case 0, 1:
-		return iptables.IPSet{}, fmt.Errorf("missing version and/or namespace")
-	case 2:
-		return iptables.NewIPSet(resource.NewNS(ids[1]), ""), nil
-	default:
-		return iptables.NewIPSet(resource.NewNS(ids[1]), ids[2]), nil
+func IPSetChainedFactory(ipSet *iptables.IPSet) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(setName string) (resource.Resource, error) {
+			(*ipSet).Name = setName
+			return firewall.For(ipSet.NS).IPSetResource(*ipSet), nil
+		}
+		return NSChainedFactory(&ipSet.NS), factory
 	}
 }
 
-var IPSets = Resources{
-	Name: "IP Set",
-	Factory: func(ids ...string) (resource.Resource, error) {
-		ipSet, err := NewIPSet(ids...)
-		if err != nil {
-			return nil, err
+func MemberChainedFactory(member *iptables.Member) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		// the id is a MAC for a hash:mac set, or an IP for a hash:ip set
+		factory := func(element string) (resource.Resource, error) {
+			if element != "" {
+				parsed, err := iptables.MemberFromString(member.IPSet, element)
+				if err != nil {
+					return nil, err
+				}
+				(*member).MAC, (*member).IP = parsed.MAC, parsed.IP
+			}
+			return firewall.For(member.NS).MemberResource(*member), nil
 		}
-		return ipSet.IPSetResource(), nil
+		return IPSetChainedFactory(&member.IPSet), factory
+	}
+}
+
+var IPSets = Resources{
+	Label: "IP Set",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		ipSet := iptables.IPSet{}
+		return IPSetChainedFactory(&ipSet)()
 	},
 	Relationships: map[string]Resources{
 		"members": IPSetMembers,
 	},
 	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED, DELETE_ALLOWED, UPSERT_ALLOWED},
+	IdParam: Param{Name: "set", Description: "name of the set"},
 }
 
 var IPSetMembers = Resources{
-	Name: "IP Set Member",
-	Factory: func(ids ...string) (resource.Resource, error) {
-		ipSet, err := NewIPSet(ids...)
+	Label: "IP Set Member",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		member := iptables.Member{}
+		return MemberChainedFactory(&member)()
+	},
+	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED, DELETE_ALLOWED, UPSERT_ALLOWED},
+	IdParam: Param{
+		Name:        "member",
+		Description: "a MAC for a hash:mac set, or an IPv4 address for a hash:ip set",
+		Pattern:     "^(" + strings.Trim(MAC_PATTERN, "^$") + "|" + strings.Trim(IPV4_PATTERN, "^$") + ")$",
+	},
+	// the connections of a member blocked by a rule with flushConnections are flushed
+	Created: func(res resource.Resource) (any, error) {
+		member, err := firewall.MemberOf(res)
 		if err != nil {
 			return nil, err
 		}
-		switch len(ids) {
-		case 2:
-			return nil, fmt.Errorf("missing ipset name")
-		case 3:
-			return iptables.NewMember(ipSet, address.MAC{}).MemberResource(), nil
-		default:
-			mac, err := address.MACFromString(ids[3])
-			return iptables.NewMember(ipSet, mac).MemberResource(), err
+		report, err := conntrack.FlushMember(member, time.Now())
+		if err != nil || len(report.Flushed) == 0 {
+			return nil, err
 		}
+		return report, nil
 	},
-	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED, DELETE_ALLOWED, UPSERT_ALLOWED},
 }
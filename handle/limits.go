@@ -0,0 +1,33 @@
+package handle
+
+import (
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/throttle"
+)
+
+func LimitChainedFactory(l *throttle.Limit) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(limitId string) (resource.Resource, error) {
+			if limitId != "" {
+				id, err := throttle.ParseLimitId(limitId)
+				if err != nil {
+					return nil, err
+				}
+				l.Id = id
+			}
+			return l.LimitResource(), nil
+		}
+		return NSChainedFactory(&l.NS), factory
+	}
+}
+
+// Limits throttle the packets marked with their Id to a rate on the devices
+var Limits = Resources{
+	Label: "Limits",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		l := throttle.Limit{}
+		return LimitChainedFactory(&l)()
+	},
+	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED, DELETE_ALLOWED, UPSERT_ALLOWED},
+	IdParam: Param{Name: "limitId", Description: "the mark of the packets to limit, 1 to 65535", Pattern: "^[0-9]{1,5}$"},
+}
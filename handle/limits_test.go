@@ -0,0 +1,96 @@
+package handle_test
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/throttle"
+)
+
+// classExecutor has the devices lan and wan with the HTB classes added by tc,
+// other commands are passed through
+type classExecutor struct {
+	exec.Executor
+	// classes are the class show lines, keyed by device then class Id
+	classes map[string]map[string]string
+}
+
+func (c *classExecutor) Exec(cmd []string) (int, string, error) {
+	line := strings.Join(cmd, " ")
+	if strings.HasSuffix(line, strings.Join(address.LinksJsonCmd(), " ")) {
+		return 0, `[{"ifname":"lan","link_type":"ether"},{"ifname":"wan","link_type":"ether"}]`, nil
+	}
+	i := strings.Index(line, "tc ")
+	if i < 0 {
+		return c.Executor.Exec(cmd)
+	}
+	tc := strings.Fields(line[i:])
+	dev := tc[4]
+	switch tc[1] + " " + tc[2] {
+	case "class show":
+		lines := []string{}
+		for _, class := range c.classes[dev] {
+			lines = append(lines, class)
+		}
+		return 0, strings.Join(lines, "\n"), nil
+	case "class add":
+		c.classes[dev][tc[8]] = fmt.Sprintf("class htb %s root prio 0 rate %s ceil %s", tc[8], tc[11], tc[11])
+	case "class del":
+		delete(c.classes[dev], tc[6])
+	}
+	return 0, "", nil
+}
+
+func TestLimitHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		host, restore := useHostExecutor()
+		defer restore()
+		resource.DefaultExecutor = &classExecutor{
+			Executor: host,
+			classes:  map[string]map[string]string{"lan": {}, "wan": {}},
+		}
+
+		limit := throttle.Limit{Rate: "256kbit", Devices: []string{"lan"}}
+
+		t.Run("creating a limit", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/limits/16", limit, 201)
+		})
+
+		t.Run("get a limit", func(t *testing.T) {
+			res := AssertHandler[throttle.LimitRes](t, http.MethodGet, "/api/v1/netns/test/limits/16", nil, 200)
+			if res.Rate != "256kbit" || !reflect.DeepEqual(res.Devices, []string{"lan"}) {
+				t.Fatalf("unexpected limit %+v", res)
+			}
+		})
+
+		t.Run("updating a limit", func(t *testing.T) {
+			limit := limit
+			limit.Rate, limit.Devices = "1mbit", nil
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/limits/16", limit, 200)
+			res := AssertHandler[throttle.LimitRes](t, http.MethodGet, "/api/v1/netns/test/limits/16", nil, 200)
+			if res.Rate != "1mbit" || !reflect.DeepEqual(res.Devices, []string{"lan", "wan"}) {
+				t.Fatalf("expected the limit on every device, got %+v", res)
+			}
+		})
+
+		t.Run("invalid limits", func(t *testing.T) {
+			AssertHandlerFailKind(t, http.MethodPut, "/api/v1/netns/test/limits/0", limit, 400, resource.INVALID)
+			AssertHandlerFailKind(t, http.MethodPut, "/api/v1/netns/test/limits/17", throttle.Limit{Rate: "fast"}, 400, resource.INVALID)
+		})
+
+		t.Run("list and delete limits", func(t *testing.T) {
+			ids := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/limits", nil, 200)
+			if !reflect.DeepEqual(*ids, []string{"16"}) {
+				t.Fatalf("unexpected limits %v", *ids)
+			}
+			AssertHandler[any](t, http.MethodDelete, "/api/v1/netns/test/limits/16", nil, 204)
+			AssertHandlerFail(t, http.MethodGet, "/api/v1/netns/test/limits/16", nil, 404)
+		})
+	})
+}
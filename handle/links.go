@@ -0,0 +1,95 @@
+package handle
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// HAL_JSON in the Accept header of a GET has the response include the _links
+// to the relationships and the allowed methods, lists have the ids in an object
+const HAL_JSON = "application/hal+json"
+
+// Link is to a path with the methods allowed on it
+type Link struct {
+	Href    string   `json:"href"`
+	Methods []string `json:"methods"`
+}
+
+// List is the response for a list with links
+type List struct {
+	Ids   []string       `json:"ids"`
+	Links map[string]any `json:"_links"`
+}
+
+func wantsLinks(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), HAL_JSON)
+}
+
+// itemMethods are allowed on the path with an id, or on the path of a singleton
+func (r Resources) itemMethods() []string {
+	methods := []string{}
+	for allowed, method := range map[Allowed]string{
+		GET_ALLOWED: http.MethodGet, UPSERT_ALLOWED: http.MethodPut, DELETE_ALLOWED: http.MethodDelete,
+	} {
+		if slices.Contains(r.Allowed, allowed) && !(r.Singleton && allowed == DELETE_ALLOWED) {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// listMethods are allowed on the path without an id
+func (r Resources) listMethods() []string {
+	if r.Singleton {
+		return r.itemMethods()
+	}
+	methods := []string{}
+	for allowed, method := range map[Allowed]string{
+		LIST_ALLOWED: http.MethodGet, UPSERT_ALLOWED: http.MethodPut, DELETE_ALLOWED: http.MethodDelete,
+	} {
+		if slices.Contains(r.Allowed, allowed) {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// itemLinks are to the resource at the path and to its relationships
+func (r Resources) itemLinks(path string) map[string]any {
+	path = strings.TrimSuffix(path, "/")
+	links := map[string]any{"self": Link{Href: path, Methods: r.itemMethods()}}
+	for relation, related := range r.Relationships {
+		links[relation] = Link{Href: path + "/" + relation, Methods: related.listMethods()}
+	}
+	return links
+}
+
+// listLinks are to the list at the path and to each of the ids
+func (r Resources) listLinks(path string, ids []string) map[string]any {
+	path = strings.TrimSuffix(path, "/")
+	items := []Link{}
+	for _, id := range ids {
+		items = append(items, Link{Href: path + "/" + id, Methods: r.itemMethods()})
+	}
+	return map[string]any{"self": Link{Href: path, Methods: r.listMethods()}, "item": items}
+}
+
+// withLinks adds the _links to the JSON object of the resource
+func withLinks(res any, links map[string]any) (any, error) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	object := map[string]any{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	object["_links"] = links
+	return object, nil
+}
@@ -0,0 +1,90 @@
+package handle_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/iptables"
+	"golang.org/x/exp/slices"
+)
+
+type linked struct {
+	Ids   []string                   `json:"ids"`
+	Links map[string]json.RawMessage `json:"_links"`
+}
+
+// getLinked gets the path accepting HAL
+func getLinked(t *testing.T, path string) linked {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", handle.HAL_JSON)
+	w := httptest.NewRecorder()
+	handle.Api{}.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 for %s, got %d: %s", path, w.Code, w.Body)
+	}
+	res := linked{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func link(t *testing.T, res linked, relation string) handle.Link {
+	l := handle.Link{}
+	if err := json.Unmarshal(res.Links[relation], &l); err != nil {
+		t.Fatalf("expected a %s link in %v: %v", relation, res.Links, err)
+	}
+	return l
+}
+
+func TestLinks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		set := iptables.NewIPSet(testNS, "tvs")
+		AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/ipsets/tvs", set, 201)
+		defer AssertHandler[any](t, http.MethodDelete, "/api/v1/netns/test/ipsets/tvs", nil, 204)
+
+		root := getLinked(t, "/api/v1")
+		if netns := link(t, root, "netns"); netns.Href != "/api/v1/netns" || !reflect.DeepEqual(netns.Methods, []string{"DELETE", "GET"}) {
+			t.Fatalf("unexpected netns link %+v", netns)
+		}
+
+		sets := getLinked(t, "/api/v1/netns/test/ipsets/")
+		if !slices.Contains(sets.Ids, "tvs") {
+			t.Fatalf("expected the ids, got %v", sets.Ids)
+		}
+		if self := link(t, sets, "self"); !reflect.DeepEqual(self.Methods, []string{"DELETE", "GET", "PUT"}) {
+			t.Fatalf("unexpected self link %+v", self)
+		}
+		items := []handle.Link{}
+		if err := json.Unmarshal(sets.Links["item"], &items); err != nil || len(items) != len(sets.Ids) {
+			t.Fatalf("expected a link to each set, got %s: %v", sets.Links["item"], err)
+		}
+
+		// walking to the members from the links
+		tvs := getLinked(t, items[slices.Index(sets.Ids, "tvs")].Href)
+		members := link(t, tvs, "members")
+		if members.Href != "/api/v1/netns/test/ipsets/tvs/members" {
+			t.Fatalf("unexpected members link %+v", members)
+		}
+		if list := getLinked(t, members.Href); list.Ids == nil || len(list.Ids) != 0 {
+			t.Fatalf("expected no members, got %v", list.Ids)
+		}
+
+		// singletons only have the methods they allow
+		attempts := link(t, getLinked(t, "/api/v1/netns/test/blocked-attempts"), "self")
+		if attempts.Href != "/api/v1/netns/test/blocked-attempts" || !reflect.DeepEqual(attempts.Methods, []string{"GET"}) {
+			t.Fatalf("unexpected blocked attempts link %+v", attempts)
+		}
+
+		// without HAL the list is only the ids
+		ids := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/ipsets", nil, 200)
+		if !reflect.DeepEqual(*ids, sets.Ids) {
+			t.Fatalf("unexpected ids %v", *ids)
+		}
+	})
+}
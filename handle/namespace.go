@@ -1,22 +1,56 @@
 package handle
 
 import (
+	"regexp"
+
 	"github.com/plockc/gateway/resource"
 )
 
-var Namespaces = Resources{
-	Name: "Network Namespace",
-	Factory: func(ids ...string) (resource.Resource, error) {
-		switch len(ids) {
-		case 0, 1:
-			return resource.NewNS("").NSResource(), nil
-		default:
-			return resource.NewNS(ids[0]).NSResource(), nil
+// NS_NAME_PATTERN is a name of a network namespace, which is a file in /run/netns
+// so it cannot have a slash or be . or ..
+const NS_NAME_PATTERN = `^[A-Za-z0-9_][A-Za-z0-9_.-]{0,63}$`
+
+var nsNameRegex = regexp.MustCompile(NS_NAME_PATTERN)
+
+func NSChainedFactory(ns *resource.NS) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(nsName string) (resource.Resource, error) {
+			(*ns).Name = nsName
+			if nsName == NS.Name {
+				return servedNSRes{ns.NSResource()}, nil
+			}
+			return ns.NSResource(), nil
 		}
+		return VersionChainedFactory, factory
+	}
+}
+
+// servedNSRes is the namespace of the gateway, which cannot be deleted through its own API
+type servedNSRes struct {
+	resource.Resource
+}
+
+func (s servedNSRes) Delete() error {
+	return resource.Conflict("%s is served by the gateway and cannot be deleted", NS)
+}
+
+var Namespaces = Resources{
+	Label: "Network Namespace",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		ns := resource.NS{}
+		return NSChainedFactory(&ns)()
 	},
 	Relationships: map[string]Resources{
-		"iptables": Tables,
-		"ipsets":   IPSets,
+		"blocked-attempts": BlockedAttempts,
+		"bootstrap":        Bootstrap,
+		"domains":          Domains,
+		"firewall":         Firewalls,
+		"iptables":         Tables,
+		"ipsets":           IPSets,
+		"limits":           Limits,
+		"status":           Status,
+		"wan":              WAN,
 	},
-	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED},
+	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED, DELETE_ALLOWED},
+	IdParam: Param{Name: "netns", Description: "name of the network namespace of the gateway", Pattern: NS_NAME_PATTERN},
 }
@@ -0,0 +1,323 @@
+package handle
+
+import (
+	"encoding"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+// OPENAPI_PATH serves the OpenAPI document generated from the Versions tree
+const OPENAPI_PATH = "/api/openapi.json"
+
+// the patterns of the MACs and IPv4 addresses in the paths and query parameters
+const (
+	MAC_PATTERN  = `^[0-9A-Fa-f]{2}(:[0-9A-Fa-f]{2}){5}$`
+	IPV4_PATTERN = `^[0-9]{1,3}(\.[0-9]{1,3}){3}$`
+)
+
+// Param is a path or query parameter for the OpenAPI document
+type Param struct {
+	Name        string
+	Description string
+	// Format is an OpenAPI string format, like date-time
+	Format string
+	// Pattern is a regular expression the value matches
+	Pattern string
+}
+
+// Schema is a JSON schema
+type Schema map[string]any
+
+func (p Param) schema() Schema {
+	schema := Schema{"type": "string"}
+	if p.Format != "" {
+		schema["format"] = p.Format
+	}
+	if p.Pattern != "" {
+		schema["pattern"] = p.Pattern
+	}
+	return schema
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	Schema      Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]any       `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Operation struct {
+	Summary     string              `json:"summary"`
+	OperationId string              `json:"operationId"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Components struct {
+	Schemas map[string]Schema `json:"schemas"`
+}
+
+type OpenAPIDoc struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       map[string]string               `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+func jsonContent(schema Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+func ref(name string) Schema {
+	return Schema{"$ref": "#/components/schemas/" + name}
+}
+
+// OpenAPI documents every path of the Versions tree, with the schemas of the resources
+func OpenAPI() OpenAPIDoc {
+	doc := OpenAPIDoc{
+		OpenAPI: "3.0.3",
+		Info:    map[string]string{"title": "Gateway API", "version": "v1"},
+		Paths:   map[string]map[string]Operation{},
+		Components: Components{Schemas: map[string]Schema{
+			"Error": {
+				"type": "object",
+				"properties": map[string]Schema{
+					"error": {"type": "string"},
+					"code": {"type": "string", "enum": []resource.Kind{
+						resource.INVALID, resource.NOT_FOUND, resource.CONFLICT, resource.UNSUPPORTED,
+					}},
+				},
+				"required": []string{"error"},
+			},
+		}},
+	}
+	doc.addPaths("/api", nil, Versions)
+	doc.addApply()
+	doc.addEvents()
+	return doc
+}
+
+// schemaName is the component for the resource, the first of the types with the same name
+// keeps the name and the others have the package added
+func (doc *OpenAPIDoc) schemaName(t reflect.Type, schema Schema) string {
+	name := t.Name()
+	if existing, ok := doc.Components.Schemas[name]; ok && !reflect.DeepEqual(existing, schema) {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	doc.Components.Schemas[name] = schema
+	return name
+}
+
+// operationId is like getIPSetMember from the method and the label of the resources
+func operationId(method string, r Resources) string {
+	return method + strings.ReplaceAll(r.Label, " ", "")
+}
+
+// addPaths adds the operations of the resources under the path, then their relationships
+func (doc *OpenAPIDoc) addPaths(path string, params []Parameter, r Resources) {
+	schema := Schema{"type": "object"}
+	if res, err := r.Resource(); err == nil {
+		t := reflect.TypeOf(res)
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		schema = ref(doc.schemaName(t, typeSchema(t)))
+	}
+	body := &RequestBody{Required: false, Content: jsonContent(schema)}
+	failed := Response{Description: "the error", Content: jsonContent(ref("Error"))}
+	responses := func(codes map[string]Response) map[string]Response {
+		codes["default"] = failed
+		return codes
+	}
+	ensured := responses(map[string]Response{
+		"200": {Description: r.Label + " already existed and was updated if it can be"},
+		"201": {Description: r.Label + " was created"},
+	})
+	operations := map[string]Operation{}
+	if r.Singleton {
+		if slices.Contains(r.Allowed, GET_ALLOWED) {
+			query := append([]Parameter{}, params...)
+			for _, q := range r.QueryParams {
+				query = append(query, Parameter{Name: q.Name, In: "query", Description: q.Description, Schema: q.schema()})
+			}
+			operations["get"] = Operation{
+				Summary: "get the " + r.Label, OperationId: operationId("get", r), Parameters: query,
+				Responses: responses(map[string]Response{"200": {Description: "the " + r.Label, Content: jsonContent(schema)}}),
+			}
+		}
+		if slices.Contains(r.Allowed, UPSERT_ALLOWED) {
+			operations["put"] = Operation{
+				Summary: "ensure the " + r.Label, OperationId: operationId("ensure", r), Parameters: params,
+				RequestBody: body, Responses: ensured,
+			}
+		}
+		doc.Paths[path] = operations
+		return
+	}
+
+	id := Parameter{Name: r.IdParam.Name, In: "path", Description: r.IdParam.Description, Required: true, Schema: r.IdParam.schema()}
+	if slices.Contains(r.Allowed, LIST_ALLOWED) {
+		operations["get"] = Operation{
+			Summary: "list the ids of the " + r.Label, OperationId: operationId("list", r), Parameters: params,
+			Responses: responses(map[string]Response{"200": {
+				Description: "the ids", Content: jsonContent(Schema{"type": "array", "items": id.Schema}),
+			}}),
+		}
+	}
+	if slices.Contains(r.Allowed, DELETE_ALLOWED) {
+		operations["delete"] = Operation{
+			Summary: "delete all of the " + r.Label, OperationId: operationId("clear", r), Parameters: params,
+			Responses: responses(map[string]Response{
+				"200": {Description: "there was nothing to delete"},
+				"204": {Description: "deleted"},
+			}),
+		}
+	}
+	if slices.Contains(r.Allowed, UPSERT_ALLOWED) {
+		operations["put"] = Operation{
+			Summary: "create a " + r.Label + " with the id in the body", OperationId: operationId("create", r),
+			Parameters: params, RequestBody: body,
+			Responses: responses(map[string]Response{"201": {
+				Description: "created, or already existed",
+				Headers:     map[string]any{"Location": map[string]any{"schema": Schema{"type": "string"}}},
+			}}),
+		}
+	}
+	if len(operations) > 0 {
+		doc.Paths[path] = operations
+	}
+
+	itemPath := path + "/{" + id.Name + "}"
+	itemParams := append(append([]Parameter{}, params...), id)
+	operations = map[string]Operation{}
+	if slices.Contains(r.Allowed, GET_ALLOWED) {
+		operations["get"] = Operation{
+			Summary: "get a " + r.Label, OperationId: operationId("get", r), Parameters: itemParams,
+			Responses: responses(map[string]Response{
+				"200": {Description: "the " + r.Label, Content: jsonContent(schema)},
+				"404": {Description: "missing", Content: jsonContent(ref("Error"))},
+			}),
+		}
+	}
+	if slices.Contains(r.Allowed, DELETE_ALLOWED) {
+		operations["delete"] = Operation{
+			Summary: "delete a " + r.Label, OperationId: operationId("delete", r), Parameters: itemParams,
+			Responses: responses(map[string]Response{
+				"200": {Description: "was already missing"},
+				"204": {Description: "deleted"},
+			}),
+		}
+	}
+	if slices.Contains(r.Allowed, UPSERT_ALLOWED) {
+		operations["put"] = Operation{
+			Summary: "create or update a " + r.Label, OperationId: operationId("ensure", r), Parameters: itemParams,
+			RequestBody: body, Responses: ensured,
+		}
+	}
+	if len(operations) > 0 {
+		doc.Paths[itemPath] = operations
+	}
+
+	relations := []string{}
+	for relation := range r.Relationships {
+		relations = append(relations, relation)
+	}
+	sort.Strings(relations)
+	for _, relation := range relations {
+		doc.addPaths(itemPath+"/"+relation, itemParams, r.Relationships[relation])
+	}
+}
+
+var (
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// typeSchema is the JSON schema for how encoding/json marshals the type
+func typeSchema(t reflect.Type) Schema {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return Schema{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(net.IP{}):
+		return Schema{"type": "string", "format": "ipv4"}
+	case t.Implements(textMarshaler) || t.Implements(jsonMarshaler):
+		return Schema{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := typeSchema(t.Elem())
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]Schema{}
+		addProperties(t, properties)
+		return Schema{"type": "object", "properties": properties}
+	}
+	return Schema{}
+}
+
+// addProperties has the fields of the struct by their JSON names,
+// embedded structs without a name have their fields promoted
+func addProperties(t reflect.Type, properties map[string]Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			addProperties(fieldType, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type)
+	}
+}
@@ -0,0 +1,80 @@
+package handle_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/handle"
+)
+
+func TestOpenAPI(t *testing.T) {
+	// fetched without a content type
+	w := httptest.NewRecorder()
+	handle.Api{}.ServeHTTP(w, httptest.NewRequest(http.MethodGet, handle.OPENAPI_PATH, nil))
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	doc := handle.OpenAPIDoc{}
+	if err := handle.UpdateFromJson(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	members := doc.Paths["/api/{version}/netns/{netns}/ipsets/{set}/members/{member}"]
+	for _, method := range []string{"get", "put", "delete"} {
+		if _, ok := members[method]; !ok {
+			t.Fatalf("expected %s for members, got %v", method, members)
+		}
+	}
+	params := members["get"].Parameters
+	if len(params) != 4 || params[3].Name != "member" || params[3].Schema["pattern"] == nil {
+		t.Fatalf("expected the member with a pattern last, got %+v", params)
+	}
+
+	rules := doc.Paths["/api/{version}/netns/{netns}/iptables/{table}/chains/{chain}/rules/{ruleId}"]
+	if rules["get"].Parameters[4].Schema["pattern"] != "^[0-9a-f]{1,8}$" {
+		t.Fatalf("expected the hex rule Id, got %+v", rules["get"].Parameters)
+	}
+	if _, ok := rules["put"]; !ok {
+		t.Fatalf("expected put for rules, got %v", rules)
+	}
+	if ref := rules["put"].RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/RuleRes" {
+		t.Fatalf("expected the rule as the body, got %v", ref)
+	}
+	properties := doc.Components.Schemas["RuleRes"]["properties"].(map[string]any)
+	for _, property := range []string{"Id", "target", "matchSetSrc", "end", "notice", "targetOptions"} {
+		if _, ok := properties[property]; !ok {
+			t.Errorf("expected %s in the rule properties %v", property, properties)
+		}
+	}
+	if _, ok := properties["Chain"]; ok {
+		t.Errorf("expected the chain to be left out of the rule properties %v", properties)
+	}
+
+	attempts := doc.Paths["/api/{version}/netns/{netns}/blocked-attempts"]["get"].Parameters
+	names := []string{}
+	for _, param := range attempts {
+		names = append(names, param.In+":"+param.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"path:version", "path:netns", "query:mac", "query:since"}) {
+		t.Fatalf("unexpected blocked attempts parameters %v", names)
+	}
+
+	if _, ok := doc.Components.Schemas["Error"]; !ok {
+		t.Fatal("expected the error schema")
+	}
+	// the operation ids are unique so clients can be generated
+	ids := map[string]string{}
+	for path, operations := range doc.Paths {
+		for method, operation := range operations {
+			if other, ok := ids[operation.OperationId]; ok {
+				t.Errorf("operation %s of %s %s is also %s", operation.OperationId, method, path, other)
+			}
+			ids[operation.OperationId] = method + " " + path
+			if _, ok := operation.Responses["default"]; !ok {
+				t.Errorf("expected the error response for %s %s", method, path)
+			}
+		}
+	}
+}
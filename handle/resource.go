@@ -1,6 +1,12 @@
 package handle
 
-import "github.com/plockc/gateway/resource"
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+)
 
 type Allowed int
 
@@ -11,6 +17,11 @@ const (
 	UPSERT_ALLOWED
 )
 
+// Filterable resources take the query parameters of a GET
+type Filterable interface {
+	Filter(url.Values) error
+}
+
 type Factory func(string) (resource.Resource, error)
 type ChainedFactory func() (ChainedFactory, Factory)
 
@@ -20,4 +31,56 @@ type Resources struct {
 	ChainedFactory
 	Relationships map[string]Resources
 	Allowed       []Allowed
+	// Singleton resources have no id in the path, there is only one for the parent
+	Singleton bool
+	// Created is run after a PUT creates a resource, what it returns is the body of the response,
+	// its failure is logged as the resource was created
+	Created func(resource.Resource) (any, error)
+	// IdParam describes the id in the path for the OpenAPI document
+	IdParam Param
+	// QueryParams are the query parameters a Filterable GET takes
+	QueryParams []Param
+}
+
+// created runs Created if there is one, the request still succeeds if it fails
+// as the resource was created
+func (r Resources) created(res resource.Resource) any {
+	if r.Created == nil {
+		return nil
+	}
+	data, err := r.Created(res)
+	if err != nil {
+		logs.Warnf("created %s %s but failed after: %s\n", r.Label, res.Id(), err)
+		return nil
+	}
+	return data
+}
+
+// Resource builds the resource using one id per level starting from the version,
+// a missing last id is for list and clear requests.
+// The chained factories are gathered from this resource up to the root,
+// then run from the root down so the parents are populated before the child is built
+func (r Resources) Resource(ids ...string) (resource.Resource, error) {
+	factories := []Factory{}
+	for chained := r.ChainedFactory; chained != nil; {
+		var factory Factory
+		chained, factory = chained()
+		factories = append(factories, factory)
+	}
+	if len(ids) > len(factories) {
+		return nil, fmt.Errorf("%s needs %d ids, got %v", r.Label, len(factories), ids)
+	}
+	var res resource.Resource
+	for depth := 0; depth < len(factories); depth++ {
+		id := ""
+		if depth < len(ids) {
+			id = ids[depth]
+		}
+		var err error
+		res, err = factories[len(factories)-1-depth](id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
@@ -5,22 +5,63 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
 )
 
+// statuses have the HTTP status for each kind of error
+var statuses = map[resource.Kind]int{
+	resource.INVALID:     http.StatusBadRequest,
+	resource.NOT_FOUND:   http.StatusNotFound,
+	resource.CONFLICT:    http.StatusConflict,
+	resource.UNSUPPORTED: http.StatusUnprocessableEntity,
+}
+
+// statusFor is the status for the kind of the error, the fallback if it has none
+func statusFor(err error, fallback int) int {
+	if status, ok := statuses[resource.KindOf(err)]; ok {
+		return status
+	}
+	return fallback
+}
+
+// errorResponse has the kind of the error as the code in the body when it has one
 func errorResponse(w http.ResponseWriter, path string, code int, err error) {
-	jsonResponse(w, path, code, map[string]string{"error": err.Error()})
-	log.Printf("Error %d at %s: %s\n", code, path, err.Error())
+	body := map[string]string{"error": err.Error()}
+	if kind := resource.KindOf(err); kind != "" {
+		body["code"] = string(kind)
+	}
+	jsonResponse(w, path, code, body)
+	if code >= 500 {
+		logs.Errorf("%d at %s: %s\n", code, path, err.Error())
+	} else {
+		logs.Infof("%d at %s: %s\n", code, path, err.Error())
+	}
 }
 
-func locationResponse(w http.ResponseWriter, path string, code int, location string) {
-	jsonWithHeadersResponse(w, path, code, map[string]any{"Location": location}, nil)
+func locationResponse(w http.ResponseWriter, path string, code int, location string, data any) {
+	if data == nil {
+		jsonWithHeadersResponse(w, path, code, map[string]any{"Location": location}, nil)
+		return
+	}
+	response, err := json.Marshal(data)
+	if err != nil {
+		errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+			"failed to convert data to json: %w", err,
+		))
+		return
+	}
+	jsonWithHeadersResponse(w, path, code, map[string]any{
+		"Location": location, "content-type": "application/json",
+	}, response)
 }
 
 func jsonWithHeadersResponse(w http.ResponseWriter, path string, code int, headers map[string]any, body []byte) {
 	for h, v := range headers {
 		w.Header().Add(h, fmt.Sprintf("%v", v))
-		w.WriteHeader(code)
 	}
+	w.WriteHeader(code)
 	_, err := w.Write(body)
 	if err != nil {
 		log.Printf(
@@ -30,6 +71,23 @@ func jsonWithHeadersResponse(w http.ResponseWriter, path string, code int, heade
 	}
 }
 
+// linkedResponse has the _links in the response if the request wants them
+func linkedResponse(w http.ResponseWriter, req *http.Request, code int, res any, links map[string]any) {
+	path := req.URL.Path
+	if !wantsLinks(req) {
+		jsonResponse(w, path, code, res)
+		return
+	}
+	linked, err := withLinks(res, links)
+	if err != nil {
+		errorResponse(w, path, http.StatusInternalServerError, fmt.Errorf(
+			"failed to add links: %w", err,
+		))
+		return
+	}
+	jsonResponse(w, path, code, linked)
+}
+
 func jsonResponse(w http.ResponseWriter, path string, code int, data any) {
 	var response []byte
 	var err error
@@ -45,6 +103,6 @@ func jsonResponse(w http.ResponseWriter, path string, code int, data any) {
 	if string(response) == "{}" {
 		response = nil
 	}
-	fmt.Println("RESPONSING", path, data, string(response), fmt.Sprintf("%T", data))
+	logs.Debugf("responding to %s with %T: %s\n", path, data, string(response))
 	jsonWithHeadersResponse(w, path, code, map[string]any{"content-type": "application/json"}, response)
 }
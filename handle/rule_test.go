@@ -2,96 +2,179 @@ package handle_test
 
 import (
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/conntrack"
 	"github.com/plockc/gateway/funcs"
 	"github.com/plockc/gateway/iptables"
 	"github.com/plockc/gateway/resource"
 )
 
 func TestRuleHandlers(t *testing.T) {
-	ipSet := iptables.NewIPSet(testNS, "testSet")
-	table := iptables.NewTable(testNS, "filter")
-	chain := iptables.NewChain(table, "testChain")
-	rule := iptables.NewRule(chain)
-	rule.Comment = "this is a test rule"
-	rule.MatchSetSrc = ipSet.Name
-	rule.Target = "DROP"
-
-	var ignored bool
-	var mac address.MAC
-	if err := funcs.Do(
-		funcs.AssignFunc(resource.NewLifecycle(ipSet.IPSetResource()).Ensure, &ignored),
-		funcs.AssignFunc(func() (address.MAC, error) {
-			return address.MACFromString("12:12:12:12:12:12")
-		}, &mac),
-		funcs.AssignFunc(resource.NewLifecycle(table.TableResource()).Ensure, &ignored),
-		funcs.AssignFunc(resource.NewLifecycle(chain.ChainResource()).Ensure, &ignored),
-		rule.RuleResource().Clear,
-	); err != nil {
-		t.Fatal(err)
-	}
-	defer resource.NewLifecycle(rule.RuleResource()).EnsureDeleted()
-	defer resource.NewLifecycle(chain.ChainResource()).EnsureDeleted()
-	defer resource.NewLifecycle(table.TableResource()).EnsureDeleted()
-
-	member := iptables.NewMember(ipSet, mac)
-	defer resource.NewLifecycle(member.MemberResource()).EnsureDeleted()
-	defer resource.NewLifecycle(ipSet.IPSetResource()).EnsureDeleted()
-
-	// at this point should be no rules
-
-	var createdRuleId string
-	t.Run("creating rule", func(t *testing.T) {
-		rulesPath := "/api/v1/netns/test/iptables/filter/chains/testChain/rules"
-		body, headers := AssertHandlerGetHeaders[any](
-			t, http.MethodPut, rulesPath, rule, 201,
-		)
-		if body != nil {
-			t.Fatalf("got unexpected body: %v", *body)
-		}
-		location := headers.Get("Location")
-		if !strings.HasPrefix(location, rulesPath) {
-			t.Fatalf("unexpected location, got '%s'", location)
-		}
-		createdRuleId = strings.TrimLeft(location, rulesPath+"/")
-	})
+	forEachBackend(t, func(t *testing.T) {
+		ipSet := iptables.NewIPSet(testNS, "testSet")
+		table := iptables.NewTable(testNS, "filter")
+		chain := iptables.NewChain(table, "testChain")
+		rule := iptables.NewRule(chain)
+		rule.Comment = "this is a test rule"
+		rule.MatchSetSrc = ipSet.Name
+		rule.Target = "DROP"
 
-	t.Run("check existence of rule using GET on rule id", func(t *testing.T) {
-		data := AssertHandler[iptables.Rule](
-			t, http.MethodGet, "/api/v1/netns/test/iptables/filter/chains/testChain/rules/"+createdRuleId, nil, 200,
-		)
-		if data == nil {
-			t.Fatalf("missing body: %#v", data)
-		}
-		if data.Target != "DROP" {
-			t.Fatalf("wrong target, had: %s", data.Target)
-		}
-		if data.MatchSetSrc != "testSet" {
-			t.Fatalf("wrong set name, had: %s", data.MatchSetSrc)
-		}
-		if data.Comment != rule.Comment {
-			t.Fatalf("wrong comment, had: %s", data.Comment)
+		var ignored bool
+		var mac address.MAC
+		if err := funcs.Do(
+			funcs.AssignFunc(resource.NewLifecycle(fw().IPSetResource(ipSet)).Ensure, &ignored),
+			funcs.AssignFunc(func() (address.MAC, error) {
+				return address.MACFromString("12:12:12:12:12:12")
+			}, &mac),
+			funcs.AssignFunc(resource.NewLifecycle(fw().TableResource(table)).Ensure, &ignored),
+			funcs.AssignFunc(resource.NewLifecycle(fw().ChainResource(chain)).Ensure, &ignored),
+			fw().RuleResource(rule).Clear,
+		); err != nil {
+			t.Fatal(err)
 		}
+		defer resource.NewLifecycle(fw().RuleResource(rule)).EnsureDeleted()
+		defer resource.NewLifecycle(fw().ChainResource(chain)).EnsureDeleted()
+		defer resource.NewLifecycle(fw().TableResource(table)).EnsureDeleted()
+
+		member := iptables.NewMember(ipSet, mac)
+		defer resource.NewLifecycle(fw().MemberResource(member)).EnsureDeleted()
+		defer resource.NewLifecycle(fw().IPSetResource(ipSet)).EnsureDeleted()
+
+		// at this point should be no rules
+
+		var createdRuleId string
+		t.Run("creating rule", func(t *testing.T) {
+			rulesPath := "/api/v1/netns/test/iptables/filter/chains/testChain/rules"
+			body, headers := AssertHandlerGetHeaders[any](
+				t, http.MethodPut, rulesPath, rule, 201,
+			)
+			if body != nil {
+				t.Fatalf("got unexpected body: %v", *body)
+			}
+			location := headers.Get("Location")
+			if !strings.HasPrefix(location, rulesPath) {
+				t.Fatalf("unexpected location, got '%s'", location)
+			}
+			createdRuleId = strings.TrimPrefix(location, rulesPath+"/")
+		})
+
+		t.Run("check existence of rule using GET on rule id", func(t *testing.T) {
+			data := AssertHandler[iptables.Rule](
+				t, http.MethodGet, "/api/v1/netns/test/iptables/filter/chains/testChain/rules/"+createdRuleId, nil, 200,
+			)
+			if data == nil {
+				t.Fatalf("missing body: %#v", data)
+			}
+			if data.Target != "DROP" {
+				t.Fatalf("wrong target, had: %s", data.Target)
+			}
+			if data.MatchSetSrc != "testSet" {
+				t.Fatalf("wrong set name, had: %s", data.MatchSetSrc)
+			}
+			if data.Comment != rule.Comment {
+				t.Fatalf("wrong comment, had: %s", data.Comment)
+			}
+		})
+
+		t.Run("check existence of rule using GET for list of rules", func(t *testing.T) {
+			data := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/iptables/filter/chains/testChain/rules", nil, 200)
+			if len(*data) != 1 {
+				t.Fatalf("expected rule, got %v", *data)
+			}
+			ruleId := (*data)[0]
+			if ruleId != createdRuleId {
+				t.Fatalf("GET returned Id '%s' instead of expected '%s'", ruleId, createdRuleId)
+			}
+		})
+
+		t.Run("remove rule", func(t *testing.T) {
+			data := AssertHandler[[]string](t, http.MethodDelete, "/api/v1/netns/test/iptables/filter/chains/testChain/rules/"+createdRuleId, nil, 204)
+			if data != nil {
+				t.Fatalf("did not expect body: %#v", data)
+			}
+		})
 	})
+}
 
-	t.Run("check existence of rule using GET for list of rules", func(t *testing.T) {
-		data := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/iptables/filter/chains/testChain/rules", nil, 200)
-		if len(*data) != 1 {
-			t.Fatalf("expected rule, got %v", *data)
-		}
-		ruleId := (*data)[0]
-		if ruleId != createdRuleId {
-			t.Fatalf("GET returned Id '%s' instead of expected '%s'", ruleId, createdRuleId)
+func TestFlushConnectionsHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		host, restore := useHostExecutor()
+		defer restore()
+
+		ipSet := iptables.NewIPSet(testNS, "flushSet")
+		chain := iptables.NewChain(iptables.FilterTable(testNS), "flushChain")
+		rule := iptables.NewRule(chain)
+		rule.MatchSetSrc = ipSet.Name
+		rule.Target = iptables.DROP
+		rule.FlushConnections = true
+		mac, err := address.MACFromString("12:12:12:12:12:12")
+		if err != nil {
+			t.Fatal(err)
 		}
-	})
+		member := iptables.NewMember(ipSet, mac)
 
-	t.Run("remove rule", func(t *testing.T) {
-		data := AssertHandler[[]string](t, http.MethodDelete, "/api/v1/netns/test/iptables/filter/chains/testChain/rules/"+createdRuleId, nil, 204)
-		if data != nil {
-			t.Fatalf("did not expect body: %#v", data)
+		var ignored bool
+		if err := funcs.Do(
+			funcs.AssignFunc(resource.NewLifecycle(fw().IPSetResource(ipSet)).Ensure, &ignored),
+			funcs.AssignFunc(resource.NewLifecycle(fw().ChainResource(chain)).Ensure, &ignored),
+		); err != nil {
+			t.Fatal(err)
 		}
+		defer resource.NewLifecycle(fw().IPSetResource(ipSet)).EnsureDeleted()
+		defer resource.NewLifecycle(fw().ChainResource(chain)).EnsureDeleted()
+		defer resource.NewLifecycle(fw().MemberResource(member)).EnsureDeleted()
+		defer fw().RuleResource(rule).Clear()
+
+		expected := conntrack.Report{Flushed: []conntrack.Flushed{{
+			MAC: mac.String(), IPs: []string{"192.168.100.20"}, Connections: 3,
+		}}}
+
+		t.Run("creating rule with no members", func(t *testing.T) {
+			report := AssertHandler[conntrack.Report](
+				t, http.MethodPut, "/api/v1/netns/test/iptables/filter/chains/flushChain/rules", rule, 201,
+			)
+			if report == nil || len(report.Flushed) != 0 {
+				t.Fatalf("expected nothing flushed, got %v", report)
+			}
+		})
+
+		t.Run("adding a member flushes its connections", func(t *testing.T) {
+			report := AssertHandler[conntrack.Report](
+				t, http.MethodPut, "/api/v1/netns/test/ipsets/flushSet/members/"+mac.String(), nil, 201,
+			)
+			if report == nil || !reflect.DeepEqual(*report, expected) {
+				t.Fatalf("expected %+v, got %v", expected, report)
+			}
+		})
+
+		t.Run("adding the member again", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/ipsets/flushSet/members/"+mac.String(), nil, 200)
+		})
+
+		t.Run("creating rule with a member", func(t *testing.T) {
+			rule := rule
+			rule.Id++
+			report := AssertHandler[conntrack.Report](
+				t, http.MethodPut, "/api/v1/netns/test/iptables/filter/chains/flushChain/rules", rule, 201,
+			)
+			if report == nil || !reflect.DeepEqual(*report, expected) {
+				t.Fatalf("expected %+v, got %v", expected, report)
+			}
+		})
+
+		t.Run("failing to flush after creating the rule", func(t *testing.T) {
+			host.noRoute = true
+			defer func() { host.noRoute = false }()
+			rule := rule
+			rule.Id += 2
+			AssertHandler[any](t, http.MethodPut, "/api/v1/netns/test/iptables/filter/chains/flushChain/rules", rule, 201)
+			if exists, err := resource.NewLifecycle(fw().RuleResource(rule)).Exists(); err != nil || !exists {
+				t.Fatalf("expected the rule to be created, got %v", err)
+			}
+		})
 	})
 }
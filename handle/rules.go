@@ -1,8 +1,10 @@
 package handle
 
 import (
-	"strconv"
+	"time"
 
+	"github.com/plockc/gateway/conntrack"
+	"github.com/plockc/gateway/firewall"
 	"github.com/plockc/gateway/iptables"
 	"github.com/plockc/gateway/resource"
 )
@@ -11,13 +13,13 @@ func RuleChainedFactory(rule *iptables.Rule) ChainedFactory {
 	return func() (ChainedFactory, Factory) {
 		factory := func(ruleId string) (resource.Resource, error) {
 			if ruleId != "" {
-				id, err := strconv.ParseUint(ruleId, 16, 32)
+				id, err := iptables.ParseRuleId(ruleId)
 				if err != nil {
-					return iptables.Rule{}.RuleResource(), err
+					return nil, err
 				}
-				rule.Id = uint32(id)
+				rule.Id = id
 			}
-			return rule.RuleResource(), nil
+			return firewall.For(rule.NS).RuleResource(*rule), nil
 		}
 		return ChainChainedFactory(&rule.Chain), factory
 	}
@@ -26,8 +28,26 @@ func RuleChainedFactory(rule *iptables.Rule) ChainedFactory {
 var Rules = Resources{
 	Label: "IPTables Rules",
 	ChainedFactory: func() (ChainedFactory, Factory) {
-		rule := iptables.Rule{}
+		// new rules get a random Id unless the body of the request has one
+		rule := iptables.NewRule(iptables.Chain{})
 		return RuleChainedFactory(&rule)()
 	},
 	Allowed: []Allowed{LIST_ALLOWED, UPSERT_ALLOWED, GET_ALLOWED, DELETE_ALLOWED},
+	IdParam: Param{Name: "ruleId", Description: "the Id of the rule in hex", Pattern: "^[0-9a-f]{1,8}$"},
+	// the connections of the devices that are now blocked are flushed, a rule starting later
+	// is flushed by the schedule of conntrack when it starts
+	Created: func(res resource.Resource) (any, error) {
+		rule, err := firewall.RuleOf(res)
+		if err != nil {
+			return nil, err
+		}
+		if !rule.FlushConnections {
+			return nil, nil
+		}
+		now := time.Now()
+		if rule.Start != nil && rule.Start.After(now) {
+			conntrack.Reschedule()
+		}
+		return conntrack.FlushRule(rule, now)
+	},
 }
@@ -0,0 +1,81 @@
+package handle
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+)
+
+// SnapshotDir keeps the state of the namespaces changed through the API,
+// which is restored on startup, no snapshots if empty
+var SnapshotDir = ""
+
+// Snapshotting saves the state of the namespace after each change made through the API
+type Snapshotting struct {
+	Snapshots *state.Snapshots
+	Next      http.Handler
+}
+
+// changedNS is the namespace of a path like /api/v1/netns/{netns}/..., but not
+// of the namespace itself
+func changedNS(path string) (resource.NS, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 6 || parts[3] != "netns" {
+		return resource.NS{}, false
+	}
+	return resource.NewNS(parts[4]), true
+}
+
+// deletedNS is the namespace of a path like /api/v1/netns/{netns}
+func deletedNS(path string) (resource.NS, bool) {
+	parts := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	if len(parts) != 5 || parts[3] != "netns" {
+		return resource.NS{}, false
+	}
+	return resource.NewNS(parts[4]), true
+}
+
+// putChain is the chain of a path like /api/v1/netns/{netns}/iptables/{table}/chains/{chain}
+func putChain(path string) (iptables.Chain, bool) {
+	parts := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	if len(parts) != 9 || parts[3] != "netns" || parts[5] != "iptables" || parts[7] != "chains" {
+		return iptables.Chain{}, false
+	}
+	return iptables.NewChain(iptables.NewTable(resource.NewNS(parts[4]), parts[6]), parts[8]), true
+}
+
+func (s Snapshotting) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		s.Next.ServeHTTP(w, req)
+		return
+	}
+	recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	s.Next.ServeHTTP(recorder, req)
+	if recorder.code >= 400 {
+		return
+	}
+	if ns, ok := deletedNS(req.URL.Path); ok && req.Method == http.MethodDelete {
+		if err := s.Snapshots.Delete(ns); err != nil {
+			logs.Warnf("failed to delete the snapshot of %s: %s\n", ns, err)
+		}
+		return
+	}
+	// the chains created through the API are saved even without rules
+	if chain, ok := putChain(req.URL.Path); ok && req.Method == http.MethodPut {
+		s.Snapshots.Keep(chain)
+	}
+	ns, ok := changedNS(req.URL.Path)
+	if !ok {
+		return
+	}
+	// the export is not recorded in the audit of another change
+	changing.RLock()
+	defer changing.RUnlock()
+	if err := s.Snapshots.Save(ns); err != nil {
+		logs.Warnf("failed to save the snapshot of %s: %s\n", ns, err)
+	}
+}
@@ -0,0 +1,95 @@
+package handle_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/handle"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+	"github.com/plockc/gateway/throttle/throttletest"
+)
+
+func TestSnapshotting(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		// the snapshot has the limits, which are listed from the classes on the devices
+		throttletest.Use(t)
+		ClearIPSets(testNS, t, "snapshot")
+		defer ClearIPSets(testNS, t, "snapshot")
+		snapshots := state.NewSnapshots(t.TempDir())
+		api := handle.Snapshotting{Snapshots: snapshots, Next: handle.Api{}}
+		request := func(method, path string) int {
+			u, err := url.Parse(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := NewTestResponseWriter()
+			api.ServeHTTP(w, &http.Request{
+				Method: method, URL: u, Header: http.Header{"Content-Type": {"application/json"}}, Body: http.NoBody,
+			})
+			return w.Code
+		}
+		saved := func() bool {
+			_, err := os.Stat(snapshots.File(testNS))
+			return err == nil
+		}
+
+		// reading and failing do not save
+		if code := request(http.MethodGet, "/api/v1/netns/test/ipsets"); code != 200 || saved() {
+			t.Fatalf("expected no snapshot after listing, got %d", code)
+		}
+		if code := request(http.MethodDelete, "/api/v1/netns/test/ipsets/snapshot/members/tv"); code < 400 || saved() {
+			t.Fatalf("expected no snapshot after failing, got %d", code)
+		}
+		if code := request(http.MethodPut, "/api/v1/netns/test/ipsets/snapshot"); code != 201 || !saved() {
+			t.Fatalf("expected a snapshot after creating the set, got %d", code)
+		}
+		data, err := os.ReadFile(snapshots.File(testNS))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := state.Snapshot{}
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, set := range s.IPSets {
+			found = found || set.Name == "snapshot"
+		}
+		if !found {
+			t.Fatalf("expected the set in the snapshot, got %s", data)
+		}
+
+		// a chain created through the API is saved without rules
+		defer AssertHandler[any](t, http.MethodDelete, "/api/v1/netns/test/iptables/filter/chains/snapshot", nil, 204)
+		if code := request(http.MethodPut, "/api/v1/netns/test/iptables/filter/chains/snapshot"); code != 201 {
+			t.Fatalf("expected the chain to be created, got %d", code)
+		}
+		if data, err = os.ReadFile(snapshots.File(testNS)); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatal(err)
+		}
+		chains := []string{}
+		for _, c := range s.Chains {
+			chains = append(chains, c.Table+" "+c.Name)
+		}
+		if !reflect.DeepEqual(chains, []string{"filter snapshot"}) {
+			t.Fatalf("expected only the created chain in the snapshot, got %v", chains)
+		}
+
+		// the namespace of the gateway cannot be deleted, and keeps its snapshot
+		_, restore := useHostExecutor()
+		defer restore()
+		defer func(ns resource.NS) { handle.NS = ns }(handle.NS)
+		handle.NS = testNS
+		if code := request(http.MethodDelete, "/api/v1/netns/test"); code != http.StatusConflict || !saved() {
+			t.Fatalf("expected a conflict deleting the namespace of the gateway, got %d", code)
+		}
+	})
+}
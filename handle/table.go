@@ -1,34 +1,32 @@
 package handle
 
 import (
-	"fmt"
+	"strings"
 
+	"github.com/plockc/gateway/firewall"
 	"github.com/plockc/gateway/iptables"
 	"github.com/plockc/gateway/resource"
 )
 
-func NewTable(ids ...string) (iptables.Table, error) {
-	switch len(ids) {
-	case 0, 1:
-		return iptables.Table{}, fmt.Errorf("missing version and/or namespace")
-	case 2:
-		return iptables.NewTable(resource.NewNS(ids[1]), "filter"), nil
-	default:
-		return iptables.NewTable(resource.NewNS(ids[1]), ids[2]), nil
+func TableChainedFactory(table *iptables.Table) ChainedFactory {
+	return func() (ChainedFactory, Factory) {
+		factory := func(tableName string) (resource.Resource, error) {
+			(*table).Name = tableName
+			return firewall.For(table.NS).TableResource(*table), nil
+		}
+		return NSChainedFactory(&table.NS), factory
 	}
 }
 
 var Tables = Resources{
-	Name: "IP Table",
-	Factory: func(ids ...string) (resource.Resource, error) {
-		table, err := NewTable(ids...)
-		if err != nil {
-			return nil, err
-		}
-		return iptables.NewTableResource(table), nil
+	Label: "IP Table",
+	ChainedFactory: func() (ChainedFactory, Factory) {
+		table := iptables.Table{}
+		return TableChainedFactory(&table)()
 	},
 	Relationships: map[string]Resources{
 		"chains": Chains,
 	},
 	Allowed: []Allowed{LIST_ALLOWED},
+	IdParam: Param{Name: "table", Pattern: "^(" + strings.Join(iptables.TableNames(), "|") + ")$"},
 }
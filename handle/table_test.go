@@ -0,0 +1,68 @@
+package handle_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestTableHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		t.Run("list tables", func(t *testing.T) {
+			data := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/iptables", nil, 200)
+			if data == nil || !reflect.DeepEqual(*data, []string{"filter", "mangle", "nat", "raw"}) {
+				t.Fatalf("unexpected tables: %v", data)
+			}
+		})
+
+		for table, chains := range iptables.BuiltinChains {
+			t.Run("list built in chains of "+table, func(t *testing.T) {
+				data := AssertHandler[[]string](t, http.MethodGet, "/api/v1/netns/test/iptables/"+table+"/chains", nil, 200)
+				if data == nil || !reflect.DeepEqual(*data, chains) {
+					t.Fatalf("expected %v, got %v", chains, data)
+				}
+			})
+		}
+
+		rulesPath := "/api/v1/netns/test/iptables/nat/chains/PREROUTING/rules"
+		rule := iptables.NewRule(iptables.Chain{})
+		rule.Target = iptables.DNAT
+		rule.InInterface = "wan"
+		rule.Protocol = "tcp"
+		rule.DstPort = "8080"
+		rule.TargetOptions = map[string]string{"to-destination": "192.168.100.20:80"}
+		rule.Comment = "web server"
+
+		var ruleId string
+		t.Run("create DNAT rule", func(t *testing.T) {
+			_, headers := AssertHandlerGetHeaders[any](t, http.MethodPut, rulesPath, rule, 201)
+			ruleId = strings.TrimPrefix(headers.Get("Location"), rulesPath+"/")
+		})
+		prerouting := iptables.NewChain(iptables.NewTable(testNS, "nat"), "PREROUTING")
+		defer fw().RuleResource(iptables.NewRule(prerouting)).Clear()
+
+		t.Run("get DNAT rule", func(t *testing.T) {
+			data := AssertHandler[iptables.Rule](t, http.MethodGet, rulesPath+"/"+ruleId, nil, 200)
+			if data == nil {
+				t.Fatal("missing body")
+			}
+			if data.Target != rule.Target || data.InInterface != rule.InInterface ||
+				data.Protocol != rule.Protocol || data.DstPort != rule.DstPort ||
+				!reflect.DeepEqual(data.TargetOptions, rule.TargetOptions) {
+				t.Fatalf("expected %#v, got %#v", rule, *data)
+			}
+		})
+
+		t.Run("DNAT is only for the nat table", func(t *testing.T) {
+			AssertHandlerFailKind(t, http.MethodPut, "/api/v1/netns/test/iptables/filter/chains/FORWARD/rules", rule, 400, resource.INVALID)
+		})
+
+		t.Run("remove DNAT rule", func(t *testing.T) {
+			AssertHandler[any](t, http.MethodDelete, rulesPath+"/"+ruleId, nil, 204)
+		})
+	})
+}
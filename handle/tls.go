@@ -0,0 +1,91 @@
+package handle
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/plockc/gateway/certs"
+	"github.com/plockc/gateway/logs"
+)
+
+// the HTTPS is served on HTTPSAddr with the CertFile and KeyFile, or with a self-signed
+// certificate generated into the CertDir if they are not configured, no HTTPS if empty
+var (
+	HTTPSAddr = ":8443"
+	CertFile  = ""
+	KeyFile   = ""
+	CertDir   = "/etc/gateway"
+	// RedirectHTTP has HTTP redirect to HTTPS instead of serving the API
+	RedirectHTTP = false
+)
+
+// loadCertificate loads the configured certificate, generating the self-signed one if needed,
+// and reloads it on SIGHUP
+func loadCertificate() (*certs.Certificate, error) {
+	certFile, keyFile := CertFile, KeyFile
+	if certFile == "" && keyFile == "" {
+		certFile, keyFile = filepath.Join(CertDir, "cert.pem"), filepath.Join(CertDir, "key.pem")
+		generated, err := certs.EnsureSelfSigned(certFile, keyFile, certs.LocalHosts()...)
+		if err != nil {
+			return nil, err
+		}
+		if generated {
+			fmt.Println("Generated a self-signed certificate at", certFile)
+		}
+	} else if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("both the certificate '%s' and key '%s' are needed", certFile, keyFile)
+	}
+	cert := certs.NewCertificate(certFile, keyFile)
+	if err := cert.Load(); err != nil {
+		return nil, err
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := cert.Load(); err != nil {
+				logs.Warnf("keeping the certificate: %s\n", err)
+				continue
+			}
+			fmt.Println("Reloaded the certificate with SHA-256 fingerprint", cert.Fingerprint())
+		}
+	}()
+	return cert, nil
+}
+
+// serveTLS serves the handler with HTTPS until it fails
+func serveTLS(handler http.Handler) error {
+	cert, err := loadCertificate()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Listening on", HTTPSAddr, "with certificate SHA-256 fingerprint", cert.Fingerprint())
+	server := &http.Server{
+		Addr:      HTTPSAddr,
+		Handler:   handler,
+		TLSConfig: &tls.Config{GetCertificate: cert.GetCertificate, MinVersion: tls.VersionTLS12},
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// RedirectToHTTPS sends the requests to the same host and path on the port of the HTTPSAddr
+type RedirectToHTTPS struct{}
+
+func (RedirectToHTTPS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host, _, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host = req.Host
+	}
+	if _, port, err := net.SplitHostPort(HTTPSAddr); err == nil && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	target := *req.URL
+	target.Scheme, target.Host = "https", host
+	http.Redirect(w, req, target.String(), http.StatusPermanentRedirect)
+}
@@ -0,0 +1,33 @@
+package handle_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/plockc/gateway/handle"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	defer func(addr string) { handle.HTTPSAddr = addr }(handle.HTTPSAddr)
+	for _, tc := range []struct {
+		httpsAddr string
+		host      string
+		location  string
+	}{
+		{":8443", "192.168.1.1:8000", "https://192.168.1.1:8443/api/v1/netns?x=1"},
+		{":443", "gateway.lan:8000", "https://gateway.lan/api/v1/netns?x=1"},
+		{"0.0.0.0:8443", "gateway.lan", "https://gateway.lan:8443/api/v1/netns?x=1"},
+	} {
+		handle.HTTPSAddr = tc.httpsAddr
+		u, err := url.Parse("/api/v1/netns?x=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := NewTestResponseWriter()
+		handle.RedirectToHTTPS{}.ServeHTTP(w, &http.Request{Method: http.MethodGet, URL: u, Host: tc.host, Header: http.Header{}})
+		if w.Code != http.StatusPermanentRedirect || w.Headers.Get("Location") != tc.location {
+			t.Fatalf("expected a redirect to %s, got %d to %s", tc.location, w.Code, w.Headers.Get("Location"))
+		}
+	}
+}
@@ -1,28 +1,28 @@
 package handle
 
 import (
-	"fmt"
-
 	"github.com/plockc/gateway/resource"
 )
 
-var Versions = Resources{
-	Name: "Version",
-	Factory: func(ids ...string) (resource.Resource, error) {
-		switch len(ids) {
-		case 0:
-			return Version{}, nil
-		default:
-			if ids[0] != "v1" {
-				return nil, fmt.Errorf("only v1 supported")
-			}
-			return Version{Name: ids[0]}, nil
+func VersionChainedFactory() (ChainedFactory, Factory) {
+	factory := func(version string) (resource.Resource, error) {
+		if version != "" && version != "v1" {
+			return nil, resource.NotFound("only v1 supported")
 		}
-	},
+		return Version{Name: version}, nil
+	}
+	return nil, factory
+}
+
+var Versions = Resources{
+	Label:          "Version",
+	ChainedFactory: VersionChainedFactory,
 	Relationships: map[string]Resources{
+		"audit": Audit,
 		"netns": Namespaces,
 	},
 	Allowed: []Allowed{GET_ALLOWED, LIST_ALLOWED},
+	IdParam: Param{Name: "version", Pattern: "^v1$"},
 }
 
 type Version struct {
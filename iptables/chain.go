@@ -40,18 +40,18 @@ func (chain ChainRes) Id() string {
 }
 
 func (chain ChainRes) Delete() error {
-	return chain.Runner().RunLine(DELETE_CHAIN.ChainCmd(chain.Id()))
+	return iptablesError(chain.Runner().RunLine(DELETE_CHAIN.TableChainCmd(chain.Table.Name, chain.Id())))
 }
 
 func (chain ChainRes) Create() error {
-	return chain.Runner().RunLine(NEW.ChainCmd(chain.Id()))
+	return iptablesError(chain.Runner().RunLine(NEW.TableChainCmd(chain.Table.Name, chain.Id())))
 }
 
 func (chain ChainRes) List() ([]string, error) {
 	run := chain.Runner()
 	results, err := run.ExecLine("iptables -t " + chain.Table.Name + " -L")
 	if err != nil {
-		return nil, err
+		return nil, iptablesError(err)
 	}
 	chainLines := funcs.Keep(strings.Split(results.Out, "\n"), func(s string) bool {
 		return strings.HasPrefix(s, "Chain")
@@ -67,5 +67,5 @@ func (chain ChainRes) List() ([]string, error) {
 }
 
 func (chain ChainRes) Clear() error {
-	return chain.Runner().RunLine("iptables -X")
+	return iptablesError(chain.Runner().RunLine(DELETE_CHAIN.TableChainCmd(chain.Table.Name, "")))
 }
@@ -1,5 +1,7 @@
 package iptables
 
+import "strings"
+
 type ChainCmd string
 
 const (
@@ -12,3 +14,9 @@ const (
 func (ipcc ChainCmd) ChainCmd(name string) string {
 	return "iptables " + string(ipcc) + " " + name
 }
+
+// TableChainCmd is for a chain in the table, without a name
+// the command is for all the chains in the table
+func (ipcc ChainCmd) TableChainCmd(table, name string) string {
+	return strings.TrimSuffix("iptables -t "+table+" "+string(ipcc)+" "+name, " ")
+}
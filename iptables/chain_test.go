@@ -8,6 +8,7 @@ import (
 )
 
 func TestChainResource(t *testing.T) {
+	requireIntegration(t)
 	table := iptables.FilterTable(testNS)
 	chain := iptables.NewChain(table, "tchain")
 	chainNames := func(cs ...iptables.Chain) []string {
@@ -0,0 +1,35 @@
+package iptables
+
+import "github.com/plockc/gateway/resource"
+
+// IPTablesErrors have the kinds of the failures of iptables by their messages,
+// iptables exits with 2 for bad parameters
+var IPTablesErrors = []resource.Match{
+	{Message: "No chain/target/match by that name", Kind: resource.NOT_FOUND},
+	{Message: "does a matching rule exist", Kind: resource.NOT_FOUND},
+	{Message: "Chain already exists", Kind: resource.CONFLICT},
+	{Message: "Directory not empty", Kind: resource.CONFLICT},
+	{Message: "Too many links", Kind: resource.CONFLICT},
+	{Message: "Couldn't load", Kind: resource.UNSUPPORTED},
+	{Message: "not supported", Kind: resource.UNSUPPORTED},
+	{Code: 2, Kind: resource.INVALID},
+}
+
+// IPSetErrors have the kinds of the failures of ipset by their messages
+var IPSetErrors = []resource.Match{
+	{Message: "does not exist", Kind: resource.NOT_FOUND},
+	{Message: "it's not added", Kind: resource.NOT_FOUND},
+	{Message: "already exists", Kind: resource.CONFLICT},
+	{Message: "already added", Kind: resource.CONFLICT},
+	{Message: "in use by a kernel component", Kind: resource.CONFLICT},
+	{Message: "not supported", Kind: resource.UNSUPPORTED},
+	{Message: "Syntax error", Kind: resource.INVALID},
+}
+
+func iptablesError(err error) error {
+	return resource.Classify(err, IPTablesErrors...)
+}
+
+func ipsetError(err error) error {
+	return resource.Classify(err, IPSetErrors...)
+}
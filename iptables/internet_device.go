@@ -1,7 +1,36 @@
 package iptables
 
+import (
+	"fmt"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/resource"
+)
+
 const (
 	DOWNTIME_CHAIN = "downtime"
 )
 
-var InternetDevice = "eth1"
+// InternetDevice overrides the detection of the Internet device when not empty
+var InternetDevice = ""
+
+// DetectInternetDevice is the InternetDevice if set, otherwise the device of the
+// default route in the namespace
+func DetectInternetDevice(ns resource.NS) (string, error) {
+	if InternetDevice != "" {
+		return InternetDevice, nil
+	}
+	res, err := ns.Runner().Exec(address.DefaultRouteJsonCmd())
+	if err != nil {
+		return "", fmt.Errorf("failed to detect the Internet device: %w", err)
+	}
+	routes, err := address.RoutesOutFromString(res.Out)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse routes: %w", err)
+	}
+	dev, err := routes.DefaultDev()
+	if err != nil {
+		return "", fmt.Errorf("failed to detect the Internet device in %s: %w", ns, err)
+	}
+	return dev, nil
+}
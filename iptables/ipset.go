@@ -6,9 +6,17 @@ import (
 	"github.com/plockc/gateway/resource"
 )
 
+const (
+	HASH_MAC = "hash:mac"
+	// HASH_IP sets have IPv4 addresses, matched as the destination of a rule
+	HASH_IP = "hash:ip"
+)
+
 type IPSet struct {
 	Name        string `json:"-"`
 	resource.NS `json:"-"`
+	// Type is HASH_MAC when empty
+	Type string `json:"type,omitempty"`
 }
 
 var _ resource.Resource = IPSetRes{}
@@ -21,6 +29,21 @@ func (ipSet IPSet) String() string {
 	return ipSet.NS.String() + ":ipSet[" + ipSet.Name + "]"
 }
 
+func (ipSet IPSet) SetType() string {
+	if ipSet.Type == "" {
+		return HASH_MAC
+	}
+	return ipSet.Type
+}
+
+func (ipSet IPSet) Validate() error {
+	switch ipSet.SetType() {
+	case HASH_MAC, HASH_IP:
+		return nil
+	}
+	return resource.Invalid("set type '%s' is not %s or %s", ipSet.Type, HASH_MAC, HASH_IP)
+}
+
 func (ipSet IPSet) IPSetResource() *IPSetRes {
 	return &IPSetRes{IPSet: ipSet}
 }
@@ -35,17 +58,35 @@ func (ipSet IPSetRes) Id() string {
 }
 
 func (ipSet IPSetRes) Delete() error {
-	return ipSet.Runner().RunLine("ipset destroy " + ipSet.Id())
+	return ipsetError(ipSet.Runner().RunLine("ipset destroy " + ipSet.Id()))
 }
 
 func (ipSet IPSetRes) Create() error {
-	return ipSet.Runner().RunLine("ipset -N " + ipSet.Id() + " hash:mac")
+	if err := ipSet.Validate(); err != nil {
+		return err
+	}
+	return ipsetError(ipSet.Runner().RunLine("ipset -N " + ipSet.Id() + " " + ipSet.SetType()))
 }
 
 func (ipSet IPSetRes) List() ([]string, error) {
 	runner := ipSet.Runner()
 	if err := runner.RunLine("ipset list -n"); err != nil {
-		return nil, err
+		return nil, ipsetError(err)
 	}
 	return strings.Split(runner.LastOut(), "\n"), nil
 }
+
+// LoadType has the Type of the set from `ipset list -t`
+func (ipSet *IPSetRes) LoadType() error {
+	res, err := ipSet.Runner().Exec([]string{"ipset", "list", "-t", ipSet.Name})
+	if err != nil {
+		return ipsetError(err)
+	}
+	for _, line := range strings.Split(res.Out, "\n") {
+		if strings.HasPrefix(line, "Type: ") {
+			ipSet.Type = strings.TrimSpace(strings.TrimPrefix(line, "Type: "))
+			return nil
+		}
+	}
+	return resource.NotFound("no type for %s in: %s", ipSet.IPSet, res.Out)
+}
@@ -2,6 +2,7 @@ package iptables
 
 import (
 	"fmt"
+	"net"
 	"strings"
 
 	"github.com/plockc/gateway/address"
@@ -9,13 +10,23 @@ import (
 	"github.com/plockc/gateway/resource"
 )
 
+// Member is a MAC of a hash:mac set, or an IP of a hash:ip set
 type Member struct {
 	address.MAC `json:"-"`
+	IP          net.IP `json:"-"`
 	IPSet       `json:"-"`
 }
 
 func (member Member) String() string {
-	return member.IPSet.String() + ":member[" + member.MAC.String() + "]"
+	return member.IPSet.String() + ":member[" + member.Element() + "]"
+}
+
+// Element is the address as it is added to the set
+func (member Member) Element() string {
+	if member.IP != nil {
+		return member.IP.String()
+	}
+	return member.MAC.String()
 }
 
 func (m Member) MemberResource() *MemberRes {
@@ -26,6 +37,22 @@ func NewMember(ipSet IPSet, mac address.MAC) Member {
 	return Member{MAC: mac, IPSet: ipSet}
 }
 
+func NewIPMember(ipSet IPSet, ip net.IP) Member {
+	return Member{IP: ip, IPSet: ipSet}
+}
+
+// MemberFromString parses the element as a MAC, or else as an IPv4 address
+func MemberFromString(ipSet IPSet, element string) (Member, error) {
+	if mac, err := address.MACFromString(element); err == nil {
+		return NewMember(ipSet, mac), nil
+	}
+	ip := net.ParseIP(element).To4()
+	if ip == nil {
+		return Member{}, resource.Invalid("'%s' is not a MAC or an IPv4 address", element)
+	}
+	return NewIPMember(ipSet, ip), nil
+}
+
 var _ resource.Resource = &MemberRes{}
 
 type MemberRes struct {
@@ -34,15 +61,15 @@ type MemberRes struct {
 }
 
 func (m MemberRes) Id() string {
-	return m.MAC.String()
+	return m.Element()
 }
 
 func (m MemberRes) Create() error {
-	return m.Runner().RunLine("ipset add " + m.IPSet.Name + " " + m.MAC.String())
+	return ipsetError(m.Runner().RunLine("ipset add " + m.IPSet.Name + " " + m.Element()))
 }
 
 func (m MemberRes) Delete() error {
-	return m.Runner().RunLine("ipset del " + m.IPSet.Name + " " + m.MAC.String())
+	return ipsetError(m.Runner().RunLine("ipset del " + m.IPSet.Name + " " + m.Element()))
 }
 
 func (m MemberRes) List() ([]string, error) {
@@ -50,7 +77,7 @@ func (m MemberRes) List() ([]string, error) {
 	setName := m.IPSet.Name
 	err := run.RunLine("ipset save -sorted " + setName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list members of ipset '%s': %w", setName, err)
+		return nil, fmt.Errorf("failed to list members of ipset '%s': %w", setName, ipsetError(err))
 	}
 	elems := funcs.Keep(strings.Split(run.LastOut(), "\n"), func(s string) bool {
 		return strings.HasPrefix(s, "add ")
@@ -65,5 +92,5 @@ func (m MemberRes) List() ([]string, error) {
 }
 
 func (m MemberRes) Clear() error {
-	return m.Runner().RunLine("ipset flush " + m.IPSet.Name)
+	return ipsetError(m.Runner().RunLine("ipset flush " + m.IPSet.Name))
 }
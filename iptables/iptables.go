@@ -5,14 +5,80 @@ import "github.com/plockc/gateway/resource"
 type IPRuleCmd string
 
 const (
-	DROP   = "DROP"
-	RETURN = "RETURN"
+	ACCEPT     = "ACCEPT"
+	DROP       = "DROP"
+	RETURN     = "RETURN"
+	DNAT       = "DNAT"
+	MASQUERADE = "MASQUERADE"
+	MARK       = "MARK"
+	REJECT     = "REJECT"
+	LOG        = "LOG"
+	NFLOG      = "NFLOG"
+	REDIRECT   = "REDIRECT"
+	CONNMARK   = "CONNMARK"
 
 	APPEND IPRuleCmd = "-A"
 	CHECK  IPRuleCmd = "-C"
 	DELETE IPRuleCmd = "-D"
 )
 
+// Targets are the targets that are not chains, with the tables
+// that can use them, no tables means every table can use the target
+var Targets = map[string][]string{
+	ACCEPT:     nil,
+	DROP:       nil,
+	RETURN:     nil,
+	DNAT:       {"nat"},
+	MASQUERADE: {"nat"},
+	MARK:       {"mangle"},
+	REJECT:     {"filter"},
+	LOG:        nil,
+	NFLOG:      nil,
+	REDIRECT:   {"nat"},
+	CONNMARK:   {"mangle"},
+}
+
+// AllowedTargetOptions are the options each target can have, without the leading dashes
+var AllowedTargetOptions = map[string][]string{
+	DNAT:       {"to-destination"},
+	MASQUERADE: {"to-ports"},
+	MARK:       {"set-mark", "set-xmark"},
+	REJECT:     {"reject-with"},
+	LOG:        {"log-prefix", "log-level"},
+	NFLOG:      {"nflog-group", "nflog-prefix"},
+	REDIRECT:   {"to-ports"},
+	// iptables-save adds the masks to save-mark and restore-mark
+	CONNMARK: {"save-mark", "restore-mark", "nfmask", "ctmask"},
+}
+
+// NFLOG_GROUP is the netlink group of the rules logging blocked attempts
+const NFLOG_GROUP = 2
+
+// BlockingTargets are the targets that can log the blocked attempts,
+// flush the connections of the blocked devices and show them the notice
+var BlockingTargets = []string{DROP, REJECT}
+
+// NoticePort is where the gateway serves the downtime notice, the HTTP traffic
+// of devices blocked by rules with Notice is redirected to it
+var NoticePort = 8099
+
+// RejectWith are the replies REJECT can send, tcp-reset needs the tcp protocol
+var RejectWith = []string{
+	"icmp-net-unreachable", "icmp-host-unreachable", "icmp-port-unreachable",
+	"icmp-proto-unreachable", "icmp-net-prohibited", "icmp-host-prohibited",
+	"icmp-admin-prohibited", "tcp-reset",
+}
+
+// LogLevels are the syslog levels for LOG, which also accepts the numbers 0 to 7,
+// iptables-save has the number and leaves out the default of warning (4)
+var LogLevels = []string{"emerg", "alert", "crit", "error", "warning", "notice", "info", "debug"}
+
+// LOG_PREFIX_MAX and NFLOG_PREFIX_MAX are the longest prefixes the kernel keeps
+const (
+	LOG_PREFIX_MAX   = 29
+	NFLOG_PREFIX_MAX = 63
+)
+
 func (iptc IPRuleCmd) FilterRule(chain, match, target string) string {
 	return "iptables " + string(iptc) + " " + chain + " " + match + " -j " + target
 }
@@ -1,10 +1,14 @@
 package iptables_test
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	osexec "os/exec"
+	"path/filepath"
 	"testing"
 
+	"github.com/plockc/gateway/exec"
 	"github.com/plockc/gateway/funcs"
 	"github.com/plockc/gateway/handle"
 	"github.com/plockc/gateway/resource"
@@ -12,14 +16,68 @@ import (
 
 var (
 	testNS = resource.NewNS("iptablestest")
+
+	record = flag.Bool("record", false, "record the transcripts in testdata by running the commands in a namespace")
+
+	// integration is true when the namespace for the tests could be set up
+	integration bool
 )
 
+// requireIntegration skips tests that run commands in the namespace unless running as root
+// with iptables and ipset
+func requireIntegration(t *testing.T) {
+	if !integration {
+		t.Skip("requires root with iptables and ipset")
+	}
+}
+
+// replay runs the test with the commands replayed from the transcript in testdata,
+// with -record the setup is run first then the commands are run in the namespace
+// and saved as the transcript
+func replay(t *testing.T, name string, setup func() error, test func()) *exec.Replayer {
+	path := filepath.Join("testdata", name+".json")
+	defer func(executor exec.Executor) { resource.DefaultExecutor = executor }(resource.DefaultExecutor)
+	if *record {
+		requireIntegration(t)
+		if err := setup(); err != nil {
+			t.Fatal(err)
+		}
+		recorder := exec.NewRecorder(exec.System{})
+		resource.DefaultExecutor = recorder
+		test()
+		if err := recorder.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		return exec.NewReplayer(recorder.Transcript)
+	}
+	replayer, err := exec.LoadReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource.DefaultExecutor = replayer
+	test()
+	return replayer
+}
+
 func TestMain(m *testing.M) {
 	// it is the internal client outbound that can get blocked for downtime
 	exitCode := func() int {
+		flag.Parse()
+		handle.NS = testNS
+
+		if os.Geteuid() != 0 {
+			fmt.Println("skipping integration tests, requires root")
+			return m.Run()
+		}
+		for _, cmd := range []string{"iptables", "iptables-save", "ipset"} {
+			if _, err := osexec.LookPath(cmd); err != nil {
+				fmt.Println("skipping integration tests, missing", cmd)
+				return m.Run()
+			}
+		}
+
 		testRunner := testNS.Runner()
 		testNSLifecycle := resource.Lifecycle{Resource: testNS.NSResource()}
-		handle.NS = testNS
 
 		testNSLifecycle.EnsureDeleted()
 
@@ -33,6 +91,7 @@ func TestMain(m *testing.M) {
 			fmt.Println(err)
 			return 1
 		}
+		integration = true
 
 		return m.Run()
 	}()
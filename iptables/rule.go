@@ -4,24 +4,72 @@ import (
 	"fmt"
 	"math/rand"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/plockc/gateway/funcs"
 	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
 )
 
-var RuleIdRegex = regexp.MustCompile(`.*gw-dt\[([0-9a-f]+)]: (.*)`)
+// RuleIdRegex finds the Id, the flags, then the comment of a rule
+var RuleIdRegex = regexp.MustCompile(`.*gw-dt\[([0-9a-f]+)]((?:\+[a-z]+(?:=[0-9]+)?)*): (.*)`)
+
+// FLUSH_FLAG in the comment of a rule keeps FlushConnections
+const FLUSH_FLAG = "+flush"
+
+// NOTICE_FLAG in the comment of a rule keeps Notice
+const NOTICE_FLAG = "+notice"
+
+// START_FLAG in the comment of a rule keeps the Start as unix seconds, like +start=1760904000
+const START_FLAG = "+start="
+
+// END_FLAG in the comment of a rule keeps the End as unix seconds, like +end=1760929200
+const END_FLAG = "+end="
+
+var (
+	startFlagRegex = regexp.MustCompile(`\+start=([0-9]+)`)
+	endFlagRegex   = regexp.MustCompile(`\+end=([0-9]+)`)
+)
+
+// LogIdRegex finds the NFLOG rule logging the attempts blocked by a rule,
+// which is not matched by RuleIdRegex so it is not listed as a rule
+var LogIdRegex = regexp.MustCompile(`.*gw-dt-log\[([0-9a-f]+)]`)
+
+// NoticeIdRegex finds the rules rejecting HTTPS and redirecting HTTP to the notice
+// for a rule, which are not matched by RuleIdRegex so they are not listed as rules
+var NoticeIdRegex = regexp.MustCompile(`.*gw-dt-notice\[([0-9a-f]+)]`)
 
 type Rule struct {
-	Id          uint32
-	Chain       `json:"-"`
-	Target      string     `json:"target"`
-	Start       *time.Time `json:"start"`
-	End         *time.Time `json:"end"`
-	MatchSetSrc string     `json:"matchSetSrc"`
-	Comment     string     `json:"comment"`
+	Id     uint32
+	Chain  `json:"-"`
+	Target string `json:"target"`
+	// Start and End bound when the rule matches, with the time match of iptables or
+	// meta time of nft, the rule matches from its Start until before its End
+	Start        *time.Time `json:"start"`
+	End          *time.Time `json:"end"`
+	MatchSetSrc  string     `json:"matchSetSrc"`
+	MatchSetDst  string     `json:"matchSetDst"`
+	InInterface  string     `json:"inInterface"`
+	OutInterface string     `json:"outInterface"`
+	Protocol     string     `json:"protocol"`
+	// DstPort needs the tcp or udp Protocol, and can be a range like 8000:8080
+	DstPort string `json:"dstPort"`
+	// TargetOptions are the options of the target without the leading dashes,
+	// options that are flags have an empty value
+	TargetOptions map[string]string `json:"targetOptions"`
+	Comment       string            `json:"comment"`
+	// LogAttempts adds an NFLOG rule ahead of a DROP or REJECT rule
+	// to log the packets that are blocked
+	LogAttempts bool `json:"logAttempts"`
+	// FlushConnections deletes the tracked connections of the members of the MatchSetSrc
+	// blocked by a DROP or REJECT rule when it is created, or when it starts if later
+	FlushConnections bool `json:"flushConnections"`
+	// Notice redirects the HTTP traffic of the devices blocked by a DROP or REJECT rule
+	// to the downtime notice, and rejects their HTTPS traffic so it fails quickly
+	Notice bool `json:"notice"`
 }
 
 func NewRule(c Chain) Rule {
@@ -40,21 +88,285 @@ func (r Rule) RuleResource() *RuleRes {
 	return &RuleRes{Rule: r}
 }
 
+// RuleComment has the Id so the rules managed by the gateway can be found,
+// and the flags for the fields that are not in the rule spec
+func (r Rule) RuleComment() string {
+	flags := ""
+	if r.FlushConnections {
+		flags += FLUSH_FLAG
+	}
+	if r.Notice {
+		flags += NOTICE_FLAG
+	}
+	if r.Start != nil {
+		flags += START_FLAG + strconv.FormatInt(r.Start.Unix(), 10)
+	}
+	if r.End != nil {
+		flags += END_FLAG + strconv.FormatInt(r.End.Unix(), 10)
+	}
+	return fmt.Sprintf("gw-dt[%s]%s: %s", r.RuleId(), flags, r.Comment)
+}
+
+// LoadComment sets the Id, flags and comment from the comment of a managed rule
+func (r *Rule) LoadComment(comment string) error {
+	matches := RuleIdRegex.FindStringSubmatch(comment)
+	if len(matches) != 4 {
+		return fmt.Errorf("failed to process Id from comment: %v", comment)
+	}
+	id, err := ParseRuleId(matches[1])
+	if err != nil {
+		return err
+	}
+	r.Id = id
+	r.FlushConnections = strings.Contains(matches[2], FLUSH_FLAG)
+	r.Notice = strings.Contains(matches[2], NOTICE_FLAG)
+	if start := startFlagRegex.FindStringSubmatch(matches[2]); len(start) > 1 {
+		seconds, err := strconv.ParseInt(start[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse the start of %s: %w", comment, err)
+		}
+		startTime := time.Unix(seconds, 0)
+		r.Start = &startTime
+	}
+	if end := endFlagRegex.FindStringSubmatch(matches[2]); len(end) > 1 {
+		seconds, err := strconv.ParseInt(end[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse the end of %s: %w", comment, err)
+		}
+		endTime := time.Unix(seconds, 0)
+		r.End = &endTime
+	}
+	r.Comment = matches[3]
+	return nil
+}
+
+// Active rules have started and not yet ended at the time
+func (r Rule) Active(now time.Time) bool {
+	return (r.Start == nil || !r.Start.After(now)) && (r.End == nil || r.End.After(now))
+}
+
 // TODO: sanitize the comment
 func (r Rule) CoreArgs() []string {
 	return []string{r.Chain.Name, "-t", r.Table.Name}
 }
 
+// LogComment has the Id of the rule for the NFLOG rule logging its blocked attempts,
+// it is also the prefix of the logged packets
+func (r Rule) LogComment() string {
+	return fmt.Sprintf("gw-dt-log[%s]", r.RuleId())
+}
+
+// LogRule has the same matches as the rule with the NFLOG target
+func (r Rule) LogRule() Rule {
+	log := r
+	log.Target = NFLOG
+	log.TargetOptions = map[string]string{
+		"nflog-group":  strconv.Itoa(NFLOG_GROUP),
+		"nflog-prefix": r.LogComment(),
+	}
+	log.LogAttempts = false
+	return log
+}
+
+// NoticeComment has the Id of the rule for the rules of its notice
+func (r Rule) NoticeComment() string {
+	return fmt.Sprintf("gw-dt-notice[%s]", r.RuleId())
+}
+
+// HTTPSRejectRule has the same matches as the rule, rejecting HTTPS with a reset
+// so browsers fail quickly instead of waiting for a timeout
+func (r Rule) HTTPSRejectRule() Rule {
+	reject := r.noticeRule("443")
+	reject.Target = REJECT
+	reject.TargetOptions = map[string]string{"reject-with": "tcp-reset"}
+	return reject
+}
+
+// NoticeRedirectRule has the same matches as the rule in the nat PREROUTING chain,
+// redirecting HTTP to the NoticePort of the gateway
+func (r Rule) NoticeRedirectRule() Rule {
+	redirect := r.noticeRule("80")
+	redirect.Chain = NewChain(NewTable(r.NS, "nat"), "PREROUTING")
+	redirect.Target = REDIRECT
+	redirect.TargetOptions = map[string]string{"to-ports": strconv.Itoa(NoticePort)}
+	return redirect
+}
+
+func (r Rule) noticeRule(port string) Rule {
+	notice := r
+	notice.Protocol = "tcp"
+	notice.DstPort = port
+	notice.LogAttempts = false
+	notice.FlushConnections = false
+	notice.Notice = false
+	return notice
+}
+
 func (r Rule) Args() []string {
+	return r.args(r.RuleComment())
+}
+
+// LogArgs are the args for the NFLOG rule logging the attempts blocked by the rule
+func (r Rule) LogArgs() []string {
+	return r.LogRule().args(r.LogComment())
+}
+
+// NoticeArgs are the args for the HTTPS reject rule then the HTTP redirect rule of the notice
+func (r Rule) NoticeArgs() [][]string {
+	return [][]string{
+		r.HTTPSRejectRule().args(r.NoticeComment()),
+		r.NoticeRedirectRule().args(r.NoticeComment()),
+	}
+}
+
+func (r Rule) args(comment string) []string {
 	args := []string{}
+	if len(r.InInterface) > 0 {
+		args = append(args, "-i", r.InInterface)
+	}
+	if len(r.OutInterface) > 0 {
+		args = append(args, "-o", r.OutInterface)
+	}
+	if len(r.Protocol) > 0 {
+		args = append(args, "-p", r.Protocol)
+	}
+	if len(r.DstPort) > 0 {
+		args = append(args, "-m", r.Protocol, "--dport", r.DstPort)
+	}
 	if len(r.MatchSetSrc) > 0 {
 		args = append(args, []string{"-m", "set", "--match-set", r.MatchSetSrc, "src"}...)
 	}
-	args = append(
-		args, []string{
-			"-m", "comment", "--comment", fmt.Sprintf("gw-dt[%s]: %s", r.RuleId(), r.Comment)}...,
-	)
-	return append(r.CoreArgs(), append(args, "-j", r.Target)...)
+	if len(r.MatchSetDst) > 0 {
+		args = append(args, []string{"-m", "set", "--match-set", r.MatchSetDst, "dst"}...)
+	}
+	args = append(args, r.timeArgs()...)
+	args = append(args, []string{"-m", "comment", "--comment", comment}...)
+	args = append(args, "-j", r.Target)
+	for _, option := range r.TargetOptionNames() {
+		args = append(args, "--"+option)
+		if value := r.TargetOptions[option]; value != "" {
+			args = append(args, value)
+		}
+	}
+	return append(r.CoreArgs(), args...)
+}
+
+// TIME_MATCH_FORMAT is the UTC date and time of the time match
+const TIME_MATCH_FORMAT = "2006-01-02T15:04:05"
+
+// TIME_MATCH_MAX is past the last date the time match can have
+var TIME_MATCH_MAX = time.Date(2038, 1, 19, 0, 0, 0, 0, time.UTC)
+
+// timeArgs match the packets from the Start until the End, the stop of the time match
+// is the last second matched while the End is the first second not active
+func (r Rule) timeArgs() []string {
+	if r.Start == nil && r.End == nil {
+		return nil
+	}
+	args := []string{"-m", "time"}
+	if r.Start != nil {
+		args = append(args, "--datestart", r.Start.UTC().Format(TIME_MATCH_FORMAT))
+	}
+	if r.End != nil {
+		args = append(args, "--datestop", r.End.Add(-time.Second).UTC().Format(TIME_MATCH_FORMAT))
+	}
+	return args
+}
+
+// TargetOptionNames are sorted so the args are always in the same order
+func (r Rule) TargetOptionNames() []string {
+	names := []string{}
+	for name := range r.TargetOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks the matches of the rule can be used together
+func (r Rule) Validate() error {
+	if len(r.DstPort) > 0 && r.Protocol != "tcp" && r.Protocol != "udp" {
+		return resource.Invalid("dstPort needs protocol tcp or udp, protocol is '%s'", r.Protocol)
+	}
+	tables, ok := Targets[r.Target]
+	if !ok && len(r.TargetOptions) > 0 {
+		return resource.Invalid("jumping to chain '%s' cannot have target options", r.Target)
+	}
+	if len(tables) > 0 && !slices.Contains(tables, r.Table.Name) {
+		return resource.Invalid("target %s can only be used in tables %v", r.Target, tables)
+	}
+	if r.LogAttempts && !slices.Contains(BlockingTargets, r.Target) {
+		return resource.Invalid("only %v can log attempts, target is %s", BlockingTargets, r.Target)
+	}
+	if r.FlushConnections && !slices.Contains(BlockingTargets, r.Target) {
+		return resource.Invalid("only %v can flush connections, target is %s", BlockingTargets, r.Target)
+	}
+	for _, t := range []*time.Time{r.Start, r.End} {
+		if t != nil && !t.Before(TIME_MATCH_MAX) {
+			return resource.Invalid("start and end need to be before %s", TIME_MATCH_MAX.Format("2006-01-02"))
+		}
+	}
+	if r.Start != nil && r.End != nil && !r.End.After(*r.Start) {
+		return resource.Invalid("end %s needs to be after start %s", r.End.Format(time.RFC3339), r.Start.Format(time.RFC3339))
+	}
+	// only the members of the set are flushed, never every device on the network
+	if r.FlushConnections && r.MatchSetSrc == "" {
+		return resource.Invalid("flushConnections needs matchSetSrc for the devices to flush")
+	}
+	if r.Notice {
+		if !slices.Contains(BlockingTargets, r.Target) || r.Table.Name != "filter" {
+			return resource.Invalid("only %v in the filter table can show the notice, target is %s", BlockingTargets, r.Target)
+		}
+		// the matches are copied to the redirect in PREROUTING, which has no output interface
+		if r.Protocol != "" || r.DstPort != "" || r.OutInterface != "" {
+			return resource.Invalid("rules showing the notice cannot match the protocol, dstPort or outInterface")
+		}
+	}
+	for _, option := range r.TargetOptionNames() {
+		if !slices.Contains(AllowedTargetOptions[r.Target], option) {
+			return resource.Invalid(
+				"target %s does not have option '%s', allowed: %v",
+				r.Target, option, AllowedTargetOptions[r.Target],
+			)
+		}
+	}
+	return r.validateOptionValues()
+}
+
+// validateOptionValues checks the values of the options that only take some values
+func (r Rule) validateOptionValues() error {
+	if rejectWith, ok := r.TargetOptions["reject-with"]; ok {
+		if !slices.Contains(RejectWith, rejectWith) {
+			return resource.Invalid("reject-with '%s' is not one of %v", rejectWith, RejectWith)
+		}
+		if rejectWith == "tcp-reset" && r.Protocol != "tcp" {
+			return resource.Invalid("reject-with tcp-reset needs protocol tcp, protocol is '%s'", r.Protocol)
+		}
+	}
+	if level, ok := r.TargetOptions["log-level"]; ok {
+		if n, err := strconv.Atoi(level); (err != nil || n < 0 || n > 7) && !slices.Contains(LogLevels, level) {
+			return resource.Invalid("log-level '%s' is not 0 to 7 or one of %v", level, LogLevels)
+		}
+	}
+	if prefix, ok := r.TargetOptions["log-prefix"]; ok && len(prefix) > LOG_PREFIX_MAX {
+		return resource.Invalid("log-prefix '%s' is longer than %d", prefix, LOG_PREFIX_MAX)
+	}
+	if group, ok := r.TargetOptions["nflog-group"]; ok {
+		if _, err := strconv.ParseUint(group, 10, 16); err != nil {
+			return resource.Invalid("nflog-group '%s' is not 0 to 65535", group)
+		}
+	}
+	if prefix, ok := r.TargetOptions["nflog-prefix"]; ok && len(prefix) > NFLOG_PREFIX_MAX {
+		return resource.Invalid("nflog-prefix '%s' is longer than %d", prefix, NFLOG_PREFIX_MAX)
+	}
+	if r.Target == CONNMARK {
+		_, save := r.TargetOptions["save-mark"]
+		_, restore := r.TargetOptions["restore-mark"]
+		if save == restore {
+			return resource.Invalid("CONNMARK needs one of the save-mark or restore-mark options")
+		}
+	}
+	return nil
 }
 
 func (r Rule) String() string {
@@ -73,7 +385,24 @@ func (r RuleRes) Id() string {
 }
 
 func (r RuleRes) Create() error {
-	return r.Runner().Batch(append([]string{"iptables", "-A"}, r.Args()...))
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	cmds := [][]string{append([]string{"iptables", "-A"}, r.Args()...)}
+	if r.Notice {
+		// the HTTPS reject is ahead so it is not dropped, the redirect is in another table
+		notice := r.NoticeArgs()
+		cmds = [][]string{
+			append([]string{"iptables", "-A"}, notice[0]...),
+			cmds[0],
+			append([]string{"iptables", "-A"}, notice[1]...),
+		}
+	}
+	if r.LogAttempts {
+		// the log rule is ahead so it sees the packets before they are blocked
+		cmds = append([][]string{append([]string{"iptables", "-A"}, r.LogArgs()...)}, cmds...)
+	}
+	return iptablesError(r.Runner().Batch(cmds...))
 }
 
 func (r RuleRes) Delete() error {
@@ -81,13 +410,22 @@ func (r RuleRes) Delete() error {
 	if err != nil {
 		return err
 	}
-	return r.Runner().Batch(append([]string{"iptables", "-D"}, r.Args()...))
+	cmds := [][]string{append([]string{"iptables", "-D"}, r.Args()...)}
+	if r.LogAttempts {
+		cmds = append(cmds, append([]string{"iptables", "-D"}, r.LogArgs()...))
+	}
+	if r.Notice {
+		for _, args := range r.NoticeArgs() {
+			cmds = append(cmds, append([]string{"iptables", "-D"}, args...))
+		}
+	}
+	return iptablesError(r.Runner().Batch(cmds...))
 }
 
 func (r RuleRes) List() ([]string, error) {
 	res, err := r.Runner().Exec(append([]string{"iptables", "-v", "-L"}, r.CoreArgs()...))
 	if err != nil {
-		return nil, err
+		return nil, iptablesError(err)
 	}
 	ids := []string{}
 	for _, l := range strings.Split(res.Out, "\n") {
@@ -125,7 +463,7 @@ func (r RuleRes) Clear() error {
 func ParseRuleId(s string) (uint32, error) {
 	rId, err := strconv.ParseUint(s, 16, 32)
 	if err != nil {
-		return 0, err
+		return 0, resource.Invalid("rule Id '%s' is not hex: %w", s, err)
 	}
 	return uint32(rId), nil
 }
@@ -133,67 +471,174 @@ func ParseRuleId(s string) (uint32, error) {
 func (r *RuleRes) Load() error {
 	res, err := r.Runner().Exec([]string{"iptables-save", "-t", r.Table.Name})
 	if err != nil {
-		return err
+		return iptablesError(err)
 	}
 	// remove rules not in the chain or not managed by this program
-	rules := funcs.Keep(strings.Split(res.Out, "\n"), func(s string) bool {
-		if !strings.HasPrefix(s, "-A "+r.Chain.Name+" ") {
-			return false
-		}
+	inChain := funcs.Keep(strings.Split(res.Out, "\n"), func(s string) bool {
+		return strings.HasPrefix(s, "-A "+r.Chain.Name+" ")
+	})
+	rules := funcs.Keep(inChain, func(s string) bool {
 		matches := RuleIdRegex.FindStringSubmatch(s)
-		return len(matches) >= 2
+		return len(matches) >= 2 && matches[1] == r.RuleId()
 	})
 	if len(rules) < 1 {
-		return fmt.Errorf("expected a matching rule, got %v", rules)
+		return resource.NotFound("expected a matching rule for %s", r.RuleId())
 	}
+	logRules := funcs.Keep(inChain, func(s string) bool {
+		matches := LogIdRegex.FindStringSubmatch(s)
+		return len(matches) >= 2 && matches[1] == r.RuleId()
+	})
 
-	ruleSpec := strings.Split(rules[0], " ")
+	// only the fields from the rule spec are kept, the rest are cleared
+	r.Rule = Rule{
+		Id: r.Rule.Id, Chain: r.Chain, Target: RETURN, Start: r.Start, End: r.End,
+		LogAttempts: len(logRules) > 0,
+	}
+	ruleSpec, err := SplitRuleSpec(rules[0])
+	if err != nil {
+		return err
+	}
+	// arg is the rule spec at index i after checking it is there
+	arg := func(i int) (string, error) {
+		if i >= len(ruleSpec) {
+			return "", fmt.Errorf("rule spec ended early: %s", ruleSpec)
+		}
+		return ruleSpec[i], nil
+	}
+	// args are the expected number of rule spec elements from index i
+	args := func(i, n int) ([]string, error) {
+		if i+n > len(ruleSpec) {
+			return nil, fmt.Errorf("rule spec ended early: %s", ruleSpec)
+		}
+		return ruleSpec[i : i+n], nil
+	}
 	i := 2
 	for i < len(ruleSpec) {
 		switch ruleSpec[i] {
+		case "-i", "-o", "-p":
+			value, err := arg(i + 1)
+			if err != nil {
+				return err
+			}
+			switch ruleSpec[i] {
+			case "-i":
+				r.InInterface = value
+			case "-o":
+				r.OutInterface = value
+			case "-p":
+				r.Protocol = value
+			}
+			i += 2
 		case "-m":
-			switch ruleSpec[i+1] {
+			match, err := arg(i + 1)
+			if err != nil {
+				return err
+			}
+			switch match {
 			case "set":
-				if ruleSpec[i+2] != "--match-set" {
+				set, err := args(i+2, 3)
+				if err != nil {
+					return err
+				}
+				if set[0] != "--match-set" {
 					return fmt.Errorf("failed to find match-set arg for -m set: %s", ruleSpec)
 				}
-				if ruleSpec[i+4] != "src" {
-					return fmt.Errorf("only supporting src for match-set: %s", ruleSpec)
+				switch set[2] {
+				case "src":
+					r.MatchSetSrc = set[1]
+				case "dst":
+					r.MatchSetDst = set[1]
+				default:
+					return fmt.Errorf("only supporting src or dst for match-set: %s", ruleSpec)
 				}
-				r.MatchSetSrc = ruleSpec[i+3]
 				i += 5
 			case "comment":
-				if ruleSpec[i+2] != "--comment" {
+				comment, err := args(i+2, 2)
+				if err != nil {
+					return err
+				}
+				if comment[0] != "--comment" {
 					return fmt.Errorf("failed to find comment arg for -m comment: %s", ruleSpec)
 				}
-				i += 3
-				commentParts := []string{}
-				for {
-					if !strings.HasSuffix(ruleSpec[i], `"`) {
-						commentParts = append(commentParts, ruleSpec[i])
-						i++
-					} else {
-						commentParts = append(commentParts, ruleSpec[i])
-						i++
-						break
-					}
+				if err := r.Rule.LoadComment(comment[1]); err != nil {
+					return err
 				}
-				commentMatch := RuleIdRegex.FindStringSubmatch(strings.Trim(strings.Join(commentParts, " "), `"`))
-				if len(commentMatch) != 3 {
-					return fmt.Errorf("failed to process Id from comment: %v", commentParts)
+				i += 4
+			case "time":
+				// the start and end are loaded from the comment, which has their seconds
+				i += 2
+				for i+1 < len(ruleSpec) && strings.HasPrefix(ruleSpec[i], "--date") {
+					i += 2
 				}
-				r.Rule.Id, err = ParseRuleId(commentMatch[1])
+			case "tcp", "udp":
+				port, err := args(i+2, 2)
 				if err != nil {
 					return err
 				}
-				r.Comment = commentMatch[2]
+				if port[0] != "--dport" {
+					return fmt.Errorf("only supporting dport for -m %s: %s", match, ruleSpec)
+				}
+				r.DstPort = port[1]
+				i += 4
+			default:
+				return fmt.Errorf("unsupported match '%s': %s", match, ruleSpec)
 			}
 		case "-j":
-			r.Target = ruleSpec[i+1]
+			if r.Target, err = arg(i + 1); err != nil {
+				return err
+			}
 			i += 2
+			// the rest are options for the target
+			for i < len(ruleSpec) && strings.HasPrefix(ruleSpec[i], "--") {
+				if r.TargetOptions == nil {
+					r.TargetOptions = map[string]string{}
+				}
+				option := strings.TrimPrefix(ruleSpec[i], "--")
+				r.TargetOptions[option] = ""
+				if i+1 < len(ruleSpec) && !strings.HasPrefix(ruleSpec[i+1], "--") {
+					r.TargetOptions[option] = ruleSpec[i+1]
+					i++
+				}
+				i++
+			}
 		default:
 			return fmt.Errorf("failed to parse at index %d: %s", i, ruleSpec[i])
 		}
 	}
 	return nil
 }
+
+// SplitRuleSpec splits a line from iptables-save on spaces,
+// keeping quoted args like comments together without the quotes
+func SplitRuleSpec(line string) ([]string, error) {
+	spec := []string{}
+	current := strings.Builder{}
+	inQuotes, hasArg := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && inQuotes && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case c == ' ' && !inQuotes:
+			if hasArg {
+				spec = append(spec, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteByte(c)
+			hasArg = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote in rule spec: %s", line)
+	}
+	if hasArg {
+		spec = append(spec, current.String())
+	}
+	return spec, nil
+}
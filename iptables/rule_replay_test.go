@@ -0,0 +1,379 @@
+package iptables_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/funcs"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+var (
+	replayChain = iptables.NewChain(iptables.FilterTable(testNS), "tchain")
+	replaySet   = iptables.NewIPSet(testNS, "testSet")
+	// the rules in the transcripts, the ids are fixed so they can be replayed
+	replayRules = []iptables.Rule{
+		{Id: 0x2a, Chain: replayChain, Target: iptables.DROP, MatchSetSrc: replaySet.Name, Comment: "testRule"},
+		{Id: 0x1b, Chain: replayChain, Target: iptables.RETURN, Comment: "testRule2"},
+	}
+)
+
+// setupReplayRules creates the chain and rules in the namespace for recording transcripts
+func setupReplayRules() error {
+	mac, err := address.MACFromString("12:12:12:12:12:12")
+	if err != nil {
+		return err
+	}
+	var ignored bool
+	return funcs.Do(
+		funcs.AssignFunc(resource.NewLifecycle(replayChain.ChainResource()).Ensure, &ignored),
+		replayChain.ChainResource().Clear,
+		funcs.AssignFunc(resource.NewLifecycle(replaySet.IPSetResource()).Ensure, &ignored),
+		funcs.AssignFunc(resource.NewLifecycle(iptables.NewMember(replaySet, mac).MemberResource()).Ensure, &ignored),
+		replayRules[0].RuleResource().Create,
+		replayRules[1].RuleResource().Create,
+	)
+}
+
+func TestRuleLoadReplay(t *testing.T) {
+	loaded := []iptables.Rule{}
+	replayer := replay(t, "rule_load", setupReplayRules, func() {
+		for _, rule := range replayRules {
+			ruleRes := iptables.Rule{Id: rule.Id, Chain: replayChain}.RuleResource()
+			if err := ruleRes.Load(); err != nil {
+				t.Fatal(err)
+			}
+			loaded = append(loaded, ruleRes.Rule)
+		}
+	})
+	if err := replayer.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, replayRules) {
+		t.Fatalf("expected %v, loaded %v", replayRules, loaded)
+	}
+}
+
+func TestRuleClearReplay(t *testing.T) {
+	replayer := replay(t, "rule_clear", setupReplayRules, func() {
+		if err := iptables.NewRule(replayChain).RuleResource().Clear(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := replayer.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRuleClearPartialFailure(t *testing.T) {
+	defer func(executor exec.Executor) { resource.DefaultExecutor = executor }(resource.DefaultExecutor)
+	// fail listing the rules, then deleting the first and the second rule
+	for _, failAt := range []int{1, 4, 7} {
+		replayer, err := exec.LoadReplayer("testdata/rule_clear.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resource.DefaultExecutor = exec.NewFaultInjector(replayer, failAt)
+		err = iptables.NewRule(replayChain).RuleResource().Clear()
+		if err == nil || !strings.Contains(err.Error(), "injected fault") {
+			t.Fatalf("expected injected fault for command %d, got %v", failAt, err)
+		}
+	}
+}
+
+func TestNATRuleLoadReplay(t *testing.T) {
+	nat := iptables.NewTable(testNS, "nat")
+	mangle := iptables.NewTable(testNS, "mangle")
+	rules := []iptables.Rule{{
+		Id: 0xc1, Chain: iptables.NewChain(nat, "PREROUTING"), Target: iptables.DNAT,
+		InInterface: "wan", Protocol: "tcp", DstPort: "8080", Comment: "web server",
+		TargetOptions: map[string]string{"to-destination": "192.168.100.20:80"},
+	}, {
+		Id: 0xc2, Chain: iptables.NewChain(nat, "POSTROUTING"), Target: iptables.MASQUERADE,
+		OutInterface: "wan",
+	}, {
+		Id: 0xc3, Chain: iptables.NewChain(mangle, "PREROUTING"), Target: iptables.MARK,
+		Protocol: "udp", DstPort: "5000:5100", TargetOptions: map[string]string{"set-mark": "0x10"},
+	}}
+	setup := func() error {
+		return funcs.Do(
+			iptables.NewTable(testNS, "").TableResource().Clear,
+			rules[0].RuleResource().Create,
+			rules[1].RuleResource().Create,
+			rules[2].RuleResource().Create,
+		)
+	}
+	loaded := []iptables.Rule{}
+	replayer := replay(t, "rule_load_nat", setup, func() {
+		for _, rule := range rules {
+			ruleRes := iptables.Rule{Id: rule.Id, Chain: rule.Chain}.RuleResource()
+			if err := ruleRes.Load(); err != nil {
+				t.Fatal(err)
+			}
+			loaded = append(loaded, ruleRes.Rule)
+		}
+	})
+	if err := replayer.Done(); err != nil {
+		t.Fatal(err)
+	}
+	// iptables saves the mark with the mask
+	rules[2].TargetOptions = map[string]string{"set-xmark": "0x10/0xffffffff"}
+	if !reflect.DeepEqual(loaded, rules) {
+		t.Fatalf("expected %v, loaded %v", rules, loaded)
+	}
+}
+
+func TestSplitRuleSpec(t *testing.T) {
+	spec, err := iptables.SplitRuleSpec(
+		`-A downtime -m comment --comment "gw-dt[2a]: say \"hi\"" -j LOG --log-prefix "blocked: "`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"-A", "downtime", "-m", "comment", "--comment", `gw-dt[2a]: say "hi"`,
+		"-j", "LOG", "--log-prefix", "blocked: ",
+	}
+	if !reflect.DeepEqual(spec, expected) {
+		t.Fatalf("expected %q, got %q", expected, spec)
+	}
+	if _, err := iptables.SplitRuleSpec(`-A downtime --comment "unterminated`); err == nil {
+		t.Fatal("expected failure for unterminated quote")
+	}
+}
+
+func TestRejectRuleLoadReplay(t *testing.T) {
+	downtime := iptables.NewChain(iptables.FilterTable(testNS), iptables.DOWNTIME_CHAIN)
+	rules := []iptables.Rule{{
+		Id: 0xd1, Chain: downtime, Target: iptables.REJECT, Protocol: "tcp",
+		TargetOptions: map[string]string{"reject-with": "tcp-reset"},
+	}, {
+		Id: 0xd2, Chain: downtime, Target: iptables.REJECT,
+		TargetOptions: map[string]string{"reject-with": "icmp-admin-prohibited"},
+	}, {
+		Id: 0xd3, Chain: downtime, Target: iptables.LOG,
+		TargetOptions: map[string]string{"log-prefix": "blocked: ", "log-level": "info"},
+	}}
+	setup := func() error {
+		return funcs.Do(
+			iptables.NewTable(testNS, "").TableResource().Clear,
+			downtime.ChainResource().Create,
+			rules[0].RuleResource().Create,
+			rules[1].RuleResource().Create,
+			rules[2].RuleResource().Create,
+		)
+	}
+	loaded := []iptables.Rule{}
+	replayer := replay(t, "rule_load_reject", setup, func() {
+		for _, rule := range rules {
+			ruleRes := iptables.Rule{Id: rule.Id, Chain: rule.Chain}.RuleResource()
+			if err := ruleRes.Load(); err != nil {
+				t.Fatal(err)
+			}
+			loaded = append(loaded, ruleRes.Rule)
+		}
+	})
+	if err := replayer.Done(); err != nil {
+		t.Fatal(err)
+	}
+	// iptables saves the log level as a number
+	rules[2].TargetOptions["log-level"] = "6"
+	if !reflect.DeepEqual(loaded, rules) {
+		t.Fatalf("expected %v, loaded %v", rules, loaded)
+	}
+}
+
+func TestValidateTargetOptions(t *testing.T) {
+	filter := iptables.FilterTable(testNS)
+	forward := iptables.NewChain(filter, "FORWARD")
+	for _, test := range []struct {
+		rule  iptables.Rule
+		valid bool
+	}{
+		{iptables.Rule{Chain: forward, Target: iptables.REJECT}, true},
+		{iptables.Rule{Chain: forward, Target: iptables.REJECT, Protocol: "tcp",
+			TargetOptions: map[string]string{"reject-with": "tcp-reset"}}, true},
+		{iptables.Rule{Chain: forward, Target: iptables.REJECT, Protocol: "udp",
+			TargetOptions: map[string]string{"reject-with": "tcp-reset"}}, false},
+		{iptables.Rule{Chain: forward, Target: iptables.REJECT,
+			TargetOptions: map[string]string{"reject-with": "icmp-teapot"}}, false},
+		{iptables.Rule{Chain: iptables.NewChain(iptables.NewTable(testNS, "nat"), "PREROUTING"),
+			Target: iptables.REJECT}, false},
+		{iptables.Rule{Chain: forward, Target: iptables.LOG,
+			TargetOptions: map[string]string{"log-prefix": "blocked: ", "log-level": "warning"}}, true},
+		{iptables.Rule{Chain: forward, Target: iptables.LOG,
+			TargetOptions: map[string]string{"log-level": "8"}}, false},
+		{iptables.Rule{Chain: forward, Target: iptables.LOG,
+			TargetOptions: map[string]string{"log-prefix": strings.Repeat("x", 30)}}, false},
+		{iptables.Rule{Chain: forward, Target: iptables.LOG,
+			TargetOptions: map[string]string{"reject-with": "tcp-reset"}}, false},
+		{iptables.Rule{Chain: forward, Target: iptables.DROP,
+			TargetOptions: map[string]string{"log-level": "4"}}, false},
+		{iptables.Rule{Chain: iptables.NewChain(iptables.NewTable(testNS, "mangle"), "PREROUTING"),
+			Target: iptables.CONNMARK, TargetOptions: map[string]string{"restore-mark": ""}}, true},
+		{iptables.Rule{Chain: iptables.NewChain(iptables.NewTable(testNS, "mangle"), "PREROUTING"),
+			Target: iptables.CONNMARK}, false},
+	} {
+		if err := test.rule.Validate(); (err == nil) != test.valid {
+			t.Errorf("expected valid %t for %s, got %v", test.valid, test.rule, err)
+		}
+	}
+}
+
+func TestLogAttemptsReplay(t *testing.T) {
+	downtime := iptables.NewChain(iptables.FilterTable(testNS), iptables.DOWNTIME_CHAIN)
+	rules := []iptables.Rule{
+		{Id: 0xe1, Chain: downtime, Target: iptables.DROP, MatchSetSrc: replaySet.Name, Comment: "tvs", LogAttempts: true},
+		{Id: 0xe2, Chain: downtime, Target: iptables.DROP},
+	}
+	setup := func() error {
+		var ignored bool
+		return funcs.Do(
+			iptables.NewTable(testNS, "").TableResource().Clear,
+			funcs.AssignFunc(resource.NewLifecycle(replaySet.IPSetResource()).Ensure, &ignored),
+			downtime.ChainResource().Create,
+			rules[0].RuleResource().Create,
+			rules[1].RuleResource().Create,
+		)
+	}
+	loaded := []iptables.Rule{}
+	replayer := replay(t, "rule_log_attempts", setup, func() {
+		for _, rule := range rules {
+			ruleRes := iptables.Rule{Id: rule.Id, Chain: rule.Chain}.RuleResource()
+			if err := ruleRes.Load(); err != nil {
+				t.Fatal(err)
+			}
+			loaded = append(loaded, ruleRes.Rule)
+		}
+		// deleting the rule also deletes the rule logging its attempts
+		if err := (iptables.Rule{Id: rules[0].Id, Chain: downtime}).RuleResource().Delete(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := replayer.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, rules) {
+		t.Fatalf("expected %v, loaded %v", rules, loaded)
+	}
+	if err := (iptables.Rule{Chain: downtime, Target: iptables.ACCEPT, LogAttempts: true}).Validate(); err == nil {
+		t.Fatal("expected failure logging attempts for ACCEPT")
+	}
+}
+
+func TestRuleCommentFlags(t *testing.T) {
+	rule := iptables.Rule{Id: 0x2a, Target: iptables.DROP, Comment: "kids: tvs", FlushConnections: true}
+	if comment := rule.RuleComment(); comment != "gw-dt[2a]+flush: kids: tvs" {
+		t.Fatalf("unexpected comment '%s'", comment)
+	}
+	loaded := iptables.Rule{}
+	if err := loaded.LoadComment(rule.RuleComment()); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Id != rule.Id || !loaded.FlushConnections || loaded.Comment != rule.Comment {
+		t.Fatalf("expected %+v, loaded %+v", rule, loaded)
+	}
+	if err := loaded.LoadComment("gw-dt-log[2a]"); err == nil {
+		t.Fatal("expected failure loading the comment of a log rule")
+	}
+
+	start, end := time.Date(2026, 10, 19, 21, 0, 0, 0, time.UTC), time.Date(2026, 10, 20, 7, 0, 0, 0, time.UTC)
+	rule.Start, rule.End = &start, &end
+	if comment := rule.RuleComment(); comment != "gw-dt[2a]+flush+start=1792443600+end=1792479600: kids: tvs" {
+		t.Fatalf("unexpected comment '%s'", comment)
+	}
+	loaded = iptables.Rule{}
+	if err := loaded.LoadComment(rule.RuleComment()); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Start == nil || !loaded.Start.Equal(start) || loaded.End == nil || !loaded.End.Equal(end) {
+		t.Fatalf("expected %+v, loaded %+v", rule, loaded)
+	}
+	if rule.Active(start.Add(-time.Minute)) || !rule.Active(start) || rule.Active(end) {
+		t.Fatalf("expected %+v to be active from its start until its end", rule)
+	}
+	// the kernel only matches from the start until the second before the end
+	rule.Chain = replayChain
+	if args := strings.Join(rule.Args(), " "); !strings.Contains(args,
+		" -m time --datestart 2026-10-19T21:00:00 --datestop 2026-10-20T06:59:59 -m comment ") {
+		t.Fatalf("expected the time match in '%s'", args)
+	}
+	if err := (iptables.Rule{Target: iptables.DROP, Start: &end, End: &start}).Validate(); err == nil {
+		t.Fatal("expected failure for an end before the start")
+	}
+
+	// flushing without a set would flush every device on the network
+	if err := (iptables.Rule{Target: iptables.DROP, MatchSetDst: "games", FlushConnections: true}).Validate(); err == nil {
+		t.Fatal("expected failure flushing connections without matchSetSrc")
+	}
+}
+
+func TestLoadTimeMatch(t *testing.T) {
+	defer func(executor exec.Executor) { resource.DefaultExecutor = executor }(resource.DefaultExecutor)
+	resource.DefaultExecutor = exec.NewReplayer(exec.Transcript{Commands: []exec.Command{{
+		Cmd: []string{"ip", "netns", "exec", testNS.Name, "iptables-save", "-t", "filter"},
+		Out: "*filter\n:tchain - [0:0]\n-A tchain -m set --match-set kids src" +
+			" -m time --datestart 2026-10-19T21:00:00 --datestop 2026-10-20T06:59:59" +
+			` -m comment --comment "gw-dt[2a]+start=1792443600+end=1792479600: bedtime" -j DROP` + "\nCOMMIT",
+	}}})
+	loaded := iptables.Rule{Id: 0x2a, Chain: replayChain}.RuleResource()
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	start, end := time.Unix(1792443600, 0), time.Unix(1792479600, 0)
+	expected := iptables.Rule{
+		Id: 0x2a, Chain: replayChain, Target: iptables.DROP, MatchSetSrc: "kids", Start: &start, End: &end, Comment: "bedtime",
+	}
+	if !reflect.DeepEqual(loaded.Rule, expected) {
+		t.Fatalf("expected %+v, loaded %+v", expected, loaded.Rule)
+	}
+}
+
+func TestNoticeRules(t *testing.T) {
+	downtime := iptables.NewChain(iptables.FilterTable(testNS), iptables.DOWNTIME_CHAIN)
+	end := time.Date(2026, 10, 20, 7, 0, 0, 0, time.UTC)
+	rule := iptables.Rule{
+		Id: 0x3c, Chain: downtime, Target: iptables.DROP, MatchSetSrc: "kids", End: &end,
+		Comment: "bedtime", Notice: true,
+	}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if comment := rule.RuleComment(); comment != "gw-dt[3c]+notice+end=1792479600: bedtime" {
+		t.Fatalf("unexpected comment '%s'", comment)
+	}
+	loaded := iptables.Rule{}
+	if err := loaded.LoadComment(rule.RuleComment()); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Notice || loaded.End == nil || !loaded.End.Equal(end) || loaded.Comment != "bedtime" {
+		t.Fatalf("expected %+v, loaded %+v", rule, loaded)
+	}
+
+	expected := []string{
+		"downtime -t filter -p tcp -m tcp --dport 443 -m set --match-set kids src -m time --datestop 2026-10-20T06:59:59" +
+			" -m comment --comment gw-dt-notice[3c] -j REJECT --reject-with tcp-reset",
+		"PREROUTING -t nat -p tcp -m tcp --dport 80 -m set --match-set kids src -m time --datestop 2026-10-20T06:59:59" +
+			" -m comment --comment gw-dt-notice[3c] -j REDIRECT --to-ports 8099",
+	}
+	for i, args := range rule.NoticeArgs() {
+		if strings.Join(args, " ") != expected[i] {
+			t.Errorf("expected '%s', got '%s'", expected[i], strings.Join(args, " "))
+		}
+	}
+
+	for _, invalid := range []iptables.Rule{
+		{Chain: downtime, Target: iptables.RETURN, Notice: true},
+		{Chain: downtime, Target: iptables.DROP, Protocol: "udp", Notice: true},
+		{Chain: downtime, Target: iptables.DROP, OutInterface: "wan", Notice: true},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected %s with notice to be invalid", invalid)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 )
 
 func TestRuleResource(t *testing.T) {
+	requireIntegration(t)
 	table := iptables.FilterTable(testNS)
 	chain := iptables.NewChain(table, "tchain")
 	chainRes := chain.ChainResource()
@@ -2,12 +2,31 @@ package iptables
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/plockc/gateway/resource"
 )
 
 var _ resource.Resource = TableRes{}
 
+// BuiltinChains are always in the table and cannot be deleted, keyed by table name
+var BuiltinChains = map[string][]string{
+	"filter": {"INPUT", "FORWARD", "OUTPUT"},
+	"nat":    {"PREROUTING", "INPUT", "OUTPUT", "POSTROUTING"},
+	"mangle": {"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"},
+	"raw":    {"PREROUTING", "OUTPUT"},
+}
+
+// TableNames are the tables that can be managed, sorted
+func TableNames() []string {
+	names := []string{}
+	for name := range BuiltinChains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 type Table struct {
 	Name        string `json:"-"`
 	resource.NS `json:"-"`
@@ -39,9 +58,19 @@ func (t TableRes) Id() string {
 }
 
 func (t TableRes) List() ([]string, error) {
-	return []string{"filter"}, nil
+	return TableNames(), nil
 }
 
-func (TableRes) Clear() error {
-	return fmt.Errorf("unimplemented")
+// Clear flushes the rules and deletes the chains that are not built in for every table
+func (t TableRes) Clear() error {
+	runner := t.Runner()
+	for _, name := range TableNames() {
+		if err := runner.BatchLines(
+			FLUSH.TableChainCmd(name, ""),
+			DELETE_CHAIN.TableChainCmd(name, ""),
+		); err != nil {
+			return fmt.Errorf("failed to clear table '%s': %w", name, err)
+		}
+	}
+	return nil
 }
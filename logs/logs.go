@@ -0,0 +1,61 @@
+package logs
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+type Level int
+
+const (
+	DEBUG Level = iota
+	INFO
+	WARN
+	ERROR
+)
+
+var names = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DEBUG || l > ERROR {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return names[l]
+}
+
+// Threshold is the lowest level that is logged
+var Threshold = INFO
+
+// ParseLevel is the level for its name, like info
+func ParseLevel(name string) (Level, error) {
+	for i, n := range names {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	return INFO, fmt.Errorf("log level '%s' is not one of %v", name, names)
+}
+
+func logf(level Level, format string, args ...any) {
+	if level < Threshold {
+		return
+	}
+	log.Printf(strings.ToUpper(level.String())+" "+format, args...)
+}
+
+func Debugf(format string, args ...any) {
+	logf(DEBUG, format, args...)
+}
+
+func Infof(format string, args ...any) {
+	logf(INFO, format, args...)
+}
+
+func Warnf(format string, args ...any) {
+	logf(WARN, format, args...)
+}
+
+func Errorf(format string, args ...any) {
+	logf(ERROR, format, args...)
+}
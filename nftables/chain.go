@@ -0,0 +1,72 @@
+package nftables
+
+import (
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+var _ resource.Resource = ChainRes{}
+
+type ChainRes struct {
+	resource.FailUnimplementedMethods
+	iptables.Chain
+}
+
+func NewChainResource(c iptables.Chain) *ChainRes {
+	return &ChainRes{Chain: c}
+}
+
+func (chain ChainRes) Id() string {
+	return chain.Name
+}
+
+func (chain ChainRes) Delete() error {
+	return Apply(chain.Runner(), "delete chain "+tableRef(chain.Table.Name)+" "+chain.Id())
+}
+
+// Create will also create the table and its base chains if needed
+func (chain ChainRes) Create() error {
+	return Apply(chain.Runner(), append(
+		EnsureTableScript(chain.Table.Name),
+		"add chain "+tableRef(chain.Table.Name)+" "+chain.Id(),
+	)...)
+}
+
+// List has the base chains first, even when the table has yet to be created
+// as they are always declared along with the table
+func (chain ChainRes) List() ([]string, error) {
+	names := BaseChainNames(chain.Table.Name)
+	rs, err := List(chain.Runner(), "table", tableRef(chain.Table.Name))
+	if err != nil {
+		if missing(err) {
+			return names, nil
+		}
+		return nil, err
+	}
+	for _, c := range rs.Chains(chain.Table.Name) {
+		if !slices.Contains(names, c.Name) {
+			names = append(names, c.Name)
+		}
+	}
+	return names, nil
+}
+
+// Clear deletes all the chains in the table except the base chains
+func (chain ChainRes) Clear() error {
+	names, err := chain.List()
+	if err != nil {
+		return err
+	}
+	base := BaseChainNames(chain.Table.Name)
+	script := []string{}
+	for _, name := range names {
+		if !slices.Contains(base, name) {
+			script = append(script, "delete chain "+tableRef(chain.Table.Name)+" "+name)
+		}
+	}
+	if len(script) == 0 {
+		return nil
+	}
+	return Apply(chain.Runner(), script...)
+}
@@ -0,0 +1,132 @@
+package nftables
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/plockc/gateway/resource"
+)
+
+// Family of the managed tables, the same one iptables-nft uses
+// so the tables and chains look familiar to iptables users
+const Family = "ip"
+
+// SetTable has the named sets that are listed. Unlike ipsets an nft set belongs to a table
+// and only the rules in the table can match it, so each set is declared in every table
+// with the same elements
+var SetTable = "filter"
+
+type BaseChain struct {
+	Name     string
+	Hook     string
+	Type     string
+	Priority int
+}
+
+// BaseChains are declared along with their table so they act like
+// the built in chains of iptables, keyed by table name.
+// The priorities are the same ones iptables-nft uses
+var BaseChains = map[string][]BaseChain{
+	"filter": {
+		{Name: "INPUT", Hook: "input", Type: "filter"},
+		{Name: "FORWARD", Hook: "forward", Type: "filter"},
+		{Name: "OUTPUT", Hook: "output", Type: "filter"},
+	},
+	"nat": {
+		{Name: "PREROUTING", Hook: "prerouting", Type: "nat", Priority: -100},
+		{Name: "INPUT", Hook: "input", Type: "nat", Priority: 100},
+		{Name: "OUTPUT", Hook: "output", Type: "nat", Priority: -100},
+		{Name: "POSTROUTING", Hook: "postrouting", Type: "nat", Priority: 100},
+	},
+	"mangle": {
+		{Name: "PREROUTING", Hook: "prerouting", Type: "filter", Priority: -150},
+		{Name: "INPUT", Hook: "input", Type: "filter", Priority: -150},
+		{Name: "FORWARD", Hook: "forward", Type: "filter", Priority: -150},
+		{Name: "OUTPUT", Hook: "output", Type: "route", Priority: -150},
+		{Name: "POSTROUTING", Hook: "postrouting", Type: "filter", Priority: -150},
+	},
+	"raw": {
+		{Name: "PREROUTING", Hook: "prerouting", Type: "filter", Priority: -300},
+		{Name: "OUTPUT", Hook: "output", Type: "filter", Priority: -300},
+	},
+}
+
+// Tables are the names of the tables that can be managed
+func Tables() []string {
+	names := []string{}
+	for name := range BaseChains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func BaseChainNames(table string) []string {
+	names := []string{}
+	for _, c := range BaseChains[table] {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func tableRef(table string) string {
+	return Family + " " + table
+}
+
+// EnsureTableScript declares the table and its base chains,
+// "add" will not fail if they already exist
+func EnsureTableScript(table string) []string {
+	script := []string{"add table " + tableRef(table)}
+	for _, c := range BaseChains[table] {
+		script = append(script, fmt.Sprintf(
+			"add chain %s %s { type %s hook %s priority %d; policy accept; }",
+			tableRef(table), c.Name, c.Type, c.Hook, c.Priority,
+		))
+	}
+	return script
+}
+
+// NFTablesErrors have the kinds of the failures of nft by the messages of the kernel
+var NFTablesErrors = []resource.Match{
+	{Message: "No such file or directory", Kind: resource.NOT_FOUND},
+	{Message: "File exists", Kind: resource.CONFLICT},
+	{Message: "Device or resource busy", Kind: resource.CONFLICT},
+	{Message: "Operation not supported", Kind: resource.UNSUPPORTED},
+	{Message: "syntax error", Kind: resource.INVALID},
+}
+
+// Apply loads the script with `nft -f` so either all the commands are applied or none are
+func Apply(runner *resource.Runner, script ...string) error {
+	f, err := os.CreateTemp("", "gateway-*.nft")
+	if err != nil {
+		return fmt.Errorf("failed to create nft script: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(strings.Join(script, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write nft script: %w", err)
+	}
+	if err := runner.Run([]string{"nft", "-f", f.Name()}); err != nil {
+		return fmt.Errorf("failed to apply nft script %q: %w", script, resource.Classify(err, NFTablesErrors...))
+	}
+	return nil
+}
+
+// List runs `nft -j list` with the args and parses the output
+func List(runner *resource.Runner, args ...string) (Ruleset, error) {
+	res, err := runner.Exec(append([]string{"nft", "-j", "list"}, args...))
+	if err != nil {
+		return Ruleset{}, resource.Classify(err, NFTablesErrors...)
+	}
+	return RulesetFromString(res.Out)
+}
+
+// missing is true when the command failed because the table, chain or set does not exist
+func missing(err error) bool {
+	return resource.KindOf(err) == resource.NOT_FOUND
+}
@@ -0,0 +1,670 @@
+package nftables
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+var verdicts = map[string]string{
+	iptables.ACCEPT: "accept",
+	iptables.DROP:   "drop",
+	iptables.RETURN: "return",
+}
+
+// TIME_FORMAT is the date and time of a meta time match
+const TIME_FORMAT = "2006-01-02 15:04:05"
+
+var _ resource.Resource = RuleRes{}
+
+// RuleRes is an iptables Rule written in nft syntax, the Id is kept in the comment
+type RuleRes struct {
+	iptables.Rule
+	resource.FailUnimplementedMethods
+}
+
+func NewRuleResource(r iptables.Rule) *RuleRes {
+	return &RuleRes{Rule: r}
+}
+
+func (r RuleRes) Id() string {
+	return r.RuleId()
+}
+
+func (r RuleRes) chainRef() string {
+	return tableRef(r.Table.Name) + " " + r.Chain.Name
+}
+
+// Statement is the nft rule for the matches and target of the rule
+func Statement(r iptables.Rule) (string, error) {
+	return statement(r, r.RuleComment())
+}
+
+// LogStatement is the nft rule logging the attempts blocked by the rule
+func LogStatement(r iptables.Rule) (string, error) {
+	return statement(r.LogRule(), r.LogComment())
+}
+
+func statement(r iptables.Rule, comment string) (string, error) {
+	if err := r.Validate(); err != nil {
+		return "", err
+	}
+	if strings.Contains(r.Comment, `"`) {
+		return "", fmt.Errorf("comment cannot have double quotes: %s", r.Comment)
+	}
+	stmt := []string{}
+	if len(r.InInterface) > 0 {
+		stmt = append(stmt, `iifname "`+r.InInterface+`"`)
+	}
+	if len(r.OutInterface) > 0 {
+		stmt = append(stmt, `oifname "`+r.OutInterface+`"`)
+	}
+	if len(r.DstPort) > 0 {
+		stmt = append(stmt, r.Protocol+" dport "+strings.ReplaceAll(r.DstPort, ":", "-"))
+	} else if len(r.Protocol) > 0 {
+		stmt = append(stmt, "meta l4proto "+r.Protocol)
+	}
+	if len(r.MatchSetSrc) > 0 {
+		stmt = append(stmt, "ether saddr @"+r.MatchSetSrc)
+	}
+	if len(r.MatchSetDst) > 0 {
+		stmt = append(stmt, "ip daddr @"+r.MatchSetDst)
+	}
+	// nft has the times in the time zone of the gateway
+	if r.Start != nil {
+		stmt = append(stmt, `meta time >= "`+r.Start.Local().Format(TIME_FORMAT)+`"`)
+	}
+	if r.End != nil {
+		stmt = append(stmt, `meta time < "`+r.End.Local().Format(TIME_FORMAT)+`"`)
+	}
+	target, err := targetStatement(r)
+	if err != nil {
+		return "", err
+	}
+	stmt = append(stmt, target, `comment "`+comment+`"`)
+	return strings.Join(stmt, " "), nil
+}
+
+// targetStatement is the nft statement for the target of the rule and its options
+func targetStatement(r iptables.Rule) (string, error) {
+	options := map[string]string{}
+	for k, v := range r.TargetOptions {
+		options[k] = v
+	}
+	// option removes the option so any left over are not supported
+	option := func(name string) (string, bool) {
+		value, ok := options[name]
+		delete(options, name)
+		return value, ok
+	}
+	stmt := ""
+	switch r.Target {
+	case iptables.DNAT:
+		to, ok := option("to-destination")
+		if !ok {
+			return "", fmt.Errorf("DNAT needs the to-destination option")
+		}
+		stmt = "dnat to " + to
+	case iptables.MASQUERADE:
+		stmt = "masquerade"
+		if ports, ok := option("to-ports"); ok {
+			stmt += " to :" + ports
+		}
+	case iptables.REDIRECT:
+		stmt = "redirect"
+		if ports, ok := option("to-ports"); ok {
+			stmt += " to :" + ports
+		}
+	case iptables.MARK:
+		mark, ok := option("set-mark")
+		if !ok {
+			xmark, ok := option("set-xmark")
+			if !ok || !strings.HasSuffix(xmark, "/0xffffffff") {
+				return "", fmt.Errorf("MARK needs the set-mark option")
+			}
+			mark = strings.TrimSuffix(xmark, "/0xffffffff")
+		}
+		stmt = "meta mark set " + mark
+	case iptables.CONNMARK:
+		// the masks iptables-save adds are the same as having none
+		for _, mask := range []string{"nfmask", "ctmask"} {
+			if value, ok := option(mask); ok && value != "0xffffffff" {
+				return "", fmt.Errorf("CONNMARK only supports the %s 0xffffffff, got %s", mask, value)
+			}
+		}
+		if _, ok := option("save-mark"); ok {
+			stmt = "ct mark set meta mark"
+		} else if _, ok := option("restore-mark"); ok {
+			stmt = "meta mark set ct mark"
+		} else {
+			return "", fmt.Errorf("CONNMARK needs the save-mark or restore-mark option")
+		}
+	case iptables.REJECT:
+		stmt = "reject"
+		if rejectWith, ok := option("reject-with"); ok {
+			if rejectWith == "tcp-reset" {
+				stmt += " with tcp reset"
+			} else {
+				stmt += " with icmp type " + icmpType(rejectWith)
+			}
+		}
+	case iptables.NFLOG:
+		stmt = "log"
+		if prefix, ok := option("nflog-prefix"); ok {
+			if strings.Contains(prefix, `"`) {
+				return "", fmt.Errorf("nflog-prefix cannot have double quotes: %s", prefix)
+			}
+			stmt += ` prefix "` + prefix + `"`
+		}
+		group, _ := option("nflog-group")
+		if group == "" {
+			group = "0"
+		}
+		stmt += " group " + group
+	case iptables.LOG:
+		stmt = "log"
+		if prefix, ok := option("log-prefix"); ok {
+			if strings.Contains(prefix, `"`) {
+				return "", fmt.Errorf("log-prefix cannot have double quotes: %s", prefix)
+			}
+			stmt += ` prefix "` + prefix + `"`
+		}
+		if level, ok := option("log-level"); ok {
+			stmt += " level " + logLevel(level)
+		}
+	default:
+		verdict, ok := verdicts[r.Target]
+		if !ok {
+			verdict = "jump " + r.Target
+		}
+		stmt = verdict
+	}
+	if len(options) > 0 {
+		return "", resource.Unsupported("unsupported options for %s: %v", r.Target, options)
+	}
+	return stmt, nil
+}
+
+// icmpType is the nft icmp type for the reject-with of iptables
+func icmpType(rejectWith string) string {
+	icmp := strings.TrimPrefix(rejectWith, "icmp-")
+	// nft has the shorter name for protocol unreachable
+	if icmp == "proto-unreachable" {
+		return "prot-unreachable"
+	}
+	return icmp
+}
+
+// nftLogLevels are the nft names of the syslog levels, in order
+var nftLogLevels = []string{"emerg", "alert", "crit", "err", "warn", "notice", "info", "debug"}
+
+// logLevel is the nft level for the log-level of iptables, a number or a name
+func logLevel(level string) string {
+	if n, err := strconv.Atoi(level); err == nil && n >= 0 && n < len(nftLogLevels) {
+		return nftLogLevels[n]
+	}
+	if i := slices.Index(iptables.LogLevels, level); i >= 0 {
+		return nftLogLevels[i]
+	}
+	return level
+}
+
+// the redirects of HTTP to the notice are in the nat PREROUTING chain, like with iptables
+const (
+	NOTICE_TABLE = "nat"
+	NOTICE_CHAIN = "PREROUTING"
+)
+
+func noticeChainRef() string {
+	return tableRef(NOTICE_TABLE) + " " + NOTICE_CHAIN
+}
+
+// NoticeStatements are the nft rules rejecting HTTPS and redirecting HTTP to the notice
+func NoticeStatements(r iptables.Rule) (string, string, error) {
+	reject, err := statement(r.HTTPSRejectRule(), r.NoticeComment())
+	if err != nil {
+		return "", "", err
+	}
+	redirect, err := statement(r.NoticeRedirectRule(), r.NoticeComment())
+	return reject, redirect, err
+}
+
+func (r RuleRes) Create() error {
+	stmt, err := Statement(r.Rule)
+	if err != nil {
+		return err
+	}
+	script := []string{"add rule " + r.chainRef() + " " + stmt}
+	if r.Notice {
+		reject, redirect, err := NoticeStatements(r.Rule)
+		if err != nil {
+			return err
+		}
+		// the HTTPS reject is ahead so it is not dropped
+		script = append([]string{"add rule " + r.chainRef() + " " + reject}, script...)
+		script = append(append(script, EnsureTableScript(NOTICE_TABLE)...), "add rule "+noticeChainRef()+" "+redirect)
+	}
+	if r.LogAttempts {
+		logStmt, err := LogStatement(r.Rule)
+		if err != nil {
+			return err
+		}
+		// the log rule is ahead so it sees the packets before they are blocked
+		script = append([]string{"add rule " + r.chainRef() + " " + logStmt}, script...)
+	}
+	return Apply(r.Runner(), script...)
+}
+
+func (r RuleRes) Delete() error {
+	rules, err := r.list()
+	if err != nil {
+		return err
+	}
+	obj, ok := rules.managed()[r.RuleId()]
+	if !ok {
+		return resource.NotFound("expected a matching rule for %s", r.RuleId())
+	}
+	script := append([]string{r.deleteCmd(obj)}, rules.companionDeleteCmds(r.RuleId())...)
+	redirects, err := r.redirects()
+	if err != nil {
+		return err
+	}
+	if redirect, ok := redirects[r.RuleId()]; ok {
+		script = append(script, deleteRedirectCmd(redirect))
+	}
+	return Apply(r.Runner(), script...)
+}
+
+func (r RuleRes) deleteCmd(obj RuleObj) string {
+	return "delete rule " + r.chainRef() + " handle " + strconv.Itoa(obj.Handle)
+}
+
+func deleteRedirectCmd(obj RuleObj) string {
+	return "delete rule " + noticeChainRef() + " handle " + strconv.Itoa(obj.Handle)
+}
+
+// chainRules are the managed rules of a chain along with the rules logging their
+// blocked attempts and rejecting HTTPS for their notice, keyed by the id of the rule
+type chainRules struct {
+	chain   string
+	ids     []string
+	objs    []RuleObj
+	logs    map[string]RuleObj
+	notices map[string]RuleObj
+}
+
+// managed rules in the chain keyed by rule id
+func (rules chainRules) managed() map[string]RuleObj {
+	managed := map[string]RuleObj{}
+	for i, id := range rules.ids {
+		managed[id] = rules.objs[i]
+	}
+	return managed
+}
+
+// companionDeleteCmds delete the rules in the chain logging and rejecting HTTPS for the rule
+func (rules chainRules) companionDeleteCmds(id string) []string {
+	script := []string{}
+	for _, companions := range []map[string]RuleObj{rules.logs, rules.notices} {
+		if obj, ok := companions[id]; ok {
+			script = append(script, "delete rule "+rules.chain+" handle "+strconv.Itoa(obj.Handle))
+		}
+	}
+	return script
+}
+
+// list has the ids of the managed rules in the chain and the rules in the same order,
+// and their companion rules
+func (r RuleRes) list() (chainRules, error) {
+	rules := chainRules{
+		chain: r.chainRef(), ids: []string{}, objs: []RuleObj{},
+		logs: map[string]RuleObj{}, notices: map[string]RuleObj{},
+	}
+	rs, err := List(r.Runner(), "chain", r.chainRef())
+	if err != nil {
+		return rules, err
+	}
+	for _, obj := range rs.Rules(r.Table.Name, r.Chain.Name) {
+		if matches := iptables.LogIdRegex.FindStringSubmatch(obj.Comment); len(matches) > 1 {
+			rules.logs[matches[1]] = obj
+			continue
+		}
+		if matches := iptables.NoticeIdRegex.FindStringSubmatch(obj.Comment); len(matches) > 1 {
+			rules.notices[matches[1]] = obj
+			continue
+		}
+		matches := iptables.RuleIdRegex.FindStringSubmatch(obj.Comment)
+		if len(matches) <= 1 {
+			continue
+		}
+		rules.ids = append(rules.ids, matches[1])
+		rules.objs = append(rules.objs, obj)
+	}
+	return rules, nil
+}
+
+// redirects to the notice keyed by the id of the rule, the nat table is only
+// there once a rule has had a notice or a nat rule was created
+func (r RuleRes) redirects() (map[string]RuleObj, error) {
+	redirects := map[string]RuleObj{}
+	rs, err := List(r.Runner(), "chain", noticeChainRef())
+	if err != nil {
+		if missing(err) {
+			return redirects, nil
+		}
+		return nil, err
+	}
+	for _, obj := range rs.Rules(NOTICE_TABLE, NOTICE_CHAIN) {
+		if matches := iptables.NoticeIdRegex.FindStringSubmatch(obj.Comment); len(matches) > 1 {
+			redirects[matches[1]] = obj
+		}
+	}
+	return redirects, nil
+}
+
+func (r RuleRes) List() ([]string, error) {
+	rules, err := r.list()
+	return rules.ids, err
+}
+
+// Clear removes all the managed rules from the chain at once
+func (r RuleRes) Clear() error {
+	rules, err := r.list()
+	if err != nil {
+		return err
+	}
+	redirects, err := r.redirects()
+	if err != nil {
+		return err
+	}
+	script := []string{}
+	for i, id := range rules.ids {
+		script = append(script, r.deleteCmd(rules.objs[i]))
+		if redirect, ok := redirects[id]; ok {
+			script = append(script, deleteRedirectCmd(redirect))
+		}
+	}
+	for _, companions := range []map[string]RuleObj{rules.logs, rules.notices} {
+		for _, obj := range companions {
+			script = append(script, r.deleteCmd(obj))
+		}
+	}
+	if len(script) == 0 {
+		return nil
+	}
+	return Apply(r.Runner(), script...)
+}
+
+func (r *RuleRes) Load() error {
+	rules, err := r.list()
+	if err != nil {
+		return err
+	}
+	obj, ok := rules.managed()[r.RuleId()]
+	if !ok {
+		return resource.NotFound("expected a matching rule for %s", r.RuleId())
+	}
+	_, logAttempts := rules.logs[r.RuleId()]
+	// only the fields from the nft rule are kept, the rest are cleared
+	r.Rule = iptables.Rule{Id: r.Rule.Id, Chain: r.Chain, Start: r.Start, End: r.End, LogAttempts: logAttempts}
+	return LoadRule(&r.Rule, obj)
+}
+
+// LoadRule sets the fields of the rule from the statements of the nft rule
+func LoadRule(r *iptables.Rule, obj RuleObj) error {
+	if err := r.LoadComment(obj.Comment); err != nil {
+		return err
+	}
+	for _, expr := range obj.Expr {
+		for stmt, value := range expr {
+			if err := loadStatement(r, stmt, value); err != nil {
+				return fmt.Errorf("failed to load rule %d: %w", obj.Handle, err)
+			}
+		}
+	}
+	return nil
+}
+
+func loadStatement(r *iptables.Rule, stmt string, value json.RawMessage) error {
+	// setOption sets an option for the target, creating the options if needed
+	setOption := func(name, value string) {
+		if r.TargetOptions == nil {
+			r.TargetOptions = map[string]string{}
+		}
+		r.TargetOptions[name] = value
+	}
+	switch stmt {
+	case "match":
+		return loadMatch(r, value)
+	case "jump":
+		target := struct {
+			Target string `json:"target"`
+		}{}
+		if err := json.Unmarshal(value, &target); err != nil {
+			return fmt.Errorf("failed to parse jump: %s", string(value))
+		}
+		r.Target = target.Target
+	case "dnat":
+		dnat := struct {
+			Addr string          `json:"addr"`
+			Port json.RawMessage `json:"port"`
+		}{}
+		if err := json.Unmarshal(value, &dnat); err != nil {
+			return fmt.Errorf("failed to parse dnat: %s", string(value))
+		}
+		r.Target = iptables.DNAT
+		to := dnat.Addr
+		if len(dnat.Port) > 0 {
+			port, err := portValue(dnat.Port)
+			if err != nil {
+				return err
+			}
+			to += ":" + strings.ReplaceAll(port, ":", "-")
+		}
+		setOption("to-destination", to)
+	case "masquerade", "redirect":
+		r.Target = iptables.MASQUERADE
+		if stmt == "redirect" {
+			r.Target = iptables.REDIRECT
+		}
+		to := struct {
+			Port json.RawMessage `json:"port"`
+		}{}
+		if err := json.Unmarshal(value, &to); err == nil && len(to.Port) > 0 {
+			port, err := portValue(to.Port)
+			if err != nil {
+				return err
+			}
+			setOption("to-ports", strings.ReplaceAll(port, ":", "-"))
+		}
+	case "mangle":
+		return loadMangle(r, value)
+	case "reject":
+		r.Target = iptables.REJECT
+		reject := struct {
+			Type string `json:"type"`
+			Expr string `json:"expr"`
+		}{}
+		// a reject without options is null
+		if err := json.Unmarshal(value, &reject); err != nil {
+			return fmt.Errorf("failed to parse reject: %s", string(value))
+		}
+		switch {
+		case reject.Type == "tcp reset":
+			setOption("reject-with", "tcp-reset")
+		case reject.Expr == "prot-unreachable":
+			setOption("reject-with", "icmp-proto-unreachable")
+		case reject.Expr != "":
+			setOption("reject-with", "icmp-"+reject.Expr)
+		}
+	case "log":
+		log := struct {
+			Prefix string `json:"prefix"`
+			Level  string `json:"level"`
+			Group  *int   `json:"group"`
+		}{}
+		if err := json.Unmarshal(value, &log); err != nil {
+			return fmt.Errorf("failed to parse log: %s", string(value))
+		}
+		// logging to a group is NFLOG
+		if log.Group != nil {
+			r.Target = iptables.NFLOG
+			setOption("nflog-group", strconv.Itoa(*log.Group))
+			if log.Prefix != "" {
+				setOption("nflog-prefix", log.Prefix)
+			}
+			return nil
+		}
+		r.Target = iptables.LOG
+		if log.Prefix != "" {
+			setOption("log-prefix", log.Prefix)
+		}
+		// the same as iptables-save, the level is a number and the default is left out
+		if i := slices.Index(nftLogLevels, log.Level); i >= 0 && log.Level != "warn" {
+			setOption("log-level", strconv.Itoa(i))
+		}
+	case "counter":
+	default:
+		for target, verdict := range verdicts {
+			if verdict == stmt {
+				r.Target = target
+				return nil
+			}
+		}
+		return fmt.Errorf("unsupported statement '%s'", stmt)
+	}
+	return nil
+}
+
+// markKey is the key of a mangle statement or its value when copying between the marks
+type markKey struct {
+	Meta *struct {
+		Key string `json:"key"`
+	} `json:"meta"`
+	Ct *struct {
+		Key string `json:"key"`
+	} `json:"ct"`
+}
+
+// kind is meta or ct for the mark of the packet or the connection
+func (k markKey) kind() string {
+	switch {
+	case k.Meta != nil && k.Meta.Key == "mark":
+		return "meta"
+	case k.Ct != nil && k.Ct.Key == "mark":
+		return "ct"
+	}
+	return ""
+}
+
+// loadMangle is MARK setting the mark of the packet to a value,
+// or CONNMARK copying the mark between the packet and the connection
+func loadMangle(r *iptables.Rule, value json.RawMessage) error {
+	mangle := struct {
+		Key   markKey         `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}{}
+	if err := json.Unmarshal(value, &mangle); err != nil {
+		return fmt.Errorf("failed to parse mangle: %s", string(value))
+	}
+	var mark uint32
+	if mangle.Key.kind() == "meta" && json.Unmarshal(mangle.Value, &mark) == nil {
+		r.Target = iptables.MARK
+		r.TargetOptions = map[string]string{"set-mark": fmt.Sprintf("0x%x", mark)}
+		return nil
+	}
+	from := markKey{}
+	if err := json.Unmarshal(mangle.Value, &from); err != nil {
+		return fmt.Errorf("failed to parse mangle: %s", string(value))
+	}
+	switch {
+	case mangle.Key.kind() == "ct" && from.kind() == "meta":
+		r.TargetOptions = map[string]string{"save-mark": ""}
+	case mangle.Key.kind() == "meta" && from.kind() == "ct":
+		r.TargetOptions = map[string]string{"restore-mark": ""}
+	default:
+		return fmt.Errorf("only supporting setting the mark or copying it to or from the connection: %s", string(value))
+	}
+	r.Target = iptables.CONNMARK
+	return nil
+}
+
+// portValue is a port number or a range of ports as "first:last"
+func portValue(raw json.RawMessage) (string, error) {
+	var port int
+	if err := json.Unmarshal(raw, &port); err == nil {
+		return strconv.Itoa(port), nil
+	}
+	portRange := struct {
+		Range []int `json:"range"`
+	}{}
+	if err := json.Unmarshal(raw, &portRange); err != nil || len(portRange.Range) != 2 {
+		return "", fmt.Errorf("failed to parse port: %s", string(raw))
+	}
+	return strconv.Itoa(portRange.Range[0]) + ":" + strconv.Itoa(portRange.Range[1]), nil
+}
+
+type payload struct {
+	Protocol string `json:"protocol"`
+	Field    string `json:"field"`
+}
+
+func loadMatch(r *iptables.Rule, value json.RawMessage) error {
+	match := struct {
+		Op   string `json:"op"`
+		Left struct {
+			Payload *payload `json:"payload"`
+			Meta    *struct {
+				Key string `json:"key"`
+			} `json:"meta"`
+		} `json:"left"`
+		Right json.RawMessage `json:"right"`
+	}{}
+	if err := json.Unmarshal(value, &match); err != nil {
+		return fmt.Errorf("failed to parse match: %s", string(value))
+	}
+	var right string
+	switch {
+	// the start and end are loaded from the comment, which has their seconds
+	case match.Left.Meta != nil && match.Left.Meta.Key == "time":
+	case match.Left.Meta != nil:
+		if err := json.Unmarshal(match.Right, &right); err != nil {
+			return fmt.Errorf("failed to parse meta match: %s", string(value))
+		}
+		switch match.Left.Meta.Key {
+		case "iifname":
+			r.InInterface = right
+		case "oifname":
+			r.OutInterface = right
+		case "l4proto":
+			r.Protocol = right
+		default:
+			return fmt.Errorf("unsupported meta match: %s", string(value))
+		}
+	case match.Left.Payload != nil && match.Left.Payload.Field == "dport":
+		port, err := portValue(match.Right)
+		if err != nil {
+			return err
+		}
+		r.Protocol = match.Left.Payload.Protocol
+		r.DstPort = port
+	case match.Left.Payload != nil && *match.Left.Payload == payload{Protocol: "ether", Field: "saddr"}:
+		if err := json.Unmarshal(match.Right, &right); err != nil || !strings.HasPrefix(right, "@") {
+			return fmt.Errorf("only supporting sets for ether saddr: %s", string(value))
+		}
+		r.MatchSetSrc = strings.TrimPrefix(right, "@")
+	case match.Left.Payload != nil && *match.Left.Payload == payload{Protocol: "ip", Field: "daddr"}:
+		if err := json.Unmarshal(match.Right, &right); err != nil || !strings.HasPrefix(right, "@") {
+			return fmt.Errorf("only supporting sets for ip daddr: %s", string(value))
+		}
+		r.MatchSetDst = strings.TrimPrefix(right, "@")
+	default:
+		return fmt.Errorf("unsupported match: %s", string(value))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package nftables
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Ruleset is the output of `nft -j list ...`, each object has one of the fields
+type Ruleset struct {
+	Nftables []Object `json:"nftables"`
+}
+
+type Object struct {
+	Table *TableObj `json:"table,omitempty"`
+	Chain *ChainObj `json:"chain,omitempty"`
+	Rule  *RuleObj  `json:"rule,omitempty"`
+	Set   *SetObj   `json:"set,omitempty"`
+}
+
+type TableObj struct {
+	Family string `json:"family"`
+	Name   string `json:"name"`
+	Handle int    `json:"handle"`
+}
+
+type ChainObj struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Handle int    `json:"handle"`
+	Hook   string `json:"hook,omitempty"`
+}
+
+type RuleObj struct {
+	Family  string `json:"family"`
+	Table   string `json:"table"`
+	Chain   string `json:"chain"`
+	Handle  int    `json:"handle"`
+	Comment string `json:"comment,omitempty"`
+	// each statement is an object with a single key naming the statement
+	Expr []map[string]json.RawMessage `json:"expr"`
+}
+
+type SetObj struct {
+	Family string            `json:"family"`
+	Table  string            `json:"table"`
+	Name   string            `json:"name"`
+	Handle int               `json:"handle"`
+	Type   string            `json:"type"`
+	Elem   []json.RawMessage `json:"elem,omitempty"`
+}
+
+// pass in the output from `nft -j list ...`
+func RulesetFromString(output string) (Ruleset, error) {
+	rs := Ruleset{}
+	err := json.Unmarshal([]byte(output), &rs)
+	return rs, err
+}
+
+func (rs Ruleset) Chains(table string) []ChainObj {
+	chains := []ChainObj{}
+	for _, o := range rs.Nftables {
+		if o.Chain != nil && o.Chain.Family == Family && o.Chain.Table == table {
+			chains = append(chains, *o.Chain)
+		}
+	}
+	return chains
+}
+
+func (rs Ruleset) Rules(table, chain string) []RuleObj {
+	rules := []RuleObj{}
+	for _, o := range rs.Nftables {
+		if o.Rule != nil && o.Rule.Family == Family && o.Rule.Table == table && o.Rule.Chain == chain {
+			rules = append(rules, *o.Rule)
+		}
+	}
+	return rules
+}
+
+func (rs Ruleset) Sets(table string) []SetObj {
+	sets := []SetObj{}
+	for _, o := range rs.Nftables {
+		if o.Set != nil && o.Set.Family == Family && o.Set.Table == table {
+			sets = append(sets, *o.Set)
+		}
+	}
+	return sets
+}
+
+// Elems are the values of the set elements, elements with options
+// like timeouts are objects that hold the value
+func (s SetObj) Elems() ([]string, error) {
+	elems := []string{}
+	for _, raw := range s.Elem {
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			elems = append(elems, value)
+			continue
+		}
+		wrapped := struct {
+			Elem struct {
+				Val string `json:"val"`
+			} `json:"elem"`
+		}{}
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return nil, fmt.Errorf("failed to parse element of set '%s': %s", s.Name, string(raw))
+		}
+		elems = append(elems, wrapped.Elem.Val)
+	}
+	return elems, nil
+}
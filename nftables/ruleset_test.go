@@ -0,0 +1,537 @@
+package nftables_test
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/nftables"
+	"github.com/plockc/gateway/resource"
+)
+
+const chainOutput = `{"nftables": [
+{"metainfo": {"version": "1.0.6", "release_name": "Lester Gooch #5", "json_schema_version": 1}},
+{"chain": {"family": "ip", "table": "filter", "name": "downtime", "handle": 4}},
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 6,
+  "comment": "gw-dt[1f2e3d]: kids tvs",
+  "expr": [
+    {"match": {"op": "==", "left": {"payload": {"protocol": "ether", "field": "saddr"}}, "right": "@tvs"}},
+    {"drop": null}
+  ]}},
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 7,
+  "expr": [{"accept": null}]}},
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 8,
+  "comment": "gw-dt[a]: ",
+  "expr": [{"counter": {"packets": 0, "bytes": 0}}, {"jump": {"target": "allowed"}}]}}
+]}`
+
+const setOutput = `{"nftables": [
+{"metainfo": {"version": "1.0.6", "release_name": "Lester Gooch #5", "json_schema_version": 1}},
+{"set": {"family": "ip", "name": "tvs", "table": "filter", "type": "ether_addr", "handle": 3,
+  "elem": ["12:12:12:12:12:ab", {"elem": {"val": "12:12:12:12:12:34", "timeout": 60}}]}}
+]}`
+
+const natOutput = `{"nftables": [
+{"metainfo": {"version": "1.0.6", "release_name": "Lester Gooch #5", "json_schema_version": 1}},
+{"rule": {"family": "ip", "table": "nat", "chain": "PREROUTING", "handle": 5,
+  "comment": "gw-dt[c1]: web server",
+  "expr": [
+    {"match": {"op": "==", "left": {"meta": {"key": "iifname"}}, "right": "wan"}},
+    {"match": {"op": "==", "left": {"payload": {"protocol": "tcp", "field": "dport"}}, "right": 8080}},
+    {"dnat": {"addr": "192.168.100.20", "port": 80}}
+  ]}},
+{"rule": {"family": "ip", "table": "nat", "chain": "POSTROUTING", "handle": 6,
+  "comment": "gw-dt[c2]: ",
+  "expr": [
+    {"match": {"op": "==", "left": {"meta": {"key": "oifname"}}, "right": "wan"}},
+    {"masquerade": null}
+  ]}},
+{"rule": {"family": "ip", "table": "mangle", "chain": "PREROUTING", "handle": 7,
+  "comment": "gw-dt[c3]: ",
+  "expr": [
+    {"match": {"op": "==", "left": {"payload": {"protocol": "udp", "field": "dport"}}, "right": {"range": [5000, 5100]}}},
+    {"mangle": {"key": {"meta": {"key": "mark"}}, "value": 16}}
+  ]}}
+]}`
+
+func TestLoadNATRules(t *testing.T) {
+	rs, err := nftables.RulesetFromString(natOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]iptables.Rule{
+		"PREROUTING": {
+			Id: 0xc1, Target: iptables.DNAT, InInterface: "wan", Protocol: "tcp", DstPort: "8080",
+			TargetOptions: map[string]string{"to-destination": "192.168.100.20:80"}, Comment: "web server",
+		},
+		"POSTROUTING": {Id: 0xc2, Target: iptables.MASQUERADE, OutInterface: "wan"},
+	}
+	for chain, rule := range expected {
+		objs := rs.Rules("nat", chain)
+		if len(objs) != 1 {
+			t.Fatalf("expected a rule in %s, got %v", chain, objs)
+		}
+		loaded := iptables.Rule{}
+		if err := nftables.LoadRule(&loaded, objs[0]); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, rule) {
+			t.Fatalf("expected %#v, got %#v", rule, loaded)
+		}
+	}
+
+	loaded := iptables.Rule{}
+	if err := nftables.LoadRule(&loaded, rs.Rules("mangle", "PREROUTING")[0]); err != nil {
+		t.Fatal(err)
+	}
+	mark := iptables.Rule{
+		Id: 0xc3, Target: iptables.MARK, Protocol: "udp", DstPort: "5000:5100",
+		TargetOptions: map[string]string{"set-mark": "0x10"},
+	}
+	if !reflect.DeepEqual(loaded, mark) {
+		t.Fatalf("expected %#v, got %#v", mark, loaded)
+	}
+}
+
+func TestNATStatements(t *testing.T) {
+	nat := iptables.NewTable(resource.NewNS("test"), "nat")
+	mangle := iptables.NewTable(resource.NewNS("test"), "mangle")
+	for _, test := range []struct {
+		rule     iptables.Rule
+		expected string
+	}{{
+		iptables.Rule{
+			Id: 1, Chain: iptables.NewChain(nat, "PREROUTING"), Target: iptables.DNAT,
+			InInterface: "wan", Protocol: "tcp", DstPort: "8080",
+			TargetOptions: map[string]string{"to-destination": "192.168.100.20:80"},
+		},
+		`iifname "wan" tcp dport 8080 dnat to 192.168.100.20:80 comment "gw-dt[1]: "`,
+	}, {
+		iptables.Rule{
+			Id: 2, Chain: iptables.NewChain(nat, "POSTROUTING"), Target: iptables.MASQUERADE,
+			OutInterface: "wan", TargetOptions: map[string]string{"to-ports": "1024-2000"},
+		},
+		`oifname "wan" masquerade to :1024-2000 comment "gw-dt[2]: "`,
+	}, {
+		iptables.Rule{
+			Id: 3, Chain: iptables.NewChain(mangle, "PREROUTING"), Target: iptables.MARK,
+			Protocol: "udp", TargetOptions: map[string]string{"set-xmark": "0x10/0xffffffff"},
+		},
+		`meta l4proto udp meta mark set 0x10 comment "gw-dt[3]: "`,
+	}} {
+		stmt, err := nftables.Statement(test.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stmt != test.expected {
+			t.Fatalf("expected '%s', got '%s'", test.expected, stmt)
+		}
+	}
+
+	dnat := iptables.Rule{Chain: iptables.NewChain(nat, "PREROUTING"), Target: iptables.DNAT}
+	if _, err := nftables.Statement(dnat); err == nil {
+		t.Fatal("expected failure for DNAT without a destination")
+	}
+	dnat.Chain = iptables.NewChain(mangle, "PREROUTING")
+	dnat.TargetOptions = map[string]string{"to-destination": "192.168.100.20"}
+	if _, err := nftables.Statement(dnat); err == nil {
+		t.Fatal("expected failure for DNAT in the mangle table")
+	}
+}
+
+func TestLoadRule(t *testing.T) {
+	rs, err := nftables.RulesetFromString(chainOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs := rs.Rules("filter", "downtime")
+	if len(objs) != 3 {
+		t.Fatalf("expected 3 rules, got %v", objs)
+	}
+
+	rule := iptables.Rule{}
+	if err := nftables.LoadRule(&rule, objs[0]); err != nil {
+		t.Fatal(err)
+	}
+	expected := iptables.Rule{Id: 0x1f2e3d, Target: "DROP", MatchSetSrc: "tvs", Comment: "kids tvs"}
+	if !reflect.DeepEqual(rule, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, rule)
+	}
+
+	if err := nftables.LoadRule(&rule, objs[1]); err == nil {
+		t.Fatal("expected failure for unmanaged rule without comment")
+	}
+
+	rule = iptables.Rule{}
+	if err := nftables.LoadRule(&rule, objs[2]); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Target != "allowed" || rule.Id != 0xa {
+		t.Fatalf("expected jump to allowed for rule a, got %#v", rule)
+	}
+}
+
+func TestStatement(t *testing.T) {
+	rule := iptables.Rule{Id: 0xab, Target: "DROP", MatchSetSrc: "tvs", Comment: "kids"}
+	stmt, err := nftables.Statement(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `ether saddr @tvs drop comment "gw-dt[ab]: kids"`
+	if stmt != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, stmt)
+	}
+
+	rule.Target = "downtime"
+	rule.MatchSetSrc = ""
+	if stmt, err = nftables.Statement(rule); err != nil {
+		t.Fatal(err)
+	}
+	expected = `jump downtime comment "gw-dt[ab]: kids"`
+	if stmt != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, stmt)
+	}
+
+	rule.Comment = `"quoted"`
+	if _, err := nftables.Statement(rule); err == nil {
+		t.Fatal("expected failure for comment with quotes")
+	}
+}
+
+func TestTimeStatement(t *testing.T) {
+	start, end := time.Date(2026, 10, 19, 21, 0, 0, 0, time.Local), time.Date(2026, 10, 20, 7, 0, 0, 0, time.Local)
+	rule := iptables.Rule{Id: 0xab, Target: "DROP", MatchSetSrc: "tvs", Start: &start, End: &end, Comment: "bedtime"}
+	stmt, err := nftables.Statement(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `ether saddr @tvs meta time >= "2026-10-19 21:00:00" meta time < "2026-10-20 07:00:00" drop comment "` +
+		rule.RuleComment() + `"`
+	if stmt != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, stmt)
+	}
+
+	rs, err := nftables.RulesetFromString(`{"nftables": [
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 6,
+  "comment": "` + rule.RuleComment() + `",
+  "expr": [
+    {"match": {"op": "==", "left": {"payload": {"protocol": "ether", "field": "saddr"}}, "right": "@tvs"}},
+    {"match": {"op": ">=", "left": {"meta": {"key": "time"}}, "right": "2026-10-19 21:00:00"}},
+    {"match": {"op": "<", "left": {"meta": {"key": "time"}}, "right": "2026-10-20 07:00:00"}},
+    {"drop": null}
+  ]}}
+]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := iptables.Rule{}
+	if err := nftables.LoadRule(&loaded, rs.Rules("filter", "downtime")[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Start.Equal(start) || !loaded.End.Equal(end) || loaded.MatchSetSrc != "tvs" || loaded.Target != "DROP" {
+		t.Fatalf("expected %+v, loaded %+v", rule, loaded)
+	}
+}
+
+func TestSetElems(t *testing.T) {
+	rs, err := nftables.RulesetFromString(setOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets := rs.Sets("filter")
+	if len(sets) != 1 {
+		t.Fatalf("expected one set, got %v", sets)
+	}
+	elems, err := sets[0].Elems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(elems, []string{"12:12:12:12:12:ab", "12:12:12:12:12:34"}) {
+		t.Fatalf("unexpected elements: %v", elems)
+	}
+}
+
+const rejectOutput = `{"nftables": [
+{"metainfo": {"version": "1.0.6", "release_name": "Lester Gooch #5", "json_schema_version": 1}},
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 9,
+  "comment": "gw-dt[d1]: ",
+  "expr": [
+    {"match": {"op": "==", "left": {"meta": {"key": "l4proto"}}, "right": "tcp"}},
+    {"reject": {"type": "tcp reset"}}
+  ]}},
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 10,
+  "comment": "gw-dt[d2]: ",
+  "expr": [{"reject": {"type": "icmp", "expr": "admin-prohibited"}}]}},
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 11,
+  "comment": "gw-dt[d3]: ",
+  "expr": [{"log": {"prefix": "blocked: ", "level": "info"}}]}}
+]}`
+
+func TestRejectAndLog(t *testing.T) {
+	filter := iptables.FilterTable(resource.NewNS("test"))
+	downtime := iptables.NewChain(filter, iptables.DOWNTIME_CHAIN)
+	rules := []iptables.Rule{{
+		Id: 0xd1, Target: iptables.REJECT, Protocol: "tcp",
+		TargetOptions: map[string]string{"reject-with": "tcp-reset"},
+	}, {
+		Id: 0xd2, Target: iptables.REJECT,
+		TargetOptions: map[string]string{"reject-with": "icmp-admin-prohibited"},
+	}, {
+		Id: 0xd3, Target: iptables.LOG,
+		TargetOptions: map[string]string{"log-prefix": "blocked: ", "log-level": "6"},
+	}}
+	statements := []string{
+		`meta l4proto tcp reject with tcp reset comment "gw-dt[d1]: "`,
+		`reject with icmp type admin-prohibited comment "gw-dt[d2]: "`,
+		`log prefix "blocked: " level info comment "gw-dt[d3]: "`,
+	}
+
+	rs, err := nftables.RulesetFromString(rejectOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs := rs.Rules("filter", iptables.DOWNTIME_CHAIN)
+	if len(objs) != len(rules) {
+		t.Fatalf("expected %d rules, got %v", len(rules), objs)
+	}
+	for i, rule := range rules {
+		loaded := iptables.Rule{}
+		if err := nftables.LoadRule(&loaded, objs[i]); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, rule) {
+			t.Fatalf("expected %#v, got %#v", rule, loaded)
+		}
+		rule.Chain = downtime
+		stmt, err := nftables.Statement(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stmt != statements[i] {
+			t.Fatalf("expected '%s', got '%s'", statements[i], stmt)
+		}
+	}
+
+	for _, options := range []map[string]string{
+		{"reject-with": "icmp-nonsense"},
+		{"reject-with": "tcp-reset"},
+		{"log-level": "info"},
+	} {
+		rule := iptables.Rule{Chain: downtime, Target: iptables.REJECT, TargetOptions: options}
+		if _, err := nftables.Statement(rule); err == nil {
+			t.Fatalf("expected failure for REJECT with %v", options)
+		}
+	}
+	if _, err := nftables.Statement(iptables.Rule{
+		Chain: downtime, Target: iptables.LOG, TargetOptions: map[string]string{"log-level": "loud"},
+	}); err == nil {
+		t.Fatal("expected failure for an unknown log-level")
+	}
+}
+
+func TestLogStatement(t *testing.T) {
+	downtime := iptables.NewChain(iptables.FilterTable(resource.NewNS("test")), iptables.DOWNTIME_CHAIN)
+	rule := iptables.Rule{Id: 0xe1, Chain: downtime, Target: iptables.DROP, MatchSetSrc: "tvs", LogAttempts: true}
+	stmt, err := nftables.LogStatement(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `ether saddr @tvs log prefix "gw-dt-log[e1]" group 2 comment "gw-dt-log[e1]"`
+	if stmt != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, stmt)
+	}
+
+	rs, err := nftables.RulesetFromString(`{"nftables": [
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 12,
+  "comment": "gw-dt[e2]: ",
+  "expr": [{"log": {"prefix": "gw-dt-log[e1]", "group": 2}}]}}
+]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := iptables.Rule{}
+	if err := nftables.LoadRule(&loaded, rs.Rules("filter", iptables.DOWNTIME_CHAIN)[0]); err != nil {
+		t.Fatal(err)
+	}
+	nflog := iptables.Rule{
+		Id: 0xe2, Target: iptables.NFLOG,
+		TargetOptions: map[string]string{"nflog-group": "2", "nflog-prefix": "gw-dt-log[e1]"},
+	}
+	if !reflect.DeepEqual(loaded, nflog) {
+		t.Fatalf("expected %#v, got %#v", nflog, loaded)
+	}
+}
+
+const dstSetOutput = `{"nftables": [
+{"metainfo": {"version": "1.0.6", "release_name": "Lester Gooch #5", "json_schema_version": 1}},
+{"rule": {"family": "ip", "table": "filter", "chain": "downtime", "handle": 12,
+  "comment": "gw-dt[e1]: homework",
+  "expr": [
+    {"match": {"op": "==", "left": {"payload": {"protocol": "ether", "field": "saddr"}}, "right": "@kids"}},
+    {"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": "@youtube"}},
+    {"drop": null}
+  ]}}
+]}`
+
+func TestMatchSetDst(t *testing.T) {
+	rule := iptables.Rule{Id: 0xe1, Target: iptables.DROP, MatchSetSrc: "kids", MatchSetDst: "youtube", Comment: "homework"}
+	stmt, err := nftables.Statement(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `ether saddr @kids ip daddr @youtube drop comment "gw-dt[e1]: homework"`
+	if stmt != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, stmt)
+	}
+
+	rs, err := nftables.RulesetFromString(dstSetOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs := rs.Rules("filter", "downtime")
+	loaded := iptables.Rule{}
+	if err := nftables.LoadRule(&loaded, objs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, rule) {
+		t.Fatalf("expected %#v, got %#v", rule, loaded)
+	}
+}
+
+func TestNoticeStatements(t *testing.T) {
+	downtime := iptables.NewChain(iptables.FilterTable(resource.NewNS("")), iptables.DOWNTIME_CHAIN)
+	rule := iptables.Rule{Id: 0x3c, Chain: downtime, Target: iptables.DROP, MatchSetSrc: "kids", Notice: true}
+	reject, redirect, err := nftables.NoticeStatements(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `tcp dport 443 ether saddr @kids reject with tcp reset comment "gw-dt-notice[3c]"`
+	if reject != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, reject)
+	}
+	expected = `tcp dport 80 ether saddr @kids redirect to :8099 comment "gw-dt-notice[3c]"`
+	if redirect != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, redirect)
+	}
+}
+
+const connmarkOutput = `{"nftables": [
+{"metainfo": {"version": "1.0.6", "release_name": "Lester Gooch #5", "json_schema_version": 1}},
+{"rule": {"family": "ip", "table": "mangle", "chain": "POSTROUTING", "handle": 8,
+  "comment": "gw-dt[d1]: ",
+  "expr": [
+    {"match": {"op": "==", "left": {"meta": {"key": "oifname"}}, "right": "wan"}},
+    {"mangle": {"key": {"ct": {"key": "mark"}}, "value": {"meta": {"key": "mark"}}}}
+  ]}},
+{"rule": {"family": "ip", "table": "mangle", "chain": "PREROUTING", "handle": 9,
+  "comment": "gw-dt[d2]: ",
+  "expr": [
+    {"match": {"op": "==", "left": {"meta": {"key": "iifname"}}, "right": "wan"}},
+    {"mangle": {"key": {"meta": {"key": "mark"}}, "value": {"ct": {"key": "mark"}}}}
+  ]}}
+]}`
+
+func TestConnmark(t *testing.T) {
+	mangle := iptables.NewTable(resource.NewNS("test"), "mangle")
+	save := iptables.Rule{
+		Id: 0xd1, Chain: iptables.NewChain(mangle, "POSTROUTING"), Target: iptables.CONNMARK, OutInterface: "wan",
+		TargetOptions: map[string]string{"save-mark": "", "nfmask": "0xffffffff", "ctmask": "0xffffffff"},
+	}
+	restore := iptables.Rule{
+		Id: 0xd2, Chain: iptables.NewChain(mangle, "PREROUTING"), Target: iptables.CONNMARK, InInterface: "wan",
+		TargetOptions: map[string]string{"restore-mark": ""},
+	}
+	for rule, expected := range map[*iptables.Rule]string{
+		&save:    `oifname "wan" ct mark set meta mark comment "gw-dt[d1]: "`,
+		&restore: `iifname "wan" meta mark set ct mark comment "gw-dt[d2]: "`,
+	} {
+		stmt, err := nftables.Statement(*rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stmt != expected {
+			t.Fatalf("expected '%s', got '%s'", expected, stmt)
+		}
+	}
+
+	rs, err := nftables.RulesetFromString(connmarkOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for chain, expected := range map[string]iptables.Rule{
+		"POSTROUTING": {Id: 0xd1, Target: iptables.CONNMARK, OutInterface: "wan", TargetOptions: map[string]string{"save-mark": ""}},
+		"PREROUTING":  {Id: 0xd2, Target: iptables.CONNMARK, InInterface: "wan", TargetOptions: map[string]string{"restore-mark": ""}},
+	} {
+		loaded := iptables.Rule{}
+		if err := nftables.LoadRule(&loaded, rs.Rules("mangle", chain)[0]); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, expected) {
+			t.Fatalf("expected %#v, got %#v", expected, loaded)
+		}
+	}
+}
+
+// scriptExecutor has the scripts applied with nft -f, and fails listing as nothing exists
+type scriptExecutor struct {
+	scripts []string
+}
+
+func (s *scriptExecutor) Exec(cmd []string) (int, string, error) {
+	if len(cmd) > 1 && cmd[len(cmd)-2] == "-f" {
+		script, err := os.ReadFile(cmd[len(cmd)-1])
+		s.scripts = append(s.scripts, string(script))
+		return 0, "", err
+	}
+	out := "Error: No such file or directory"
+	return 1, out, exec.ExitError(cmd, 1, out)
+}
+
+func TestScripts(t *testing.T) {
+	defer func(executor exec.Executor) { resource.DefaultExecutor = executor }(resource.DefaultExecutor)
+	executor := &scriptExecutor{}
+	resource.DefaultExecutor = executor
+	ns := resource.NewNS("")
+
+	// the set and its elements are in every table, so the rules of each table can match them
+	set := iptables.NewIPSet(ns, "kids")
+	mac, _ := address.MACFromString("12:12:12:12:12:ab")
+	if err := nftables.NewSetResource(set).Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nftables.NewMemberResource(iptables.NewMember(set, mac)).Create(); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range nftables.Tables() {
+		for i, expected := range []string{
+			"add set ip " + table + " kids { type ether_addr; }", "add element ip " + table + " kids { 12:12:12:12:12:AB }",
+		} {
+			if !strings.Contains(executor.scripts[i], expected+"\n") {
+				t.Fatalf("expected '%s' in the script, got:\n%s", expected, executor.scripts[i])
+			}
+		}
+	}
+
+	// the redirect to the notice is in the nat table
+	executor.scripts = nil
+	downtime := iptables.NewChain(iptables.FilterTable(ns), iptables.DOWNTIME_CHAIN)
+	rule := iptables.Rule{Id: 0x3c, Chain: downtime, Target: iptables.DROP, MatchSetSrc: "kids", Notice: true}
+	if err := nftables.NewRuleResource(rule).Create(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `add rule ip nat PREROUTING tcp dport 80 ether saddr @kids redirect to :8099 comment "gw-dt-notice[3c]"`
+	if !strings.Contains(executor.scripts[0], expected+"\n") {
+		t.Fatalf("expected '%s' in the script, got:\n%s", expected, executor.scripts[0])
+	}
+
+	// a table that does not exist has its base chains
+	chains, err := nftables.NewChainResource(iptables.NewChain(iptables.NewTable(ns, "nat"), "")).List()
+	if err != nil || !reflect.DeepEqual(chains, nftables.BaseChainNames("nat")) {
+		t.Fatalf("expected the base chains of nat, got %v, %v", chains, err)
+	}
+}
@@ -0,0 +1,84 @@
+package nftables
+
+import (
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+var _ resource.Resource = SetRes{}
+
+// SetRes is a named set in every table, taking the place of an ipset,
+// with MAC addresses for a hash:mac set and IPv4 addresses for a hash:ip set
+type SetRes struct {
+	resource.FailUnimplementedMethods
+	iptables.IPSet
+}
+
+func NewSetResource(s iptables.IPSet) *SetRes {
+	return &SetRes{IPSet: s}
+}
+
+func (s SetRes) Id() string {
+	return s.Name
+}
+
+func (s SetRes) Delete() error {
+	script := []string{}
+	for _, table := range Tables() {
+		script = append(script, "delete set "+tableRef(table)+" "+s.Id())
+	}
+	return Apply(s.Runner(), script...)
+}
+
+// SetTypes are the nft types of the elements for each ipset type
+var SetTypes = map[string]string{
+	iptables.HASH_MAC: "ether_addr",
+	iptables.HASH_IP:  "ipv4_addr",
+}
+
+// Create declares the set in every table, creating the tables if needed
+func (s SetRes) Create() error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	script := []string{}
+	for _, table := range Tables() {
+		script = append(append(script, EnsureTableScript(table)...),
+			"add set "+tableRef(table)+" "+s.Id()+" { type "+SetTypes[s.SetType()]+"; }",
+		)
+	}
+	return Apply(s.Runner(), script...)
+}
+
+func (s SetRes) List() ([]string, error) {
+	rs, err := List(s.Runner(), "sets", Family)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, set := range rs.Sets(SetTable) {
+		names = append(names, set.Name)
+	}
+	return names, nil
+}
+
+// LoadType has the Type of the ipset for the type of the elements of the set
+func (s *SetRes) LoadType() error {
+	rs, err := List(s.Runner(), "sets", Family)
+	if err != nil {
+		return err
+	}
+	for _, set := range rs.Sets(SetTable) {
+		if set.Name != s.Name {
+			continue
+		}
+		for setType, elemType := range SetTypes {
+			if elemType == set.Type {
+				s.Type = setType
+				return nil
+			}
+		}
+		return resource.Unsupported("set '%s' has elements of type %s", s.Name, set.Type)
+	}
+	return resource.NotFound("set '%s' does not exist", s.Name)
+}
@@ -0,0 +1,68 @@
+package nftables
+
+import (
+	"fmt"
+
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+var _ resource.Resource = &MemberRes{}
+
+type MemberRes struct {
+	iptables.Member `json:",inline"`
+	resource.FailUnimplementedMethods
+}
+
+func NewMemberResource(m iptables.Member) *MemberRes {
+	return &MemberRes{Member: m}
+}
+
+func (m MemberRes) Id() string {
+	return m.Element()
+}
+
+// script has the command for the set in every table, so the elements are the same in each
+func (m MemberRes) script(cmd, elements string) []string {
+	script := []string{}
+	for _, table := range Tables() {
+		script = append(script, cmd+" "+tableRef(table)+" "+m.IPSet.Name+elements)
+	}
+	return script
+}
+
+func (m MemberRes) Create() error {
+	return Apply(m.Runner(), m.script("add element", " { "+m.Element()+" }")...)
+}
+
+func (m MemberRes) Delete() error {
+	return Apply(m.Runner(), m.script("delete element", " { "+m.Element()+" }")...)
+}
+
+// List has the elements formatted the same as the Id, nft shows MACs in lower case
+func (m MemberRes) List() ([]string, error) {
+	setName := m.IPSet.Name
+	rs, err := List(m.Runner(), "set", tableRef(SetTable), setName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members of set '%s': %w", setName, err)
+	}
+	ids := []string{}
+	for _, set := range rs.Sets(SetTable) {
+		elems, err := set.Elems()
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range elems {
+			member, err := iptables.MemberFromString(m.IPSet, elem)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse elements: %w", err)
+			}
+			ids = append(ids, member.Element())
+		}
+	}
+	return ids, nil
+}
+
+func (m MemberRes) Clear() error {
+	return Apply(m.Runner(), m.script("flush set", "")...)
+}
@@ -0,0 +1,57 @@
+package nftables
+
+import (
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+var _ resource.Resource = TableRes{}
+
+type TableRes struct {
+	iptables.Table
+	resource.FailUnimplementedMethods
+}
+
+func NewTableResource(t iptables.Table) TableRes {
+	return TableRes{Table: t}
+}
+
+func (t TableRes) Id() string {
+	return t.Name
+}
+
+func (t TableRes) Create() error {
+	return Apply(t.Runner(), EnsureTableScript(t.Name)...)
+}
+
+func (t TableRes) List() ([]string, error) {
+	return Tables(), nil
+}
+
+// Clear flushes the rules and deletes the chains that are not base chains for every table,
+// the sets are kept
+func (t TableRes) Clear() error {
+	run := t.Runner()
+	script := []string{}
+	for _, name := range Tables() {
+		rs, err := List(run, "table", tableRef(name))
+		if err != nil {
+			if missing(err) {
+				continue
+			}
+			return err
+		}
+		script = append(script, "flush table "+tableRef(name))
+		base := BaseChainNames(name)
+		for _, c := range rs.Chains(name) {
+			if !slices.Contains(base, c.Name) {
+				script = append(script, "delete chain "+tableRef(name)+" "+c.Name)
+			}
+		}
+	}
+	if len(script) == 0 {
+		return nil
+	}
+	return Apply(run, script...)
+}
@@ -0,0 +1,124 @@
+package notice
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// NAME_TIMEOUT bounds looking up the name of the device, the MAC is shown without one
+	NAME_TIMEOUT = time.Second
+	// MAX_LOOKUPS bounds the names looked up at once, the MAC is shown when there are more
+	MAX_LOOKUPS = 8
+)
+
+// Notice is shown to a device blocked by a rule with Notice
+type Notice struct {
+	Device string `json:"device"`
+	MAC    string `json:"mac"`
+	IP     string `json:"ip"`
+	// Reason is the comment of the rule
+	Reason string `json:"reason"`
+	// Until is the end of the rule, the downtime has no end if nil
+	Until *time.Time `json:"until"`
+}
+
+// Headline is like "Downtime until 07:00", in the time zone of the gateway
+func (n Notice) Headline() string {
+	if n.Until == nil {
+		return "Downtime"
+	}
+	return "Downtime until " + n.Until.Local().Format("15:04")
+}
+
+// lookups has a token for each name being looked up
+var lookups = make(chan struct{}, MAX_LOOKUPS)
+
+// LookupName is the name of the device from a reverse lookup, like the names
+// a DHCP server registers, or empty if it has none
+var LookupName = func(ip string) string {
+	select {
+	case lookups <- struct{}{}:
+		defer func() { <-lookups }()
+	default:
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), NAME_TIMEOUT)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// Find is the notice for the device with the IP, false if no active rule with Notice blocks it.
+// The rules are checked in the order of the chains of the filter table
+func Find(ns resource.NS, ip string) (Notice, bool, error) {
+	res, err := ns.Runner().Exec(address.NeighJsonCmd())
+	if err != nil {
+		return Notice{}, false, fmt.Errorf("failed to list neighbors: %w", err)
+	}
+	neighs, err := address.NeighsOutFromString(res.Out)
+	if err != nil {
+		return Notice{}, false, fmt.Errorf("failed to parse neighbors: %w", err)
+	}
+	neigh, ok := neighs.Neighbor(ip)
+	if !ok {
+		return Notice{}, false, nil
+	}
+	mac, err := address.MACFromString(neigh.LLAddr)
+	if err != nil {
+		return Notice{}, false, err
+	}
+	rule, ok, err := blockingRule(ns, mac, neigh.Dev, time.Now())
+	if err != nil || !ok {
+		return Notice{}, false, err
+	}
+	n := Notice{Device: LookupName(ip), MAC: mac.String(), IP: ip, Reason: rule.Comment, Until: rule.End}
+	if n.Device == "" {
+		n.Device = n.MAC
+	}
+	return n, true, nil
+}
+
+// blockingRule is the first rule with Notice active at now that matches the MAC from the device
+func blockingRule(ns resource.NS, mac address.MAC, dev string, now time.Time) (iptables.Rule, bool, error) {
+	fw := firewall.For(ns)
+	filter := iptables.FilterTable(ns)
+	chains, err := fw.ChainResource(iptables.NewChain(filter, "")).List()
+	if err != nil {
+		return iptables.Rule{}, false, err
+	}
+	for _, chain := range chains {
+		rules, err := firewall.Rules(fw, iptables.NewChain(filter, chain))
+		if err != nil {
+			return iptables.Rule{}, false, err
+		}
+		for _, rule := range rules {
+			if !rule.Notice || !rule.Active(now) || (rule.InInterface != "" && rule.InInterface != dev) {
+				continue
+			}
+			if rule.MatchSetSrc == "" {
+				return rule, true, nil
+			}
+			members, err := fw.MemberResource(iptables.NewMember(iptables.NewIPSet(ns, rule.MatchSetSrc), mac)).List()
+			if err != nil {
+				return iptables.Rule{}, false, err
+			}
+			if slices.Contains(members, mac.String()) {
+				return rule, true, nil
+			}
+		}
+	}
+	return iptables.Rule{}, false, nil
+}
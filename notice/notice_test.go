@@ -0,0 +1,127 @@
+package notice_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/notice"
+	"github.com/plockc/gateway/resource"
+)
+
+var testNS = resource.NewNS("notice")
+
+const neighs = `[
+	{"dst":"192.168.100.20","dev":"lan","lladdr":"12:12:12:12:12:ab","state":["REACHABLE"]},
+	{"dst":"192.168.100.30","dev":"lan","lladdr":"12:12:12:12:12:cd","state":["STALE"]}
+]`
+
+type neighborExecutor struct{}
+
+func (neighborExecutor) Exec(cmd []string) (int, string, error) {
+	line := strings.Join(cmd, " ")
+	if strings.HasSuffix(line, strings.Join(address.NeighJsonCmd(), " ")) {
+		return 0, neighs, nil
+	}
+	return 1, "", fmt.Errorf("unexpected command: %s", line)
+}
+
+func get(ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "http://youtube.com/watch", nil)
+	req.RemoteAddr = ip + ":51000"
+	w := httptest.NewRecorder()
+	notice.Handler{NS: testNS}.ServeHTTP(w, req)
+	return w
+}
+
+func TestNotice(t *testing.T) {
+	defer func(executor exec.Executor) { resource.DefaultExecutor = executor }(resource.DefaultExecutor)
+	resource.DefaultExecutor = neighborExecutor{}
+	defer func(lookup func(string) string) { notice.LookupName = lookup }(notice.LookupName)
+	notice.LookupName = func(ip string) string {
+		if ip == "192.168.100.20" {
+			return "kids-tablet.lan"
+		}
+		return ""
+	}
+
+	firewalltest.Use(t, testNS)
+
+	set := iptables.NewIPSet(testNS, "kids")
+	mac, _ := address.MACFromString("12:12:12:12:12:ab")
+	downtime := iptables.NewChain(iptables.FilterTable(testNS), iptables.DOWNTIME_CHAIN)
+	end := time.Now().Add(time.Hour)
+	rule := iptables.NewRule(downtime)
+	rule.Target, rule.MatchSetSrc, rule.End, rule.Notice, rule.Comment = iptables.DROP, set.Name, &end, true, "bedtime"
+	// the ended rule blocks every device but no longer shows its notice
+	ended := time.Now().Add(-time.Hour)
+	endedRule := iptables.NewRule(downtime)
+	endedRule.Target, endedRule.End, endedRule.Notice, endedRule.Comment = iptables.DROP, &ended, true, "yesterday"
+	fw := firewall.For(testNS)
+	for _, create := range []func() error{
+		fw.IPSetResource(set).Create,
+		fw.MemberResource(iptables.NewMember(set, mac)).Create,
+		fw.ChainResource(downtime).Create,
+		fw.RuleResource(endedRule).Create,
+		fw.RuleResource(rule).Create,
+	} {
+		if err := create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("blocked device", func(t *testing.T) {
+		w := get("192.168.100.20")
+		if w.Code != 200 {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+		}
+		for _, expected := range []string{"Downtime until " + end.Format("15:04"), "kids-tablet.lan", "bedtime"} {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("expected '%s' in %s", expected, w.Body)
+			}
+		}
+	})
+
+	t.Run("burst of requests", func(t *testing.T) {
+		lookups := 0
+		notice.LookupName = func(string) string {
+			lookups++
+			return ""
+		}
+		if w := get("192.168.100.20"); w.Code != 200 || !strings.Contains(w.Body.String(), "kids-tablet.lan") {
+			t.Fatalf("expected the notice found for the burst, got %d: %s", w.Code, w.Body)
+		}
+		if lookups != 0 {
+			t.Fatalf("expected no lookup during the burst, got %d", lookups)
+		}
+	})
+
+	t.Run("device not in the set with only an ended rule", func(t *testing.T) {
+		if w := get("192.168.100.30"); w.Code != 404 {
+			t.Fatalf("expected 404, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("device without a name", func(t *testing.T) {
+		n, ok, err := notice.Find(testNS, "192.168.100.20")
+		if err != nil || !ok {
+			t.Fatal(ok, err)
+		}
+		n.Until = nil
+		if n.Headline() != "Downtime" {
+			t.Fatalf("unexpected headline '%s'", n.Headline())
+		}
+		notice.LookupName = func(string) string { return "" }
+		if n, _, _ := notice.Find(testNS, "192.168.100.20"); n.Device != mac.String() {
+			t.Fatalf("expected the MAC as the device, got '%s'", n.Device)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package notice
+
+import (
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/logs"
+	"github.com/plockc/gateway/resource"
+)
+
+// BURST is how long the notice found for a device is kept, a blocked device retries
+// its pages and apps in bursts that would otherwise each look up the rules and its name
+const BURST = 5 * time.Second
+
+var page = template.Must(template.New("notice").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Headline}}</title>
+<style>
+body { font-family: sans-serif; text-align: center; margin-top: 20vh; color: #333; }
+h1 { font-size: 2.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Headline}}</h1>
+<p>{{.Device}} is blocked{{if .Reason}}: {{.Reason}}{{end}}</p>
+<p>The Wi-Fi is working, this device is in downtime.</p>
+</body>
+</html>
+`))
+
+// Handler shows the notice for the device making the request, whatever the path,
+// as the HTTP requests of blocked devices are redirected to it
+type Handler struct {
+	resource.NS
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n, ok, err := find(h.NS, ip, time.Now())
+	if err != nil {
+		logs.Errorf("failed to find the notice for %s: %s\n", ip, err)
+		http.Error(w, "failed to find the downtime of this device", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "this device is not in downtime", http.StatusNotFound)
+		return
+	}
+	// the notice changes with the rules so it is not cached for the site that was redirected
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, n); err != nil {
+		logs.Warnf("failed to show the notice for %s: %s\n", ip, err)
+	}
+}
+
+// found is a notice kept for the burst of requests from a device
+type found struct {
+	notice  Notice
+	ok      bool
+	expires time.Time
+}
+
+var (
+	recentLock sync.Mutex
+	// recent has the notices found in the last BURST, keyed by namespace and IP
+	recent = map[string]found{}
+)
+
+// find is the notice for the device with the IP, found again once the one found
+// for its last burst of requests expired
+func find(ns resource.NS, ip string, now time.Time) (Notice, bool, error) {
+	key := ns.Name + " " + ip
+	recentLock.Lock()
+	f, ok := recent[key]
+	recentLock.Unlock()
+	if ok && now.Before(f.expires) {
+		return f.notice, f.ok, nil
+	}
+	n, ok, err := Find(ns, ip)
+	if err != nil {
+		return Notice{}, false, err
+	}
+	recentLock.Lock()
+	defer recentLock.Unlock()
+	for k, f := range recent {
+		if !now.Before(f.expires) {
+			delete(recent, k)
+		}
+	}
+	recent[key] = found{notice: n, ok: ok, expires: now.Add(BURST)}
+	return n, ok, nil
+}
+
+// Listen opens the port of the notice in the namespace
+func Listen(ns resource.NS, port int) (net.Listener, error) {
+	var l net.Listener
+	err := ns.Enter(func() error {
+		var err error
+		l, err = net.Listen("tcp", ":"+strconv.Itoa(port))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the notice on %d in %s: %w", port, ns, err)
+	}
+	return l, nil
+}
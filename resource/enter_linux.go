@@ -0,0 +1,41 @@
+package resource
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// Enter runs the function with the thread in the namespace, sockets opened by the
+// function stay in the namespace after the thread switches back
+func (ns NS) Enter(fn func() error) error {
+	if ns.Name == "" {
+		return fn()
+	}
+	runtime.LockOSThread()
+	original, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer original.Close()
+	target, err := os.Open("/var/run/netns/" + ns.Name)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer target.Close()
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to enter %s: %w", ns, err)
+	}
+	fnErr := fn()
+	if err := unix.Setns(int(original.Fd()), unix.CLONE_NEWNET); err != nil {
+		// the thread is left locked so it is not reused in the wrong namespace
+		return fmt.Errorf("failed to leave %s: %w", ns, err)
+	}
+	runtime.UnlockOSThread()
+	return fnErr
+}
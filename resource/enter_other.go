@@ -0,0 +1,13 @@
+//go:build !linux
+
+package resource
+
+import "fmt"
+
+// Enter only supports the host outside of linux
+func (ns NS) Enter(fn func() error) error {
+	if ns.Name == "" {
+		return fn()
+	}
+	return fmt.Errorf("entering %s needs linux", ns)
+}
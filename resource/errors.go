@@ -0,0 +1,89 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/plockc/gateway/exec"
+)
+
+// Kind is a machine readable reason for a failure
+type Kind string
+
+const (
+	NOT_FOUND   Kind = "not_found"
+	CONFLICT    Kind = "conflict"
+	INVALID     Kind = "invalid"
+	UNSUPPORTED Kind = "unsupported"
+)
+
+// Error has the Kind of the failure, it is found through wrapping with errors.As
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithKind has the error be of the kind, nil stays nil
+func WithKind(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+func NotFound(format string, args ...any) error {
+	return WithKind(NOT_FOUND, fmt.Errorf(format, args...))
+}
+
+func Conflict(format string, args ...any) error {
+	return WithKind(CONFLICT, fmt.Errorf(format, args...))
+}
+
+func Invalid(format string, args ...any) error {
+	return WithKind(INVALID, fmt.Errorf(format, args...))
+}
+
+func Unsupported(format string, args ...any) error {
+	return WithKind(UNSUPPORTED, fmt.Errorf(format, args...))
+}
+
+// KindOf is the kind of the first Error wrapped by the error, empty if there is none
+func KindOf(err error) Kind {
+	var kindErr *Error
+	if errors.As(err, &kindErr) {
+		return kindErr.Kind
+	}
+	return ""
+}
+
+// Match is a failed command with the exit code, any code if 0,
+// and the output containing the message, any output if empty
+type Match struct {
+	Code    int
+	Message string
+	Kind
+}
+
+// Classify has the kind of the first match for a failed command,
+// other errors and commands without a match are returned as they are
+func Classify(err error, matches ...Match) error {
+	var cmdErr *exec.CommandError
+	if KindOf(err) != "" || !errors.As(err, &cmdErr) {
+		return err
+	}
+	for _, m := range matches {
+		if (m.Code == 0 || m.Code == cmdErr.Code) && strings.Contains(cmdErr.Out, m.Message) {
+			return WithKind(m.Kind, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package resource_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/nftables"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		cmd     string
+		code    int
+		out     string
+		matches []resource.Match
+		kind    resource.Kind
+	}{
+		{"ipset -N tvs hash:mac", 1, "ipset v7.17: Set cannot be created: set with the same name already exists",
+			iptables.IPSetErrors, resource.CONFLICT},
+		{"ipset add tvs 00:00:00:00:00:01", 1, "ipset v7.17: Element cannot be added to the set: it's already added",
+			iptables.IPSetErrors, resource.CONFLICT},
+		{"ipset del tvs 00:00:00:00:00:01", 1, "ipset v7.17: Element cannot be deleted from the set: it's not added",
+			iptables.IPSetErrors, resource.NOT_FOUND},
+		{"ipset add missing 00:00:00:00:00:01", 1,
+			"ipset v7.17: The set with the given name does not exist", iptables.IPSetErrors, resource.NOT_FOUND},
+		{"ipset destroy tvs", 1, "ipset v7.17: Set cannot be destroyed: it is in use by a kernel component",
+			iptables.IPSetErrors, resource.CONFLICT},
+		{"iptables -N blocked", 1, "iptables: Chain already exists.", iptables.IPTablesErrors, resource.CONFLICT},
+		{"iptables -A FORWARD -j missing", 2,
+			"iptables v1.8.9 (legacy): Couldn't load target `missing':No such file or directory",
+			iptables.IPTablesErrors, resource.UNSUPPORTED},
+		{"iptables -X blocked", 1, "iptables v1.8.9 (legacy): CHAIN_DEL failed (Directory not empty): chain blocked",
+			iptables.IPTablesErrors, resource.CONFLICT},
+		{"iptables -A FORWARD --bad", 2, "iptables v1.8.9 (legacy): unknown option \"--bad\"",
+			iptables.IPTablesErrors, resource.INVALID},
+		{"nft -f rules.nft", 1, "Error: Could not process rule: No such file or directory",
+			nftables.NFTablesErrors, resource.NOT_FOUND},
+		{"nft -f rules.nft", 1, "Error: Could not process rule: Device or resource busy",
+			nftables.NFTablesErrors, resource.CONFLICT},
+		{"ipset list", 1, "ipset v7.17: Kernel error received: Operation not permitted", iptables.IPSetErrors, ""},
+	} {
+		err := resource.Classify(fmt.Errorf("wrapped: %w", exec.ExitError([]string{tc.cmd}, tc.code, tc.out)), tc.matches...)
+		if kind := resource.KindOf(err); kind != tc.kind {
+			t.Errorf("expected '%s' to be '%s', got '%s'", tc.out, tc.kind, kind)
+		}
+		var cmdErr *exec.CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Code != tc.code {
+			t.Errorf("expected the command error to be kept, got %v", err)
+		}
+	}
+
+	// errors already with a kind, and errors that are not from commands, are kept as they are
+	invalid := resource.Invalid("bad MAC")
+	if err := resource.Classify(invalid, iptables.IPSetErrors...); err != invalid {
+		t.Errorf("expected the kind to be kept, got %v", err)
+	}
+	if err := resource.Classify(errors.New("does not exist"), iptables.IPSetErrors...); resource.KindOf(err) != "" {
+		t.Errorf("expected only command errors to be classified, got %v", err)
+	}
+	if resource.WithKind(resource.CONFLICT, nil) != nil {
+		t.Error("expected nil to stay nil")
+	}
+}
@@ -1,10 +1,7 @@
 package resource
 
 import (
-	"fmt"
 	"strings"
-
-	"github.com/plockc/gateway/exec"
 )
 
 type NS struct {
@@ -43,23 +40,31 @@ func (ns NSRes) Id() string {
 }
 
 func (ns NSRes) Delete() error {
-	_, _, err := exec.ExecLine("ip netns del " + ns.Id())
-	return err
+	if ns.Name == "" {
+		return Conflict("the host namespace cannot be deleted")
+	}
+	return NewNS("").Runner().RunLine("ip netns del " + ns.Id())
 }
 
+// List has the names of the namespaces, ip lists a namespace with an id like "gw (id: 0)"
 func (ns NSRes) List() ([]string, error) {
-	_, out, err := exec.ExecLine("ip netns list")
+	res, err := NewNS("").Runner().ExecLine("ip netns list")
 	if err != nil {
 		return nil, err
 	}
-	return strings.Split(out, "\n"), nil
+	names := []string{}
+	for _, line := range strings.Split(res.Out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names, nil
 }
 
 func (ns NSRes) Create() error {
-	_, _, err := exec.ExecLine("ip netns add " + ns.Id())
-	return err
+	return NewNS("").Runner().RunLine("ip netns add " + ns.Id())
 }
 
 func (ns NSRes) Clear() error {
-	return fmt.Errorf("Clear not implemented")
+	return Unsupported("the namespaces are deleted one at a time")
 }
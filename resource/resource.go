@@ -20,6 +20,11 @@ type Loader interface {
 	Load() error
 }
 
+// Updater resources are updated by Ensure when they already exist
+type Updater interface {
+	Update() error
+}
+
 type Lifecycle struct {
 	Resource
 }
@@ -40,6 +45,9 @@ func (lf Lifecycle) Ensure() (bool, error) {
 	if exists, err := lf.Exists(); err != nil {
 		return false, fmt.Errorf("cannot ensure %v exists: %w", lf.Resource.Id(), err)
 	} else if exists {
+		if updater, ok := lf.Resource.(Updater); ok {
+			return false, updater.Update()
+		}
 		return false, nil
 	}
 	return true, lf.Create()
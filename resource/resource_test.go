@@ -0,0 +1,41 @@
+package resource_test
+
+import (
+	"testing"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+func TestLifecycle(t *testing.T) {
+	fake := firewall.NewFake()
+	ns := resource.NewNS("lifecycle")
+	ipSet := iptables.NewIPSet(ns, "tvs")
+	lc := resource.NewLifecycle(fake.IPSetResource(ipSet))
+	members := resource.NewLifecycle(fake.MemberResource(iptables.NewMember(ipSet, address.MAC{1})))
+
+	for _, step := range []struct {
+		name     string
+		f        func() (bool, error)
+		expected bool
+	}{
+		{"ensure missing set is deleted", lc.EnsureDeleted, false},
+		{"ensure set exists", lc.Ensure, true},
+		{"ensure existing set exists", lc.Ensure, false},
+		{"check set exists", lc.Exists, true},
+		{"ensure member exists", members.Ensure, true},
+		{"ensure members are cleared", members.EnsureCleared, true},
+		{"ensure no members are cleared", members.EnsureCleared, false},
+		{"ensure set is deleted", lc.EnsureDeleted, true},
+	} {
+		changed, err := step.f()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if changed != step.expected {
+			t.Fatalf("%s: expected %v, got %v", step.name, step.expected, changed)
+		}
+	}
+}
@@ -8,12 +8,18 @@ import (
 	"github.com/plockc/gateway/multiline"
 )
 
+// DefaultExecutor runs the commands for Runners without an Executor,
+// replace it to record, replay or inject faults into the commands
+var DefaultExecutor exec.Executor = exec.System{}
+
 type Runner struct {
 	// prevent Id and String from promoting so
 	// can embed Runner without conflicting with
 	// an embedded resource.Named
 	NS
 	Results []Result
+	// Executor runs the commands, the DefaultExecutor if nil
+	Executor exec.Executor
 }
 
 type Result struct {
@@ -113,7 +119,11 @@ func (r *Runner) Run(cmd []string) error {
 	if r.NSName() != "" {
 		cmd = r.WrapCmd(cmd)
 	}
-	code, out, err := exec.Exec(cmd)
+	executor := r.Executor
+	if executor == nil {
+		executor = DefaultExecutor
+	}
+	code, out, err := executor.Exec(cmd)
 	r.Results = append(r.Results, Result{Cmd: cmd, Out: out, Code: code})
 	return err
 }
@@ -0,0 +1,284 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/plockc/gateway/bootstrap"
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/throttle"
+	"golang.org/x/exp/slices"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	CREATE = "create"
+	DELETE = "delete"
+)
+
+// Change is a difference between the live and the desired state
+type Change struct {
+	// Action is CREATE or DELETE
+	Action string `json:"action"`
+	// Kind is ipset, member, chain or rule
+	Kind string `json:"kind"`
+	// Name is the set, the set and member, the table and chain, or the table, chain and rule Id
+	Name string `json:"name"`
+	// Rule is the rule being created or deleted
+	Rule *iptables.Rule `json:"rule,omitempty"`
+	res  resource.Resource
+}
+
+func (c Change) String() string {
+	sign := "+"
+	if c.Action == DELETE {
+		sign = "-"
+	}
+	s := fmt.Sprintf("%s %s %s", sign, c.Kind, c.Name)
+	if c.Rule != nil {
+		s += ": " + strings.TrimSpace(c.Rule.Target+" "+c.Rule.Comment)
+	}
+	return s
+}
+
+// Options of reconciling, Prune deletes the members and rules of the sets and chains in the
+// desired state that are not in it, and DryRun only has the changes without making them
+type Options struct {
+	Prune  bool `json:"prune"`
+	DryRun bool `json:"dryRun"`
+}
+
+// Validate checks the sets, members and rules, the rules need their Ids so
+// they are the same rules each time the state is applied
+func (s State) Validate(ns resource.NS) error {
+	sets := map[string]bool{}
+	for _, set := range s.IPSets {
+		ipSet := iptables.IPSet{Name: set.Name, NS: ns, Type: set.Type}
+		if set.Name == "" {
+			return resource.Invalid("a set needs a name")
+		}
+		if sets[set.Name] {
+			return resource.Invalid("set '%s' is in the state more than once", set.Name)
+		}
+		sets[set.Name] = true
+		if err := ipSet.Validate(); err != nil {
+			return err
+		}
+		for _, element := range set.Members {
+			if _, err := iptables.MemberFromString(ipSet, element); err != nil {
+				return err
+			}
+		}
+	}
+	chains := map[string]bool{}
+	for _, c := range s.Chains {
+		if _, ok := iptables.BuiltinChains[c.Table]; !ok {
+			return resource.Invalid("table '%s' is not one of %v", c.Table, iptables.TableNames())
+		}
+		if c.Name == "" {
+			return resource.Invalid("a chain of table '%s' needs a name", c.Table)
+		}
+		if chains[c.Table+" "+c.Name] {
+			return resource.Invalid("chain '%s' of table '%s' is in the state more than once", c.Name, c.Table)
+		}
+		chains[c.Table+" "+c.Name] = true
+		ids := map[uint32]bool{}
+		for _, rule := range c.Rules {
+			if rule.Id == 0 {
+				return resource.Invalid("the rules of chain '%s' need an Id", c.Name)
+			}
+			if ids[rule.Id] {
+				return resource.Invalid("rule Id %x is in chain '%s' more than once", rule.Id, c.Name)
+			}
+			ids[rule.Id] = true
+			rule.Chain = iptables.NewChain(iptables.NewTable(ns, c.Table), c.Name)
+			if err := rule.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Plan has the changes making the live state of the namespace the desired state, in the order
+// they are made: sets, members, chains, then the rules after the rules out of order are deleted,
+// then the members that are pruned.
+// Pruning only deletes from the sets and chains in the desired state, and never the members of
+// the sets of domains or the rules of the bootstrap and the limits, which are kept by the gateway.
+// A set of another type is a conflict as the set would need to be deleted with its members
+func Plan(ns resource.NS, desired State, prune bool) ([]Change, error) {
+	if err := desired.Validate(ns); err != nil {
+		return nil, err
+	}
+	fw := firewall.For(ns)
+	live, err := Export(ns)
+	if err != nil {
+		return nil, err
+	}
+	liveSets := map[string]IPSet{}
+	for _, set := range live.IPSets {
+		liveSets[set.Name] = set
+	}
+	resolved := map[string]bool{}
+	for _, name := range domains.Names(ns) {
+		resolved[name] = true
+	}
+	liveChains := map[string]Chain{}
+	for _, c := range live.Chains {
+		liveChains[c.Table+" "+c.Name] = c
+	}
+
+	var creates, ruleDeletes []Change
+	create := func(kind, name string, res resource.Resource) {
+		creates = append(creates, Change{Action: CREATE, Kind: kind, Name: name, res: res})
+	}
+
+	// the sets then the members
+	memberCreates := []Change{}
+	memberDeletes := []Change{}
+	for _, set := range desired.IPSets {
+		ipSet := iptables.IPSet{Name: set.Name, NS: ns, Type: set.Type}
+		liveSet, exists := liveSets[set.Name]
+		if !exists {
+			create("ipset", set.Name, fw.IPSetResource(ipSet))
+		} else if liveSet.Type != ipSet.SetType() && liveSet.Type != "" {
+			return nil, resource.Conflict("set '%s' is %s, not %s", set.Name, liveSet.Type, ipSet.SetType())
+		}
+		liveElements := map[string]bool{}
+		for _, element := range liveSet.Members {
+			if member, err := iptables.MemberFromString(ipSet, element); err == nil {
+				liveElements[member.Element()] = true
+			}
+		}
+		desiredElements := map[string]bool{}
+		for _, element := range set.Members {
+			member, _ := iptables.MemberFromString(ipSet, element)
+			desiredElements[member.Element()] = true
+			if !liveElements[member.Element()] {
+				memberCreates = append(memberCreates, Change{
+					Action: CREATE, Kind: "member", Name: set.Name + " " + member.Element(), res: fw.MemberResource(member),
+				})
+			}
+		}
+		if !prune || resolved[set.Name] {
+			continue
+		}
+		for _, element := range liveSet.Members {
+			member, err := iptables.MemberFromString(ipSet, element)
+			if err != nil || desiredElements[member.Element()] {
+				continue
+			}
+			memberDeletes = append(memberDeletes, Change{
+				Action: DELETE, Kind: "member", Name: set.Name + " " + member.Element(), res: fw.MemberResource(member),
+			})
+		}
+	}
+	creates = append(creates, memberCreates...)
+
+	// the chains, then the rules in order
+	ruleCreates := []Change{}
+	for _, c := range desired.Chains {
+		key := c.Table + " " + c.Name
+		chain := iptables.NewChain(iptables.NewTable(ns, c.Table), c.Name)
+		liveChain, exists := liveChains[key]
+		if !exists {
+			create("chain", key, fw.ChainResource(chain))
+		}
+		desiredIds := map[uint32]bool{}
+		for _, rule := range c.Rules {
+			desiredIds[rule.Id] = true
+		}
+		// the live rules that stay, which have to be in the desired order
+		kept := []iptables.Rule{}
+		for _, rule := range liveChain.Rules {
+			if desiredIds[rule.Id] {
+				kept = append(kept, rule)
+			} else if prune && !gatewayRule(rule.Id) {
+				ruleDeletes = append(ruleDeletes, ruleChange(fw, DELETE, key, rule))
+			}
+		}
+		// the rules are added at the end of the chain, so the kept rules after the first
+		// that differs from the desired rules are deleted then created again
+		same := 0
+		for same < len(kept) && same < len(c.Rules) && kept[same].Id == c.Rules[same].Id &&
+			slices.Equal(kept[same].Args(), withChain(c.Rules[same], chain).Args()) {
+			same++
+		}
+		for _, rule := range kept[same:] {
+			ruleDeletes = append(ruleDeletes, ruleChange(fw, DELETE, key, rule))
+		}
+		for _, rule := range c.Rules[same:] {
+			ruleCreates = append(ruleCreates, ruleChange(fw, CREATE, key, withChain(rule, chain)))
+		}
+	}
+
+	changes := append(append(append(creates, ruleDeletes...), ruleCreates...), memberDeletes...)
+	if changes == nil {
+		changes = []Change{}
+	}
+	return changes, nil
+}
+
+// RULE_IDS are how many Ids from the RULE_ID_BASE of the bootstrap and the limits are theirs
+const RULE_IDS = 0x100000
+
+// gatewayRule is a rule the gateway keeps by its Id, like the masquerading of the bootstrap
+// or the marking of a limit, which would be deleted from the builtin chains when pruning
+func gatewayRule(id uint32) bool {
+	return (id >= bootstrap.RULE_ID_BASE && id < bootstrap.RULE_ID_BASE+RULE_IDS) || limitRule(id)
+}
+
+// limitRule is a rule of the limits, which is created along with the classes of the limit
+func limitRule(id uint32) bool {
+	return id >= throttle.RULE_ID_BASE && id < throttle.RULE_ID_BASE+RULE_IDS
+}
+
+func withChain(rule iptables.Rule, chain iptables.Chain) iptables.Rule {
+	rule.Chain = chain
+	return rule
+}
+
+func ruleChange(fw firewall.Backend, action, chain string, rule iptables.Rule) Change {
+	return Change{
+		Action: action, Kind: "rule", Name: chain + " " + rule.RuleId(), Rule: &rule, res: fw.RuleResource(rule),
+	}
+}
+
+// Make makes the changes in order, stopping at the first that fails
+func Make(changes []Change) error {
+	for _, c := range changes {
+		lc := resource.NewLifecycle(c.res)
+		var err error
+		if c.Action == DELETE {
+			_, err = lc.EnsureDeleted()
+		} else {
+			_, err = lc.Ensure()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s %s %s: %w", c.Action, c.Kind, c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Reconcile makes the live state of the namespace the desired state,
+// the changes are returned even if they are not all made
+func Reconcile(ns resource.NS, desired State, opts Options) ([]Change, error) {
+	changes, err := Plan(ns, desired, opts.Prune)
+	if err != nil || opts.DryRun {
+		return changes, err
+	}
+	return changes, Make(changes)
+}
+
+// Parse reads the state from a YAML or JSON document, unknown fields are an error
+func Parse(data []byte) (State, error) {
+	s := State{}
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return s, resource.Invalid("the state is not valid: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,162 @@
+package state_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/bootstrap"
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+)
+
+const policy = `
+ipsets:
+- name: kids
+  members: ["12:12:12:12:12:ab"]
+- name: games
+  type: hash:ip
+  members: [44.44.44.44]
+chains:
+- table: filter
+  name: FORWARD
+  rules:
+  - {Id: 10, target: downtime}
+- table: filter
+  name: downtime
+  rules:
+  - {Id: 11, target: DROP, matchSetSrc: kids, matchSetDst: games}
+  - {Id: 12, target: REJECT, matchSetSrc: kids, end: "2030-01-01T07:00:00Z"}
+`
+
+// changes are like "+ ipset kids" for comparing
+func changes(t *testing.T, ns resource.NS, desired state.State, opts state.Options) []string {
+	t.Helper()
+	made, err := state.Reconcile(ns, desired, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, c := range made {
+		sign := "+"
+		if c.Action == state.DELETE {
+			sign = "-"
+		}
+		names = append(names, sign+" "+c.Kind+" "+c.Name)
+	}
+	return names
+}
+
+func TestReconcile(t *testing.T) {
+	ns := resource.NewNS("reconcile")
+	fake := firewalltest.Use(t, ns)
+	desired, err := state.Parse([]byte(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := []string{
+		"+ ipset kids", "+ ipset games", "+ member kids 12:12:12:12:12:AB", "+ member games 44.44.44.44",
+		"+ chain filter downtime", "+ rule filter FORWARD a", "+ rule filter downtime b", "+ rule filter downtime c",
+	}
+	if got := changes(t, ns, desired, state.Options{DryRun: true}); !reflect.DeepEqual(got, all) {
+		t.Fatalf("expected the changes %v, got %v", all, got)
+	}
+	if got := changes(t, ns, desired, state.Options{}); !reflect.DeepEqual(got, all) {
+		t.Fatalf("expected the changes %v, got %v", all, got)
+	}
+	if got := changes(t, ns, desired, state.Options{Prune: true}); len(got) != 0 {
+		t.Fatalf("expected no changes when applied again, got %v", got)
+	}
+
+	// the rules after the first out of order are created again in order
+	rules := desired.Chains[1].Rules
+	desired.Chains[1].Rules = []iptables.Rule{rules[1], rules[0]}
+	expected := []string{"- rule filter downtime b", "- rule filter downtime c", "+ rule filter downtime c", "+ rule filter downtime b"}
+	if got := changes(t, ns, desired, state.Options{}); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected the changes %v, got %v", expected, got)
+	}
+	exported, err := state.Export(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range exported.Chains {
+		if c.Name == "downtime" && (len(c.Rules) != 2 || c.Rules[0].Id != 12 || c.Rules[1].Id != 11) {
+			t.Fatalf("expected the rules in the new order, got %+v", c.Rules)
+		}
+	}
+
+	// only pruning deletes what is not in the desired state, only from the sets and chains in it
+	// and never the rules of the gateway
+	jump := iptables.NewRule(iptables.NewChain(iptables.FilterTable(ns), "FORWARD"))
+	jump.Id, jump.Target = bootstrap.FORWARD_JUMP_RULE_ID, "downtime"
+	if err := fake.RuleResource(jump).Create(); err != nil {
+		t.Fatal(err)
+	}
+	desired.IPSets = desired.IPSets[:1]
+	desired.IPSets[0].Members = nil
+	desired.Chains = desired.Chains[:1]
+	desired.Chains[0].Rules = nil
+	if got := changes(t, ns, desired, state.Options{}); len(got) != 0 {
+		t.Fatalf("expected no changes without pruning, got %v", got)
+	}
+	expected = []string{"- rule filter FORWARD a", "- member kids 12:12:12:12:12:AB"}
+	if got := changes(t, ns, desired, state.Options{Prune: true}); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected the changes %v, got %v", expected, got)
+	}
+	if exists, err := resource.NewLifecycle(fake.RuleResource(jump)).Exists(); err != nil || !exists {
+		t.Fatalf("expected the jump of the bootstrap kept, got %t, %v", exists, err)
+	}
+}
+
+func TestReconcileInvalid(t *testing.T) {
+	ns := resource.NewNS("reconcile-invalid")
+	firewalltest.Use(t, ns)
+	for name, doc := range map[string]string{
+		"unknown field":   "ipsets: [{name: kids, colour: red}]",
+		"bad member":      "ipsets: [{name: kids, members: [tv]}]",
+		"rule without Id": "chains: [{table: filter, name: FORWARD, rules: [{target: DROP}]}]",
+		"unknown table":   "chains: [{table: other, name: FORWARD}]",
+	} {
+		desired, err := state.Parse([]byte(doc))
+		if err == nil {
+			_, err = state.Reconcile(ns, desired, state.Options{})
+		}
+		if resource.KindOf(err) != resource.INVALID {
+			t.Fatalf("%s: expected an invalid state, got %v", name, err)
+		}
+	}
+	// a set of another type is a conflict
+	if _, err := state.Reconcile(ns, state.State{IPSets: []state.IPSet{{Name: "games", Type: iptables.HASH_IP}}}, state.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := state.Reconcile(ns, state.State{IPSets: []state.IPSet{{Name: "games"}}}, state.Options{})
+	if resource.KindOf(err) != resource.CONFLICT {
+		t.Fatalf("expected a conflict for the type of the set, got %v", err)
+	}
+}
+
+func TestReconcileDomains(t *testing.T) {
+	ns := resource.NewNS("reconcile-domains")
+	fake := firewalltest.Use(t, ns)
+	defer func(server string) { domains.Server = server }(domains.Server)
+	// nothing answers, so the members of the set are only those added
+	domains.Server = "127.0.0.1:9"
+	d := domains.NewDomains(ns, "homework")
+	d.Domains = []string{"youtube.test"}
+	if _, err := domains.Start(d, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	defer domains.Stop(ns, d.Name)
+	if err := fake.MemberResource(iptables.NewIPMember(d.IPSet(), net.ParseIP("10.0.0.1"))).Create(); err != nil {
+		t.Fatal(err)
+	}
+	// the members of the set of the domains are resolved, so they are not pruned
+	desired := state.State{IPSets: []state.IPSet{{Name: d.Name, Type: iptables.HASH_IP}}}
+	if got := changes(t, ns, desired, state.Options{Prune: true}); len(got) != 0 {
+		t.Fatalf("expected no changes to the set of the domains, got %v", got)
+	}
+}
@@ -0,0 +1,254 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/throttle"
+	"golang.org/x/exp/slices"
+)
+
+// Snapshot is the state of a namespace with the firewall backend it was in, its limits
+// and its watched domains, which are only in memory
+type Snapshot struct {
+	// Firewall is the backend of the namespace, selected again before the state is restored
+	Firewall string `json:"firewall,omitempty"`
+	State
+	Limits  []Limit          `json:"limits,omitempty"`
+	Domains []WatchedDomains `json:"domains,omitempty"`
+}
+
+// Limit has the classes and the mark rule of the limit of the Id created again when restored
+type Limit struct {
+	Id uint16 `json:"id"`
+	throttle.Limit
+}
+
+// WatchedDomains are the domains filling the set of the Name, they are watched again when restored
+type WatchedDomains struct {
+	Name string `json:"name"`
+	domains.Domains
+}
+
+// Snapshots keep the state of each namespace in a file of the Dir, as the sets, chains
+// and rules are only in the kernel and are gone after a reboot. Only the chains the gateway
+// manages are kept, the chains of other software are left for it to create
+type Snapshots struct {
+	Dir string
+	// mu has one save write the files at a time
+	mu sync.Mutex
+	// kept are the chains without managed rules that are saved, keyed by namespace then table and name
+	kept map[string]map[string]bool
+}
+
+func NewSnapshots(dir string) *Snapshots {
+	return &Snapshots{Dir: dir, kept: map[string]map[string]bool{}}
+}
+
+// Keep has the chain saved even while it has no managed rules, like a chain created through the API
+func (s *Snapshots) Keep(chain iptables.Chain) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keep(chain.NS, chain.Table.Name, chain.Name)
+}
+
+func (s *Snapshots) keep(ns resource.NS, table, name string) {
+	if s.kept[ns.Name] == nil {
+		s.kept[ns.Name] = map[string]bool{}
+	}
+	s.kept[ns.Name][table+" "+name] = true
+}
+
+// managed has the chains with managed rules, the chains the managed rules jump to,
+// and the chains that are kept
+func (s *Snapshots) managed(ns resource.NS, exported State) []Chain {
+	targets := map[string]bool{}
+	for _, c := range exported.Chains {
+		for _, rule := range c.Rules {
+			targets[c.Table+" "+rule.Target] = true
+		}
+	}
+	chains := []Chain{}
+	for _, c := range exported.Chains {
+		key := c.Table + " " + c.Name
+		builtin := slices.Contains(iptables.BuiltinChains[c.Table], c.Name)
+		if len(c.Rules) > 0 || (!builtin && (targets[key] || s.kept[ns.Name][key])) {
+			chains = append(chains, c)
+		}
+	}
+	return chains
+}
+
+// File is state.json for the host, or like state-gw.json for a network namespace
+func (s *Snapshots) File(ns resource.NS) string {
+	if ns.Name == "" {
+		return filepath.Join(s.Dir, "state.json")
+	}
+	return filepath.Join(s.Dir, "state-"+ns.Name+".json")
+}
+
+// limits are the limits of the namespace with their rates, devices and sets
+func limits(ns resource.NS) ([]Limit, error) {
+	ids, err := throttle.NewLimit(ns, 0).LimitResource().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the limits: %w", err)
+	}
+	found := []Limit{}
+	for _, id := range ids {
+		limitId, err := throttle.ParseLimitId(id)
+		if err != nil {
+			return nil, err
+		}
+		res := throttle.NewLimit(ns, limitId).LimitResource()
+		if err := res.Load(); err != nil {
+			return nil, err
+		}
+		found = append(found, Limit{Id: limitId, Limit: res.Limit})
+	}
+	return found, nil
+}
+
+// Save exports the firewall backend, the state, the limits and the watched domains of the namespace,
+// replacing the file so it is never partly written. The rules of the limits are only in the limits
+func (s *Snapshots) Save(ns resource.NS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exported, err := Export(ns)
+	if err != nil {
+		return err
+	}
+	for i, c := range exported.Chains {
+		rules := []iptables.Rule{}
+		for _, rule := range c.Rules {
+			if !limitRule(rule.Id) {
+				rules = append(rules, rule)
+			}
+		}
+		exported.Chains[i].Rules = rules
+	}
+	exported.Chains = s.managed(ns, exported)
+	snapshot := Snapshot{Firewall: firewall.For(ns).Name(), State: exported}
+	if snapshot.Limits, err = limits(ns); err != nil {
+		return err
+	}
+	for _, d := range domains.List(ns) {
+		snapshot.Domains = append(snapshot.Domains, WatchedDomains{Name: d.Name, Domains: d})
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.File(ns))
+}
+
+// Delete removes the snapshot of a namespace that is deleted, so it is not restored
+func (s *Snapshots) Delete(ns resource.NS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.kept, ns.Name)
+	if err := os.Remove(s.File(ns)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Namespaces are the namespaces with a snapshot, the host first
+func (s *Snapshots) Namespaces() ([]resource.NS, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	namespaces := []resource.NS{}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case name == "state.json":
+			namespaces = append([]resource.NS{resource.NewNS("")}, namespaces...)
+		case strings.HasPrefix(name, "state-") && strings.HasSuffix(name, ".json"):
+			namespaces = append(namespaces, resource.NewNS(strings.TrimSuffix(strings.TrimPrefix(name, "state-"), ".json")))
+		}
+	}
+	return namespaces, nil
+}
+
+// Restore creates the network namespace if it is gone, selects its firewall backend, imports the
+// snapshot of the namespace, if it has one, then creates its limits and watches its domains again.
+// The rules that are different in the namespace are reported as Conflicts
+func (s *Snapshots) Restore(ns resource.NS) error {
+	data, err := os.ReadFile(s.File(ns))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	snapshot := Snapshot{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to parse the snapshot %s: %w", s.File(ns), err)
+	}
+	if ns.Name != "" {
+		if _, err := resource.NewLifecycle(ns.NSResource()).Ensure(); err != nil {
+			return fmt.Errorf("failed to create %s: %w", ns, err)
+		}
+	}
+	if snapshot.Firewall != "" {
+		if err := firewall.Select(ns, snapshot.Firewall); err != nil {
+			return err
+		}
+	}
+	// the chains in the snapshot were managed, so they are kept in the next saves
+	s.mu.Lock()
+	for _, c := range snapshot.Chains {
+		s.keep(ns, c.Table, c.Name)
+	}
+	s.mu.Unlock()
+	// the limits and domains are restored even when some rules conflict, as their sets are restored
+	err = Import(ns, snapshot.State)
+	if err != nil && resource.KindOf(err) != resource.CONFLICT {
+		return err
+	}
+	for _, saved := range snapshot.Limits {
+		l := saved.Limit
+		l.Id, l.NS = saved.Id, ns
+		if _, limitErr := resource.NewLifecycle(l.LimitResource()).Ensure(); limitErr != nil && err == nil {
+			err = fmt.Errorf("failed to create %s: %w", l, limitErr)
+		}
+	}
+	for _, watched := range snapshot.Domains {
+		d := watched.Domains
+		d.Name, d.NS = watched.Name, ns
+		if _, startErr := domains.Start(d, time.Now()); startErr != nil && err == nil {
+			err = fmt.Errorf("failed to watch %s: %w", d, startErr)
+		}
+	}
+	return err
+}
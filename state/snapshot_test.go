@@ -0,0 +1,317 @@
+package state_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plockc/gateway/domains"
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+	"github.com/plockc/gateway/throttle"
+	"github.com/plockc/gateway/throttle/throttletest"
+)
+
+// netnsExecutor has the network namespaces added, which ip lists with an id,
+// and the devices and classes of throttletest, other commands are passed through
+type netnsExecutor struct {
+	exec.Executor
+	added []string
+}
+
+func (n *netnsExecutor) Exec(cmd []string) (int, string, error) {
+	line := strings.Join(cmd, " ")
+	switch {
+	case strings.HasSuffix(line, "ip netns list"):
+		listed := []string{}
+		for i, name := range n.added {
+			listed = append(listed, fmt.Sprintf("%s (id: %d)", name, i))
+		}
+		return 0, strings.Join(listed, "\n"), nil
+	case strings.Contains(line, "ip netns add "):
+		n.added = append(n.added, cmd[len(cmd)-1])
+		return 0, "", nil
+	}
+	return n.Executor.Exec(cmd)
+}
+
+// useGateway has the commands of the test run against namespaces with lan and wan and without limits
+func useGateway(t *testing.T) (*netnsExecutor, *throttletest.TC) {
+	tc := throttletest.Use(t)
+	netns := &netnsExecutor{Executor: tc}
+	resource.DefaultExecutor = netns
+	return netns, tc
+}
+
+func TestSnapshots(t *testing.T) {
+	ns, host := resource.NewNS("snapshot"), resource.NewNS("")
+	useGateway(t)
+	firewalltest.Use(t, ns)
+	firewalltest.Use(t, host)
+	snapshots := state.NewSnapshots(filepath.Join(t.TempDir(), "data"))
+	if namespaces, err := snapshots.Namespaces(); err != nil || len(namespaces) != 0 {
+		t.Fatalf("expected no snapshots before the data dir exists, got %v %v", namespaces, err)
+	}
+	// there is nothing to restore without a snapshot
+	if err := snapshots.Restore(ns); err != nil {
+		t.Fatal(err)
+	}
+	desired, err := state.Parse([]byte(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.Reconcile(ns, desired, state.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, saved := range []resource.NS{ns, host} {
+		if err := snapshots.Save(saved); err != nil {
+			t.Fatal(err)
+		}
+	}
+	namespaces, err := snapshots.Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(namespaces, []resource.NS{host, ns}) {
+		t.Fatalf("expected the snapshots of the host and %s, got %v", ns, namespaces)
+	}
+	saved, err := state.Export(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// after a reboot the namespace has the same sets, chains and rules with their Ids
+	firewalltest.Use(t, ns)
+	if err := snapshots.Restore(ns); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := state.Export(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(saved)
+	got, _ := json.Marshal(restored)
+	if string(got) != string(want) {
+		t.Fatalf("expected %s, restored %s", want, got)
+	}
+}
+
+func TestSnapshotChains(t *testing.T) {
+	ns := resource.NewNS("snapshot-chains")
+	useGateway(t)
+	fake := firewalltest.Use(t, ns)
+	snapshots := state.NewSnapshots(t.TempDir())
+	desired, err := state.Parse([]byte(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.Reconcile(ns, desired, state.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	filter := iptables.FilterTable(ns)
+	// a chain of other software, and a chain created through the API without rules
+	for _, name := range []string{"DOCKER", "empty"} {
+		if err := fake.ChainResource(iptables.NewChain(filter, name)).Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshots.Keep(iptables.NewChain(filter, "empty"))
+	if err := snapshots.Save(ns); err != nil {
+		t.Fatal(err)
+	}
+	chains := func() []string {
+		t.Helper()
+		data, err := os.ReadFile(snapshots.File(ns))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := state.Snapshot{}
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, c := range s.Chains {
+			names = append(names, c.Table+" "+c.Name)
+		}
+		return names
+	}
+	expected := []string{"filter FORWARD", "filter downtime", "filter empty"}
+	if got := chains(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected the managed chains %v, got %v", expected, got)
+	}
+
+	// after a reboot the chains restored are still saved
+	firewalltest.Use(t, ns)
+	restored := state.NewSnapshots(snapshots.Dir)
+	if err := restored.Restore(ns); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Save(ns); err != nil {
+		t.Fatal(err)
+	}
+	if got := chains(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected the managed chains %v after restoring, got %v", expected, got)
+	}
+
+	if err := restored.Delete(ns); err != nil {
+		t.Fatal(err)
+	}
+	if namespaces, err := restored.Namespaces(); err != nil || len(namespaces) != 0 {
+		t.Fatalf("expected no snapshots after deleting the namespace, got %v %v", namespaces, err)
+	}
+}
+
+func TestSnapshotDomains(t *testing.T) {
+	ns := resource.NewNS("snapshot-domains")
+	useGateway(t)
+	firewalltest.Use(t, ns)
+	defer func(server string) { domains.Server = server }(domains.Server)
+	// nothing answers, so the members of the set are only those restored
+	domains.Server = "127.0.0.1:9"
+	snapshots := state.NewSnapshots(t.TempDir())
+
+	d := domains.NewDomains(ns, "homework")
+	d.Domains, d.Expiry = []string{"youtube.test"}, "2h"
+	if _, err := domains.Start(d, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	member := iptables.NewIPMember(d.IPSet(), net.ParseIP("10.0.0.1"))
+	if err := firewall.For(ns).MemberResource(member).Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshots.Save(ns); err != nil {
+		t.Fatal(err)
+	}
+	if err := domains.Stop(ns, d.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	// after a reboot the domains are watched again, and the members restored expire
+	// unless the domains still resolve to them
+	firewalltest.Use(t, ns)
+	before := time.Now()
+	if err := snapshots.Restore(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer domains.Stop(ns, d.Name)
+	w, ok := domains.Get(ns, d.Name)
+	if !ok || !reflect.DeepEqual(w.Domains.Domains, d.Domains) || w.Expiry != d.Expiry {
+		t.Fatalf("expected %+v to be watched again, got %v", d, domains.List(ns))
+	}
+	resolved := w.Resolved()
+	if len(resolved) != 1 || resolved[0].IP != "10.0.0.1" || resolved[0].LastSeen.Before(before) {
+		t.Fatalf("expected the restored member to expire from the restore, got %+v", resolved)
+	}
+}
+
+func TestRestoreConflicts(t *testing.T) {
+	ns := resource.NewNS("snapshot-conflicts")
+	useGateway(t)
+	firewalltest.Use(t, ns)
+	snapshots := state.NewSnapshots(t.TempDir())
+	desired, err := state.Parse([]byte(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.Reconcile(ns, desired, state.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshots.Save(ns); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rules changed since the snapshot are each reported, the others are restored
+	firewalltest.Use(t, ns)
+	desired.Chains[0].Rules[0].Target = "ACCEPT"
+	desired.Chains[1].Rules[0].Target = "ACCEPT"
+	desired.Chains[1].Rules = desired.Chains[1].Rules[:1]
+	if _, err := state.Reconcile(ns, desired, state.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	err = snapshots.Restore(ns)
+	if resource.KindOf(err) != resource.CONFLICT {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	var conflicts state.Conflicts
+	if !errors.As(err, &conflicts) || len(conflicts) != 2 {
+		t.Fatalf("expected 2 conflicts, got %v", err)
+	}
+	exported, err := state.Export(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range exported.Chains {
+		if c.Name == "downtime" && len(c.Rules) != 2 {
+			t.Fatalf("expected the rule without a conflict to be restored, got %+v", c.Rules)
+		}
+	}
+}
+
+func TestSnapshotLimits(t *testing.T) {
+	ns := resource.NewNS("snapshot-limits")
+	useGateway(t)
+	defer func(device string) { iptables.InternetDevice = device }(iptables.InternetDevice)
+	iptables.InternetDevice = "wan"
+	firewalltest.Use(t, ns)
+	snapshots := state.NewSnapshots(t.TempDir())
+	desired := state.State{IPSets: []state.IPSet{{Name: "kids"}}}
+	if _, err := state.Reconcile(ns, desired, state.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	homework := throttle.NewLimit(ns, 16)
+	homework.Rate, homework.MatchSetSrc, homework.Devices = "256kbit", "kids", []string{"lan"}
+	if err := homework.LimitResource().Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshots.Save(ns); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(snapshots.File(ns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := state.Snapshot{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	// the rules of the limit are created with the limit, so they are not in the state
+	if saved.Firewall != firewall.For(ns).Name() || len(saved.Limits) != 1 || len(saved.Chains) != 0 {
+		t.Fatalf("expected the backend and the limit without its rules, got %s", data)
+	}
+
+	// after a reboot the namespace is created again with the backend selected before the state
+	// and the limit is created again once its set is restored
+	netns, _ := useGateway(t)
+	firewalltest.Use(t, ns)
+	if err := firewall.Unselect(ns); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshots.Restore(ns); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(netns.added, []string{ns.Name}) {
+		t.Fatalf("expected %s to be created, got %v", ns, netns.added)
+	}
+	restored := throttle.NewLimit(ns, 16).LimitResource()
+	if err := restored.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Limit, homework) {
+		t.Fatalf("expected %+v restored, got %+v", homework, restored.Limit)
+	}
+	// a namespace that exists is not created again
+	if err := snapshots.Restore(ns); err != nil || len(netns.added) != 1 {
+		t.Fatalf("expected %s to be restored again without creating it, got %v, %v", ns, err, netns.added)
+	}
+}
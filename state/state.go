@@ -0,0 +1,152 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+)
+
+// State is the sets and chains of a namespace with the managed rules,
+// it is exported and imported as JSON
+type State struct {
+	IPSets []IPSet `json:"ipsets"`
+	Chains []Chain `json:"chains"`
+}
+
+type IPSet struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+	// Members are MACs for a hash:mac set, or IPv4 addresses for a hash:ip set
+	Members []string `json:"members"`
+}
+
+type Chain struct {
+	Table string `json:"table"`
+	Name  string `json:"name"`
+	// Rules are the managed rules in the order they are in the chain
+	Rules []iptables.Rule `json:"rules"`
+}
+
+// Export has the sets with their members and the chains of each table with their managed rules
+func Export(ns resource.NS) (State, error) {
+	fw := firewall.For(ns)
+	s := State{IPSets: []IPSet{}, Chains: []Chain{}}
+	sets, err := firewall.IPSets(fw, ns)
+	if err != nil {
+		return s, fmt.Errorf("failed to export the sets: %w", err)
+	}
+	for _, set := range sets {
+		members, err := fw.MemberResource(iptables.Member{IPSet: set}).List()
+		if err != nil {
+			return s, fmt.Errorf("failed to export the members of %s: %w", set, err)
+		}
+		s.IPSets = append(s.IPSets, IPSet{Name: set.Name, Type: set.Type, Members: members})
+	}
+	for _, table := range iptables.TableNames() {
+		names, err := fw.ChainResource(iptables.NewChain(iptables.NewTable(ns, table), "")).List()
+		if err != nil {
+			return s, fmt.Errorf("failed to export the chains of table '%s': %w", table, err)
+		}
+		for _, name := range names {
+			chain := iptables.NewChain(iptables.NewTable(ns, table), name)
+			rules, err := firewall.Rules(fw, chain)
+			if err != nil {
+				return s, fmt.Errorf("failed to export the rules of %s: %w", chain, err)
+			}
+			s.Chains = append(s.Chains, Chain{Table: table, Name: name, Rules: rules})
+		}
+	}
+	return s, nil
+}
+
+// Conflicts are the rules that are different in the namespace than in the imported state
+type Conflicts []error
+
+func (c Conflicts) Error() string {
+	msgs := []string{}
+	for _, err := range c {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d conflicts: %s", len(c), strings.Join(msgs, "; "))
+}
+
+// Import ensures the sets, then the members, then the chains, then the rules so
+// the rules can match the sets and jump to the chains. Rules keep their Ids,
+// an existing rule with the Id of a rule that is different is a conflict,
+// the other rules are still imported then the conflicts are the error
+func Import(ns resource.NS, s State) error {
+	fw := firewall.For(ns)
+	for _, set := range s.IPSets {
+		ipSet := iptables.IPSet{Name: set.Name, NS: ns, Type: set.Type}
+		if _, err := resource.NewLifecycle(fw.IPSetResource(ipSet)).Ensure(); err != nil {
+			return fmt.Errorf("failed to import %s: %w", ipSet, err)
+		}
+	}
+	for _, set := range s.IPSets {
+		ipSet := iptables.IPSet{Name: set.Name, NS: ns, Type: set.Type}
+		for _, element := range set.Members {
+			member, err := iptables.MemberFromString(ipSet, element)
+			if err != nil {
+				return err
+			}
+			if _, err := resource.NewLifecycle(fw.MemberResource(member)).Ensure(); err != nil {
+				return fmt.Errorf("failed to import %s: %w", member, err)
+			}
+		}
+	}
+	for _, c := range s.Chains {
+		chain := iptables.NewChain(iptables.NewTable(ns, c.Table), c.Name)
+		if _, err := resource.NewLifecycle(fw.ChainResource(chain)).Ensure(); err != nil {
+			return fmt.Errorf("failed to import %s: %w", chain, err)
+		}
+	}
+	conflicts := Conflicts{}
+	for _, c := range s.Chains {
+		chain := iptables.NewChain(iptables.NewTable(ns, c.Table), c.Name)
+		for _, rule := range c.Rules {
+			rule.Chain = chain
+			err := importRule(fw, rule)
+			if resource.KindOf(err) == resource.CONFLICT {
+				conflicts = append(conflicts, err)
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return resource.WithKind(resource.CONFLICT, conflicts)
+	}
+	return nil
+}
+
+func importRule(fw firewall.Backend, rule iptables.Rule) error {
+	res := fw.RuleResource(rule)
+	exists, err := resource.NewLifecycle(res).Exists()
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", rule, err)
+	}
+	if !exists {
+		if err := res.Create(); err != nil {
+			return fmt.Errorf("failed to import %s: %w", rule, err)
+		}
+		return nil
+	}
+	loader, ok := res.(resource.Loader)
+	if !ok {
+		return fmt.Errorf("%s rules cannot be loaded", fw.Name())
+	}
+	if err := loader.Load(); err != nil {
+		return err
+	}
+	existing, err := firewall.RuleOf(res)
+	if err != nil {
+		return err
+	}
+	if strings.Join(existing.Args(), " ") != strings.Join(rule.Args(), " ") {
+		return resource.Conflict("%s already exists as %v", rule, existing.Args())
+	}
+	return nil
+}
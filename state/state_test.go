@@ -0,0 +1,80 @@
+package state_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/state"
+)
+
+func TestExportImport(t *testing.T) {
+	from, to := resource.NewNS("export"), resource.NewNS("import")
+	firewalltest.Use(t, from)
+	filter := iptables.FilterTable(from)
+	downtime := iptables.NewChain(filter, "downtime")
+	s := state.State{
+		IPSets: []state.IPSet{
+			{Name: "kids", Type: iptables.HASH_MAC, Members: []string{"12:12:12:12:12:AB"}},
+			{Name: "games", Type: iptables.HASH_IP, Members: []string{"44.44.44.44"}},
+		},
+		Chains: []state.Chain{
+			{Table: "filter", Name: "FORWARD", Rules: []iptables.Rule{{Id: 0xa, Target: downtime.Name}}},
+			{Table: "filter", Name: "downtime", Rules: []iptables.Rule{
+				{Id: 0xb, Target: "DROP", MatchSetSrc: "kids", MatchSetDst: "games"},
+				{Id: 0xc, Target: "REJECT", MatchSetSrc: "kids"},
+			}},
+		},
+	}
+	// the rules jumping to a chain and matching the sets are before them in the state
+	if err := state.Import(from, s); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := state.Export(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exported.IPSets, s.IPSets) {
+		t.Fatalf("expected sets %+v, got %+v", s.IPSets, exported.IPSets)
+	}
+	rules := map[string][]uint32{}
+	for _, c := range exported.Chains {
+		for _, r := range c.Rules {
+			rules[c.Table+" "+c.Name] = append(rules[c.Table+" "+c.Name], r.Id)
+		}
+	}
+	if !reflect.DeepEqual(rules, map[string][]uint32{"filter FORWARD": {0xa}, "filter downtime": {0xb, 0xc}}) {
+		t.Fatalf("unexpected rules %v", rules)
+	}
+
+	// importing into another namespace, and again, has the same state
+	firewalltest.Use(t, to)
+	for i := 0; i < 2; i++ {
+		if err := state.Import(to, exported); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imported, err := state.Export(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the export is compared as JSON as the rules have their namespace
+	want, _ := json.Marshal(exported)
+	got, _ := json.Marshal(imported)
+	if string(got) != string(want) {
+		t.Fatalf("expected %s, imported %s", want, got)
+	}
+
+	// a different rule with the same Id is a conflict
+	for _, c := range exported.Chains {
+		if c.Name == "FORWARD" && len(c.Rules) > 0 {
+			c.Rules[0].Target = "ACCEPT"
+		}
+	}
+	if err := state.Import(to, exported); resource.KindOf(err) != resource.CONFLICT {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package throttle
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+// ROOT_HANDLE is the HTB qdisc on each device, the classes of the limits are under it
+const ROOT_HANDLE = "1:"
+
+// the rules have Ids from RULE_ID_BASE so they are found without keeping any state,
+// the mark rule of a limit has the Id of the limit added
+const (
+	RULE_ID_BASE    = 0x7e100000
+	SAVE_RULE_ID    = RULE_ID_BASE
+	RESTORE_RULE_ID = RULE_ID_BASE + 0x10000
+)
+
+var rateRegex = regexp.MustCompile(`^(?i)[1-9][0-9]*(bit|kbit|mbit|gbit)$`)
+
+// Limit is a rate limit for the packets with the mark of its Id, which is shaped by an HTB class
+// on each of the devices. Packets from members of the MatchSetSrc are marked in mangle,
+// as are packets of rules with the MARK target setting the mark to the Id.
+// The mark is kept with the connection so the replies from the Internet are also limited
+type Limit struct {
+	// Id is the mark of the packets and the minor of the HTB class
+	Id          uint16 `json:"-"`
+	resource.NS `json:"-"`
+	// Rate is like 256kbit, it is loaded the way tc shows it in lower case, like 1mbit for 1000kbit
+	Rate        string `json:"rate"`
+	MatchSetSrc string `json:"matchSetSrc"`
+	// Devices have the HTB class, all the devices except loopback if empty
+	Devices []string `json:"devices"`
+}
+
+func NewLimit(ns resource.NS, id uint16) Limit {
+	return Limit{Id: id, NS: ns}
+}
+
+func ParseLimitId(s string) (uint16, error) {
+	id, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || id == 0 {
+		return 0, resource.Invalid("limit Id '%s' is not 1 to 65535", s)
+	}
+	return uint16(id), nil
+}
+
+func (l Limit) LimitId() string {
+	return strconv.Itoa(int(l.Id))
+}
+
+func (l Limit) String() string {
+	return l.NS.String() + ":limit[" + l.LimitId() + "]"
+}
+
+// ClassId is the HTB class, tc has the minor in hex
+func (l Limit) ClassId() string {
+	return fmt.Sprintf("%s%x", ROOT_HANDLE, l.Id)
+}
+
+func (l Limit) Mark() string {
+	return fmt.Sprintf("0x%x", l.Id)
+}
+
+func (l Limit) Validate() error {
+	if l.Id == 0 {
+		return resource.Invalid("%s needs an Id of 1 to 65535", l)
+	}
+	if !rateRegex.MatchString(l.Rate) {
+		return resource.Invalid("rate '%s' is not like 256kbit, the units are bit, kbit, mbit or gbit", l.Rate)
+	}
+	return nil
+}
+
+// MarkRule marks the packets from the members of the MatchSetSrc
+func (l Limit) MarkRule() iptables.Rule {
+	return iptables.Rule{
+		Id:            RULE_ID_BASE + uint32(l.Id),
+		Chain:         iptables.NewChain(iptables.NewTable(l.NS, "mangle"), "PREROUTING"),
+		Target:        iptables.MARK,
+		MatchSetSrc:   l.MatchSetSrc,
+		TargetOptions: map[string]string{"set-mark": l.Mark()},
+		Comment:       "throttle " + l.LimitId(),
+	}
+}
+
+// SaveRule keeps the mark of the packets going to the Internet with their connections
+func SaveRule(ns resource.NS, wan string) iptables.Rule {
+	return iptables.Rule{
+		Id:            SAVE_RULE_ID,
+		Chain:         iptables.NewChain(iptables.NewTable(ns, "mangle"), "POSTROUTING"),
+		Target:        iptables.CONNMARK,
+		OutInterface:  wan,
+		TargetOptions: map[string]string{"save-mark": ""},
+		Comment:       "throttle",
+	}
+}
+
+// RestoreRule marks the replies from the Internet with the mark of their connections
+func RestoreRule(ns resource.NS, wan string) iptables.Rule {
+	return iptables.Rule{
+		Id:            RESTORE_RULE_ID,
+		Chain:         iptables.NewChain(iptables.NewTable(ns, "mangle"), "PREROUTING"),
+		Target:        iptables.CONNMARK,
+		InInterface:   wan,
+		TargetOptions: map[string]string{"restore-mark": ""},
+		Comment:       "throttle",
+	}
+}
+
+func QdiscShowCmd(dev string) []string {
+	return []string{"tc", "qdisc", "show", "dev", dev}
+}
+
+func QdiscAddCmd(dev string) []string {
+	return []string{"tc", "qdisc", "add", "dev", dev, "root", "handle", ROOT_HANDLE, "htb"}
+}
+
+func QdiscDelCmd(dev string) []string {
+	return []string{"tc", "qdisc", "del", "dev", dev, "root"}
+}
+
+func ClassShowCmd(dev string) []string {
+	return []string{"tc", "class", "show", "dev", dev}
+}
+
+// ClassCmd adds or changes the class, the ceiling is the rate so it cannot borrow
+func (l Limit) ClassCmd(op, dev string) []string {
+	return []string{
+		"tc", "class", op, "dev", dev, "parent", ROOT_HANDLE, "classid", l.ClassId(),
+		"htb", "rate", l.Rate, "ceil", l.Rate,
+	}
+}
+
+func (l Limit) ClassDelCmd(dev string) []string {
+	return []string{"tc", "class", "del", "dev", dev, "classid", l.ClassId()}
+}
+
+// FilterCmd adds or deletes the fw filter putting the packets with the mark in the class
+func (l Limit) FilterCmd(op, dev string) []string {
+	cmd := []string{"tc", "filter", op, "dev", dev, "parent", ROOT_HANDLE, "protocol", "ip", "prio", "1", "handle", l.Mark(), "fw"}
+	if op == "add" {
+		cmd = append(cmd, "flowid", l.ClassId())
+	}
+	return cmd
+}
+
+// HasRootQdisc is true if the output of `tc qdisc show` has the HTB qdisc of the limits
+func HasRootQdisc(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "qdisc htb "+ROOT_HANDLE+" root") {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassesFromString has the rates of the HTB classes under the root qdisc,
+// keyed by the limit Id, pass in the output from `tc class show`
+func ClassesFromString(output string) (map[uint16]string, error) {
+	classes := map[uint16]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "class" || fields[1] != "htb" || !strings.HasPrefix(fields[2], ROOT_HANDLE) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(fields[2], ROOT_HANDLE), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse class '%s': %w", fields[2], err)
+		}
+		rate := slices.Index(fields, "rate")
+		if rate < 0 || rate+1 >= len(fields) {
+			return nil, fmt.Errorf("class '%s' has no rate: %s", fields[2], line)
+		}
+		classes[uint16(id)] = fields[rate+1]
+	}
+	return classes, nil
+}
+
+// devices are the names of the links in the namespace that are not loopback
+func devices(ns resource.NS) ([]string, error) {
+	res, err := ns.Runner().Exec(address.LinksJsonCmd())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	links, err := address.LinksOutFromString(res.Out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse devices: %w", err)
+	}
+	return links.Devices(), nil
+}
+
+// classes are the rates of the classes of the limits on each device, keyed by device
+func classes(ns resource.NS) (map[string]map[uint16]string, error) {
+	devs, err := devices(ns)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]map[uint16]string{}
+	for _, dev := range devs {
+		res, err := ns.Runner().Exec(ClassShowCmd(dev))
+		if err != nil {
+			return nil, fmt.Errorf("failed to show classes of '%s': %w", dev, err)
+		}
+		if found[dev], err = ClassesFromString(res.Out); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
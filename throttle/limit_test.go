@@ -0,0 +1,139 @@
+package throttle_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/firewall/firewalltest"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"github.com/plockc/gateway/throttle"
+	"github.com/plockc/gateway/throttle/throttletest"
+)
+
+var testNS = resource.NewNS("throttle")
+
+func TestLimits(t *testing.T) {
+	tc := throttletest.Use(t)
+	defer func(device string) { iptables.InternetDevice = device }(iptables.InternetDevice)
+	iptables.InternetDevice = "wan"
+
+	firewalltest.Use(t, testNS)
+	fw := firewall.For(testNS)
+	set := iptables.NewIPSet(testNS, "kids")
+	if err := fw.IPSetResource(set).Create(); err != nil {
+		t.Fatal(err)
+	}
+	mangle := iptables.NewTable(testNS, "mangle")
+	rules := func(chain string) []iptables.Rule {
+		rules, err := firewall.Rules(fw, iptables.NewChain(mangle, chain))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rules
+	}
+
+	homework := throttle.NewLimit(testNS, 16)
+	homework.Rate, homework.MatchSetSrc = "256kbit", set.Name
+	if err := homework.LimitResource().Create(); err != nil {
+		t.Fatal(err)
+	}
+	if tc.Filters["lan"]["0x10"] != "1:10" || tc.Filters["wan"]["0x10"] != "1:10" || len(tc.Filters["lo"]) != 0 {
+		t.Fatalf("expected filters for the mark on lan and wan, got %v", tc.Filters)
+	}
+	prerouting := rules("PREROUTING")
+	if len(prerouting) != 2 || prerouting[0].Target != iptables.CONNMARK || prerouting[0].InInterface != "wan" ||
+		prerouting[1].Target != iptables.MARK || prerouting[1].MatchSetSrc != set.Name ||
+		prerouting[1].TargetOptions["set-mark"] != "0x10" {
+		t.Fatalf("expected restoring the mark then marking the set, got %v", prerouting)
+	}
+	if postrouting := rules("POSTROUTING"); len(postrouting) != 1 || postrouting[0].OutInterface != "wan" {
+		t.Fatalf("expected saving the mark going out wan, got %v", postrouting)
+	}
+
+	loaded := throttle.NewLimit(testNS, 16).LimitResource()
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	homework.Devices = []string{"lan", "wan"}
+	if !reflect.DeepEqual(loaded.Limit, homework) {
+		t.Fatalf("expected %+v, loaded %+v", homework, loaded.Limit)
+	}
+
+	// a limit for rules with the MARK target, only on the lan
+	streaming := throttle.NewLimit(testNS, 300)
+	streaming.Rate, streaming.Devices = "2mbit", []string{"lan"}
+	if err := streaming.LimitResource().Create(); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := streaming.LimitResource().List(); err != nil || !reflect.DeepEqual(ids, []string{"16", "300"}) {
+		t.Fatalf("unexpected limits %v: %v", ids, err)
+	}
+	if tc.Filters["lan"]["0x12c"] != "1:12c" || len(rules("PREROUTING")) != 2 {
+		t.Fatalf("expected the filter for the mark and no rule, got %v and %v", tc.Filters, rules("PREROUTING"))
+	}
+
+	// updating the rate and leaving the wan
+	homework.Rate, homework.Devices = "512kbit", []string{"lan"}
+	if _, err := resource.NewLifecycle(homework.LimitResource()).Ensure(); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Limit, homework) || tc.Qdiscs["wan"] {
+		t.Fatalf("expected %+v without the wan qdisc, loaded %+v", homework, loaded.Limit)
+	}
+
+	// a failed update keeps the limit
+	failed := homework
+	failed.Rate, failed.Devices, failed.MatchSetSrc = "1mbit", []string{"lan", "eth9"}, "teens"
+	if err := failed.LimitResource().Update(); err == nil {
+		t.Fatal("expected the update to fail on a missing device")
+	}
+	failed.Devices = []string{"lan"}
+	if err := failed.LimitResource().Update(); err == nil {
+		t.Fatal("expected the update to fail for a missing set")
+	}
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Limit, homework) {
+		t.Fatalf("expected the failed updates to keep %+v, loaded %+v", homework, loaded.Limit)
+	}
+
+	// changing the set replaces the mark rule
+	teens := iptables.NewIPSet(testNS, "teens")
+	if err := fw.IPSetResource(teens).Create(); err != nil {
+		t.Fatal(err)
+	}
+	homework.MatchSetSrc = teens.Name
+	if err := homework.LimitResource().Update(); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Limit, homework) || len(rules("PREROUTING")) != 2 {
+		t.Fatalf("expected %+v with one mark rule, loaded %+v and %v", homework, loaded.Limit, rules("PREROUTING"))
+	}
+
+	for _, bad := range []throttle.Limit{
+		{Id: 5, NS: testNS, Rate: "fast"},
+		{Id: 5, NS: testNS, Rate: "256kbps"},
+		{NS: testNS, Rate: "256kbit"},
+	} {
+		if err := bad.LimitResource().Create(); err == nil {
+			t.Fatalf("expected %+v to be invalid", bad)
+		}
+	}
+
+	if err := homework.LimitResource().Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules("PREROUTING")) != 0 || len(rules("POSTROUTING")) != 0 || tc.Qdiscs["lan"] {
+		t.Fatalf("expected the rules and qdiscs to be deleted, got %v, %v and %v",
+			rules("PREROUTING"), rules("POSTROUTING"), tc.Qdiscs)
+	}
+}
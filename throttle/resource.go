@@ -0,0 +1,301 @@
+package throttle
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/plockc/gateway/firewall"
+	"github.com/plockc/gateway/iptables"
+	"github.com/plockc/gateway/resource"
+	"golang.org/x/exp/slices"
+)
+
+var _ resource.Resource = LimitRes{}
+
+type LimitRes struct {
+	Limit
+	resource.FailUnimplementedMethods
+}
+
+func (l Limit) LimitResource() *LimitRes {
+	return &LimitRes{Limit: l}
+}
+
+func (l LimitRes) Id() string {
+	return l.LimitId()
+}
+
+func (l LimitRes) rule(rule iptables.Rule) resource.Lifecycle {
+	return resource.NewLifecycle(firewall.For(l.NS).RuleResource(rule))
+}
+
+// Create adds the class and filter on each device, the rules keeping the mark
+// with the connections, and the rule marking the packets from the set
+func (l LimitRes) Create() error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	devs := l.Devices
+	if len(devs) == 0 {
+		var err error
+		if devs, err = devices(l.NS); err != nil {
+			return err
+		}
+	}
+	for _, dev := range devs {
+		if err := l.addClass(dev); err != nil {
+			return err
+		}
+	}
+	if err := l.ensureConnmarkRules(); err != nil {
+		return err
+	}
+	if l.MatchSetSrc != "" {
+		return l.rule(l.MarkRule()).Create()
+	}
+	return nil
+}
+
+// addClass adds the qdisc if the device does not have it yet, then the class and filter of the limit
+func (l LimitRes) addClass(dev string) error {
+	res, err := l.Runner().Exec(QdiscShowCmd(dev))
+	if err != nil {
+		return fmt.Errorf("failed to show the qdisc of '%s': %w", dev, err)
+	}
+	if !HasRootQdisc(res.Out) {
+		if err := l.Runner().Run(QdiscAddCmd(dev)); err != nil {
+			return fmt.Errorf("failed to add the qdisc to '%s': %w", dev, err)
+		}
+	}
+	if err := l.Runner().Batch(l.ClassCmd("add", dev), l.FilterCmd("add", dev)); err != nil {
+		return fmt.Errorf("failed to add %s to '%s': %w", l.Limit, dev, err)
+	}
+	return nil
+}
+
+// ensureConnmarkRules keeps the mark with the connections going out the Internet device
+func (l LimitRes) ensureConnmarkRules() error {
+	wan, err := iptables.DetectInternetDevice(l.NS)
+	if err != nil {
+		return err
+	}
+	for _, rule := range []iptables.Rule{SaveRule(l.NS, wan), RestoreRule(l.NS, wan)} {
+		if _, err := l.rule(rule).Ensure(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update adds the classes on the new devices, replaces the mark rule if the set changed
+// and changes the rate of the classes in place, only then are the classes removed from
+// the devices left, so a failed update keeps the limit working
+func (l LimitRes) Update() error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	found, err := classes(l.NS)
+	if err != nil {
+		return err
+	}
+	devs := l.Devices
+	if len(devs) == 0 {
+		devs = make([]string, 0, len(found))
+		for dev := range found {
+			devs = append(devs, dev)
+		}
+		sort.Strings(devs)
+	}
+	for _, dev := range devs {
+		if _, ok := found[dev][l.Limit.Id]; !ok {
+			if err := l.addClass(dev); err != nil {
+				return err
+			}
+		}
+	}
+	if err := l.ensureConnmarkRules(); err != nil {
+		return err
+	}
+	if err := l.replaceMarkRule(); err != nil {
+		return err
+	}
+	for _, dev := range devs {
+		if _, ok := found[dev][l.Limit.Id]; ok {
+			if err := l.Runner().Run(l.ClassCmd("change", dev)); err != nil {
+				return fmt.Errorf("failed to change %s on '%s': %w", l.Limit, dev, err)
+			}
+		}
+	}
+	for dev, limits := range found {
+		if _, ok := limits[l.Limit.Id]; !ok || slices.Contains(devs, dev) {
+			continue
+		}
+		if err := l.removeClass(dev, len(limits)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceMarkRule has the mark rule match the set, the rule has the Id of the limit
+// so it is deleted before its replacement is created, then put back if that fails
+func (l LimitRes) replaceMarkRule() error {
+	current := l.Limit.LimitResource()
+	if err := current.Load(); err != nil {
+		return err
+	}
+	if current.MatchSetSrc == l.MatchSetSrc {
+		return nil
+	}
+	if current.MatchSetSrc != "" {
+		if err := l.rule(current.MarkRule()).Delete(); err != nil {
+			return err
+		}
+	}
+	if l.MatchSetSrc == "" {
+		return nil
+	}
+	if err := l.rule(l.MarkRule()).Create(); err != nil {
+		if current.MatchSetSrc != "" {
+			if restoreErr := l.rule(current.MarkRule()).Create(); restoreErr != nil {
+				return fmt.Errorf("%w, and failed to put back the mark rule of '%s': %s", err, current.MatchSetSrc, restoreErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// remove deletes the classes, filters and mark rule of the limit,
+// and the qdisc of the devices without any other limits
+func (l LimitRes) remove() error {
+	found, err := classes(l.NS)
+	if err != nil {
+		return err
+	}
+	for dev, limits := range found {
+		if _, ok := limits[l.Limit.Id]; !ok {
+			continue
+		}
+		if err := l.removeClass(dev, len(limits)); err != nil {
+			return err
+		}
+	}
+	_, err = l.rule(l.MarkRule()).EnsureDeleted()
+	return err
+}
+
+// removeClass deletes the filter and class of the limit from the device,
+// and the qdisc when the device has no other classes out of its count of classes
+func (l LimitRes) removeClass(dev string, count int) error {
+	if err := l.Runner().Batch(l.FilterCmd("del", dev), l.ClassDelCmd(dev)); err != nil {
+		return fmt.Errorf("failed to delete %s from '%s': %w", l.Limit, dev, err)
+	}
+	if count == 1 {
+		if err := l.Runner().Run(QdiscDelCmd(dev)); err != nil {
+			return fmt.Errorf("failed to delete the qdisc of '%s': %w", dev, err)
+		}
+	}
+	return nil
+}
+
+// Delete removes the limit, and the rules keeping the mark with the connections
+// once there are no limits left
+func (l LimitRes) Delete() error {
+	if err := l.remove(); err != nil {
+		return err
+	}
+	ids, err := l.List()
+	if err != nil || len(ids) > 0 {
+		return err
+	}
+	wan, err := iptables.DetectInternetDevice(l.NS)
+	if err != nil {
+		return err
+	}
+	for _, rule := range []iptables.Rule{SaveRule(l.NS, wan), RestoreRule(l.NS, wan)} {
+		if _, err := l.rule(rule).EnsureDeleted(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List has the Ids of the limits with a class on any device, in order
+func (l LimitRes) List() ([]string, error) {
+	found, err := classes(l.NS)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[uint16]bool{}
+	for _, limits := range found {
+		for id := range limits {
+			ids[id] = true
+		}
+	}
+	sorted := []int{}
+	for id := range ids {
+		sorted = append(sorted, int(id))
+	}
+	sort.Ints(sorted)
+	list := []string{}
+	for _, id := range sorted {
+		list = append(list, strconv.Itoa(id))
+	}
+	return list, nil
+}
+
+func (l LimitRes) Clear() error {
+	ids, err := l.List()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		limitId, err := ParseLimitId(id)
+		if err != nil {
+			return err
+		}
+		if err := NewLimit(l.NS, limitId).LimitResource().Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load has the rate and devices from the classes, and the set from the mark rule
+func (l *LimitRes) Load() error {
+	found, err := classes(l.NS)
+	if err != nil {
+		return err
+	}
+	l.Rate, l.Devices, l.MatchSetSrc = "", []string{}, ""
+	for dev, limits := range found {
+		if rate, ok := limits[l.Limit.Id]; ok {
+			l.Rate = strings.ToLower(rate)
+			l.Devices = append(l.Devices, dev)
+		}
+	}
+	if len(l.Devices) == 0 {
+		return fmt.Errorf("%s does not have a class on any device", l.Limit)
+	}
+	sort.Strings(l.Devices)
+	markRule := firewall.For(l.NS).RuleResource(l.MarkRule())
+	if exists, err := resource.NewLifecycle(markRule).Exists(); err != nil || !exists {
+		return err
+	}
+	loader, ok := markRule.(resource.Loader)
+	if !ok {
+		return fmt.Errorf("%s rules cannot be loaded", firewall.For(l.NS).Name())
+	}
+	if err := loader.Load(); err != nil {
+		return err
+	}
+	rule, err := firewall.RuleOf(markRule)
+	if err != nil {
+		return err
+	}
+	l.MatchSetSrc = rule.MatchSetSrc
+	return nil
+}
@@ -0,0 +1,125 @@
+package throttletest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/plockc/gateway/address"
+	"github.com/plockc/gateway/exec"
+	"github.com/plockc/gateway/resource"
+)
+
+// TC keeps the qdiscs and classes of the devices lo, lan and wan the same as tc shows them,
+// the other commands are passed through to the Executor
+type TC struct {
+	exec.Executor
+	lock sync.Mutex
+	// Qdiscs are true for the devices with the root qdisc
+	Qdiscs map[string]bool
+	// Classes are the class show lines, keyed by device then class Id
+	Classes map[string]map[string]string
+	// Filters are the flow Ids, keyed by device then handle
+	Filters map[string]map[string]string
+}
+
+// Use has the commands of the test run by a new TC until the test ends
+func Use(t testing.TB) *TC {
+	t.Helper()
+	previous := resource.DefaultExecutor
+	tc := &TC{
+		Executor: previous,
+		Qdiscs:   map[string]bool{},
+		Classes:  map[string]map[string]string{"lan": {}, "wan": {}, "lo": {}},
+		Filters:  map[string]map[string]string{"lan": {}, "wan": {}, "lo": {}},
+	}
+	resource.DefaultExecutor = tc
+	t.Cleanup(func() { resource.DefaultExecutor = previous })
+	return tc
+}
+
+func (e *TC) Exec(original []string) (int, string, error) {
+	cmd := original
+	if len(cmd) > 4 && cmd[0] == "ip" && cmd[1] == "netns" {
+		cmd = cmd[4:]
+	}
+	line := strings.Join(cmd, " ")
+	if line == strings.Join(address.LinksJsonCmd(), " ") {
+		return 0, `[{"ifname":"lo","link_type":"loopback"},{"ifname":"lan","link_type":"ether"},` +
+			`{"ifname":"wan","link_type":"ether"}]`, nil
+	}
+	if len(cmd) < 5 || cmd[0] != "tc" || cmd[3] != "dev" {
+		return e.Executor.Exec(original)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	fail := func() (int, string, error) {
+		return 2, "RTNETLINK answers: Invalid argument", exec.ExitError(cmd, 2, line)
+	}
+	dev := cmd[4]
+	if _, ok := e.Classes[dev]; !ok {
+		return 1, "Cannot find device " + dev, exec.ExitError(cmd, 1, line)
+	}
+	switch cmd[1] + " " + cmd[2] {
+	case "qdisc show":
+		if e.Qdiscs[dev] {
+			return 0, "qdisc htb 1: root refcnt 2 r2q 10 default 0 direct_packets_stat 0 direct_qlen 1000", nil
+		}
+		return 0, "qdisc noqueue 0: root refcnt 2", nil
+	case "qdisc add":
+		if e.Qdiscs[dev] {
+			return fail()
+		}
+		e.Qdiscs[dev] = true
+	case "qdisc del":
+		delete(e.Qdiscs, dev)
+		e.Classes[dev], e.Filters[dev] = map[string]string{}, map[string]string{}
+	case "class show":
+		lines := []string{}
+		for _, class := range e.Classes[dev] {
+			lines = append(lines, class)
+		}
+		sort.Strings(lines)
+		return 0, strings.Join(lines, "\n"), nil
+	case "class add":
+		classId := cmd[8]
+		if _, ok := e.Classes[dev][classId]; ok || !e.Qdiscs[dev] {
+			return fail()
+		}
+		e.Classes[dev][classId] = class(classId, cmd[11])
+	case "class change":
+		classId := cmd[8]
+		if _, ok := e.Classes[dev][classId]; !ok {
+			return fail()
+		}
+		e.Classes[dev][classId] = class(classId, cmd[11])
+	case "class del":
+		if _, ok := e.Classes[dev][cmd[6]]; !ok {
+			return fail()
+		}
+		for _, flowId := range e.Filters[dev] {
+			if flowId == cmd[6] {
+				return 2, "Error: Class is in use", exec.ExitError(cmd, 2, line)
+			}
+		}
+		delete(e.Classes[dev], cmd[6])
+	case "filter add":
+		e.Filters[dev][cmd[12]] = cmd[15]
+	case "filter del":
+		if _, ok := e.Filters[dev][cmd[12]]; !ok {
+			return fail()
+		}
+		delete(e.Filters[dev], cmd[12])
+	default:
+		return 1, "", fmt.Errorf("unexpected command: %s", line)
+	}
+	return 0, "", nil
+}
+
+// class is the line tc shows for the class, which has the units with a capital
+func class(classId, rate string) string {
+	rate = strings.Replace(strings.Replace(rate, "kbit", "Kbit", 1), "mbit", "Mbit", 1)
+	return fmt.Sprintf("class htb %s root prio 0 rate %s ceil %s burst 1600b cburst 1600b", classId, rate, rate)
+}